@@ -13,4 +13,5 @@ require (
 	github.com/uber/jaeger-client-go v2.23.0+incompatible
 	github.com/uber/jaeger-lib v2.2.0+incompatible
 	google.golang.org/grpc v1.29.1
+	google.golang.org/protobuf v1.21.0
 )
@@ -0,0 +1,14 @@
+// Package env provides helpers for reading options from environment variables.
+package env
+
+import "strings"
+
+// Var returns the name of an environment variable with an optional prefix.
+// The prefix is upper-cased and separated from the name by an underscore (i.e. prefix "app" and name "LOG_LEVEL" give APP_LOG_LEVEL).
+func Var(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return strings.ToUpper(prefix) + "_" + name
+}
@@ -0,0 +1,26 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVar(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefix       string
+		varName      string
+		expectedName string
+	}{
+		{"NoPrefix", "", "LOG_LEVEL", "LOG_LEVEL"},
+		{"WithPrefix", "app", "LOG_LEVEL", "APP_LOG_LEVEL"},
+		{"UpperCasePrefix", "APP", "TRACE_NAME", "APP_TRACE_NAME"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedName, Var(tc.prefix, tc.varName))
+		})
+	}
+}
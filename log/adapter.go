@@ -0,0 +1,51 @@
+package log
+
+import (
+	stdlog "log"
+	"strings"
+)
+
+// stdCallerSkip is the number of stack frames of the standard library logger and levelWriter.Write above the caller.
+const stdCallerSkip = 3
+
+// levelWriter implements io.Writer and logs every write as a message in a given level.
+type levelWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func newLevelWriter(logger *Logger, level Level) *levelWriter {
+	return &levelWriter{
+		logger: logger.WithCallerSkip(stdCallerSkip),
+		level:  level,
+	}
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	w.logger.log(w.level, "message", message)
+	return len(p), nil
+}
+
+// NewStdLogger creates a standard library logger that logs every message using a logger in a given level.
+func NewStdLogger(logger *Logger, level Level) *stdlog.Logger {
+	return stdlog.New(newLevelWriter(logger, level), "", 0)
+}
+
+// RedirectStdLog redirects the output of the standard library global logger to a logger in a given level.
+// It returns a function for restoring the original output, prefix, and flags of the standard library logger.
+func RedirectStdLog(logger *Logger, level Level) func() {
+	flags := stdlog.Flags()
+	prefix := stdlog.Prefix()
+	writer := stdlog.Writer()
+
+	stdlog.SetFlags(0)
+	stdlog.SetPrefix("")
+	stdlog.SetOutput(newLevelWriter(logger, level))
+
+	return func() {
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+		stdlog.SetOutput(writer)
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	stdlog "log"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		level           Level
+		data            string
+		expectedLevel   string
+		expectedMessage string
+	}{
+		{"Info", InfoLevel, "hello\n", "info", "hello"},
+		{"Error", ErrorLevel, "failed", "error", "failed"},
+		{"Fatal", FatalLevel, "crashed\n", "fatal", "crashed"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			w := &levelWriter{
+				logger: NewLogger(Options{Writer: buff}),
+				level:  tc.level,
+			}
+
+			n, err := w.Write([]byte(tc.data))
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.data), n)
+
+			var log map[string]interface{}
+			err = json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLevel, log["level"])
+			assert.Equal(t, tc.expectedMessage, log["message"])
+		})
+	}
+}
+
+func TestNewStdLogger(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := NewLogger(Options{Writer: buff})
+
+	stdLogger := NewStdLogger(logger, WarnLevel)
+	_, file, line, _ := runtime.Caller(0)
+	stdLogger.Printf("Hello, %s!", "World")
+
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", log["level"])
+	assert.Equal(t, "Hello, World!", log["message"])
+	assert.Equal(t, fmt.Sprintf("%s:%d", filepath.Base(file), line+1), log["caller"])
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := NewLogger(Options{Writer: buff})
+
+	flags, prefix, writer := stdlog.Flags(), stdlog.Prefix(), stdlog.Writer()
+
+	restore := RedirectStdLog(logger, InfoLevel)
+	_, file, line, _ := runtime.Caller(0)
+	stdlog.Print("Hello, World!")
+	restore()
+
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", log["level"])
+	assert.Equal(t, "Hello, World!", log["message"])
+	assert.Equal(t, fmt.Sprintf("%s:%d", filepath.Base(file), line+1), log["caller"])
+
+	assert.Equal(t, flags, stdlog.Flags())
+	assert.Equal(t, prefix, stdlog.Prefix())
+	assert.Equal(t, writer, stdlog.Writer())
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// KVError is an optional interface that errors can implement to contribute their own key-value pairs.
+// When an error is logged using ErrorE, the key-value pairs of every error in the chain will be logged.
+type KVError interface {
+	error
+	KV() []interface{}
+}
+
+// errorLink describes one error in an error chain.
+type errorLink struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// errorChain is an ordered list of wrapped errors from the outermost to the innermost.
+type errorChain []errorLink
+
+// MarshalJSON implements json.Marshaler so the chain is logged as an array by the JSON logger.
+func (c errorChain) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]errorLink(c))
+}
+
+// String implements fmt.Stringer so the chain is logged as a single value by the logfmt logger.
+func (c errorChain) String() string {
+	links := make([]string, len(c))
+	for i, l := range c {
+		links[i] = fmt.Sprintf("%s: %s", l.Type, l.Message)
+	}
+
+	return strings.Join(links, " -> ")
+}
+
+// stackTrace is a list of stack frames formatted as "function file:line".
+type stackTrace []string
+
+// MarshalJSON implements json.Marshaler so the stack trace is logged as an array by the JSON logger.
+func (s stackTrace) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(s))
+}
+
+// String implements fmt.Stringer so the stack trace is logged as a single value by the logfmt logger.
+func (s stackTrace) String() string {
+	return strings.Join(s, "; ")
+}
+
+// errorStackTrace returns the stack trace of an error if it has a StackTrace method returning program counters.
+// This is compatible with errors created by the github.com/pkg/errors package.
+func errorStackTrace(err error) stackTrace {
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+
+	out := m.Type().Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	val := m.Call(nil)[0]
+	if val.Len() == 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, val.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(val.Index(i).Uint())
+	}
+
+	var st stackTrace
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		st = append(st, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+
+	return st
+}
+
+// errorKV returns the key-value pairs describing an error and its chain of wrapped errors.
+func errorKV(err error) []interface{} {
+	if err == nil {
+		return []interface{}{"error", nil}
+	}
+
+	var chain errorChain
+	var stack stackTrace
+	var fields []interface{}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		chain = append(chain, errorLink{
+			Type:    fmt.Sprintf("%T", e),
+			Message: e.Error(),
+		})
+
+		// The innermost stack trace is the closest one to where the error originated
+		if st := errorStackTrace(e); st != nil {
+			stack = st
+		}
+
+		if kve, ok := e.(KVError); ok {
+			fields = append(fields, kve.KV()...)
+		}
+	}
+
+	kv := []interface{}{
+		"error", err.Error(),
+		"error.type", fmt.Sprintf("%T", err),
+		"error.chain", chain,
+	}
+
+	if stack != nil {
+		kv = append(kv, "error.stack", stack)
+	}
+
+	return append(kv, fields...)
+}
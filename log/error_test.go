@@ -0,0 +1,173 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type kvError struct {
+	code int
+}
+
+func (e *kvError) Error() string {
+	return fmt.Sprintf("error code %d", e.code)
+}
+
+func (e *kvError) KV() []interface{} {
+	return []interface{}{"error.code", e.code}
+}
+
+type stackError struct {
+	msg   string
+	stack []uintptr
+}
+
+func newStackError(msg string) *stackError {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return &stackError{
+		msg:   msg,
+		stack: pcs[:n],
+	}
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) StackTrace() []uintptr {
+	return e.stack
+}
+
+func TestErrorChain(t *testing.T) {
+	chain := errorChain{
+		{Type: "*fmt.wrapError", Message: "query failed: timeout"},
+		{Type: "*errors.errorString", Message: "timeout"},
+	}
+
+	b, err := chain.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"*fmt.wrapError","message":"query failed: timeout"},{"type":"*errors.errorString","message":"timeout"}]`, string(b))
+	assert.Equal(t, "*fmt.wrapError: query failed: timeout -> *errors.errorString: timeout", chain.String())
+}
+
+func TestStackTrace(t *testing.T) {
+	st := stackTrace{"main.main main.go:10", "runtime.main proc.go:200"}
+
+	b, err := st.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["main.main main.go:10","runtime.main proc.go:200"]`, string(b))
+	assert.Equal(t, "main.main main.go:10; runtime.main proc.go:200", st.String())
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedStack bool
+	}{
+		{"NoStackTrace", errors.New("error"), false},
+		{"WithStackTrace", newStackError("error"), true},
+		{"EmptyStackTrace", &stackError{msg: "error"}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st := errorStackTrace(tc.err)
+
+			if tc.expectedStack {
+				assert.NotEmpty(t, st)
+				assert.Contains(t, st[0], "log.newStackError")
+			} else {
+				assert.Nil(t, st)
+			}
+		})
+	}
+}
+
+func TestErrorKV(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedType  string
+		expectedChain []interface{}
+		expectedStack bool
+		expectedKV    map[string]interface{}
+	}{
+		{
+			name:         "Simple",
+			err:          errors.New("timeout"),
+			expectedType: "*errors.errorString",
+			expectedChain: []interface{}{
+				map[string]interface{}{"type": "*errors.errorString", "message": "timeout"},
+			},
+		},
+		{
+			name:         "Wrapped",
+			err:          fmt.Errorf("query failed: %w", errors.New("timeout")),
+			expectedType: "*fmt.wrapError",
+			expectedChain: []interface{}{
+				map[string]interface{}{"type": "*fmt.wrapError", "message": "query failed: timeout"},
+				map[string]interface{}{"type": "*errors.errorString", "message": "timeout"},
+			},
+		},
+		{
+			name:         "WithKV",
+			err:          fmt.Errorf("request failed: %w", &kvError{code: 42}),
+			expectedType: "*fmt.wrapError",
+			expectedChain: []interface{}{
+				map[string]interface{}{"type": "*fmt.wrapError", "message": "request failed: error code 42"},
+				map[string]interface{}{"type": "*log.kvError", "message": "error code 42"},
+			},
+			expectedKV: map[string]interface{}{
+				"error.code": float64(42),
+			},
+		},
+		{
+			name:         "WithStackTrace",
+			err:          fmt.Errorf("operation failed: %w", newStackError("no capacity")),
+			expectedType: "*fmt.wrapError",
+			expectedChain: []interface{}{
+				map[string]interface{}{"type": "*fmt.wrapError", "message": "operation failed: no capacity"},
+				map[string]interface{}{"type": "*log.stackError", "message": "no capacity"},
+			},
+			expectedStack: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := NewLogger(Options{Writer: buff})
+			logger.InfoKV(errorKV(tc.err)...)
+
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.err.Error(), log["error"])
+			assert.Equal(t, tc.expectedType, log["error.type"])
+			assert.Equal(t, tc.expectedChain, log["error.chain"])
+
+			if tc.expectedStack {
+				assert.NotEmpty(t, log["error.stack"])
+			} else {
+				assert.NotContains(t, log, "error.stack")
+			}
+
+			for k, v := range tc.expectedKV {
+				assert.Equal(t, v, log[k])
+			}
+		})
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		kv := errorKV(nil)
+		assert.Equal(t, []interface{}{"error", nil}, kv)
+	})
+}
@@ -0,0 +1,229 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	kitLog "github.com/go-kit/kit/log"
+)
+
+const levelKey = "level"
+
+// Level is the type for logging level.
+type Level int
+
+// The values of levels are stable, so new levels are appended and do not follow the order of verbosity.
+const (
+	// NoneLevel log
+	NoneLevel Level = iota
+	// ErrorLevel log
+	ErrorLevel
+	// WarnLevel log
+	WarnLevel
+	// InfoLevel log
+	InfoLevel
+	// DebugLevel log
+	DebugLevel
+	// FatalLevel log
+	FatalLevel
+	// TraceLevel log
+	TraceLevel
+)
+
+// verbosity returns the rank of a level from the least verbose (none) to the most verbose (trace).
+// It returns -1 for invalid levels.
+func (l Level) verbosity() int {
+	switch l {
+	case NoneLevel:
+		return 0
+	case FatalLevel:
+		return 1
+	case ErrorLevel:
+		return 2
+	case WarnLevel:
+		return 3
+	case InfoLevel:
+		return 4
+	case DebugLevel:
+		return 5
+	case TraceLevel:
+		return 6
+	default:
+		return -1
+	}
+}
+
+// enables determines whether or not a logger with this level logs the events with a given level.
+func (l Level) enables(level Level) bool {
+	return l != NoneLevel && level.verbosity() > 0 && level.verbosity() <= l.verbosity()
+}
+
+// String returns the string representation of a level.
+func (l Level) String() string {
+	switch l {
+	case NoneLevel:
+		return "none"
+	case FatalLevel:
+		return "fatal"
+	case ErrorLevel:
+		return "error"
+	case WarnLevel:
+		return "warn"
+	case InfoLevel:
+		return "info"
+	case DebugLevel:
+		return "debug"
+	case TraceLevel:
+		return "trace"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// ParseLevel parses a level string.
+// An error will be returned if the level string is not valid.
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "none":
+		return NoneLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "warn":
+		return WarnLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "debug":
+		return DebugLevel, nil
+	case "trace":
+		return TraceLevel, nil
+	default:
+		return NoneLevel, fmt.Errorf("invalid log level: %q", level)
+	}
+}
+
+// levels is a default level with optional overrides for loggers by their names.
+type levels struct {
+	def       Level
+	overrides map[string]Level
+}
+
+// parseLevels parses a level string with optional overrides for loggers by their names.
+// The level string has the form "info,db=debug,jaeger=warn".
+// If no default level is specified, InfoLevel will be used.
+func parseLevels(spec string) (levels, error) {
+	ls := levels{
+		def:       InfoLevel,
+		overrides: map[string]Level{},
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if i := strings.Index(item, "="); i >= 0 {
+			name := strings.TrimSpace(item[:i])
+			if name == "" {
+				return levels{}, fmt.Errorf("invalid log level override: %q", item)
+			}
+
+			level, err := ParseLevel(item[i+1:])
+			if err != nil {
+				return levels{}, err
+			}
+
+			ls.overrides[name] = level
+		} else {
+			level, err := ParseLevel(item)
+			if err != nil {
+				return levels{}, err
+			}
+
+			ls.def = level
+		}
+	}
+
+	return ls, nil
+}
+
+// forName returns the level for a logger name.
+// For a qualified name (i.e. "service.jaeger"), the override for the full name is used first
+// and then the overrides for its suffixes (i.e. "jaeger").
+func (ls levels) forName(name string) Level {
+	for {
+		if level, ok := ls.overrides[name]; ok {
+			return level
+		}
+
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return ls.def
+		}
+		name = name[i+1:]
+	}
+}
+
+// stringToLevel returns the level of a logger name from a level string.
+// If the level string is not valid, InfoLevel and an error will be returned.
+func stringToLevel(spec, name string) (Level, error) {
+	ls, err := parseLevels(spec)
+	if err != nil {
+		return InfoLevel, err
+	}
+
+	return ls.forName(name), nil
+}
+
+// levelValue is the value logged for the level key.
+// It is a distinct type, so the filter logger can tell it apart from other values.
+type levelValue struct {
+	Level
+}
+
+var levelValues = map[Level]levelValue{
+	FatalLevel: {FatalLevel},
+	ErrorLevel: {ErrorLevel},
+	WarnLevel:  {WarnLevel},
+	InfoLevel:  {InfoLevel},
+	DebugLevel: {DebugLevel},
+	TraceLevel: {TraceLevel},
+}
+
+// withLevel returns a logger that includes the level key-value pair.
+func withLevel(logger kitLog.Logger, level Level) kitLog.Logger {
+	return kitLog.WithPrefix(logger, levelKey, levelValues[level])
+}
+
+// filterLogger drops the leveled log events that are not allowed.
+// Log events without a level are passed through unmodified.
+type filterLogger struct {
+	next  kitLog.Logger
+	level Level
+}
+
+func (l *filterLogger) Log(kv ...interface{}) error {
+	for i := 1; i < len(kv); i += 2 {
+		if v, ok := kv[i].(levelValue); ok {
+			if !l.level.enables(v.Level) {
+				return nil
+			}
+			break
+		}
+	}
+
+	return l.next.Log(kv...)
+}
+
+func createFilteredLogger(base kitLog.Logger, level Level) kitLog.Logger {
+	if level.verbosity() < 0 {
+		level = InfoLevel
+	}
+
+	return &filterLogger{
+		next:  base,
+		level: level,
+	}
+}
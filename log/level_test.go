@@ -0,0 +1,242 @@
+package log
+
+import (
+	"errors"
+	"testing"
+
+	kitLog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelString(t *testing.T) {
+	tests := []struct {
+		level          Level
+		expectedString string
+	}{
+		{NoneLevel, "none"},
+		{FatalLevel, "fatal"},
+		{ErrorLevel, "error"},
+		{WarnLevel, "warn"},
+		{InfoLevel, "info"},
+		{DebugLevel, "debug"},
+		{TraceLevel, "trace"},
+		{Level(99), "Level(99)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expectedString, func(t *testing.T) {
+			assert.Equal(t, tc.expectedString, tc.level.String())
+		})
+	}
+}
+
+func TestLevelValues(t *testing.T) {
+	// Level values are stable
+	assert.Equal(t, Level(0), NoneLevel)
+	assert.Equal(t, Level(1), ErrorLevel)
+	assert.Equal(t, Level(2), WarnLevel)
+	assert.Equal(t, Level(3), InfoLevel)
+	assert.Equal(t, Level(4), DebugLevel)
+	assert.Equal(t, Level(5), FatalLevel)
+	assert.Equal(t, Level(6), TraceLevel)
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name          string
+		level         string
+		expectedLevel Level
+		expectedError string
+	}{
+		{"None", "none", NoneLevel, ""},
+		{"Fatal", "fatal", FatalLevel, ""},
+		{"Error", "error", ErrorLevel, ""},
+		{"Warn", "warn", WarnLevel, ""},
+		{"Info", "info", InfoLevel, ""},
+		{"Debug", "debug", DebugLevel, ""},
+		{"Trace", "trace", TraceLevel, ""},
+		{"UpperCase", " DEBUG ", DebugLevel, ""},
+		{"Invalid", "verbose", NoneLevel, `invalid log level: "verbose"`},
+		{"Empty", "", NoneLevel, `invalid log level: ""`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := ParseLevel(tc.level)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedLevel, level)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		name           string
+		spec           string
+		expectedLevels levels
+		expectedError  string
+	}{
+		{
+			name: "Empty",
+			spec: "",
+			expectedLevels: levels{
+				def:       InfoLevel,
+				overrides: map[string]Level{},
+			},
+		},
+		{
+			name: "DefaultOnly",
+			spec: "debug",
+			expectedLevels: levels{
+				def:       DebugLevel,
+				overrides: map[string]Level{},
+			},
+		},
+		{
+			name: "OverridesOnly",
+			spec: "db=debug",
+			expectedLevels: levels{
+				def:       InfoLevel,
+				overrides: map[string]Level{"db": DebugLevel},
+			},
+		},
+		{
+			name: "DefaultAndOverrides",
+			spec: "info, db=debug, jaeger=warn",
+			expectedLevels: levels{
+				def:       InfoLevel,
+				overrides: map[string]Level{"db": DebugLevel, "jaeger": WarnLevel},
+			},
+		},
+		{
+			name:          "InvalidDefault",
+			spec:          "verbose,db=debug",
+			expectedError: `invalid log level: "verbose"`,
+		},
+		{
+			name:          "InvalidOverride",
+			spec:          "info,db=verbose",
+			expectedError: `invalid log level: "verbose"`,
+		},
+		{
+			name:          "MissingName",
+			spec:          "info,=debug",
+			expectedError: `invalid log level override: "=debug"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ls, err := parseLevels(tc.spec)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedLevels, ls)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestStringToLevel(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          string
+		loggerName    string
+		expectedLevel Level
+		expectedError string
+	}{
+		{"None", "none", "", NoneLevel, ""},
+		{"Fatal", "fatal", "", FatalLevel, ""},
+		{"Error", "error", "", ErrorLevel, ""},
+		{"Warn", "warn", "", WarnLevel, ""},
+		{"Info", "info", "", InfoLevel, ""},
+		{"Debug", "debug", "", DebugLevel, ""},
+		{"Trace", "trace", "", TraceLevel, ""},
+		{"Override", "info,db=debug", "db", DebugLevel, ""},
+		{"NoOverride", "info,db=debug", "jaeger", InfoLevel, ""},
+		{"QualifiedName", "info,db=debug", "service.db", DebugLevel, ""},
+		{"QualifiedNameOverride", "info,db=debug,service.db=warn", "service.db", WarnLevel, ""},
+		{"QualifiedNoOverride", "info,db=debug", "db.service", InfoLevel, ""},
+		{"Invalid", "inf", "", InfoLevel, `invalid log level: "inf"`},
+		{"InvalidOverride", "error,db=verbose", "db", InfoLevel, `invalid log level: "verbose"`},
+		{"Empty", "", "", InfoLevel, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := stringToLevel(tc.spec, tc.loggerName)
+			assert.Equal(t, tc.expectedLevel, level)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestCreateFilteredLogger(t *testing.T) {
+	tests := []struct {
+		name           string
+		level          Level
+		logLevel       Level
+		expectedLogged bool
+	}{
+		{"NoneLevel", NoneLevel, FatalLevel, false},
+		{"FatalLevel", FatalLevel, FatalLevel, true},
+		{"ErrorLevel", ErrorLevel, WarnLevel, false},
+		{"WarnLevel", WarnLevel, ErrorLevel, true},
+		{"InfoLevel", InfoLevel, DebugLevel, false},
+		{"DebugLevel", DebugLevel, DebugLevel, true},
+		{"TraceLevel", TraceLevel, TraceLevel, true},
+		{"ErrorLevelFatal", ErrorLevel, FatalLevel, true},
+		{"InfoLevelFatal", InfoLevel, FatalLevel, true},
+		{"DebugLevelTrace", DebugLevel, TraceLevel, false},
+		{"InvalidLevel", Level(99), InfoLevel, true},
+		{"InvalidLevelDebug", Level(99), DebugLevel, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			base := &mockKitLogger{}
+			filtered := createFilteredLogger(base, tc.level)
+			assert.NotNil(t, filtered)
+
+			err := withLevel(filtered, tc.logLevel).Log("message", "test")
+			assert.NoError(t, err)
+
+			if tc.expectedLogged {
+				assert.Equal(t, []interface{}{levelKey, levelValues[tc.logLevel], "message", "test"}, base.LogInKV)
+			} else {
+				assert.Nil(t, base.LogInKV)
+			}
+		})
+	}
+}
+
+func TestFilterLogger(t *testing.T) {
+	t.Run("NoLevel", func(t *testing.T) {
+		base := &mockKitLogger{}
+		filtered := &filterLogger{next: base, level: NoneLevel}
+
+		err := filtered.Log("message", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"message", "test"}, base.LogInKV)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		base := &mockKitLogger{LogOutError: errors.New("log error")}
+		filtered := &filterLogger{next: base, level: InfoLevel}
+
+		err := kitLog.WithPrefix(filtered, levelKey, levelValues[InfoLevel]).Log("message", "test")
+		assert.EqualError(t, err, "log error")
+	})
+}
@@ -4,13 +4,15 @@ package log
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
+	"syscall"
 
 	kitLog "github.com/go-kit/kit/log"
-	kitLevel "github.com/go-kit/kit/log/level"
 )
 
 const (
@@ -18,6 +20,14 @@ const (
 	singletonCallerDepth = 8
 )
 
+// exit is the function terminating the program after a fatal log.
+var exit = os.Exit
+
+// syncer is implemented by writers that can flush their buffered data (i.e. os.File).
+type syncer interface {
+	Sync() error
+}
+
 // Format is the type for output format.
 type Format int
 
@@ -28,25 +38,38 @@ const (
 	Logfmt
 )
 
-// Level is the type for logging level.
-type Level int
+// String returns the string representation of a format.
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case Logfmt:
+		return "logfmt"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
 
-const (
-	// NoneLevel log
-	NoneLevel Level = iota
-	// ErrorLevel log
-	ErrorLevel
-	// WarnLevel log
-	WarnLevel
-	// InfoLevel log
-	InfoLevel
-	// DebugLevel log
-	DebugLevel
-)
+// ParseFormat parses a format string.
+// An error will be returned if the format string is not valid.
+func ParseFormat(format string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "json":
+		return JSON, nil
+	case "logfmt":
+		return Logfmt, nil
+	default:
+		return JSON, fmt.Errorf("invalid log format: %q", format)
+	}
+}
 
 // Options contains optional options for Logger.
+// Level can be a single level (i.e. "info") or a default level with overrides for loggers by their names (i.e. "info,db=debug,jaeger=warn").
 type Options struct {
 	callerDepth int
+	callerSkip  int
+	// external is set for loggers whose records carry their own caller and timestamp (i.e. slog records).
+	external    bool
 	Name        string
 	Environment string
 	Region      string
@@ -55,23 +78,6 @@ type Options struct {
 	Writer      io.Writer
 }
 
-func stringToLevel(level string) Level {
-	switch strings.ToLower(level) {
-	case "none":
-		return NoneLevel
-	case "error":
-		return ErrorLevel
-	case "warn":
-		return WarnLevel
-	case "info":
-		return InfoLevel
-	case "debug":
-		return DebugLevel
-	default:
-		return InfoLevel
-	}
-}
-
 func createBaseLogger(opts Options) kitLog.Logger {
 	var base kitLog.Logger
 
@@ -95,10 +101,12 @@ func createBaseLogger(opts Options) kitLog.Logger {
 		opts.callerDepth = instanceCallerDepth
 	}
 
-	base = kitLog.With(base,
-		"caller", kitLog.Caller(opts.callerDepth),
-		"timestamp", kitLog.DefaultTimestampUTC,
-	)
+	if !opts.external {
+		base = kitLog.With(base,
+			"caller", kitLog.Caller(opts.callerDepth+opts.callerSkip),
+			"timestamp", kitLog.DefaultTimestampUTC,
+		)
+	}
 
 	if opts.Name != "" {
 		base = kitLog.With(base, "logger", opts.Name)
@@ -115,48 +123,37 @@ func createBaseLogger(opts Options) kitLog.Logger {
 	return base
 }
 
-func createFilteredLogger(base kitLog.Logger, level Level) kitLog.Logger {
-	var filtered kitLog.Logger
-
-	switch level {
-	case NoneLevel:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowNone())
-	case ErrorLevel:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowError())
-	case WarnLevel:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowWarn())
-	case InfoLevel:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowInfo())
-	case DebugLevel:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowDebug())
-	default:
-		filtered = kitLevel.NewFilter(base, kitLevel.AllowInfo())
-	}
-
-	return filtered
-}
-
 // Logger wraps a go-kit Logger.
 type Logger struct {
-	Level  Level
-	base   kitLog.Logger
-	logger *kitLog.SwapLogger
+	Level   Level
+	opts    Options
+	context []interface{}
+	base    kitLog.Logger
+	logger  *kitLog.SwapLogger
 }
 
 // NewLogger creates a new logger.
+// If the level string is not valid, InfoLevel will be used and a warning will be logged.
 func NewLogger(opts Options) *Logger {
-	level := stringToLevel(opts.Level)
+	level, err := stringToLevel(opts.Level, opts.Name)
 	base := createBaseLogger(opts)
 	filtered := createFilteredLogger(base, level)
 
 	logger := new(kitLog.SwapLogger)
 	logger.Swap(filtered)
 
-	return &Logger{
+	l := &Logger{
 		Level:  level,
+		opts:   opts,
 		base:   base,
 		logger: logger,
 	}
+
+	if err != nil {
+		l.warnInvalidLevel(opts.Level, err)
+	}
+
+	return l
 }
 
 // NewVoidLogger creates a void logger for testing purposes.
@@ -167,6 +164,10 @@ func NewVoidLogger() *Logger {
 	logger.Swap(nop)
 
 	return &Logger{
+		opts: Options{
+			Level:  "none",
+			Writer: ioutil.Discard,
+		},
 		base:   nop,
 		logger: logger,
 	}
@@ -182,87 +183,251 @@ func (l *Logger) With(kv ...interface{}) *Logger {
 	logger.Swap(filtered)
 
 	return &Logger{
-		Level:  level,
-		base:   base,
-		logger: logger,
+		Level:   level,
+		opts:    l.opts,
+		context: append(append([]interface{}{}, l.context...), kv...),
+		base:    base,
+		logger:  logger,
+	}
+}
+
+// Named returns a new logger with a child name and the same options and context.
+// The name is appended to the name of the logger (i.e. "service.jaeger").
+// The level of the new logger will be resolved from the level overrides by its name.
+func (l *Logger) Named(name string) *Logger {
+	opts := l.opts
+	if opts.Name != "" {
+		name = opts.Name + "." + name
+	}
+	opts.Name = name
+	opts.callerDepth = instanceCallerDepth
+
+	// An invalid level string is already reported by the logger having the level string
+	level, _ := stringToLevel(opts.Level, name)
+	base := kitLog.With(createBaseLogger(opts), l.context...)
+	filtered := createFilteredLogger(base, level)
+
+	logger := new(kitLog.SwapLogger)
+	logger.Swap(filtered)
+
+	return &Logger{
+		Level:   level,
+		opts:    opts,
+		context: l.context,
+		base:    base,
+		logger:  logger,
+	}
+}
+
+// WithCallerSkip returns a new logger with the same options and context that skips additional stack frames
+// when logging the caller. It can be used by wrappers and adapters, so the caller is the call site of the wrapper.
+func (l *Logger) WithCallerSkip(skip int) *Logger {
+	opts := l.opts
+	opts.callerSkip += skip
+
+	return l.rebuild(opts)
+}
+
+// withExternal returns a new logger with the same options and context that does not log the caller and timestamp.
+// It is used by adapters for logging records that carry their own caller and timestamp.
+func (l *Logger) withExternal() *Logger {
+	opts := l.opts
+	opts.external = true
+
+	return l.rebuild(opts)
+}
+
+// rebuild returns a new logger with the same level and context and a new base logger for given options.
+func (l *Logger) rebuild(opts Options) *Logger {
+	level := l.Level
+	base := kitLog.With(createBaseLogger(opts), l.context...)
+	filtered := createFilteredLogger(base, level)
+
+	logger := new(kitLog.SwapLogger)
+	logger.Swap(filtered)
+
+	return &Logger{
+		Level:   level,
+		opts:    opts,
+		context: l.context,
+		base:    base,
+		logger:  logger,
 	}
 }
 
 // SetLevel changes the level of logger.
-func (l *Logger) SetLevel(level string) {
-	l.Level = stringToLevel(level)
+// The level can be a single level or a default level with overrides for loggers by their names.
+// If the level string is not valid, an error will be returned and the level will not be changed.
+func (l *Logger) SetLevel(level string) error {
+	lvl, err := stringToLevel(level, l.opts.Name)
+	if err != nil {
+		return err
+	}
+
+	l.opts.Level = level
+	l.Level = lvl
 	l.logger.Swap(createFilteredLogger(l.base, l.Level))
+
+	return nil
 }
 
 // SetOptions resets a logger with new options.
+// If the level string is not valid, InfoLevel will be used and a warning will be logged.
 func (l *Logger) SetOptions(opts Options) {
-	l.Level = stringToLevel(opts.Level)
+	level, err := stringToLevel(opts.Level, opts.Name)
+
+	l.opts = opts
+	l.context = nil
+	l.Level = level
 	l.base = createBaseLogger(opts)
 	l.logger.Swap(createFilteredLogger(l.base, l.Level))
+
+	if err != nil {
+		l.warnInvalidLevel(opts.Level, err)
+	}
+}
+
+// warnInvalidLevel logs a warning for an invalid level string,
+// so a typo does not quietly change the verbosity of a logger.
+func (l *Logger) warnInvalidLevel(spec string, err error) {
+	l.log(WarnLevel, "message", fmt.Sprintf("invalid log level %q, using info: %s", spec, err))
+}
+
+// Sync flushes the writer of logger if it is buffered (i.e. os.File or an asynchronous writer).
+// Files that do not support syncing (i.e. pipes and terminals) are ignored.
+func (l *Logger) Sync() error {
+	w := l.opts.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	if s, ok := w.(syncer); ok {
+		if err := s.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exit flushes the writer if it is buffered and terminates the program.
+func (l *Logger) exit() {
+	_ = l.Sync()
+	exit(1)
+}
+
+// log logs key-value pairs in a given level.
+// It is used by adapters for other logging APIs, so fatal logs do not terminate the program.
+func (l *Logger) log(level Level, kv ...interface{}) {
+	_ = withLevel(l.logger, level).Log(kv...)
+}
+
+// Trace logs a message in trace level.
+func (l *Logger) Trace(message string) {
+	_ = withLevel(l.logger, TraceLevel).Log("message", message)
+}
+
+// Tracef logs a message in trace level.
+// It uses fmt.Sprintf() to log a message.
+func (l *Logger) Tracef(format string, v ...interface{}) {
+	_ = withLevel(l.logger, TraceLevel).Log("message", fmt.Sprintf(format, v...))
+}
+
+// TraceKV logs key-value pairs in trace level.
+func (l *Logger) TraceKV(kv ...interface{}) {
+	_ = withLevel(l.logger, TraceLevel).Log(kv...)
 }
 
 // Debug logs a message in debug level.
 func (l *Logger) Debug(message string) {
-	_ = kitLevel.Debug(l.logger).Log("message", message)
+	_ = withLevel(l.logger, DebugLevel).Log("message", message)
 }
 
 // Debugf logs a message in debug level.
 // It uses fmt.Sprintf() to log a message.
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	_ = kitLevel.Debug(l.logger).Log("message", fmt.Sprintf(format, v...))
+	_ = withLevel(l.logger, DebugLevel).Log("message", fmt.Sprintf(format, v...))
 }
 
 // DebugKV logs key-value pairs in debug level.
 func (l *Logger) DebugKV(kv ...interface{}) {
-	_ = kitLevel.Debug(l.logger).Log(kv...)
+	_ = withLevel(l.logger, DebugLevel).Log(kv...)
 }
 
 // Info logs a message in info level.
 func (l *Logger) Info(message string) {
-	_ = kitLevel.Info(l.logger).Log("message", message)
+	_ = withLevel(l.logger, InfoLevel).Log("message", message)
 }
 
 // Infof logs a message in info level.
 // It uses fmt.Sprintf() to log a message.
 func (l *Logger) Infof(format string, v ...interface{}) {
-	_ = kitLevel.Info(l.logger).Log("message", fmt.Sprintf(format, v...))
+	_ = withLevel(l.logger, InfoLevel).Log("message", fmt.Sprintf(format, v...))
 }
 
 // InfoKV logs key-value pairs in info level.
 func (l *Logger) InfoKV(kv ...interface{}) {
-	_ = kitLevel.Info(l.logger).Log(kv...)
+	_ = withLevel(l.logger, InfoLevel).Log(kv...)
 }
 
 // Warn logs a message pairs in warn level.
 func (l *Logger) Warn(message string) {
-	_ = kitLevel.Warn(l.logger).Log("message", message)
+	_ = withLevel(l.logger, WarnLevel).Log("message", message)
 }
 
 // Warnf logs a message in warn level.
 // It uses fmt.Sprintf() to log a message.
 func (l *Logger) Warnf(format string, v ...interface{}) {
-	_ = kitLevel.Warn(l.logger).Log("message", fmt.Sprintf(format, v...))
+	_ = withLevel(l.logger, WarnLevel).Log("message", fmt.Sprintf(format, v...))
 }
 
 // WarnKV logs key-value pairs in warn level.
 func (l *Logger) WarnKV(kv ...interface{}) {
-	_ = kitLevel.Warn(l.logger).Log(kv...)
+	_ = withLevel(l.logger, WarnLevel).Log(kv...)
 }
 
 // Error logs a message pairs in error level.
 func (l *Logger) Error(message string) {
-	_ = kitLevel.Error(l.logger).Log("message", message)
+	_ = withLevel(l.logger, ErrorLevel).Log("message", message)
 }
 
 // Errorf logs a message in error level.
 // It uses fmt.Sprintf() to log a message.
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	_ = kitLevel.Error(l.logger).Log("message", fmt.Sprintf(format, v...))
+	_ = withLevel(l.logger, ErrorLevel).Log("message", fmt.Sprintf(format, v...))
 }
 
 // ErrorKV logs key-value pairs in error level.
 func (l *Logger) ErrorKV(kv ...interface{}) {
-	_ = kitLevel.Error(l.logger).Log(kv...)
+	_ = withLevel(l.logger, ErrorLevel).Log(kv...)
+}
+
+// ErrorE logs an error with a message and key-value pairs in error level.
+// The chain of wrapped errors, the error type, and the stack trace (if any) will be logged too.
+// Errors implementing KVError can contribute their own key-value pairs.
+func (l *Logger) ErrorE(err error, message string, kv ...interface{}) {
+	kv = append(append([]interface{}{"message", message}, kv...), errorKV(err)...)
+	_ = withLevel(l.logger, ErrorLevel).Log(kv...)
+}
+
+// Fatal logs a message in fatal level and then terminates the program.
+// The output will be flushed before termination if the writer supports it (i.e. os.File).
+func (l *Logger) Fatal(message string) {
+	_ = withLevel(l.logger, FatalLevel).Log("message", message)
+	l.exit()
+}
+
+// Fatalf logs a message in fatal level and then terminates the program.
+// It uses fmt.Sprintf() to log a message.
+func (l *Logger) Fatalf(format string, v ...interface{}) {
+	_ = withLevel(l.logger, FatalLevel).Log("message", fmt.Sprintf(format, v...))
+	l.exit()
+}
+
+// FatalKV logs key-value pairs in fatal level and then terminates the program.
+func (l *Logger) FatalKV(kv ...interface{}) {
+	_ = withLevel(l.logger, FatalLevel).Log(kv...)
+	l.exit()
 }
 
 // The singleton logger.
@@ -271,17 +436,44 @@ var singleton = NewLogger(Options{
 	callerDepth: singletonCallerDepth,
 })
 
+// Named returns a new logger with a child name of the singleton logger and the same options.
+func Named(name string) *Logger {
+	return singleton.Named(name)
+}
+
 // SetLevel changes the level of singleton logger.
-func SetLevel(level string) {
-	singleton.SetLevel(level)
+// If the level string is not valid, an error will be returned and the level will not be changed.
+func SetLevel(level string) error {
+	return singleton.SetLevel(level)
 }
 
 // SetOptions set optional options for singleton logger.
 func SetOptions(opts Options) {
-	opts.callerDepth = 8
+	opts.callerDepth = singletonCallerDepth
 	singleton.SetOptions(opts)
 }
 
+// Sync flushes the writer of singleton logger if it is buffered.
+func Sync() error {
+	return singleton.Sync()
+}
+
+// Trace logs a message in trace level using singleton logger.
+func Trace(message string) {
+	singleton.Trace(message)
+}
+
+// Tracef logs a message in trace level using singleton logger.
+// It uses fmt.Sprintf() to log a message.
+func Tracef(format string, v ...interface{}) {
+	singleton.Tracef(format, v...)
+}
+
+// TraceKV logs key-value pairs in trace level using singleton logger.
+func TraceKV(kv ...interface{}) {
+	singleton.TraceKV(kv...)
+}
+
 // Debug logs a message in debug level using singleton logger.
 func Debug(message string) {
 	singleton.Debug(message)
@@ -346,6 +538,28 @@ func ErrorKV(kv ...interface{}) {
 	singleton.ErrorKV(kv...)
 }
 
+// ErrorE logs an error with a message and key-value pairs in error level using singleton logger.
+// The chain of wrapped errors, the error type, and the stack trace (if any) will be logged too.
+func ErrorE(err error, message string, kv ...interface{}) {
+	singleton.ErrorE(err, message, kv...)
+}
+
+// Fatal logs a message in fatal level using singleton logger and then terminates the program.
+func Fatal(message string) {
+	singleton.Fatal(message)
+}
+
+// Fatalf logs a message in fatal level using singleton logger and then terminates the program.
+// It uses fmt.Sprintf() to log a message.
+func Fatalf(format string, v ...interface{}) {
+	singleton.Fatalf(format, v...)
+}
+
+// FatalKV logs key-value pairs in fatal level using singleton logger and then terminates the program.
+func FatalKV(kv ...interface{}) {
+	singleton.FatalKV(kv...)
+}
+
 // contextKey is the type for the keys added to context.
 type contextKey string
 
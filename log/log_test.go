@@ -3,7 +3,13 @@ package log
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
 	"testing"
 
 	kitLog "github.com/go-kit/kit/log"
@@ -20,25 +26,45 @@ func (m *mockKitLogger) Log(kv ...interface{}) error {
 	return m.LogOutError
 }
 
-func TestStringToLevel(t *testing.T) {
+func TestFormatString(t *testing.T) {
 	tests := []struct {
-		name          string
-		level         string
-		expectedLevel Level
+		format         Format
+		expectedString string
+	}{
+		{JSON, "json"},
+		{Logfmt, "logfmt"},
+		{Format(99), "Format(99)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expectedString, func(t *testing.T) {
+			assert.Equal(t, tc.expectedString, tc.format.String())
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		format         string
+		expectedFormat Format
+		expectedError  string
 	}{
-		{"None", "none", NoneLevel},
-		{"Error", "error", ErrorLevel},
-		{"Warn", "warn", WarnLevel},
-		{"Info", "info", InfoLevel},
-		{"Debug", "debug", DebugLevel},
-		{"Default", "trace", InfoLevel},
-		{"Empty", "", InfoLevel},
+		{"JSON", "json", JSON, ""},
+		{"Logfmt", "LOGFMT", Logfmt, ""},
+		{"Invalid", "xml", JSON, `invalid log format: "xml"`},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			level := stringToLevel(tc.level)
-			assert.Equal(t, tc.expectedLevel, level)
+			format, err := ParseFormat(tc.format)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedFormat, format)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
 		})
 	}
 }
@@ -94,52 +120,6 @@ func TestCreateBaseLogger(t *testing.T) {
 	}
 }
 
-func TestCreateFilteredLogger(t *testing.T) {
-	tests := []struct {
-		name  string
-		base  kitLog.Logger
-		level Level
-	}{
-		{
-			"NoneLevel",
-			kitLog.NewNopLogger(),
-			NoneLevel,
-		},
-		{
-			"ErrorLevel",
-			kitLog.NewNopLogger(),
-			ErrorLevel,
-		},
-		{
-			"WarnLevel",
-			kitLog.NewNopLogger(),
-			WarnLevel,
-		},
-		{
-			"InfoLevel",
-			kitLog.NewNopLogger(),
-			InfoLevel,
-		},
-		{
-			"DebugLevel",
-			kitLog.NewNopLogger(),
-			DebugLevel,
-		},
-		{
-			"InvalidLevel",
-			kitLog.NewNopLogger(),
-			Level(99),
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			filtered := createFilteredLogger(tc.base, tc.level)
-			assert.NotNil(t, filtered)
-		})
-	}
-}
-
 func TestNewLogger(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -200,6 +180,31 @@ func TestNewLogger(t *testing.T) {
 			},
 			DebugLevel,
 		},
+		{
+			"TraceLevel",
+			Options{
+				Name:  "test",
+				Level: "trace",
+			},
+			TraceLevel,
+		},
+		{
+			"LevelOverride",
+			Options{
+				Name:  "test",
+				Level: "warn,test=debug,db=error",
+			},
+			DebugLevel,
+		},
+		{
+			"InvalidLevel",
+			Options{
+				Name:   "test",
+				Level:  "invalid",
+				Writer: &bytes.Buffer{},
+			},
+			InfoLevel,
+		},
 		{
 			"JSONLogger",
 			Options{
@@ -235,6 +240,30 @@ func TestNewLogger(t *testing.T) {
 	}
 }
 
+func TestNewLoggerInvalidLevel(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := NewLogger(Options{
+		Name:   "test",
+		Level:  "error,db=verbose",
+		Writer: buff,
+	})
+
+	assert.Equal(t, InfoLevel, logger.Level)
+
+	// The invalid level is reported once and not by derived loggers
+	logger.Named("db").Info("query")
+
+	var log map[string]interface{}
+	dec := json.NewDecoder(buff)
+	assert.NoError(t, dec.Decode(&log))
+	assert.Equal(t, "warn", log["level"])
+	assert.Equal(t, `invalid log level "error,db=verbose", using info: invalid log level: "verbose"`, log["message"])
+
+	assert.NoError(t, dec.Decode(&log))
+	assert.Equal(t, "query", log["message"])
+	assert.False(t, dec.More())
+}
+
 func TestNewVoidLogger(t *testing.T) {
 	logger := NewVoidLogger()
 	assert.NotNil(t, logger)
@@ -267,6 +296,108 @@ func TestLoggerWith(t *testing.T) {
 	}
 }
 
+func TestLoggerWithCallerSkip(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := NewLogger(Options{Name: "service", Writer: buff}).With("version", "0.1.0")
+	helper := func(message string) {
+		logger.WithCallerSkip(1).Named("helper").Info(message)
+	}
+
+	_, file, line, _ := runtime.Caller(0)
+	helper("Hello, World!")
+
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s:%d", filepath.Base(file), line+1), log["caller"])
+	assert.Equal(t, "service.helper", log["logger"])
+	assert.Equal(t, "0.1.0", log["version"])
+}
+
+func TestLoggerNamed(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		kv            []interface{}
+		loggerName    string
+		expectedName  string
+		expectedLevel Level
+	}{
+		{
+			name:          "DefaultLevel",
+			opts:          Options{Name: "service", Level: "warn"},
+			loggerName:    "db",
+			expectedName:  "service.db",
+			expectedLevel: WarnLevel,
+		},
+		{
+			name:          "LevelOverride",
+			opts:          Options{Name: "service", Level: "warn,db=debug"},
+			loggerName:    "db",
+			expectedName:  "service.db",
+			expectedLevel: DebugLevel,
+		},
+		{
+			name:          "WithContext",
+			opts:          Options{Name: "service", Level: "info,jaeger=trace"},
+			kv:            []interface{}{"version", "0.1.0"},
+			loggerName:    "jaeger",
+			expectedName:  "service.jaeger",
+			expectedLevel: TraceLevel,
+		},
+		{
+			name:          "NoParentName",
+			opts:          Options{Level: "info,jaeger=trace"},
+			loggerName:    "jaeger",
+			expectedName:  "jaeger",
+			expectedLevel: TraceLevel,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			tc.opts.Writer = buff
+			logger := NewLogger(tc.opts).With(tc.kv...).Named(tc.loggerName)
+
+			assert.Equal(t, tc.expectedLevel, logger.Level)
+
+			logger.TraceKV("message", "hello")
+			if tc.expectedLevel != TraceLevel {
+				assert.Empty(t, buff.String())
+				return
+			}
+
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, log["logger"])
+			assert.Equal(t, "trace", log["level"])
+			assert.Contains(t, log["caller"], "log_test.go")
+			for i := 0; i < len(tc.kv); i += 2 {
+				assert.Equal(t, tc.kv[i+1], log[tc.kv[i].(string)])
+			}
+		})
+	}
+
+	t.Run("VoidLogger", func(t *testing.T) {
+		logger := NewVoidLogger().Named("db")
+		assert.Equal(t, NoneLevel, logger.Level)
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		logger := NewLogger(Options{Name: "service", Level: "info,service.db.pool=debug"}).Named("db").Named("pool")
+		assert.Equal(t, "service.db.pool", logger.opts.Name)
+		assert.Equal(t, DebugLevel, logger.Level)
+	})
+
+	t.Run("Singleton", func(t *testing.T) {
+		logger := Named("db")
+		assert.NotNil(t, logger)
+		assert.Equal(t, "singleton.db", logger.opts.Name)
+	})
+}
+
 func TestLoggerSetLevel(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -319,16 +450,49 @@ func TestLoggerSetLevel(t *testing.T) {
 			"debug",
 			DebugLevel,
 		},
+		{
+			"TraceLevel",
+			&Logger{
+				base:   kitLog.NewNopLogger(),
+				logger: &kitLog.SwapLogger{},
+			},
+			"trace",
+			TraceLevel,
+		},
+		{
+			"LevelOverride",
+			&Logger{
+				opts:   Options{Name: "db"},
+				base:   kitLog.NewNopLogger(),
+				logger: &kitLog.SwapLogger{},
+			},
+			"info,db=debug",
+			DebugLevel,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.logger.SetLevel(tc.level)
+			err := tc.logger.SetLevel(tc.level)
+			assert.NoError(t, err)
 
 			assert.NotNil(t, tc.logger.logger)
 			assert.Equal(t, tc.expectedLevel, tc.logger.Level)
 		})
 	}
+
+	t.Run("InvalidLevel", func(t *testing.T) {
+		logger := NewLogger(Options{
+			Name:   "db",
+			Level:  "debug",
+			Writer: &bytes.Buffer{},
+		})
+
+		err := logger.SetLevel("warn,db=verbose")
+		assert.EqualError(t, err, `invalid log level: "verbose"`)
+		assert.Equal(t, DebugLevel, logger.Level)
+		assert.Equal(t, "debug", logger.opts.Level)
+	})
 }
 
 func TestLoggerSetOptions(t *testing.T) {
@@ -470,6 +634,22 @@ func TestLoggerSetOptions(t *testing.T) {
 			assert.Equal(t, tc.expectedLevel, tc.logger.Level)
 		})
 	}
+
+	t.Run("InvalidLevel", func(t *testing.T) {
+		buff := &bytes.Buffer{}
+		logger := NewLogger(Options{Level: "debug"})
+		logger.SetOptions(Options{
+			Level:  "inf",
+			Writer: buff,
+		})
+
+		assert.Equal(t, InfoLevel, logger.Level)
+
+		var log map[string]interface{}
+		assert.NoError(t, json.NewDecoder(buff).Decode(&log))
+		assert.Equal(t, "warn", log["level"])
+		assert.Equal(t, `invalid log level "inf", using info: invalid log level: "inf"`, log["message"])
+	})
 }
 
 func TestLoggerLog(t *testing.T) {
@@ -503,6 +683,13 @@ func TestLoggerLog(t *testing.T) {
 			logger := &Logger{logger: &kitLog.SwapLogger{}}
 			logger.logger.Swap(tc.mockKitLogger)
 
+			t.Run("Trace", func(t *testing.T) {
+				logger.Trace(tc.message)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("Debug", func(t *testing.T) {
 				logger.Debug(tc.message)
 				for _, val := range tc.expectedKV {
@@ -530,6 +717,18 @@ func TestLoggerLog(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("Fatal", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				logger.Fatal(tc.message)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
 		})
 	}
 }
@@ -566,6 +765,13 @@ func TestLoggerLogf(t *testing.T) {
 			logger := &Logger{logger: &kitLog.SwapLogger{}}
 			logger.logger.Swap(tc.mockKitLogger)
 
+			t.Run("Tracef", func(t *testing.T) {
+				logger.Tracef(tc.format, tc.vals...)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("Debugf", func(t *testing.T) {
 				logger.Debugf(tc.format, tc.vals...)
 				for _, val := range tc.expectedKV {
@@ -593,6 +799,18 @@ func TestLoggerLogf(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("Fatalf", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				logger.Fatalf(tc.format, tc.vals...)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
 		})
 	}
 }
@@ -628,6 +846,13 @@ func TestLoggerLogKV(t *testing.T) {
 			logger := &Logger{logger: &kitLog.SwapLogger{}}
 			logger.logger.Swap(tc.mockKitLogger)
 
+			t.Run("TraceKV", func(t *testing.T) {
+				logger.TraceKV(tc.kv...)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("DebugKV", func(t *testing.T) {
 				logger.DebugKV(tc.kv...)
 				for _, val := range tc.expectedKV {
@@ -655,10 +880,111 @@ func TestLoggerLogKV(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("FatalKV", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				logger.FatalKV(tc.kv...)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+		})
+	}
+}
+
+func TestLoggerErrorE(t *testing.T) {
+	tests := []struct {
+		name          string
+		mockKitLogger *mockKitLogger
+		err           error
+		message       string
+		kv            []interface{}
+		expectedKV    []interface{}
+	}{
+		{
+			"Error",
+			&mockKitLogger{
+				LogOutError: errors.New("log error"),
+			},
+			errors.New("no capacity"),
+			"operation failed",
+			[]interface{}{"operation", "test"},
+			[]interface{}{"message", "operation failed", "operation", "test", "error", "no capacity", "error.type", "*errors.errorString"},
+		},
+		{
+			"Success",
+			&mockKitLogger{},
+			errors.New("no capacity"),
+			"operation failed",
+			nil,
+			[]interface{}{"message", "operation failed", "error", "no capacity", "error.type", "*errors.errorString"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &Logger{logger: &kitLog.SwapLogger{}}
+			logger.logger.Swap(tc.mockKitLogger)
+
+			logger.ErrorE(tc.err, tc.message, tc.kv...)
+			for _, val := range tc.expectedKV {
+				assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+			}
 		})
 	}
 }
 
+type mockSyncWriter struct {
+	bytes.Buffer
+	SyncCalled   bool
+	SyncOutError error
+}
+
+func (m *mockSyncWriter) Sync() error {
+	m.SyncCalled = true
+	return m.SyncOutError
+}
+
+func TestLoggerSync(t *testing.T) {
+	t.Run("NotBuffered", func(t *testing.T) {
+		logger := NewLogger(Options{Writer: new(bytes.Buffer)})
+		assert.NoError(t, logger.Sync())
+	})
+
+	t.Run("Buffered", func(t *testing.T) {
+		w := &mockSyncWriter{}
+		logger := NewLogger(Options{Writer: w})
+		assert.NoError(t, logger.Sync())
+		assert.True(t, w.SyncCalled)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		w := &mockSyncWriter{SyncOutError: errors.New("disk full")}
+		logger := NewLogger(Options{Writer: w})
+		assert.EqualError(t, logger.Sync(), "disk full")
+	})
+
+	t.Run("NotSupported", func(t *testing.T) {
+		w := &mockSyncWriter{SyncOutError: &os.PathError{Op: "sync", Path: "/dev/stdout", Err: syscall.ENOTSUP}}
+		logger := NewLogger(Options{Writer: w})
+		assert.NoError(t, logger.Sync())
+	})
+
+	t.Run("Pipe", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		assert.NoError(t, err)
+		defer r.Close()
+		defer w.Close()
+
+		logger := NewLogger(Options{Writer: w})
+		assert.NoError(t, logger.Sync())
+	})
+}
+
 func TestSingletonSetLevel(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -694,7 +1020,8 @@ func TestSingletonSetLevel(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			SetLevel(tc.level)
+			err := SetLevel(tc.level)
+			assert.NoError(t, err)
 
 			assert.NotNil(t, singleton.logger)
 			assert.Equal(t, tc.expectedLevel, singleton.Level)
@@ -828,6 +1155,13 @@ func TestSingletonLoggerLog(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			singleton.logger.Swap(tc.mockKitLogger)
 
+			t.Run("Trace", func(t *testing.T) {
+				Trace(tc.message)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("Debug", func(t *testing.T) {
 				Debug(tc.message)
 				for _, val := range tc.expectedKV {
@@ -855,6 +1189,18 @@ func TestSingletonLoggerLog(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("Fatal", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				Fatal(tc.message)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
 		})
 	}
 }
@@ -890,6 +1236,13 @@ func TestSingletonLoggerLogf(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			singleton.logger.Swap(tc.mockKitLogger)
 
+			t.Run("Tracef", func(t *testing.T) {
+				Tracef(tc.format, tc.vals...)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("Debugf", func(t *testing.T) {
 				Debugf(tc.format, tc.vals...)
 				for _, val := range tc.expectedKV {
@@ -917,6 +1270,18 @@ func TestSingletonLoggerLogf(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("Fatalf", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				Fatalf(tc.format, tc.vals...)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
 		})
 	}
 }
@@ -951,6 +1316,13 @@ func TestSingletonLoggerLogKV(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			singleton.logger.Swap(tc.mockKitLogger)
 
+			t.Run("TraceKV", func(t *testing.T) {
+				TraceKV(tc.kv...)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+
 			t.Run("DebugKV", func(t *testing.T) {
 				DebugKV(tc.kv...)
 				for _, val := range tc.expectedKV {
@@ -978,6 +1350,59 @@ func TestSingletonLoggerLogKV(t *testing.T) {
 					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
 				}
 			})
+
+			t.Run("FatalKV", func(t *testing.T) {
+				var code int
+				exit = func(c int) { code = c }
+				defer func() { exit = os.Exit }()
+
+				FatalKV(tc.kv...)
+				assert.Equal(t, 1, code)
+				for _, val := range tc.expectedKV {
+					assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+				}
+			})
+		})
+	}
+}
+
+func TestSingletonLoggerErrorE(t *testing.T) {
+	tests := []struct {
+		name          string
+		mockKitLogger *mockKitLogger
+		err           error
+		message       string
+		kv            []interface{}
+		expectedKV    []interface{}
+	}{
+		{
+			"Error",
+			&mockKitLogger{
+				LogOutError: errors.New("log error"),
+			},
+			errors.New("no capacity"),
+			"operation failed",
+			[]interface{}{"operation", "test"},
+			[]interface{}{"message", "operation failed", "operation", "test", "error", "no capacity", "error.type", "*errors.errorString"},
+		},
+		{
+			"Success",
+			&mockKitLogger{},
+			errors.New("no capacity"),
+			"operation failed",
+			nil,
+			[]interface{}{"message", "operation failed", "error", "no capacity", "error.type", "*errors.errorString"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			singleton.logger.Swap(tc.mockKitLogger)
+
+			ErrorE(tc.err, tc.message, tc.kv...)
+			for _, val := range tc.expectedKV {
+				assert.Contains(t, tc.mockKitLogger.LogInKV, val)
+			}
 		})
 	}
 }
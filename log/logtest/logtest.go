@@ -0,0 +1,217 @@
+// Package logtest provides a recording logger and assertion helpers for testing logs.
+package logtest
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/request"
+)
+
+// TestingT is the subset of testing.TB used by assertion helpers.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Entry is a structured log entry captured by a recorder.
+type Entry struct {
+	Level   log.Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+// normalize converts a value to its JSON representation, so it can be compared with logged values.
+// Like the JSON logger, errors and fmt.Stringer values (i.e. time.Duration) are converted to their strings
+// unless they implement json.Marshaler or encoding.TextMarshaler.
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+	case error:
+		val = v.Error()
+	case fmt.Stringer:
+		val = v.String()
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprint(val)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Sprint(val)
+	}
+
+	return v
+}
+
+// Has returns true if the entry has a field with a given value.
+func (e Entry) Has(key string, val interface{}) bool {
+	v, ok := e.Fields[key]
+	return ok && reflect.DeepEqual(v, normalize(val))
+}
+
+// matches returns true if the entry has all key-value pairs.
+func (e Entry) matches(kv ...interface{}) bool {
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		if !e.Has(key, kv[i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Recorder captures log entries written by a logger.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Write implements io.Writer.
+// Every write by the JSON logger is one log entry.
+func (r *Recorder) Write(p []byte) (int, error) {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(bytes.TrimSpace(p), &fields); err != nil {
+		return 0, fmt.Errorf("invalid log entry: %w", err)
+	}
+
+	entry := Entry{Fields: fields}
+	if s, ok := fields["level"].(string); ok {
+		entry.Level, _ = log.ParseLevel(s)
+	}
+	if s, ok := fields["message"].(string); ok {
+		entry.Message = s
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+
+	return len(p), nil
+}
+
+// Entries returns all captured log entries.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+
+	return entries
+}
+
+// Reset removes all captured log entries.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = nil
+}
+
+// FilterLevel returns the captured log entries in a given level.
+func (r *Recorder) FilterLevel(level log.Level) []Entry {
+	entries := []Entry{}
+	for _, e := range r.Entries() {
+		if e.Level == level {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// FilterField returns the captured log entries having a field with a given value.
+func (r *Recorder) FilterField(key string, val interface{}) []Entry {
+	entries := []Entry{}
+	for _, e := range r.Entries() {
+		if e.Has(key, val) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// Find returns the captured log entries in a given level with a given message and key-value pairs.
+func (r *Recorder) Find(level log.Level, message string, kv ...interface{}) []Entry {
+	entries := []Entry{}
+	for _, e := range r.Entries() {
+		if e.Level == level && e.Message == message && e.matches(kv...) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// AssertLogged asserts an entry in a given level with a given message and key-value pairs is logged.
+func (r *Recorder) AssertLogged(t TestingT, level log.Level, message string, kv ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if len(r.Find(level, message, kv...)) == 0 {
+		t.Errorf("no %s log with message %q and key-values %v found in:\n%s", level, message, kv, r)
+		return false
+	}
+
+	return true
+}
+
+// AssertNotLogged asserts no entry in a given level with a given message and key-value pairs is logged.
+func (r *Recorder) AssertNotLogged(t TestingT, level log.Level, message string, kv ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if len(r.Find(level, message, kv...)) > 0 {
+		t.Errorf("unexpected %s log with message %q and key-values %v found in:\n%s", level, message, kv, r)
+		return false
+	}
+
+	return true
+}
+
+// String returns the captured log entries one per line.
+func (r *Recorder) String() string {
+	var buf bytes.Buffer
+	for _, e := range r.Entries() {
+		b, _ := json.Marshal(e.Fields)
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// New creates a new logger capturing all log entries in all levels.
+// Fatal logs still terminate the program.
+func New() (*log.Logger, *Recorder) {
+	r := new(Recorder)
+	logger := log.NewLogger(log.Options{
+		Name:   "test",
+		Level:  "trace",
+		Format: log.JSON,
+		Writer: r,
+	})
+
+	return logger, r
+}
+
+// ContextForTest takes in a context and inserts a request id as well as a new recording logger.
+// For use in tests only, to assert on logs of functions expecting a request-scoped logger.
+func ContextForTest(ctx context.Context) (context.Context, *Recorder) {
+	logger, r := New()
+	ctx = request.ContextWithID(ctx, request.NewID())
+	ctx = log.ContextWithLogger(ctx, logger)
+	return ctx, r
+}
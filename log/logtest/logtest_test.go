@@ -0,0 +1,201 @@
+package logtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/request"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockT struct {
+	ErrorfCalled bool
+	ErrorfMsg    string
+}
+
+func (m *mockT) Errorf(format string, args ...interface{}) {
+	m.ErrorfCalled = true
+	m.ErrorfMsg = fmt.Sprintf(format, args...)
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		val           interface{}
+		expectedValue interface{}
+	}{
+		{"String", "value", "value"},
+		{"Int", 10, float64(10)},
+		{"Bool", true, true},
+		{"Slice", []string{"a", "b"}, []interface{}{"a", "b"}},
+		{"Error", errors.New("connection refused"), "connection refused"},
+		{"Stringer", time.Second, "1s"},
+		{"TextMarshaler", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "2020-01-01T00:00:00Z"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedValue, normalize(tc.val))
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		assert.IsType(t, "", normalize(make(chan int)))
+	})
+}
+
+func TestRecorderWrite(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		expectedError   bool
+		expectedEntries []Entry
+	}{
+		{
+			name: "OneEntry",
+			data: `{"level":"info","message":"hello","count":1}` + "\n",
+			expectedEntries: []Entry{
+				{Level: log.InfoLevel, Message: "hello", Fields: map[string]interface{}{"level": "info", "message": "hello", "count": float64(1)}},
+			},
+		},
+		{
+			name: "NoLevel",
+			data: `{"key":"value"}`,
+			expectedEntries: []Entry{
+				{Level: log.NoneLevel, Fields: map[string]interface{}{"key": "value"}},
+			},
+		},
+		{
+			name: "LargeEntry",
+			data: `{"level":"error","message":"` + strings.Repeat("x", 100000) + `"}` + "\n",
+			expectedEntries: []Entry{
+				{Level: log.ErrorLevel, Message: strings.Repeat("x", 100000), Fields: map[string]interface{}{"level": "error", "message": strings.Repeat("x", 100000)}},
+			},
+		},
+		{
+			name:          "InvalidJSON",
+			data:          `level=info message=hello`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := new(Recorder)
+			n, err := r.Write([]byte(tc.data))
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, len(tc.data), n)
+				assert.Equal(t, tc.expectedEntries, r.Entries())
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	logger, r := New()
+
+	logger.InfoKV("message", "request handled", "statusCode", 200, "path", "/users")
+	logger.WarnKV("message", "request handled", "statusCode", 404, "path", "/teams")
+	logger.With("requestId", "1111-aaaa").Error("request failed")
+	logger.Trace("tracing")
+
+	t.Run("Entries", func(t *testing.T) {
+		entries := r.Entries()
+		assert.Len(t, entries, 4)
+		assert.Equal(t, log.InfoLevel, entries[0].Level)
+		assert.Equal(t, "request handled", entries[0].Message)
+		assert.Equal(t, "test", entries[0].Fields["logger"])
+	})
+
+	t.Run("FilterLevel", func(t *testing.T) {
+		assert.Len(t, r.FilterLevel(log.WarnLevel), 1)
+		assert.Len(t, r.FilterLevel(log.TraceLevel), 1)
+		assert.Len(t, r.FilterLevel(log.DebugLevel), 0)
+	})
+
+	t.Run("FilterField", func(t *testing.T) {
+		assert.Len(t, r.FilterField("message", "request handled"), 2)
+		assert.Len(t, r.FilterField("statusCode", 404), 1)
+		assert.Len(t, r.FilterField("requestId", "1111-aaaa"), 1)
+		assert.Len(t, r.FilterField("requestId", "2222-bbbb"), 0)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		assert.Len(t, r.Find(log.InfoLevel, "request handled", "statusCode", 200), 1)
+		assert.Len(t, r.Find(log.InfoLevel, "request handled", "statusCode", 404), 0)
+		assert.Len(t, r.Find(log.ErrorLevel, "request failed"), 1)
+	})
+
+	t.Run("AssertLogged", func(t *testing.T) {
+		assert.True(t, r.AssertLogged(t, log.InfoLevel, "request handled", "path", "/users"))
+
+		mt := &mockT{}
+		assert.False(t, r.AssertLogged(mt, log.InfoLevel, "request handled", "path", "/teams"))
+		assert.True(t, mt.ErrorfCalled)
+		assert.Contains(t, mt.ErrorfMsg, "no info log")
+	})
+
+	t.Run("AssertNotLogged", func(t *testing.T) {
+		assert.True(t, r.AssertNotLogged(t, log.DebugLevel, "request handled"))
+
+		mt := &mockT{}
+		assert.False(t, r.AssertNotLogged(mt, log.ErrorLevel, "request failed"))
+		assert.True(t, mt.ErrorfCalled)
+		assert.Contains(t, mt.ErrorfMsg, "unexpected error log")
+	})
+
+	t.Run("String", func(t *testing.T) {
+		assert.Contains(t, r.String(), `"message":"request failed"`)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		r.Reset()
+		assert.Empty(t, r.Entries())
+	})
+}
+
+func TestRecorderLargeEntry(t *testing.T) {
+	logger, r := New()
+	body := strings.Repeat("x", 100000)
+
+	logger.InfoKV("message", "request body", "body", body)
+
+	assert.True(t, r.AssertLogged(t, log.InfoLevel, "request body", "body", body))
+}
+
+func TestEntryHas(t *testing.T) {
+	logger, r := New()
+	err := errors.New("connection refused")
+
+	logger.ErrorKV("message", "query failed", "err", err, "d", time.Second, "rows", 10)
+
+	entries := r.Entries()
+	assert.Len(t, entries, 1)
+	assert.True(t, entries[0].Has("err", err))
+	assert.True(t, entries[0].Has("d", time.Second))
+	assert.True(t, entries[0].Has("rows", 10))
+	assert.False(t, entries[0].Has("d", time.Minute))
+	assert.False(t, entries[0].Has("missing", "value"))
+
+	assert.True(t, r.AssertLogged(t, log.ErrorLevel, "query failed", "err", err, "d", time.Second))
+}
+
+func TestContextForTest(t *testing.T) {
+	ctx, r := ContextForTest(context.Background())
+
+	requestID, ok := request.IDFromContext(ctx)
+	assert.True(t, ok)
+	assert.NotEmpty(t, requestID)
+
+	log.LoggerFromContext(ctx).Info("Hello, World!")
+	assert.Len(t, r.Entries(), 1)
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/moorara/observe/internal/env"
+)
+
+const (
+	envName        = "LOG_NAME"
+	envEnvironment = "ENVIRONMENT"
+	envRegion      = "REGION"
+	envLevel       = "LOG_LEVEL"
+	envFormat      = "LOG_FORMAT"
+)
+
+// OptionsFromEnv creates logger options from environment variables.
+// The following environment variables are read if set:
+//   LOG_NAME, ENVIRONMENT, REGION, LOG_LEVEL, LOG_FORMAT
+// If prefix is not empty, it will be prepended to the variable names (i.e. prefix "app" reads APP_LOG_LEVEL).
+// An error will be returned if the level or the format is not valid.
+func OptionsFromEnv(prefix string) (Options, error) {
+	opts := Options{
+		Name:        os.Getenv(env.Var(prefix, envName)),
+		Environment: os.Getenv(env.Var(prefix, envEnvironment)),
+		Region:      os.Getenv(env.Var(prefix, envRegion)),
+	}
+
+	if val := os.Getenv(env.Var(prefix, envLevel)); val != "" {
+		if _, err := parseLevels(val); err != nil {
+			return Options{}, fmt.Errorf("%s: %s", env.Var(prefix, envLevel), err)
+		}
+		opts.Level = val
+	}
+
+	if val := os.Getenv(env.Var(prefix, envFormat)); val != "" {
+		format, err := ParseFormat(val)
+		if err != nil {
+			return Options{}, fmt.Errorf("%s: %s", env.Var(prefix, envFormat), err)
+		}
+		opts.Format = format
+	}
+
+	return opts, nil
+}
+
+// levelFlag implements flag.Value for a level string with optional overrides.
+type levelFlag struct {
+	level *string
+}
+
+func (f *levelFlag) String() string {
+	if f.level == nil {
+		return ""
+	}
+
+	return *f.level
+}
+
+func (f *levelFlag) Set(val string) error {
+	if _, err := parseLevels(val); err != nil {
+		return err
+	}
+
+	*f.level = val
+	return nil
+}
+
+// formatFlag implements flag.Value for a format.
+type formatFlag struct {
+	format *Format
+}
+
+func (f *formatFlag) String() string {
+	if f.format == nil {
+		return ""
+	}
+
+	return f.format.String()
+}
+
+func (f *formatFlag) Set(val string) error {
+	format, err := ParseFormat(val)
+	if err != nil {
+		return err
+	}
+
+	*f.format = format
+	return nil
+}
+
+// BindFlags defines command-line flags for logger options in a flag set.
+// The current values of options are used as the default values for flags,
+// so flags can override the options read from environment variables.
+// The following flags are defined:
+//   -log-name, -environment, -region, -log-level, -log-format
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Name, "log-name", o.Name, "logger name")
+	fs.StringVar(&o.Environment, "environment", o.Environment, "deployment environment")
+	fs.StringVar(&o.Region, "region", o.Region, "deployment region")
+	fs.Var(&levelFlag{&o.Level}, "log-level", "log level with optional overrides by logger names (i.e. info,db=debug)")
+	fs.Var(&formatFlag{&o.Format}, "log-format", "log format (json or logfmt)")
+}
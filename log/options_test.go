@@ -0,0 +1,185 @@
+package log
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		env           map[string]string
+		expectedOpts  Options
+		expectedError string
+	}{
+		{
+			name:         "NoEnv",
+			prefix:       "",
+			env:          map[string]string{},
+			expectedOpts: Options{},
+		},
+		{
+			name:   "AllEnv",
+			prefix: "",
+			env: map[string]string{
+				"LOG_NAME":    "service",
+				"ENVIRONMENT": "production",
+				"REGION":      "us-east-1",
+				"LOG_LEVEL":   "info,db=debug",
+				"LOG_FORMAT":  "logfmt",
+			},
+			expectedOpts: Options{
+				Name:        "service",
+				Environment: "production",
+				Region:      "us-east-1",
+				Level:       "info,db=debug",
+				Format:      Logfmt,
+			},
+		},
+		{
+			name:   "WithPrefix",
+			prefix: "app",
+			env: map[string]string{
+				"APP_LOG_NAME":    "service",
+				"APP_ENVIRONMENT": "staging",
+				"APP_REGION":      "us-west-2",
+				"APP_LOG_LEVEL":   "debug",
+				"APP_LOG_FORMAT":  "json",
+			},
+			expectedOpts: Options{
+				Name:        "service",
+				Environment: "staging",
+				Region:      "us-west-2",
+				Level:       "debug",
+				Format:      JSON,
+			},
+		},
+		{
+			name:   "InvalidLevel",
+			prefix: "",
+			env: map[string]string{
+				"LOG_LEVEL": "verbose",
+			},
+			expectedError: `LOG_LEVEL: invalid log level: "verbose"`,
+		},
+		{
+			name:   "InvalidFormat",
+			prefix: "",
+			env: map[string]string{
+				"LOG_FORMAT": "xml",
+			},
+			expectedError: `LOG_FORMAT: invalid log format: "xml"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			opts, err := OptionsFromEnv(tc.prefix)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, opts)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestOptionsBindFlags(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		args          []string
+		expectedOpts  Options
+		expectedError bool
+	}{
+		{
+			name:         "NoFlag",
+			opts:         Options{Name: "service", Level: "warn"},
+			args:         []string{},
+			expectedOpts: Options{Name: "service", Level: "warn"},
+		},
+		{
+			name: "AllFlags",
+			opts: Options{Name: "service", Level: "warn"},
+			args: []string{
+				"-log-name", "api",
+				"-environment", "production",
+				"-region", "us-east-1",
+				"-log-level", "info,jaeger=warn",
+				"-log-format", "logfmt",
+			},
+			expectedOpts: Options{
+				Name:        "api",
+				Environment: "production",
+				Region:      "us-east-1",
+				Level:       "info,jaeger=warn",
+				Format:      Logfmt,
+			},
+		},
+		{
+			name:          "InvalidLevel",
+			opts:          Options{},
+			args:          []string{"-log-level", "verbose"},
+			expectedError: true,
+		},
+		{
+			name:          "InvalidFormat",
+			opts:          Options{},
+			args:          []string{"-log-format", "xml"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			tc.opts.BindFlags(fs)
+
+			err := fs.Parse(tc.args)
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, tc.opts)
+			}
+		})
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	f := &levelFlag{}
+	assert.Equal(t, "", f.String())
+
+	level := "info"
+	f = &levelFlag{&level}
+	assert.Equal(t, "info", f.String())
+	assert.NoError(t, f.Set("debug"))
+	assert.Equal(t, "debug", level)
+	assert.Error(t, f.Set("verbose"))
+}
+
+func TestFormatFlag(t *testing.T) {
+	f := &formatFlag{}
+	assert.Equal(t, "", f.String())
+
+	format := JSON
+	f = &formatFlag{&format}
+	assert.Equal(t, "json", f.String())
+	assert.NoError(t, f.Set("logfmt"))
+	assert.Equal(t, Logfmt, format)
+	assert.Error(t, f.Set("xml"))
+}
@@ -0,0 +1,141 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slogLevel converts a slog level to a level.
+// slog levels above error are logged in error level, so they never terminate the program.
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelDebug:
+		return TraceLevel
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+// slogHandler implements slog.Handler.
+type slogHandler struct {
+	logger *Logger
+	group  string
+}
+
+// NewSlogHandler creates a slog handler that logs every record using a logger.
+// Attributes in groups are logged with keys qualified by the group names (i.e. "request.method").
+// The caller and timestamp are taken from records, so they point at the call sites of slog loggers.
+func NewSlogHandler(logger *Logger) slog.Handler {
+	return &slogHandler{
+		logger: logger.withExternal(),
+	}
+}
+
+// slogCaller returns the caller of a record in the same format as the caller of other logs (i.e. "main.go:10").
+func slogCaller(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+
+	frames := runtime.CallersFrames([]uintptr{pc})
+	frame, _ := frames.Next()
+	if frame.File == "" {
+		return ""
+	}
+
+	idx := strings.LastIndexByte(frame.File, '/')
+	return frame.File[idx+1:] + ":" + strconv.Itoa(frame.Line)
+}
+
+func (h *slogHandler) appendAttr(kv []interface{}, prefix string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return kv
+	}
+
+	key := a.Key
+	if prefix != "" && key != "" {
+		key = prefix + "." + key
+	} else if prefix != "" {
+		key = prefix
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			kv = h.appendAttr(kv, key, ga)
+		}
+		return kv
+	}
+
+	return append(kv, key, a.Value.Any())
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Level.enables(slogLevel(level))
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	kv := []interface{}{}
+	if caller := slogCaller(r.PC); caller != "" {
+		kv = append(kv, "caller", caller)
+	}
+
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	kv = append(kv, "timestamp", ts.UTC().Format(time.RFC3339Nano), "message", r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		kv = h.appendAttr(kv, h.group, a)
+		return true
+	})
+
+	h.logger.log(slogLevel(r.Level), kv...)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kv := []interface{}{}
+	for _, a := range attrs {
+		kv = h.appendAttr(kv, h.group, a)
+	}
+
+	return &slogHandler{
+		logger: h.logger.With(kv...),
+		group:  h.group,
+	}
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+
+	return &slogHandler{
+		logger: h.logger,
+		group:  group,
+	}
+}
@@ -0,0 +1,194 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLevel(t *testing.T) {
+	tests := []struct {
+		level         slog.Level
+		expectedLevel Level
+	}{
+		{slog.LevelDebug - 4, TraceLevel},
+		{slog.LevelDebug, DebugLevel},
+		{slog.LevelInfo, InfoLevel},
+		{slog.LevelWarn, WarnLevel},
+		{slog.LevelError, ErrorLevel},
+		{slog.LevelError + 4, ErrorLevel},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			assert.Equal(t, tc.expectedLevel, slogLevel(tc.level))
+		})
+	}
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	tests := []struct {
+		name            string
+		loggerLevel     string
+		level           slog.Level
+		expectedEnabled bool
+	}{
+		{"InfoEnabled", "info", slog.LevelInfo, true},
+		{"DebugDisabled", "info", slog.LevelDebug, false},
+		{"DebugEnabled", "debug", slog.LevelDebug, true},
+		{"NoneLevel", "none", slog.LevelError, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewSlogHandler(NewLogger(Options{Level: tc.loggerLevel}))
+			assert.Equal(t, tc.expectedEnabled, h.Enabled(context.Background(), tc.level))
+		})
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		log           func(*slog.Logger)
+		expectedLevel string
+		expectedKV    map[string]interface{}
+	}{
+		{
+			name: "Message",
+			log: func(l *slog.Logger) {
+				l.Info("Hello, World!")
+			},
+			expectedLevel: "info",
+			expectedKV: map[string]interface{}{
+				"message": "Hello, World!",
+			},
+		},
+		{
+			name: "Attrs",
+			log: func(l *slog.Logger) {
+				l.Warn("slow request", "duration", 1.5, slog.Group("request", "method", "GET", "path", "/users"))
+			},
+			expectedLevel: "warn",
+			expectedKV: map[string]interface{}{
+				"message":        "slow request",
+				"duration":       1.5,
+				"request.method": "GET",
+				"request.path":   "/users",
+			},
+		},
+		{
+			name: "WithAttrs",
+			log: func(l *slog.Logger) {
+				l.With("version", "0.1.0").Error("failed", "reason", "timeout")
+			},
+			expectedLevel: "error",
+			expectedKV: map[string]interface{}{
+				"message": "failed",
+				"version": "0.1.0",
+				"reason":  "timeout",
+			},
+		},
+		{
+			name: "WithGroup",
+			log: func(l *slog.Logger) {
+				l.WithGroup("db").WithGroup("").With("name", "users").WithGroup("query").Debug("executed", "rows", 10)
+			},
+			expectedLevel: "debug",
+			expectedKV: map[string]interface{}{
+				"message":       "executed",
+				"db.name":       "users",
+				"db.query.rows": float64(10),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := NewLogger(Options{Level: "debug", Writer: buff})
+			tc.log(slog.New(NewSlogHandler(logger)))
+
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLevel, log["level"])
+			for k, v := range tc.expectedKV {
+				assert.Equal(t, v, log[k])
+			}
+		})
+	}
+}
+
+func TestSlogHandlerCaller(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := slog.New(NewSlogHandler(NewLogger(Options{Writer: buff})))
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Info("Hello, World!")
+
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s:%d", filepath.Base(file), line+1), log["caller"])
+	assert.NotEmpty(t, log["timestamp"])
+}
+
+func TestSlogHandlerRecord(t *testing.T) {
+	ts := time.Date(2020, 5, 1, 12, 30, 0, 0, time.FixedZone("EDT", -4*60*60))
+	pcs := make([]uintptr, 1)
+	runtime.Callers(1, pcs)
+	_, file, line, _ := runtime.Caller(0)
+
+	tests := []struct {
+		name              string
+		record            slog.Record
+		expectedCaller    interface{}
+		expectedTimestamp interface{}
+	}{
+		{
+			name:              "WithPCAndTime",
+			record:            slog.NewRecord(ts, slog.LevelInfo, "hello", pcs[0]),
+			expectedCaller:    fmt.Sprintf("%s:%d", filepath.Base(file), line-1),
+			expectedTimestamp: "2020-05-01T16:30:00Z",
+		},
+		{
+			name:              "WithoutPC",
+			record:            slog.NewRecord(ts, slog.LevelInfo, "hello", 0),
+			expectedCaller:    nil,
+			expectedTimestamp: "2020-05-01T16:30:00Z",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			h := NewSlogHandler(NewLogger(Options{Writer: buff}))
+			err := h.Handle(context.Background(), tc.record)
+			assert.NoError(t, err)
+
+			var log map[string]interface{}
+			err = json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCaller, log["caller"])
+			assert.Equal(t, tc.expectedTimestamp, log["timestamp"])
+			assert.Equal(t, "hello", log["message"])
+		})
+	}
+}
+
+func TestSlogHandlerEmptyGroup(t *testing.T) {
+	h := NewSlogHandler(NewLogger(Options{}))
+	assert.Equal(t, h, h.WithGroup(""))
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// OverflowLabelValue is the label value used when a label exceeds its limit of distinct values.
+const OverflowLabelValue = "other"
+
+// LabelName converts a string to a valid Prometheus label name.
+// Characters other than letters, digits, and underscores are replaced with underscores.
+func LabelName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// LabelLimiter bounds the number of distinct values of a label.
+// Label values coming from requests (i.e. baggage items) can have unbounded cardinality,
+// so values seen after the limit is reached are replaced with OverflowLabelValue.
+type LabelLimiter struct {
+	sync.Mutex
+	max    int
+	values map[string]bool
+}
+
+// NewLabelLimiter creates a new label limiter allowing up to max distinct values.
+func NewLabelLimiter(max int) *LabelLimiter {
+	return &LabelLimiter{
+		max:    max,
+		values: map[string]bool{},
+	}
+}
+
+// Value returns the label value to use for a given value.
+// Empty values are not counted towards the limit.
+func (l *LabelLimiter) Value(val string) string {
+	if val == "" {
+		return val
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.values[val] {
+		return val
+	}
+
+	if len(l.values) >= l.max {
+		return OverflowLabelValue
+	}
+
+	l.values[val] = true
+	return val
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelName(t *testing.T) {
+	tests := []struct {
+		s            string
+		expectedName string
+	}{
+		{"tenant", "tenant"},
+		{"tenant-id", "tenant_id"},
+		{"user.Name", "user_Name"},
+		{"1st", "_1st"},
+		{"", "_"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedName, LabelName(tc.s))
+	}
+}
+
+func TestLabelLimiter(t *testing.T) {
+	l := NewLabelLimiter(2)
+
+	assert.Equal(t, "", l.Value(""))
+	assert.Equal(t, "a", l.Value("a"))
+	assert.Equal(t, "b", l.Value("b"))
+	assert.Equal(t, OverflowLabelValue, l.Value("c"))
+	assert.Equal(t, "a", l.Value("a"))
+	assert.Equal(t, "", l.Value(""))
+	assert.Equal(t, OverflowLabelValue, l.Value("d"))
+}
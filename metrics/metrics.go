@@ -119,7 +119,7 @@ func (f *Factory) Histogram(name, description string, labels []string) *promethe
 	opts := prometheus.HistogramOpts{
 		Name:    f.getMetricName(name),
 		Help:    description,
-		Buckets: defaultBuckets,
+		Buckets: f.buckets,
 	}
 
 	histogram := prometheus.NewHistogramVec(opts, labels)
@@ -133,7 +133,7 @@ func (f *Factory) Summary(name, description string, labels []string) *prometheus
 	opts := prometheus.SummaryOpts{
 		Name:       f.getMetricName(name),
 		Help:       description,
-		Objectives: defaultQuantiles,
+		Objectives: f.quantiles,
 	}
 
 	summary := prometheus.NewSummaryVec(opts, labels)
@@ -208,36 +208,53 @@ func TestGauge(t *testing.T) {
 
 func TestHistogram(t *testing.T) {
 	tests := []struct {
-		name         string
-		opts         FactoryOptions
-		metricName   string
-		description  string
-		labels       []string
-		labelValues  []string
-		value        float64
-		expectedName string
+		name            string
+		opts            FactoryOptions
+		metricName      string
+		description     string
+		labels          []string
+		labelValues     []string
+		value           float64
+		expectedName    string
+		expectedBuckets []float64
 	}{
 		{
-			name:         "Defaults",
-			opts:         FactoryOptions{},
-			metricName:   "histogram_metric_name",
-			description:  "metric description",
-			labels:       []string{"environment", "region"},
-			labelValues:  []string{"prodcution", "us-east-1"},
-			value:        0.1234,
-			expectedName: "histogram_metric_name",
+			name:            "Defaults",
+			opts:            FactoryOptions{},
+			metricName:      "histogram_metric_name",
+			description:     "metric description",
+			labels:          []string{"environment", "region"},
+			labelValues:     []string{"prodcution", "us-east-1"},
+			value:           0.1234,
+			expectedName:    "histogram_metric_name",
+			expectedBuckets: []float64{0.01, 0.10, 0.50, 1.00, 5.00},
 		},
 		{
 			name: "WithPrefix",
 			opts: FactoryOptions{
 				Prefix: "service-name",
 			},
-			metricName:   "histogram_metric_name",
-			description:  "metric description",
-			labels:       []string{"environment", "region"},
-			labelValues:  []string{"prodcution", "us-east-1"},
-			value:        0.1234,
-			expectedName: "service_name_histogram_metric_name",
+			metricName:      "histogram_metric_name",
+			description:     "metric description",
+			labels:          []string{"environment", "region"},
+			labelValues:     []string{"prodcution", "us-east-1"},
+			value:           0.1234,
+			expectedName:    "service_name_histogram_metric_name",
+			expectedBuckets: []float64{0.01, 0.10, 0.50, 1.00, 5.00},
+		},
+		{
+			name: "WithBuckets",
+			opts: FactoryOptions{
+				Prefix:  "buckets",
+				Buckets: []float64{0.1, 1},
+			},
+			metricName:      "histogram_metric_name",
+			description:     "metric description",
+			labels:          []string{"environment", "region"},
+			labelValues:     []string{"prodcution", "us-east-1"},
+			value:           0.1234,
+			expectedName:    "buckets_histogram_metric_name",
+			expectedBuckets: []float64{0.1, 1},
 		},
 	}
 
@@ -256,6 +273,12 @@ func TestHistogram(t *testing.T) {
 				assert.Equal(t, tc.expectedName, *metricFamily.Name)
 				assert.Equal(t, tc.description, *metricFamily.Help)
 				assert.Equal(t, model.MetricType_HISTOGRAM, *metricFamily.Type)
+
+				buckets := []float64{}
+				for _, bucket := range metricFamily.Metric[0].Histogram.Bucket {
+					buckets = append(buckets, *bucket.UpperBound)
+				}
+				assert.Equal(t, tc.expectedBuckets, buckets)
 			}
 		})
 	}
@@ -263,36 +286,53 @@ func TestHistogram(t *testing.T) {
 
 func TestSummary(t *testing.T) {
 	tests := []struct {
-		name         string
-		opts         FactoryOptions
-		metricName   string
-		description  string
-		labels       []string
-		labelValues  []string
-		value        float64
-		expectedName string
+		name              string
+		opts              FactoryOptions
+		metricName        string
+		description       string
+		labels            []string
+		labelValues       []string
+		value             float64
+		expectedName      string
+		expectedQuantiles []float64
 	}{
 		{
-			name:         "Defaults",
-			opts:         FactoryOptions{},
-			metricName:   "summary_metric_name",
-			description:  "metric description",
-			labels:       []string{"environment", "region"},
-			labelValues:  []string{"prodcution", "us-east-1"},
-			value:        0.1234,
-			expectedName: "summary_metric_name",
+			name:              "Defaults",
+			opts:              FactoryOptions{},
+			metricName:        "summary_metric_name",
+			description:       "metric description",
+			labels:            []string{"environment", "region"},
+			labelValues:       []string{"prodcution", "us-east-1"},
+			value:             0.1234,
+			expectedName:      "summary_metric_name",
+			expectedQuantiles: []float64{0.1, 0.5, 0.95, 0.99},
 		},
 		{
 			name: "WithPrefix",
 			opts: FactoryOptions{
 				Prefix: "service-name",
 			},
-			metricName:   "summary_metric_name",
-			description:  "metric description",
-			labels:       []string{"environment", "region"},
-			labelValues:  []string{"prodcution", "us-east-1"},
-			value:        0.1234,
-			expectedName: "service_name_summary_metric_name",
+			metricName:        "summary_metric_name",
+			description:       "metric description",
+			labels:            []string{"environment", "region"},
+			labelValues:       []string{"prodcution", "us-east-1"},
+			value:             0.1234,
+			expectedName:      "service_name_summary_metric_name",
+			expectedQuantiles: []float64{0.1, 0.5, 0.95, 0.99},
+		},
+		{
+			name: "WithQuantiles",
+			opts: FactoryOptions{
+				Prefix:    "quantiles",
+				Quantiles: map[float64]float64{0.5: 0.05, 0.9: 0.01},
+			},
+			metricName:        "summary_metric_name",
+			description:       "metric description",
+			labels:            []string{"environment", "region"},
+			labelValues:       []string{"prodcution", "us-east-1"},
+			value:             0.1234,
+			expectedName:      "quantiles_summary_metric_name",
+			expectedQuantiles: []float64{0.5, 0.9},
 		},
 	}
 
@@ -311,6 +351,12 @@ func TestSummary(t *testing.T) {
 				assert.Equal(t, tc.expectedName, *metricFamily.Name)
 				assert.Equal(t, tc.description, *metricFamily.Help)
 				assert.Equal(t, model.MetricType_SUMMARY, *metricFamily.Type)
+
+				quantiles := []float64{}
+				for _, quantile := range metricFamily.Metric[0].Summary.Quantile {
+					quantiles = append(quantiles, *quantile.Quantile)
+				}
+				assert.Equal(t, tc.expectedQuantiles, quantiles)
 			}
 		})
 	}
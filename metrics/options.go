@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/moorara/observe/internal/env"
+)
+
+const (
+	envPrefix  = "METRICS_PREFIX"
+	envBuckets = "METRICS_BUCKETS"
+)
+
+// parseBuckets parses a comma-separated list of histogram buckets.
+// Buckets should be in strictly increasing order.
+func parseBuckets(val string) ([]float64, error) {
+	buckets := []float64{}
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		b, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket: %q", item)
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no bucket: %q", val)
+	}
+
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, fmt.Errorf("buckets not in increasing order: %q", val)
+		}
+	}
+
+	return buckets, nil
+}
+
+// OptionsFromEnv creates factory options from environment variables.
+// The following environment variables are read if set:
+//   METRICS_PREFIX, METRICS_BUCKETS (comma-separated values in increasing order)
+// If prefix is not empty, it will be prepended to the variable names (i.e. prefix "app" reads APP_METRICS_PREFIX).
+// An error will be returned if the buckets are not valid.
+func OptionsFromEnv(prefix string) (FactoryOptions, error) {
+	opts := FactoryOptions{
+		Prefix: os.Getenv(env.Var(prefix, envPrefix)),
+	}
+
+	if val := os.Getenv(env.Var(prefix, envBuckets)); val != "" {
+		buckets, err := parseBuckets(val)
+		if err != nil {
+			return FactoryOptions{}, fmt.Errorf("%s: %s", env.Var(prefix, envBuckets), err)
+		}
+		opts.Buckets = buckets
+	}
+
+	return opts, nil
+}
+
+// bucketsFlag implements flag.Value for histogram buckets.
+type bucketsFlag struct {
+	buckets *[]float64
+}
+
+func (f *bucketsFlag) String() string {
+	if f.buckets == nil {
+		return ""
+	}
+
+	items := make([]string, len(*f.buckets))
+	for i, b := range *f.buckets {
+		items[i] = strconv.FormatFloat(b, 'f', -1, 64)
+	}
+
+	return strings.Join(items, ",")
+}
+
+func (f *bucketsFlag) Set(val string) error {
+	buckets, err := parseBuckets(val)
+	if err != nil {
+		return err
+	}
+
+	*f.buckets = buckets
+	return nil
+}
+
+// BindFlags defines command-line flags for factory options in a flag set.
+// The current values of options are used as the default values for flags,
+// so flags can override the options read from environment variables.
+// The following flags are defined:
+//   -metrics-prefix, -metrics-buckets
+func (o *FactoryOptions) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Prefix, "metrics-prefix", o.Prefix, "prefix for metric names")
+	fs.Var(&bucketsFlag{&o.Buckets}, "metrics-buckets", "comma-separated histogram buckets in increasing order")
+}
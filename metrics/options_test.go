@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		name            string
+		val             string
+		expectedBuckets []float64
+		expectedError   string
+	}{
+		{"Valid", "0.01, 0.1,1,10", []float64{0.01, 0.1, 1, 10}, ""},
+		{"Empty", " , ", nil, `no bucket: " , "`},
+		{"InvalidBucket", "0.1,one", nil, `invalid bucket: "one"`},
+		{"NotIncreasing", "1,0.5", nil, `buckets not in increasing order: "1,0.5"`},
+		{"Duplicate", "1,1", nil, `buckets not in increasing order: "1,1"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buckets, err := parseBuckets(tc.val)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedBuckets, buckets)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		env           map[string]string
+		expectedOpts  FactoryOptions
+		expectedError string
+	}{
+		{
+			name:         "NoEnv",
+			env:          map[string]string{},
+			expectedOpts: FactoryOptions{},
+		},
+		{
+			name: "AllEnv",
+			env: map[string]string{
+				"METRICS_PREFIX":  "service",
+				"METRICS_BUCKETS": "0.1,0.5,1",
+			},
+			expectedOpts: FactoryOptions{
+				Prefix:  "service",
+				Buckets: []float64{0.1, 0.5, 1},
+			},
+		},
+		{
+			name:   "WithPrefix",
+			prefix: "app",
+			env: map[string]string{
+				"APP_METRICS_PREFIX": "service",
+			},
+			expectedOpts: FactoryOptions{
+				Prefix: "service",
+			},
+		},
+		{
+			name: "InvalidBuckets",
+			env: map[string]string{
+				"METRICS_BUCKETS": "1,0.5",
+			},
+			expectedError: `METRICS_BUCKETS: buckets not in increasing order: "1,0.5"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			opts, err := OptionsFromEnv(tc.prefix)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, opts)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestFactoryOptionsBindFlags(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          FactoryOptions
+		args          []string
+		expectedOpts  FactoryOptions
+		expectedError bool
+	}{
+		{
+			name:         "NoFlag",
+			opts:         FactoryOptions{Prefix: "service"},
+			args:         []string{},
+			expectedOpts: FactoryOptions{Prefix: "service"},
+		},
+		{
+			name: "AllFlags",
+			opts: FactoryOptions{Prefix: "service", Buckets: []float64{1, 2}},
+			args: []string{"-metrics-prefix", "api", "-metrics-buckets", "0.1,1,10"},
+			expectedOpts: FactoryOptions{
+				Prefix:  "api",
+				Buckets: []float64{0.1, 1, 10},
+			},
+		},
+		{
+			name:          "InvalidBuckets",
+			args:          []string{"-metrics-buckets", "10,1"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			tc.opts.BindFlags(fs)
+
+			err := fs.Parse(tc.args)
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, tc.opts)
+			}
+		})
+	}
+}
+
+func TestBucketsFlag(t *testing.T) {
+	assert.Equal(t, "", (&bucketsFlag{}).String())
+
+	buckets := []float64{0.01, 0.5, 5}
+	assert.Equal(t, "0.01,0.5,5", (&bucketsFlag{&buckets}).String())
+}
@@ -0,0 +1,213 @@
+// Package observe provides a unified shutdown for logging, metrics, and tracing.
+// Shutdown hooks are run in a fixed order, so nothing is lost when a service is terminated.
+package observe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/trace"
+)
+
+// Phase determines the order in which shutdown hooks are run.
+type Phase int
+
+const (
+	// TracingPhase is the first phase for flushing pending spans.
+	// Flushing spans can produce logs and update metrics, so it comes first.
+	TracingPhase Phase = iota
+	// MetricsPhase is the second phase for pushing final metrics.
+	MetricsPhase
+	// LoggingPhase is the last phase for flushing buffered logs.
+	// Errors in the previous phases are logged using the registered loggers before logs are flushed.
+	LoggingPhase
+)
+
+// String returns the string representation of a phase.
+func (p Phase) String() string {
+	switch p {
+	case TracingPhase:
+		return "tracing"
+	case MetricsPhase:
+		return "metrics"
+	case LoggingPhase:
+		return "logging"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// Hook is a function called on shutdown.
+// It should return when its work is done or the context is done.
+type Hook func(context.Context) error
+
+// Pusher is implemented by metric pushers (i.e. *push.Pusher from Prometheus client).
+type Pusher interface {
+	Push() error
+}
+
+type hook struct {
+	phase Phase
+	name  string
+	f     Hook
+}
+
+// shutdownError is the error returned when one or more shutdown hooks fail.
+type shutdownError struct {
+	errs []string
+}
+
+func (e *shutdownError) Error() string {
+	return "shutdown failed: " + strings.Join(e.errs, "; ")
+}
+
+// Group is a group of shutdown hooks.
+// The zero value is ready to use.
+type Group struct {
+	sync.Mutex
+	hooks   []hook
+	loggers []*log.Logger
+	done    bool
+}
+
+// Register registers a hook to be called on shutdown in a given phase.
+// Hooks in the same phase are called in the order they are registered.
+func (g *Group) Register(phase Phase, name string, f Hook) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.hooks = append(g.hooks, hook{phase: phase, name: name, f: f})
+}
+
+// RegisterTracer registers a tracer closer returned by trace.NewTracer or trace.NewOTLPTracer.
+// If logger is not nil, the number of reported, flushed, and dropped spans are logged on shutdown.
+func (g *Group) RegisterTracer(closer io.Closer, logger *log.Logger) {
+	g.Register(TracingPhase, "tracer", func(ctx context.Context) error {
+		stats, err := trace.Shutdown(ctx, closer)
+		if logger != nil {
+			logger.InfoKV(
+				"message", "tracer shut down",
+				"reported", stats.Reported,
+				"flushed", stats.Flushed,
+				"dropped", stats.Dropped,
+			)
+		}
+		return err
+	})
+}
+
+// RegisterPusher registers a metric pusher for pushing final metrics on shutdown.
+func (g *Group) RegisterPusher(pusher Pusher) {
+	g.Register(MetricsPhase, "metrics", withContext(pusher.Push))
+}
+
+// RegisterLogger registers a logger for flushing its buffered logs on shutdown.
+// Errors in the tracing and metrics phases are logged using the registered loggers before they are flushed.
+func (g *Group) RegisterLogger(logger *log.Logger) {
+	g.Lock()
+	g.loggers = append(g.loggers, logger)
+	g.Unlock()
+
+	g.Register(LoggingPhase, "logger", withContext(logger.Sync))
+}
+
+// withContext creates a hook from a function not accepting a context.
+// The hook returns when the function returns or the context is done.
+func withContext(f func() error) Hook {
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- f()
+		}()
+
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Shutdown calls all registered hooks phase by phase within the deadline of a context.
+// All hooks are called even if some of them fail. Once the context is done, the remaining hooks are skipped.
+// Errors in the tracing and metrics phases are logged using the registered loggers before the logging phase.
+// Hooks are called only once and subsequent calls to Shutdown do nothing.
+// Hooks are called without holding the lock, so they can register other hooks (which will not be called).
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.Lock()
+	if g.done {
+		g.Unlock()
+		return nil
+	}
+	g.done = true
+	hooks := append([]hook(nil), g.hooks...)
+	loggers := append([]*log.Logger(nil), g.loggers...)
+	g.Unlock()
+
+	var errs []string
+
+	for _, phase := range []Phase{TracingPhase, MetricsPhase, LoggingPhase} {
+		if phase == LoggingPhase {
+			for _, logger := range loggers {
+				for _, err := range errs {
+					logger.ErrorKV("message", "shutdown failed", "error", err)
+				}
+			}
+		}
+
+		for _, h := range hooks {
+			if h.phase != phase {
+				continue
+			}
+
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", h.name, err))
+				continue
+			}
+
+			if err := h.f(ctx); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", h.name, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &shutdownError{errs: errs}
+	}
+
+	return nil
+}
+
+// The default group.
+var group = new(Group)
+
+// Register registers a hook to be called by Shutdown in a given phase.
+func Register(phase Phase, name string, f Hook) {
+	group.Register(phase, name, f)
+}
+
+// RegisterTracer registers a tracer closer to be shut down by Shutdown.
+func RegisterTracer(closer io.Closer, logger *log.Logger) {
+	group.RegisterTracer(closer, logger)
+}
+
+// RegisterPusher registers a metric pusher for pushing final metrics by Shutdown.
+func RegisterPusher(pusher Pusher) {
+	group.RegisterPusher(pusher)
+}
+
+// RegisterLogger registers a logger to be flushed by Shutdown.
+func RegisterLogger(logger *log.Logger) {
+	group.RegisterLogger(logger)
+}
+
+// Shutdown flushes pending spans, pushes final metrics, and flushes buffered logs in order
+// within the deadline of a context. It is meant to be called once when a service receives SIGTERM.
+func Shutdown(ctx context.Context) error {
+	return group.Shutdown(ctx)
+}
@@ -0,0 +1,178 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/log/logtest"
+	"github.com/moorara/observe/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPusher struct {
+	calls        *[]string
+	PushOutError error
+}
+
+func (m *mockPusher) Push() error {
+	*m.calls = append(*m.calls, "metrics")
+	return m.PushOutError
+}
+
+type syncWriter struct {
+	bytes.Buffer
+	calls *[]string
+}
+
+func (w *syncWriter) Sync() error {
+	*w.calls = append(*w.calls, "logger")
+	return nil
+}
+
+func TestPhaseString(t *testing.T) {
+	tests := []struct {
+		phase          Phase
+		expectedString string
+	}{
+		{TracingPhase, "tracing"},
+		{MetricsPhase, "metrics"},
+		{LoggingPhase, "logging"},
+		{Phase(-1), "Phase(-1)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expectedString, func(t *testing.T) {
+			assert.Equal(t, tc.expectedString, tc.phase.String())
+		})
+	}
+}
+
+func TestGroupShutdown(t *testing.T) {
+	t.Run("Order", func(t *testing.T) {
+		calls := []string{}
+		record := func(name string) Hook {
+			return func(context.Context) error {
+				calls = append(calls, name)
+				return nil
+			}
+		}
+
+		g := new(Group)
+		g.RegisterLogger(log.NewLogger(log.Options{Writer: &syncWriter{calls: &calls}}))
+		g.RegisterPusher(&mockPusher{calls: &calls})
+		g.Register(TracingPhase, "tracer", record("tracer"))
+		g.Register(LoggingPhase, "other", record("other"))
+
+		assert.NoError(t, g.Shutdown(context.Background()))
+		assert.Equal(t, []string{"tracer", "metrics", "logger", "other"}, calls)
+
+		// Hooks are called only once
+		assert.NoError(t, g.Shutdown(context.Background()))
+		assert.Len(t, calls, 4)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		calls := []string{}
+
+		g := new(Group)
+		g.Register(TracingPhase, "tracer", func(context.Context) error {
+			return errors.New("connection refused")
+		})
+		g.RegisterPusher(&mockPusher{calls: &calls, PushOutError: errors.New("push failed")})
+		g.RegisterLogger(log.NewLogger(log.Options{Writer: &syncWriter{calls: &calls}}))
+
+		err := g.Shutdown(context.Background())
+		assert.EqualError(t, err, "shutdown failed: tracer: connection refused; metrics: push failed")
+		assert.Equal(t, []string{"metrics", "logger"}, calls)
+	})
+
+	t.Run("ErrorsLogged", func(t *testing.T) {
+		logger, logs := logtest.New()
+
+		g := new(Group)
+		g.Register(TracingPhase, "tracer", func(context.Context) error {
+			return errors.New("connection refused")
+		})
+		g.RegisterLogger(logger)
+
+		err := g.Shutdown(context.Background())
+		assert.EqualError(t, err, "shutdown failed: tracer: connection refused")
+		logs.AssertLogged(t, log.ErrorLevel, "shutdown failed", "error", "tracer: connection refused")
+	})
+
+	t.Run("Reentrant", func(t *testing.T) {
+		calls := []string{}
+
+		g := new(Group)
+		g.Register(TracingPhase, "tracer", func(ctx context.Context) error {
+			g.Register(MetricsPhase, "late", func(context.Context) error {
+				calls = append(calls, "late")
+				return nil
+			})
+			calls = append(calls, "tracer")
+			return g.Shutdown(ctx)
+		})
+
+		assert.NoError(t, g.Shutdown(context.Background()))
+		assert.Equal(t, []string{"tracer"}, calls)
+	})
+
+	t.Run("DeadlineExceeded", func(t *testing.T) {
+		called := false
+
+		g := new(Group)
+		g.RegisterPusher(pusherFunc(func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}))
+		g.Register(LoggingPhase, "logger", func(context.Context) error {
+			called = true
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := g.Shutdown(ctx)
+		assert.EqualError(t, err, "shutdown failed: metrics: context deadline exceeded; logger: context deadline exceeded")
+		assert.False(t, called)
+	})
+
+	t.Run("Tracer", func(t *testing.T) {
+		logger, logs := logtest.New()
+		tracer, closer, err := trace.NewTracer(trace.Options{
+			LogReporter: &trace.LogReporterOptions{Logger: log.NewVoidLogger()},
+		})
+		assert.NoError(t, err)
+
+		tracer.StartSpan("hello-world").Finish()
+
+		g := new(Group)
+		g.RegisterTracer(closer, logger)
+		assert.NoError(t, g.Shutdown(context.Background()))
+
+		logs.AssertLogged(t, log.InfoLevel, "tracer shut down", "reported", 1, "flushed", 1, "dropped", 0)
+	})
+}
+
+type pusherFunc func() error
+
+func (f pusherFunc) Push() error {
+	return f()
+}
+
+func TestShutdown(t *testing.T) {
+	called := false
+	Register(MetricsPhase, "metrics", func(context.Context) error {
+		called = true
+		return nil
+	})
+	RegisterLogger(log.NewVoidLogger())
+
+	assert.NoError(t, Shutdown(context.Background()))
+	assert.True(t, called)
+}
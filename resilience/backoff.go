@@ -0,0 +1,74 @@
+// Package resilience provides exponential backoff, circuit breakers, and concurrency limits in a protocol-agnostic way.
+package resilience
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultInitial    = 100 * time.Millisecond
+	defaultMax        = 10 * time.Second
+	defaultMultiplier = 2
+)
+
+// Backoff is an exponential backoff with jitter.
+//   Initial is the base delay before the first retry (default 100ms).
+//   Max is the maximum base delay between retries (default 10s).
+//   Multiplier is the factor by which the base delay grows after each retry (default 2).
+// Each delay is randomly chosen between half of the base delay and the base delay (equal jitter),
+// so clients retrying at the same time do not overload a recovering server.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// base returns the base delay before a retry.
+func (b Backoff) base(retry int) time.Duration {
+	initial, max, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = defaultInitial
+	}
+	if max <= 0 {
+		max = defaultMax
+	}
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if d > float64(max) {
+		return max
+	}
+
+	return time.Duration(d)
+}
+
+// Delay returns a random delay before a retry (starting from 1).
+func (b Backoff) Delay(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	d := b.base(retry)
+	half := d / 2
+
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Wait waits for a delay or until a context is done.
+// If the context is done before the delay, the context error will be returned.
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		backoff      Backoff
+		retry        int
+		expectedBase time.Duration
+	}{
+		{"Defaults", Backoff{}, 1, 100 * time.Millisecond},
+		{"DefaultsSecondRetry", Backoff{}, 2, 200 * time.Millisecond},
+		{"DefaultsMax", Backoff{}, 20, 10 * time.Second},
+		{"InvalidRetry", Backoff{}, 0, 100 * time.Millisecond},
+		{"Custom", Backoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 3}, 2, 3 * time.Second},
+		{"CustomMax", Backoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 3}, 3, 5 * time.Second},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				d := tc.backoff.Delay(tc.retry)
+				assert.True(t, d >= tc.expectedBase/2, "delay %s is less than half of %s", d, tc.expectedBase)
+				assert.True(t, d <= tc.expectedBase, "delay %s is greater than %s", d, tc.expectedBase)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name          string
+		ctxTimeout    time.Duration
+		delay         time.Duration
+		expectedError error
+	}{
+		{"Delay", time.Second, 10 * time.Millisecond, nil},
+		{"ContextDone", 10 * time.Millisecond, time.Second, context.DeadlineExceeded},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tc.ctxTimeout)
+			defer cancel()
+
+			err := Wait(ctx, tc.delay)
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
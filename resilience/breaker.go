@@ -0,0 +1,251 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+// ErrOpen is the error returned when a circuit breaker does not allow a request.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed is the state in which all requests are allowed.
+	Closed State = iota
+	// HalfOpen is the state in which a limited number of trial requests are allowed.
+	HalfOpen
+	// Open is the state in which no request is allowed.
+	Open
+)
+
+// String returns the string representation of a state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// BreakerOptions contains options for circuit breakers.
+//   FailureThreshold is the number of consecutive failures after which the breaker opens (default 5).
+//   OpenTimeout is the duration the breaker stays open before allowing trial requests (default 30s).
+//   HalfOpenRequests is the number of trial requests allowed and the number of successes required for closing the breaker (default 1).
+//   OnStateChange is called when the state of the breaker changes.
+type BreakerOptions struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	OnStateChange    func(from, to State)
+}
+
+// Breaker is a circuit breaker.
+// It opens after a number of consecutive failures and rejects requests until a timeout passes.
+// Then, it allows a number of trial requests and closes if they all succeed or opens again if any of them fails.
+// Every state change starts a new generation, and results of requests allowed in previous generations are ignored.
+type Breaker struct {
+	sync.Mutex
+	opts       BreakerOptions
+	now        func() time.Time
+	state      State
+	generation uint64
+	failures   int
+	successes  int
+	trials     int
+	openedAt   time.Time
+}
+
+// NewBreaker creates a new circuit breaker in the closed state.
+func NewBreaker(opts BreakerOptions) *Breaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultOpenTimeout
+	}
+
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	return &Breaker{
+		opts:  opts,
+		now:   time.Now,
+		state: Closed,
+	}
+}
+
+// setState changes the state of the breaker and returns a function for notifying the change.
+// The notification should be called after the lock is released.
+func (b *Breaker) setState(to State) func() {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.failures, b.successes, b.trials = 0, 0, 0
+
+	if to == Open {
+		b.openedAt = b.now()
+	}
+
+	if b.opts.OnStateChange == nil {
+		return func() {}
+	}
+
+	return func() {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.state
+}
+
+// Allow determines whether or not a request is allowed.
+// If the request is allowed, the generation of the breaker is returned.
+// The result of the request should be recorded using Record or the request should be released using Cancel with this generation.
+// If the request is not allowed, ErrOpen will be returned.
+func (b *Breaker) Allow() (uint64, error) {
+	notify := func() {}
+	defer func() {
+		notify()
+	}()
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.opts.OpenTimeout {
+			return 0, ErrOpen
+		}
+		notify = b.setState(HalfOpen)
+	}
+
+	if b.state == HalfOpen {
+		if b.trials >= b.opts.HalfOpenRequests {
+			return 0, ErrOpen
+		}
+		b.trials++
+	}
+
+	return b.generation, nil
+}
+
+// Record records the result of an allowed request with the generation returned by Allow.
+// Results of requests allowed before the last state change are ignored (i.e. a request allowed in the closed state
+// finishing after the breaker becomes half-open is not a trial request).
+func (b *Breaker) Record(generation uint64, success bool) {
+	notify := func() {}
+	defer func() {
+		notify()
+	}()
+
+	b.Lock()
+	defer b.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case Closed:
+		if success {
+			b.failures = 0
+			return
+		}
+
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			notify = b.setState(Open)
+		}
+
+	case HalfOpen:
+		if !success {
+			notify = b.setState(Open)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			notify = b.setState(Closed)
+		}
+	}
+}
+
+// Cancel releases an allowed request with the generation returned by Allow without recording its result
+// (i.e. the request is cancelled by the caller).
+// A cancelled trial request in the half-open state does not change the state and frees its slot for another trial.
+func (b *Breaker) Cancel(generation uint64) {
+	b.Lock()
+	defer b.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	if b.state == HalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// Breakers is a set of circuit breakers created on demand by keys (i.e. hosts or targets).
+type Breakers struct {
+	sync.Mutex
+	opts          BreakerOptions
+	onStateChange func(key string, from, to State)
+	breakers      map[string]*Breaker
+}
+
+// NewBreakers creates a new set of circuit breakers with the same options.
+// If onStateChange is not nil, it is called with the key of a breaker when its state changes.
+func NewBreakers(opts BreakerOptions, onStateChange func(key string, from, to State)) *Breakers {
+	return &Breakers{
+		opts:          opts,
+		onStateChange: onStateChange,
+		breakers:      map[string]*Breaker{},
+	}
+}
+
+// Get returns the circuit breaker for a key.
+func (b *Breakers) Get(key string) *Breaker {
+	b.Lock()
+	defer b.Unlock()
+
+	if breaker, ok := b.breakers[key]; ok {
+		return breaker
+	}
+
+	opts := b.opts
+	opts.OnStateChange = func(from, to State) {
+		if b.opts.OnStateChange != nil {
+			b.opts.OnStateChange(from, to)
+		}
+		if b.onStateChange != nil {
+			b.onStateChange(key, from, to)
+		}
+	}
+
+	breaker := NewBreaker(opts)
+	b.breakers[key] = breaker
+
+	return breaker
+}
@@ -0,0 +1,214 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type transition struct {
+	from, to State
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", Closed.String())
+	assert.Equal(t, "half-open", HalfOpen.String())
+	assert.Equal(t, "open", Open.String())
+	assert.Equal(t, "State(10)", State(10).String())
+}
+
+func TestNewBreaker(t *testing.T) {
+	tests := []struct {
+		name                     string
+		opts                     BreakerOptions
+		expectedFailureThreshold int
+		expectedOpenTimeout      time.Duration
+		expectedHalfOpenRequests int
+	}{
+		{"Defaults", BreakerOptions{}, 5, 30 * time.Second, 1},
+		{"WithOptions", BreakerOptions{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenRequests: 2}, 3, time.Minute, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBreaker(tc.opts)
+
+			assert.Equal(t, Closed, b.State())
+			assert.Equal(t, tc.expectedFailureThreshold, b.opts.FailureThreshold)
+			assert.Equal(t, tc.expectedOpenTimeout, b.opts.OpenTimeout)
+			assert.Equal(t, tc.expectedHalfOpenRequests, b.opts.HalfOpenRequests)
+		})
+	}
+}
+
+// allow calls Allow and fails the test if the request is not allowed.
+func allow(t *testing.T, b *Breaker) uint64 {
+	generation, err := b.Allow()
+	assert.NoError(t, err)
+	return generation
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	transitions := []transition{}
+
+	b := NewBreaker(BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 2,
+		OnStateChange: func(from, to State) {
+			transitions = append(transitions, transition{from, to})
+		},
+	})
+	b.now = func() time.Time { return now }
+
+	// Successes reset consecutive failures
+	b.Record(allow(t, b), false)
+	b.Record(allow(t, b), true)
+	b.Record(allow(t, b), false)
+	assert.Equal(t, Closed, b.State())
+
+	// Consecutive failures open the breaker
+	b.Record(allow(t, b), false)
+	assert.Equal(t, Open, b.State())
+	_, err := b.Allow()
+	assert.Equal(t, ErrOpen, err)
+
+	// Trial requests are allowed after the timeout
+	now = now.Add(time.Minute)
+	g1 := allow(t, b)
+	assert.Equal(t, HalfOpen, b.State())
+	g2 := allow(t, b)
+	_, err = b.Allow()
+	assert.Equal(t, ErrOpen, err)
+
+	// A failed trial request opens the breaker again
+	b.Record(g1, true)
+	b.Record(g2, false)
+	assert.Equal(t, Open, b.State())
+	_, err = b.Allow()
+	assert.Equal(t, ErrOpen, err)
+
+	// Successful trial requests close the breaker
+	now = now.Add(time.Minute)
+	g1 = allow(t, b)
+	g2 = allow(t, b)
+	b.Record(g1, true)
+	b.Record(g2, true)
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []transition{
+		{Closed, Open},
+		{Open, HalfOpen},
+		{HalfOpen, Open},
+		{Open, HalfOpen},
+		{HalfOpen, Closed},
+	}, transitions)
+}
+
+func TestBreakerGenerations(t *testing.T) {
+	now := time.Now()
+
+	b := NewBreaker(BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 1,
+	})
+	b.now = func() time.Time { return now }
+
+	// Requests allowed in the closed state
+	slow1 := allow(t, b)
+	slow2 := allow(t, b)
+	slow3 := allow(t, b)
+	b.Record(allow(t, b), false)
+	assert.Equal(t, Open, b.State())
+
+	// Late results in the open state are ignored
+	b.Record(slow1, true)
+	assert.Equal(t, Open, b.State())
+
+	// Late results in the half-open state are not trial results
+	now = now.Add(time.Minute)
+	trial := allow(t, b)
+	assert.Equal(t, HalfOpen, b.State())
+
+	b.Record(slow2, true)
+	assert.Equal(t, HalfOpen, b.State())
+	b.Record(slow3, false)
+	assert.Equal(t, HalfOpen, b.State())
+
+	// Late cancellations do not free the slot of the trial request
+	b.Cancel(slow1)
+	_, err := b.Allow()
+	assert.Equal(t, ErrOpen, err)
+
+	// Only the trial request closes the breaker
+	b.Record(trial, true)
+	assert.Equal(t, Closed, b.State())
+
+	// Results of the trial generation are ignored after the breaker closes
+	b.Record(trial, false)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerCancel(t *testing.T) {
+	now := time.Now()
+
+	b := NewBreaker(BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 1,
+	})
+	b.now = func() time.Time { return now }
+
+	// Cancelled requests in the closed state are ignored
+	b.Cancel(allow(t, b))
+	assert.Equal(t, Closed, b.State())
+
+	b.Record(allow(t, b), false)
+	assert.Equal(t, Open, b.State())
+
+	// A cancelled trial request keeps the breaker half-open and frees its slot
+	now = now.Add(time.Minute)
+	g := allow(t, b)
+	_, err := b.Allow()
+	assert.Equal(t, ErrOpen, err)
+	b.Cancel(g)
+	assert.Equal(t, HalfOpen, b.State())
+
+	g = allow(t, b)
+	b.Cancel(g)
+	b.Cancel(g)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.Equal(t, 0, b.trials)
+}
+
+func TestBreakers(t *testing.T) {
+	optTransitions := []transition{}
+	keys := []string{}
+
+	b := NewBreakers(
+		BreakerOptions{
+			FailureThreshold: 1,
+			OnStateChange: func(from, to State) {
+				optTransitions = append(optTransitions, transition{from, to})
+			},
+		},
+		func(key string, from, to State) {
+			keys = append(keys, key)
+		},
+	)
+
+	b1 := b.Get("users-service:8080")
+	b2 := b.Get("orders-service:8080")
+	assert.True(t, b1 == b.Get("users-service:8080"))
+	assert.False(t, b1 == b2)
+
+	b2.Record(allow(t, b2), false)
+	assert.Equal(t, Closed, b1.State())
+	assert.Equal(t, Open, b2.State())
+
+	assert.Equal(t, []transition{{Closed, Open}}, optTransitions)
+	assert.Equal(t, []string{"orders-service:8080"}, keys)
+}
@@ -0,0 +1,291 @@
+package resilience
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+	defaultBackoffRatio = 0.9
+	defaultSmoothing    = 0.2
+	defaultTolerance    = 2
+)
+
+// Limit is an algorithm for determining the maximum number of concurrent requests.
+type Limit interface {
+	// Limit returns the current limit.
+	Limit() int
+	// Update updates the limit by a sample of a finished request.
+	// rtt is the duration of the request, inFlight is the number of in-flight requests when the request was started,
+	// and dropped determines whether or not the request was dropped (i.e. timed out or failed due to overload).
+	Update(rtt time.Duration, inFlight int, dropped bool)
+}
+
+// FixedLimit is a static limit.
+type FixedLimit int
+
+// Limit returns the static limit.
+func (l FixedLimit) Limit() int {
+	return int(l)
+}
+
+// Update does nothing since the limit is static.
+func (l FixedLimit) Update(time.Duration, int, bool) {}
+
+// AIMDOptions contains options for AIMD limits.
+//   Initial is the initial limit (default 20).
+//   Min is the minimum limit (default 1).
+//   Max is the maximum limit (default 1000).
+//   BackoffRatio is the factor by which the limit decreases after a drop (default 0.9).
+//   Timeout is the duration after which a request is considered dropped (default none).
+type AIMDOptions struct {
+	Initial      int
+	Min          int
+	Max          int
+	BackoffRatio float64
+	Timeout      time.Duration
+}
+
+// AIMDLimit is an adaptive limit using additive increase and multiplicative decrease.
+// The limit increases by one when requests succeed while the limit is in use
+// and decreases by the backoff ratio when requests are dropped or take longer than the timeout.
+type AIMDLimit struct {
+	sync.Mutex
+	opts  AIMDOptions
+	limit int
+}
+
+// NewAIMDLimit creates a new AIMD limit.
+func NewAIMDLimit(opts AIMDOptions) *AIMDLimit {
+	opts.Min, opts.Max = limitBounds(opts.Min, opts.Max)
+	opts.Initial = initialLimit(opts.Initial, opts.Min, opts.Max)
+
+	if opts.BackoffRatio <= 0 || opts.BackoffRatio >= 1 {
+		opts.BackoffRatio = defaultBackoffRatio
+	}
+
+	return &AIMDLimit{
+		opts:  opts,
+		limit: opts.Initial,
+	}
+}
+
+// Limit returns the current limit.
+func (l *AIMDLimit) Limit() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.limit
+}
+
+// Update updates the limit by a sample of a finished request.
+func (l *AIMDLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	if dropped || (l.opts.Timeout > 0 && rtt > l.opts.Timeout) {
+		l.limit = int(float64(l.limit) * l.opts.BackoffRatio)
+		if l.limit < l.opts.Min {
+			l.limit = l.opts.Min
+		}
+		return
+	}
+
+	// The limit only increases when it is in use (not limited by the application)
+	if inFlight*2 >= l.limit && l.limit < l.opts.Max {
+		l.limit++
+	}
+}
+
+// GradientOptions contains options for gradient limits.
+//   Initial is the initial limit (default 20).
+//   Min is the minimum limit (default 1).
+//   Max is the maximum limit (default 1000).
+//   Smoothing is the factor by which the limit moves towards a new limit (default 0.2).
+//   Tolerance is the ratio of the short-term latency to the long-term latency tolerated before decreasing the limit (default 2).
+type GradientOptions struct {
+	Initial   int
+	Min       int
+	Max       int
+	Smoothing float64
+	Tolerance float64
+}
+
+// GradientLimit is an adaptive limit based on the gradient of latency.
+// It compares the latency of every request to an exponentially weighted average of latencies.
+// The limit decreases when latency grows (requests are queuing) and increases by the square root of the limit otherwise.
+type GradientLimit struct {
+	sync.Mutex
+	opts    GradientOptions
+	limit   float64
+	longRTT float64
+	samples int
+}
+
+// NewGradientLimit creates a new gradient limit.
+func NewGradientLimit(opts GradientOptions) *GradientLimit {
+	opts.Min, opts.Max = limitBounds(opts.Min, opts.Max)
+	opts.Initial = initialLimit(opts.Initial, opts.Min, opts.Max)
+
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = defaultSmoothing
+	}
+
+	if opts.Tolerance < 1 {
+		opts.Tolerance = defaultTolerance
+	}
+
+	return &GradientLimit{
+		opts:  opts,
+		limit: float64(opts.Initial),
+	}
+}
+
+// Limit returns the current limit.
+func (l *GradientLimit) Limit() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return int(l.limit)
+}
+
+// Update updates the limit by a sample of a finished request.
+func (l *GradientLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	shortRTT := float64(rtt)
+	if shortRTT <= 0 {
+		return
+	}
+
+	// The long-term latency is averaged over about 100 samples
+	l.samples++
+	if l.samples == 1 {
+		l.longRTT = shortRTT
+	} else {
+		n := math.Min(float64(l.samples), 100)
+		l.longRTT += (shortRTT - l.longRTT) / n
+	}
+
+	// The limit does not increase when it is not in use (limited by the application)
+	if !dropped && float64(inFlight)*2 < l.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*l.longRTT/shortRTT))
+	if dropped {
+		gradient = 0.5
+	}
+
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	newLimit = l.limit*(1-l.opts.Smoothing) + newLimit*l.opts.Smoothing
+	l.limit = math.Max(float64(l.opts.Min), math.Min(float64(l.opts.Max), newLimit))
+}
+
+// Outcome is the outcome of a request released by a limiter.
+type Outcome int
+
+const (
+	// Succeeded is the outcome of requests completed normally.
+	Succeeded Outcome = iota
+	// Dropped is the outcome of requests timed out or failed due to overload.
+	Dropped
+	// Ignored is the outcome of requests that say nothing about the load (i.e. cancelled by clients).
+	// The slots of these requests are released without updating the limit.
+	Ignored
+)
+
+// Limiter limits the number of concurrent requests by a limit.
+type Limiter struct {
+	sync.Mutex
+	limit    Limit
+	inFlight int
+}
+
+// NewLimiter creates a new limiter.
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit: limit,
+	}
+}
+
+// Limit returns the current limit.
+func (l *Limiter) Limit() int {
+	return l.limit.Limit()
+}
+
+// InFlight returns the number of in-flight requests.
+func (l *Limiter) InFlight() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.inFlight
+}
+
+// Acquire acquires a slot for a request if the number of in-flight requests is below the limit.
+// If a slot is acquired, the returned function should be called with the outcome of the request when it is finished
+// to release the slot. If no slot is available, false will be returned and the request should be rejected.
+func (l *Limiter) Acquire() (func(Outcome), bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.inFlight >= l.limit.Limit() {
+		return nil, false
+	}
+
+	l.inFlight++
+	inFlight := l.inFlight
+	start := time.Now()
+
+	var once sync.Once
+	release := func(outcome Outcome) {
+		once.Do(func() {
+			l.Lock()
+			l.inFlight--
+			l.Unlock()
+
+			if outcome != Ignored {
+				l.limit.Update(time.Since(start), inFlight, outcome == Dropped)
+			}
+		})
+	}
+
+	return release, true
+}
+
+func limitBounds(min, max int) (int, int) {
+	if min <= 0 {
+		min = defaultMinLimit
+	}
+
+	if max <= 0 {
+		max = defaultMaxLimit
+	}
+
+	if max < min {
+		max = min
+	}
+
+	return min, max
+}
+
+func initialLimit(initial, min, max int) int {
+	if initial <= 0 {
+		initial = defaultInitialLimit
+	}
+
+	if initial < min {
+		return min
+	}
+
+	if initial > max {
+		return max
+	}
+
+	return initial
+}
@@ -0,0 +1,192 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedLimit(t *testing.T) {
+	l := FixedLimit(10)
+	assert.Equal(t, 10, l.Limit())
+
+	l.Update(time.Second, 10, true)
+	assert.Equal(t, 10, l.Limit())
+}
+
+func TestNewAIMDLimit(t *testing.T) {
+	tests := []struct {
+		name                 string
+		opts                 AIMDOptions
+		expectedOpts         AIMDOptions
+		expectedInitialLimit int
+	}{
+		{
+			"Defaults",
+			AIMDOptions{},
+			AIMDOptions{Initial: 20, Min: 1, Max: 1000, BackoffRatio: 0.9},
+			20,
+		},
+		{
+			"InitialAboveMax",
+			AIMDOptions{Initial: 100, Min: 5, Max: 50, BackoffRatio: 0.5, Timeout: time.Second},
+			AIMDOptions{Initial: 50, Min: 5, Max: 50, BackoffRatio: 0.5, Timeout: time.Second},
+			50,
+		},
+		{
+			"MaxBelowMin",
+			AIMDOptions{Min: 10, Max: 5},
+			AIMDOptions{Initial: 20, Min: 10, Max: 10, BackoffRatio: 0.9},
+			10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewAIMDLimit(tc.opts)
+
+			assert.Equal(t, tc.expectedInitialLimit, l.Limit())
+			tc.expectedOpts.Initial = tc.expectedInitialLimit
+			assert.Equal(t, tc.expectedOpts, l.opts)
+		})
+	}
+}
+
+func TestAIMDLimitUpdate(t *testing.T) {
+	l := NewAIMDLimit(AIMDOptions{Initial: 10, Min: 5, Max: 12, Timeout: time.Second})
+
+	// The limit does not increase when it is not in use
+	l.Update(10*time.Millisecond, 2, false)
+	assert.Equal(t, 10, l.Limit())
+
+	// The limit increases additively up to the maximum
+	l.Update(10*time.Millisecond, 8, false)
+	assert.Equal(t, 11, l.Limit())
+	l.Update(10*time.Millisecond, 8, false)
+	l.Update(10*time.Millisecond, 8, false)
+	assert.Equal(t, 12, l.Limit())
+
+	// The limit decreases multiplicatively down to the minimum
+	l.Update(10*time.Millisecond, 8, true)
+	assert.Equal(t, 10, l.Limit())
+	l.Update(2*time.Second, 8, false)
+	assert.Equal(t, 9, l.Limit())
+	for i := 0; i < 10; i++ {
+		l.Update(10*time.Millisecond, 8, true)
+	}
+	assert.Equal(t, 5, l.Limit())
+}
+
+func TestNewGradientLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         GradientOptions
+		expectedOpts GradientOptions
+	}{
+		{
+			"Defaults",
+			GradientOptions{},
+			GradientOptions{Initial: 20, Min: 1, Max: 1000, Smoothing: 0.2, Tolerance: 2},
+		},
+		{
+			"WithOptions",
+			GradientOptions{Initial: 50, Min: 10, Max: 100, Smoothing: 0.5, Tolerance: 1.5},
+			GradientOptions{Initial: 50, Min: 10, Max: 100, Smoothing: 0.5, Tolerance: 1.5},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewGradientLimit(tc.opts)
+
+			assert.Equal(t, tc.expectedOpts.Initial, l.Limit())
+			assert.Equal(t, tc.expectedOpts, l.opts)
+		})
+	}
+}
+
+func TestGradientLimitUpdate(t *testing.T) {
+	l := NewGradientLimit(GradientOptions{Initial: 20, Min: 5, Max: 100})
+
+	// Invalid samples are ignored
+	l.Update(0, 20, false)
+	assert.Equal(t, 20, l.Limit())
+	assert.Equal(t, 0, l.samples)
+
+	// The limit does not change when it is not in use
+	l.Update(10*time.Millisecond, 2, false)
+	assert.Equal(t, 20, l.Limit())
+
+	// The limit increases while latency is stable
+	for i := 0; i < 20; i++ {
+		l.Update(10*time.Millisecond, l.Limit(), false)
+	}
+	increased := l.Limit()
+	assert.True(t, increased > 20)
+
+	// The limit decreases when latency grows
+	for i := 0; i < 20; i++ {
+		l.Update(time.Second, l.Limit(), false)
+	}
+	decreased := l.Limit()
+	assert.True(t, decreased < increased)
+
+	// The limit decreases when requests are dropped down to the minimum
+	for i := 0; i < 100; i++ {
+		l.Update(10*time.Millisecond, 1, true)
+	}
+	assert.Equal(t, 5, l.Limit())
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(FixedLimit(2))
+	assert.Equal(t, 2, l.Limit())
+	assert.Equal(t, 0, l.InFlight())
+
+	release1, ok := l.Acquire()
+	assert.True(t, ok)
+	release2, ok := l.Acquire()
+	assert.True(t, ok)
+	assert.Equal(t, 2, l.InFlight())
+
+	_, ok = l.Acquire()
+	assert.False(t, ok)
+
+	// Releasing more than once has no effect
+	release1(Succeeded)
+	release1(Succeeded)
+	assert.Equal(t, 1, l.InFlight())
+
+	release3, ok := l.Acquire()
+	assert.True(t, ok)
+
+	release2(Succeeded)
+	release3(Dropped)
+	assert.Equal(t, 0, l.InFlight())
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		outcome       Outcome
+		expectedLimit int
+	}{
+		{"Succeeded", Succeeded, 3},
+		{"Dropped", Dropped, 1},
+		{"Ignored", Ignored, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(NewAIMDLimit(AIMDOptions{Initial: 2}))
+
+			release, ok := l.Acquire()
+			assert.True(t, ok)
+			release(tc.outcome)
+
+			assert.Equal(t, tc.expectedLimit, l.Limit())
+			assert.Equal(t, 0, l.InFlight())
+		})
+	}
+}
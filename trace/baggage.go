@@ -0,0 +1,156 @@
+package trace
+
+import (
+	"context"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/moorara/observe/metrics"
+)
+
+const (
+	baggageFieldPrefix = "baggage."
+	baggageLabelPrefix = "baggage_"
+	baggageLabelLimit  = 100
+)
+
+// SetBaggage sets a baggage item on the span in a context.
+// Baggage items are propagated to all downstream spans of the trace.
+// It returns false if there is no span in the context.
+func SetBaggage(ctx context.Context, key, val string) bool {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return false
+	}
+
+	span.SetBaggageItem(key, val)
+	return true
+}
+
+// Baggage returns a baggage item from the span in a context.
+// It returns an empty string if there is no span in the context or the item is not set.
+// The W3C tracestate carried along a trace is not a baggage item.
+func Baggage(ctx context.Context, key string) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil || key == tracestateBaggageKey {
+		return ""
+	}
+
+	return span.BaggageItem(key)
+}
+
+// BaggageItems returns the baggage items of a span context.
+// If keys are given, only the items with those keys are returned.
+// Keys are compared case-insensitively since some propagation formats do not preserve the case.
+// The W3C tracestate carried along a trace is not a baggage item.
+func BaggageItems(spanCtx opentracing.SpanContext, keys ...string) map[string]string {
+	items := map[string]string{}
+	if spanCtx == nil {
+		return items
+	}
+
+	allowed := map[string]string{}
+	for _, key := range keys {
+		allowed[strings.ToLower(key)] = key
+	}
+
+	spanCtx.ForeachBaggageItem(func(k, v string) bool {
+		if k == tracestateBaggageKey {
+			return true
+		} else if len(keys) == 0 {
+			items[k] = v
+		} else if key, ok := allowed[strings.ToLower(k)]; ok {
+			items[key] = v
+		}
+		return true
+	})
+
+	return items
+}
+
+// promotedItem is a baggage item promoted to span tags, log fields, and metric labels.
+type promotedItem struct {
+	key     string
+	label   string
+	limiter *metrics.LabelLimiter
+}
+
+// BaggagePromoter promotes selected baggage items to span tags, log fields, and metric labels.
+// Items are promoted as baggage.<key> span tags and log fields and as baggage_<key> metric labels.
+// Metric label values are bounded by a label limiter per item, since baggage items come from requests.
+// The zero value promotes no baggage items.
+type BaggagePromoter struct {
+	items []promotedItem
+}
+
+// Add adds the baggage items with the given keys to the promoted items.
+func (p *BaggagePromoter) Add(keys ...string) {
+	for _, key := range keys {
+		p.items = append(p.items, promotedItem{
+			key:     key,
+			label:   metrics.LabelName(baggageLabelPrefix + key),
+			limiter: metrics.NewLabelLimiter(baggageLabelLimit),
+		})
+	}
+}
+
+// Len returns the number of promoted baggage items.
+func (p *BaggagePromoter) Len() int {
+	return len(p.items)
+}
+
+// Labels returns the metric label names for promoted baggage items.
+func (p *BaggagePromoter) Labels() []string {
+	labels := make([]string, len(p.items))
+	for i, item := range p.items {
+		labels[i] = item.label
+	}
+
+	return labels
+}
+
+// Items returns the promoted baggage items of a span context.
+func (p *BaggagePromoter) Items(spanCtx opentracing.SpanContext) map[string]string {
+	if len(p.items) == 0 {
+		return map[string]string{}
+	}
+
+	keys := make([]string, len(p.items))
+	for i, item := range p.items {
+		keys[i] = item.key
+	}
+
+	return BaggageItems(spanCtx, keys...)
+}
+
+// LabelValues returns the metric label values for promoted baggage items in the same order as Labels.
+func (p *BaggagePromoter) LabelValues(items map[string]string) []string {
+	values := make([]string, len(p.items))
+	for i, item := range p.items {
+		values[i] = item.limiter.Value(items[item.key])
+	}
+
+	return values
+}
+
+// Fields returns the log fields (key-value pairs) for promoted baggage items that are set.
+func (p *BaggagePromoter) Fields(items map[string]string) []interface{} {
+	var kv []interface{}
+	for _, item := range p.items {
+		if val, ok := items[item.key]; ok {
+			kv = append(kv, baggageFieldPrefix+item.key, val)
+		}
+	}
+
+	return kv
+}
+
+// SetTags sets the span tags for promoted baggage items that are set.
+func (p *BaggagePromoter) SetTags(span opentracing.Span, items map[string]string) {
+	for _, item := range p.items {
+		if val, ok := items[item.key]; ok {
+			span.SetTag(baggageFieldPrefix+item.key, val)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/moorara/observe/metrics"
+)
+
+func TestSetBaggage(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	assert.False(t, SetBaggage(context.Background(), "tenant", "acme"))
+	assert.True(t, SetBaggage(ctx, "tenant", "acme"))
+	assert.Equal(t, "acme", span.BaggageItem("tenant"))
+
+	// Baggage items are inherited by child spans
+	child := tracer.StartSpan("child", opentracing.ChildOf(span.Context()))
+	assert.Equal(t, "acme", child.BaggageItem("tenant"))
+}
+
+func TestBaggage(t *testing.T) {
+	span := mocktracer.New().StartSpan("test")
+	span.SetBaggageItem("tenant", "acme")
+	span.SetBaggageItem(tracestateBaggageKey, "vendor=value")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	assert.Equal(t, "", Baggage(context.Background(), "tenant"))
+	assert.Equal(t, "", Baggage(ctx, "user"))
+	assert.Equal(t, "", Baggage(ctx, tracestateBaggageKey))
+	assert.Equal(t, "acme", Baggage(ctx, "tenant"))
+}
+
+func TestBaggageItems(t *testing.T) {
+	span := mocktracer.New().StartSpan("test")
+	span.SetBaggageItem("tenant", "acme")
+	span.SetBaggageItem("user", "jane")
+	span.SetBaggageItem(tracestateBaggageKey, "vendor=value")
+
+	tests := []struct {
+		name          string
+		spanCtx       opentracing.SpanContext
+		keys          []string
+		expectedItems map[string]string
+	}{
+		{
+			name:          "NoSpanContext",
+			spanCtx:       nil,
+			expectedItems: map[string]string{},
+		},
+		{
+			name:    "AllItems",
+			spanCtx: span.Context(),
+			expectedItems: map[string]string{
+				"tenant": "acme",
+				"user":   "jane",
+			},
+		},
+		{
+			name:    "AllowedItems",
+			spanCtx: span.Context(),
+			keys:    []string{"Tenant", "region"},
+			expectedItems: map[string]string{
+				"Tenant": "acme",
+			},
+		},
+		{
+			name:          "TraceState",
+			spanCtx:       span.Context(),
+			keys:          []string{tracestateBaggageKey},
+			expectedItems: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			items := BaggageItems(tc.spanCtx, tc.keys...)
+			assert.Equal(t, tc.expectedItems, items)
+		})
+	}
+}
+
+func TestBaggagePromoter(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test")
+	span.SetBaggageItem("tenant", "acme")
+	span.SetBaggageItem("user", "jane")
+
+	tests := []struct {
+		name                string
+		keys                []string
+		spanCtx             opentracing.SpanContext
+		expectedLen         int
+		expectedLabels      []string
+		expectedItems       map[string]string
+		expectedLabelValues []string
+		expectedFields      []interface{}
+	}{
+		{
+			name:                "NoItems",
+			keys:                nil,
+			spanCtx:             span.Context(),
+			expectedLen:         0,
+			expectedLabels:      []string{},
+			expectedItems:       map[string]string{},
+			expectedLabelValues: []string{},
+			expectedFields:      nil,
+		},
+		{
+			name:                "NoSpanContext",
+			keys:                []string{"tenant", "user-id"},
+			spanCtx:             nil,
+			expectedLen:         2,
+			expectedLabels:      []string{"baggage_tenant", "baggage_user_id"},
+			expectedItems:       map[string]string{},
+			expectedLabelValues: []string{"", ""},
+			expectedFields:      nil,
+		},
+		{
+			name:                "PromotedItems",
+			keys:                []string{"tenant", "region"},
+			spanCtx:             span.Context(),
+			expectedLen:         2,
+			expectedLabels:      []string{"baggage_tenant", "baggage_region"},
+			expectedItems:       map[string]string{"tenant": "acme"},
+			expectedLabelValues: []string{"acme", ""},
+			expectedFields:      []interface{}{"baggage.tenant", "acme"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var p BaggagePromoter
+			p.Add(tc.keys...)
+
+			assert.Equal(t, tc.expectedLen, p.Len())
+			assert.Equal(t, tc.expectedLabels, p.Labels())
+
+			items := p.Items(tc.spanCtx)
+			assert.Equal(t, tc.expectedItems, items)
+			assert.Equal(t, tc.expectedLabelValues, p.LabelValues(items))
+			assert.Equal(t, tc.expectedFields, p.Fields(items))
+
+			s := tracer.StartSpan("promoted").(*mocktracer.MockSpan)
+			p.SetTags(s, items)
+			for _, key := range tc.keys {
+				if val, ok := tc.expectedItems[key]; ok {
+					assert.Equal(t, val, s.Tag("baggage."+key))
+				} else {
+					assert.Nil(t, s.Tag("baggage."+key))
+				}
+			}
+		})
+	}
+}
+
+func TestBaggagePromoterLabelLimit(t *testing.T) {
+	var p BaggagePromoter
+	p.Add("tenant")
+
+	for i := 0; i < baggageLabelLimit; i++ {
+		val := fmt.Sprintf("tenant-%d", i)
+		assert.Equal(t, []string{val}, p.LabelValues(map[string]string{"tenant": val}))
+	}
+
+	assert.Equal(t, []string{metrics.OverflowLabelValue}, p.LabelValues(map[string]string{"tenant": "new"}))
+	assert.Equal(t, []string{"tenant-0"}, p.LabelValues(map[string]string{"tenant": "tenant-0"}))
+}
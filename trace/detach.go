@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/request"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// Detach creates a new context for background work that outlives a request (i.e. a goroutine or an async job).
+// The new context is not cancelled when the given context is cancelled and has no deadline.
+// It holds the request id and the logger of the given context and a new span following from the span in the given context.
+// The returned function finishes the span and should be deferred with a pointer to the returned error of the caller.
+//
+//   go func(ctx context.Context) (err error) {
+//     ctx, finish := trace.Detach(ctx, "send-email")
+//     defer finish(&err)
+//     ...
+//   }(ctx)
+func Detach(ctx context.Context, name string, opts ...SpanOption) (context.Context, func(*error)) {
+	detached := context.Background()
+
+	if requestID, ok := request.IDFromContext(ctx); ok {
+		detached = request.ContextWithID(detached, requestID)
+	}
+
+	detached = log.ContextWithLogger(detached, log.LoggerFromContext(ctx))
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		opts = append([]SpanOption{WithTracer(span.Tracer()), followsFrom(span.Context())}, opts...)
+	}
+
+	return Start(detached, name, opts...)
+}
+
+// Carrier is a serializable carrier for propagating a trace and a request id through a queue.
+// It can be encoded as JSON and sent along with a job, so the consumer can resume the trace.
+type Carrier struct {
+	RequestID string            `json:"requestId,omitempty"`
+	Span      map[string]string `json:"span,omitempty"`
+}
+
+// Inject creates a carrier from the span and the request id in a context.
+// The span context is injected using the text map format of the tracer of the span.
+func Inject(ctx context.Context) Carrier {
+	c := Carrier{}
+
+	if requestID, ok := request.IDFromContext(ctx); ok {
+		c.RequestID = requestID
+	}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		m := opentracing.TextMapCarrier{}
+		if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, m); err == nil && len(m) > 0 {
+			c.Span = m
+		}
+	}
+
+	return c
+}
+
+// Resume creates a new span following from the span context in a carrier on the consumer side of a queue.
+// The returned context holds the new span, the request id from the carrier, and a logger with the request id.
+// If the carrier does not have a valid span context, the new span will be a child of the span in the context (if any).
+// By default, the tracer of the span in the context is used and if there is no span, the global tracer is used.
+// The returned function finishes the span and should be deferred with a pointer to the returned error of the caller.
+func Resume(ctx context.Context, c Carrier, name string, opts ...SpanOption) (context.Context, func(*error)) {
+	o := &spanOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	tracer := o.tracer
+	if tracer == nil {
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			tracer = span.Tracer()
+		}
+	}
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+
+	if c.RequestID != "" {
+		ctx = request.ContextWithID(ctx, c.RequestID)
+		ctx = log.ContextWithLogger(ctx, log.LoggerFromContext(ctx).With("requestId", c.RequestID))
+	}
+
+	opts = append([]SpanOption{WithTracer(tracer)}, opts...)
+	if len(c.Span) > 0 {
+		if spanCtx, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(c.Span)); err == nil {
+			opts = append(opts, followsFrom(spanCtx))
+		}
+	}
+
+	return Start(ctx, name, opts...)
+}
@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/log/logtest"
+	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/trace/tracetest"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestDetach(t *testing.T) {
+	t.Run("WithSpan", func(t *testing.T) {
+		ctx, rec, finishParent := tracetest.ContextForTest(context.Background(), "handle")
+		ctx = request.ContextWithID(ctx, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+		logger, logs := logtest.New()
+		ctx = log.ContextWithLogger(ctx, logger)
+
+		ctx, cancel := context.WithCancel(ctx)
+		detached, finish := Detach(ctx, "send-email")
+		cancel()
+		finishParent()
+
+		assert.NoError(t, detached.Err())
+		assert.Nil(t, detached.Done())
+		_, ok := detached.Deadline()
+		assert.False(t, ok)
+
+		requestID, ok := request.IDFromContext(detached)
+		assert.True(t, ok)
+		assert.Equal(t, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", requestID)
+
+		log.LoggerFromContext(detached).Info("sending")
+		err := errors.New("smtp error")
+		finish(&err)
+
+		rec.AssertChildOf(t, "send-email", "handle")
+		rec.AssertSpan(t, "send-email", "requestId", "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+		rec.AssertError(t, "send-email")
+		logs.AssertLogged(t, log.InfoLevel, "sending", "operation", "send-email")
+	})
+
+	t.Run("FollowsFrom", func(t *testing.T) {
+		reporter := jaeger.NewInMemoryReporter()
+		tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+		defer closer.Close()
+
+		span := tracer.StartSpan("handle")
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+		_, finish := Detach(ctx, "send-email")
+		finish(nil)
+		span.Finish()
+
+		spans := reporter.GetSpans()
+		assert.Len(t, spans, 2)
+		refs := spans[0].(*jaeger.Span).References()
+		assert.Len(t, refs, 1)
+		assert.Equal(t, opentracing.FollowsFromRef, refs[0].Type)
+		assert.Equal(t, span.Context(), refs[0].ReferencedContext)
+	})
+
+	t.Run("WithoutSpan", func(t *testing.T) {
+		tracer, rec := tracetest.New()
+
+		_, finish := Detach(context.Background(), "send-email", WithTracer(tracer))
+		finish(nil)
+
+		rec.AssertSpan(t, "send-email")
+		assert.Len(t, rec.Roots(), 1)
+	})
+}
+
+func TestCarrier(t *testing.T) {
+	tests := []struct {
+		name         string
+		carrier      Carrier
+		expectedJSON string
+	}{
+		{
+			name:         "Empty",
+			carrier:      Carrier{},
+			expectedJSON: `{}`,
+		},
+		{
+			name: "Full",
+			carrier: Carrier{
+				RequestID: "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+				Span:      map[string]string{"uber-trace-id": "1:1:0:1"},
+			},
+			expectedJSON: `{"requestId":"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa","span":{"uber-trace-id":"1:1:0:1"}}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.carrier)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expectedJSON, string(b))
+
+			var c Carrier
+			assert.NoError(t, json.Unmarshal(b, &c))
+			assert.Equal(t, tc.carrier, c)
+		})
+	}
+}
+
+func TestInjectResume(t *testing.T) {
+	t.Run("Producer", func(t *testing.T) {
+		tracer, rec := tracetest.New()
+		span := tracer.StartSpan("enqueue")
+		span.SetBaggageItem("tenant", "acme")
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+		ctx = request.ContextWithID(ctx, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+
+		carrier := Inject(ctx)
+		span.Finish()
+		assert.Equal(t, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", carrier.RequestID)
+		assert.NotEmpty(t, carrier.Span)
+
+		b, err := json.Marshal(carrier)
+		assert.NoError(t, err)
+
+		var c Carrier
+		assert.NoError(t, json.Unmarshal(b, &c))
+
+		logger, logs := logtest.New()
+		consumerCtx := log.ContextWithLogger(context.Background(), logger)
+
+		consumerCtx, finish := Resume(consumerCtx, c, "process", WithTracer(tracer))
+		assert.Equal(t, "acme", Baggage(consumerCtx, "tenant"))
+		log.LoggerFromContext(consumerCtx).Info("processing")
+		finish(nil)
+
+		rec.AssertChildOf(t, "process", "enqueue")
+		rec.AssertSpan(t, "process", "requestId", "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+		logs.AssertLogged(t, log.InfoLevel, "processing", "requestId", "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa", "operation", "process")
+	})
+
+	t.Run("NoSpan", func(t *testing.T) {
+		carrier := Inject(context.Background())
+		assert.Equal(t, Carrier{}, carrier)
+
+		tracer, rec := tracetest.New()
+		_, finish := Resume(context.Background(), carrier, "process", WithTracer(tracer))
+		finish(nil)
+
+		rec.AssertSpan(t, "process")
+		assert.Len(t, rec.Roots(), 1)
+	})
+
+	t.Run("InvalidSpan", func(t *testing.T) {
+		ctx, rec, finishParent := tracetest.ContextForTest(context.Background(), "consume")
+		carrier := Carrier{Span: map[string]string{"mockpfx-ids-traceid": "invalid"}}
+
+		_, finish := Resume(ctx, carrier, "process")
+		finish(nil)
+		finishParent()
+
+		rec.AssertChildOf(t, "process", "consume")
+	})
+}
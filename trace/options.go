@@ -0,0 +1,320 @@
+package trace
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/uber/jaeger-client-go"
+	jconfig "github.com/uber/jaeger-client-go/config"
+
+	"github.com/moorara/observe/internal/env"
+)
+
+const (
+	envName          = "TRACE_NAME"
+	envSamplerType   = "TRACE_SAMPLER_TYPE"
+	envSamplerParam  = "TRACE_SAMPLER_PARAM"
+	envAgentAddr     = "TRACE_AGENT_ADDR"
+	envCollectorAddr = "TRACE_COLLECTOR_ADDR"
+	envPropagation   = "TRACE_PROPAGATION"
+)
+
+// validateSamplerType returns an error if a sampler type is not supported.
+// Sampler types are case-insensitive.
+func validateSamplerType(samplerType string) error {
+	switch strings.ToLower(samplerType) {
+	case jaeger.SamplerTypeConst, jaeger.SamplerTypeProbabilistic, jaeger.SamplerTypeRateLimiting, jaeger.SamplerTypeRemote:
+		return nil
+	default:
+		return fmt.Errorf("invalid sampler type: %q", samplerType)
+	}
+}
+
+// validateSampler returns an error if the type or the parameter of a sampler is not valid.
+func validateSampler(sampler *jconfig.SamplerConfig) error {
+	if err := validateSamplerType(sampler.Type); err != nil {
+		return err
+	}
+
+	param := sampler.Param
+
+	switch strings.ToLower(sampler.Type) {
+	case jaeger.SamplerTypeConst:
+		if param != 0 && param != 1 {
+			return fmt.Errorf("invalid const sampler param: %v", param)
+		}
+	case jaeger.SamplerTypeProbabilistic:
+		if param < 0 || param > 1 {
+			return fmt.Errorf("invalid probabilistic sampler param: %v", param)
+		}
+	case jaeger.SamplerTypeRateLimiting:
+		if param < 0 {
+			return fmt.Errorf("invalid rate limiting sampler param: %v", param)
+		}
+	default:
+		if param < 0 || param > 1 {
+			return fmt.Errorf("invalid remote sampler param: %v", param)
+		}
+	}
+
+	return nil
+}
+
+// newSampler creates a Jaeger sampler for a sampler type and a parameter.
+func newSampler(samplerType string, param float64) (*jconfig.SamplerConfig, error) {
+	if err := validateSampler(&jconfig.SamplerConfig{Type: samplerType, Param: param}); err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(samplerType) {
+	case jaeger.SamplerTypeConst:
+		return NewConstSampler(param == 1), nil
+	case jaeger.SamplerTypeProbabilistic:
+		return NewProbabilisticSampler(param), nil
+	case jaeger.SamplerTypeRateLimiting:
+		return NewRateLimitingSampler(param), nil
+	default:
+		return NewRemoteSampler(param, "", 0), nil
+	}
+}
+
+// Validate returns an error if the sampler is not valid or both agent and collector addresses are set.
+// It should be called after parsing the flags defined by BindFlags.
+func (o Options) Validate() error {
+	if o.Sampler != nil {
+		if err := validateSampler(o.Sampler); err != nil {
+			return err
+		}
+	}
+
+	if o.Reporter != nil && o.Reporter.LocalAgentHostPort != "" && o.Reporter.CollectorEndpoint != "" {
+		return errors.New("only one of agent and collector addresses can be set")
+	}
+
+	return nil
+}
+
+// OptionsFromEnv creates tracer options from environment variables.
+// The following environment variables are read if set:
+//   TRACE_NAME, TRACE_SAMPLER_TYPE, TRACE_SAMPLER_PARAM, TRACE_AGENT_ADDR, TRACE_COLLECTOR_ADDR, TRACE_PROPAGATION
+// If prefix is not empty, it will be prepended to the variable names (i.e. prefix "app" reads APP_TRACE_NAME).
+// An error will be returned if the sampler or the propagation is not valid or both agent and collector addresses are set.
+func OptionsFromEnv(prefix string) (Options, error) {
+	opts := Options{
+		Name: os.Getenv(env.Var(prefix, envName)),
+	}
+
+	samplerType := os.Getenv(env.Var(prefix, envSamplerType))
+	samplerParam := os.Getenv(env.Var(prefix, envSamplerParam))
+
+	if samplerType != "" || samplerParam != "" {
+		if samplerType == "" {
+			return Options{}, fmt.Errorf("%s: sampler type is required", env.Var(prefix, envSamplerType))
+		}
+
+		// Sample all traces by default
+		param := 1.0
+		if samplerParam != "" {
+			var err error
+			if param, err = strconv.ParseFloat(samplerParam, 64); err != nil {
+				return Options{}, fmt.Errorf("%s: invalid sampler param: %q", env.Var(prefix, envSamplerParam), samplerParam)
+			}
+		}
+
+		sampler, err := newSampler(samplerType, param)
+		if err != nil {
+			return Options{}, fmt.Errorf("%s: %s", env.Var(prefix, envSamplerType), err)
+		}
+
+		opts.Sampler = sampler
+	}
+
+	agentAddr := os.Getenv(env.Var(prefix, envAgentAddr))
+	collectorAddr := os.Getenv(env.Var(prefix, envCollectorAddr))
+
+	switch {
+	case agentAddr != "" && collectorAddr != "":
+		return Options{}, fmt.Errorf("only one of %s and %s can be set", env.Var(prefix, envAgentAddr), env.Var(prefix, envCollectorAddr))
+	case agentAddr != "":
+		opts.Reporter = NewAgentReporter(agentAddr, false)
+	case collectorAddr != "":
+		opts.Reporter = NewCollectorReporter(collectorAddr, false)
+	}
+
+	if val := os.Getenv(env.Var(prefix, envPropagation)); val != "" {
+		propagator, err := ParsePropagator(val)
+		if err != nil {
+			return Options{}, fmt.Errorf("%s: %s", env.Var(prefix, envPropagation), err)
+		}
+		opts.Propagator = propagator
+	}
+
+	if err := opts.Validate(); err != nil {
+		return Options{}, err
+	}
+
+	return opts, nil
+}
+
+// samplerTypeFlag implements flag.Value for the sampler type.
+type samplerTypeFlag struct {
+	opts *Options
+}
+
+func (f *samplerTypeFlag) String() string {
+	if f.opts == nil || f.opts.Sampler == nil {
+		return ""
+	}
+
+	return f.opts.Sampler.Type
+}
+
+func (f *samplerTypeFlag) Set(val string) error {
+	if err := validateSamplerType(val); err != nil {
+		return err
+	}
+
+	if f.opts.Sampler == nil {
+		f.opts.Sampler = NewConstSampler(true)
+	}
+
+	f.opts.Sampler.Type = val
+	return nil
+}
+
+// samplerParamFlag implements flag.Value for the sampler parameter.
+type samplerParamFlag struct {
+	opts *Options
+}
+
+func (f *samplerParamFlag) String() string {
+	if f.opts == nil || f.opts.Sampler == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(f.opts.Sampler.Param, 'f', -1, 64)
+}
+
+func (f *samplerParamFlag) Set(val string) error {
+	param, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sampler param: %q", val)
+	}
+
+	if f.opts.Sampler == nil {
+		f.opts.Sampler = NewConstSampler(true)
+	}
+
+	f.opts.Sampler.Param = param
+	return nil
+}
+
+// addrFlags keeps track of the Jaeger agent and collector addresses set by flags.
+// An address set by a flag overrides the other address set before (i.e. from environment variables),
+// but both addresses cannot be set by flags.
+type addrFlags struct {
+	agent     bool
+	collector bool
+}
+
+// agentAddrFlag implements flag.Value for the Jaeger agent address.
+type agentAddrFlag struct {
+	opts  *Options
+	addrs *addrFlags
+}
+
+func (f *agentAddrFlag) String() string {
+	if f.opts == nil || f.opts.Reporter == nil {
+		return ""
+	}
+
+	return f.opts.Reporter.LocalAgentHostPort
+}
+
+func (f *agentAddrFlag) Set(val string) error {
+	if f.addrs.collector {
+		return errors.New("only one of agent and collector addresses can be set")
+	}
+
+	if f.opts.Reporter == nil {
+		f.opts.Reporter = &jconfig.ReporterConfig{}
+	}
+
+	f.opts.Reporter.LocalAgentHostPort = val
+	f.opts.Reporter.CollectorEndpoint = ""
+	f.addrs.agent = true
+	return nil
+}
+
+// collectorAddrFlag implements flag.Value for the Jaeger collector address.
+type collectorAddrFlag struct {
+	opts  *Options
+	addrs *addrFlags
+}
+
+func (f *collectorAddrFlag) String() string {
+	if f.opts == nil || f.opts.Reporter == nil {
+		return ""
+	}
+
+	return f.opts.Reporter.CollectorEndpoint
+}
+
+func (f *collectorAddrFlag) Set(val string) error {
+	if f.addrs.agent {
+		return errors.New("only one of agent and collector addresses can be set")
+	}
+
+	if f.opts.Reporter == nil {
+		f.opts.Reporter = &jconfig.ReporterConfig{}
+	}
+
+	f.opts.Reporter.CollectorEndpoint = val
+	f.opts.Reporter.LocalAgentHostPort = ""
+	f.addrs.collector = true
+	return nil
+}
+
+// propagationFlag implements flag.Value for the propagation.
+type propagationFlag struct {
+	opts *Options
+	spec string
+}
+
+func (f *propagationFlag) String() string {
+	return f.spec
+}
+
+func (f *propagationFlag) Set(val string) error {
+	propagator, err := ParsePropagator(val)
+	if err != nil {
+		return err
+	}
+
+	f.opts.Propagator = propagator
+	f.spec = val
+	return nil
+}
+
+// BindFlags defines command-line flags for tracer options in a flag set.
+// The current values of options are used as the default values for flags,
+// so flags can override the options read from environment variables.
+// The following flags are defined:
+//   -trace-name, -trace-sampler-type, -trace-sampler-param, -trace-agent-addr, -trace-collector-addr, -trace-propagation
+// An address set by a flag overrides the other address read from environment variables,
+// but parsing fails if both agent and collector addresses are set by flags.
+// Since the sampler type and parameter can be set in any order, Validate should be called after parsing the flags.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	addrs := new(addrFlags)
+
+	fs.StringVar(&o.Name, "trace-name", o.Name, "tracer (service) name")
+	fs.Var(&samplerTypeFlag{o}, "trace-sampler-type", "sampler type (const, probabilistic, rateLimiting, or remote)")
+	fs.Var(&samplerParamFlag{o}, "trace-sampler-param", "sampler parameter")
+	fs.Var(&agentAddrFlag{o, addrs}, "trace-agent-addr", "address of Jaeger agent")
+	fs.Var(&collectorAddrFlag{o, addrs}, "trace-collector-addr", "address of Jaeger collector")
+	fs.Var(&propagationFlag{opts: o}, "trace-propagation", "comma-separated propagators (jaeger, w3c, b3, or b3multi)")
+}
@@ -0,0 +1,359 @@
+package trace
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	jconfig "github.com/uber/jaeger-client-go/config"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name            string
+		samplerType     string
+		param           float64
+		expectedSampler *jconfig.SamplerConfig
+		expectedError   string
+	}{
+		{"Const", "const", 1, NewConstSampler(true), ""},
+		{"ConstInvalid", "const", 0.5, nil, "invalid const sampler param: 0.5"},
+		{"Probabilistic", "probabilistic", 0.1, NewProbabilisticSampler(0.1), ""},
+		{"ProbabilisticInvalid", "probabilistic", 2, nil, "invalid probabilistic sampler param: 2"},
+		{"RateLimiting", "rateLimiting", 10, NewRateLimitingSampler(10), ""},
+		{"RateLimitingInvalid", "rateLimiting", -1, nil, "invalid rate limiting sampler param: -1"},
+		{"Remote", "remote", 0.5, NewRemoteSampler(0.5, "", 0), ""},
+		{"RemoteInvalid", "remote", 5, nil, "invalid remote sampler param: 5"},
+		{"InvalidType", "adaptive", 1, nil, `invalid sampler type: "adaptive"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sampler, err := newSampler(tc.samplerType, tc.param)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedSampler, sampler)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		env           map[string]string
+		expectedOpts  Options
+		expectedError string
+	}{
+		{
+			name:         "NoEnv",
+			env:          map[string]string{},
+			expectedOpts: Options{},
+		},
+		{
+			name: "AgentReporter",
+			env: map[string]string{
+				"TRACE_NAME":          "service",
+				"TRACE_SAMPLER_TYPE":  "probabilistic",
+				"TRACE_SAMPLER_PARAM": "0.25",
+				"TRACE_AGENT_ADDR":    "jaeger-agent:6831",
+			},
+			expectedOpts: Options{
+				Name:     "service",
+				Sampler:  NewProbabilisticSampler(0.25),
+				Reporter: NewAgentReporter("jaeger-agent:6831", false),
+			},
+		},
+		{
+			name:   "CollectorReporter",
+			prefix: "app",
+			env: map[string]string{
+				"APP_TRACE_NAME":           "service",
+				"APP_TRACE_SAMPLER_TYPE":   "const",
+				"APP_TRACE_COLLECTOR_ADDR": "http://jaeger-collector:14268/api/traces",
+			},
+			expectedOpts: Options{
+				Name:     "service",
+				Sampler:  NewConstSampler(true),
+				Reporter: NewCollectorReporter("http://jaeger-collector:14268/api/traces", false),
+			},
+		},
+		{
+			name: "Propagation",
+			env: map[string]string{
+				"TRACE_PROPAGATION": "w3c,b3",
+			},
+			expectedOpts: Options{
+				Propagator: NewCompositePropagator(NewW3CPropagator(), NewB3SinglePropagator()),
+			},
+		},
+		{
+			name: "InvalidPropagation",
+			env: map[string]string{
+				"TRACE_PROPAGATION": "w3c,zipkin",
+			},
+			expectedError: `TRACE_PROPAGATION: invalid propagator: "zipkin"`,
+		},
+		{
+			name: "MissingSamplerType",
+			env: map[string]string{
+				"TRACE_SAMPLER_PARAM": "0.5",
+			},
+			expectedError: "TRACE_SAMPLER_TYPE: sampler type is required",
+		},
+		{
+			name: "InvalidSamplerType",
+			env: map[string]string{
+				"TRACE_SAMPLER_TYPE": "adaptive",
+			},
+			expectedError: `TRACE_SAMPLER_TYPE: invalid sampler type: "adaptive"`,
+		},
+		{
+			name: "InvalidSamplerParam",
+			env: map[string]string{
+				"TRACE_SAMPLER_TYPE":  "probabilistic",
+				"TRACE_SAMPLER_PARAM": "half",
+			},
+			expectedError: `TRACE_SAMPLER_PARAM: invalid sampler param: "half"`,
+		},
+		{
+			name: "BothAddresses",
+			env: map[string]string{
+				"TRACE_AGENT_ADDR":     "jaeger-agent:6831",
+				"TRACE_COLLECTOR_ADDR": "http://jaeger-collector:14268/api/traces",
+			},
+			expectedError: "only one of TRACE_AGENT_ADDR and TRACE_COLLECTOR_ADDR can be set",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			opts, err := OptionsFromEnv(tc.prefix)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, opts)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestOptionsBindFlags(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		args          []string
+		expectedOpts  Options
+		expectedError bool
+	}{
+		{
+			name:         "NoFlag",
+			opts:         Options{Name: "service"},
+			args:         []string{},
+			expectedOpts: Options{Name: "service"},
+		},
+		{
+			name: "AllFlags",
+			opts: Options{Name: "service"},
+			args: []string{
+				"-trace-name", "api",
+				"-trace-sampler-type", "probabilistic",
+				"-trace-sampler-param", "0.5",
+				"-trace-agent-addr", "jaeger-agent:6831",
+			},
+			expectedOpts: Options{
+				Name:     "api",
+				Sampler:  NewProbabilisticSampler(0.5),
+				Reporter: NewAgentReporter("jaeger-agent:6831", false),
+			},
+		},
+		{
+			name: "ParamBeforeType",
+			args: []string{
+				"-trace-sampler-param", "0.5",
+				"-trace-sampler-type", "probabilistic",
+			},
+			expectedOpts: Options{
+				Sampler: NewProbabilisticSampler(0.5),
+			},
+		},
+		{
+			name: "OverrideAgent",
+			opts: Options{
+				Reporter: NewAgentReporter("jaeger-agent:6831", false),
+			},
+			args: []string{"-trace-collector-addr", "http://jaeger-collector:14268/api/traces"},
+			expectedOpts: Options{
+				Reporter: NewCollectorReporter("http://jaeger-collector:14268/api/traces", false),
+			},
+		},
+		{
+			name: "OverrideParam",
+			opts: Options{
+				Sampler: NewRateLimitingSampler(10),
+			},
+			args: []string{"-trace-sampler-param", "20"},
+			expectedOpts: Options{
+				Sampler: NewRateLimitingSampler(20),
+			},
+		},
+		{
+			name: "Propagation",
+			args: []string{"-trace-propagation", "b3multi"},
+			expectedOpts: Options{
+				Propagator: NewB3MultiPropagator(),
+			},
+		},
+		{
+			name:          "InvalidSamplerType",
+			args:          []string{"-trace-sampler-type", "adaptive"},
+			expectedError: true,
+		},
+		{
+			name:          "InvalidPropagation",
+			args:          []string{"-trace-propagation", "zipkin"},
+			expectedError: true,
+		},
+		{
+			name:          "InvalidSamplerParam",
+			args:          []string{"-trace-sampler-param", "half"},
+			expectedError: true,
+		},
+		{
+			name:          "InvalidConstSamplerParam",
+			args:          []string{"-trace-sampler-type", "const", "-trace-sampler-param", "0.5"},
+			expectedError: true,
+		},
+		{
+			name:          "InvalidProbabilisticSamplerParam",
+			args:          []string{"-trace-sampler-param", "2", "-trace-sampler-type", "probabilistic"},
+			expectedError: true,
+		},
+		{
+			name: "BothAddresses",
+			args: []string{
+				"-trace-agent-addr", "jaeger-agent:6831",
+				"-trace-collector-addr", "http://jaeger-collector:14268/api/traces",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			tc.opts.BindFlags(fs)
+
+			err := fs.Parse(tc.args)
+			if err == nil {
+				err = tc.opts.Validate()
+			}
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, tc.opts)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		expectedError string
+	}{
+		{
+			name: "Empty",
+			opts: Options{},
+		},
+		{
+			name: "Valid",
+			opts: Options{
+				Sampler:  NewRateLimitingSampler(10),
+				Reporter: NewCollectorReporter("http://jaeger-collector:14268/api/traces", false),
+			},
+		},
+		{
+			name:          "InvalidSamplerType",
+			opts:          Options{Sampler: &jconfig.SamplerConfig{Type: "adaptive"}},
+			expectedError: `invalid sampler type: "adaptive"`,
+		},
+		{
+			name:          "InvalidConstSamplerParam",
+			opts:          Options{Sampler: &jconfig.SamplerConfig{Type: "const", Param: 0.5}},
+			expectedError: "invalid const sampler param: 0.5",
+		},
+		{
+			name:          "InvalidProbabilisticSamplerParam",
+			opts:          Options{Sampler: &jconfig.SamplerConfig{Type: "probabilistic", Param: 2}},
+			expectedError: "invalid probabilistic sampler param: 2",
+		},
+		{
+			name:          "InvalidRateLimitingSamplerParam",
+			opts:          Options{Sampler: &jconfig.SamplerConfig{Type: "rateLimiting", Param: -1}},
+			expectedError: "invalid rate limiting sampler param: -1",
+		},
+		{
+			name:          "InvalidRemoteSamplerParam",
+			opts:          Options{Sampler: &jconfig.SamplerConfig{Type: "remote", Param: 2}},
+			expectedError: "invalid remote sampler param: 2",
+		},
+		{
+			name: "BothAddresses",
+			opts: Options{
+				Reporter: &jconfig.ReporterConfig{
+					LocalAgentHostPort: "jaeger-agent:6831",
+					CollectorEndpoint:  "http://jaeger-collector:14268/api/traces",
+				},
+			},
+			expectedError: "only one of agent and collector addresses can be set",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestFlagStrings(t *testing.T) {
+	opts := &Options{
+		Sampler:  NewProbabilisticSampler(0.5),
+		Reporter: &jconfig.ReporterConfig{LocalAgentHostPort: "localhost:6831", CollectorEndpoint: "http://localhost:14268"},
+	}
+
+	assert.Equal(t, "", (&samplerTypeFlag{}).String())
+	assert.Equal(t, "", (&samplerParamFlag{}).String())
+	assert.Equal(t, "", (&agentAddrFlag{}).String())
+	assert.Equal(t, "", (&collectorAddrFlag{}).String())
+
+	assert.Equal(t, "probabilistic", (&samplerTypeFlag{opts}).String())
+	assert.Equal(t, "0.5", (&samplerParamFlag{opts}).String())
+	assert.Equal(t, "localhost:6831", (&agentAddrFlag{opts: opts}).String())
+	assert.Equal(t, "http://localhost:14268", (&collectorAddrFlag{opts: opts}).String())
+	assert.Equal(t, "w3c", (&propagationFlag{opts: opts, spec: "w3c"}).String())
+}
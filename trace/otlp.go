@@ -0,0 +1,500 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/resilience"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	otlpLoggerName   = "otlp"
+	otlpExportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+	defaultOTLPHTTPEndpoint  = "http://localhost:4318/v1/traces"
+	defaultOTLPGRPCEndpoint  = "localhost:4317"
+	defaultOTLPTimeout       = 10 * time.Second
+	defaultOTLPQueueSize     = 2048
+	defaultOTLPBatchSize     = 512
+	defaultOTLPFlushInterval = 5 * time.Second
+	defaultOTLPMaxRetries    = 3
+	defaultOTLPRetryBackoff  = 100 * time.Millisecond
+)
+
+// OTLPProtocol is the transport protocol for exporting spans over OTLP.
+type OTLPProtocol int
+
+const (
+	// OTLPHTTP exports spans using OTLP/HTTP with protobuf encoding.
+	OTLPHTTP OTLPProtocol = iota
+	// OTLPGRPC exports spans using OTLP/gRPC.
+	OTLPGRPC
+)
+
+// String returns the name of an OTLP protocol.
+func (p OTLPProtocol) String() string {
+	switch p {
+	case OTLPHTTP:
+		return "http"
+	case OTLPGRPC:
+		return "grpc"
+	default:
+		return ""
+	}
+}
+
+// OTLPOptions contains optional options for exporting spans over OTLP.
+type OTLPOptions struct {
+	// Protocol is either OTLPHTTP (default) or OTLPGRPC.
+	Protocol OTLPProtocol
+	// Endpoint is the URL of the OTLP/HTTP receiver (default "http://localhost:4318/v1/traces")
+	// or the address of the OTLP/gRPC receiver (default "localhost:4317").
+	Endpoint string
+	// Headers are sent with every export request as HTTP headers or gRPC metadata.
+	Headers map[string]string
+	// Insecure disables TLS for the OTLP/gRPC protocol.
+	// For the OTLP/HTTP protocol, the scheme of the endpoint URL determines whether TLS is used.
+	Insecure bool
+	// Timeout is the timeout for each export request (default 10s).
+	Timeout time.Duration
+	// QueueSize is the maximum number of spans waiting to be exported (default 2048).
+	// Spans reported when the queue is full are dropped.
+	QueueSize int
+	// BatchSize is the maximum number of spans in an export request (default 512).
+	BatchSize int
+	// FlushInterval is the maximum time a span waits in the queue before being exported (default 5s).
+	FlushInterval time.Duration
+	// MaxRetries is the maximum number of times a failed export request is retried (default 3).
+	// A negative value disables retries.
+	MaxRetries int
+	// RetryBackoff is the initial backoff between retries and is doubled after each retry (default 100ms).
+	RetryBackoff time.Duration
+}
+
+func (o *OTLPOptions) setDefaults() {
+	if o.Endpoint == "" {
+		if o.Protocol == OTLPGRPC {
+			o.Endpoint = defaultOTLPGRPCEndpoint
+		} else {
+			o.Endpoint = defaultOTLPHTTPEndpoint
+		}
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = defaultOTLPTimeout
+	}
+
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultOTLPQueueSize
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultOTLPBatchSize
+	}
+
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultOTLPFlushInterval
+	}
+
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaultOTLPMaxRetries
+	}
+
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultOTLPRetryBackoff
+	}
+}
+
+// otlpError is an error returned by an OTLP receiver.
+type otlpError struct {
+	err       error
+	retryable bool
+}
+
+func (e *otlpError) Error() string {
+	return e.err.Error()
+}
+
+// isRetryable determines whether or not a failed export request can be retried.
+func isRetryable(err error) bool {
+	var e *otlpError
+	if errors.As(err, &e) {
+		return e.retryable
+	}
+
+	return false
+}
+
+// otlpExporter sends an encoded ExportTraceServiceRequest message to an OTLP receiver.
+type otlpExporter interface {
+	export(ctx context.Context, req []byte) error
+	close() error
+}
+
+// httpExporter exports spans using OTLP/HTTP.
+type httpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func newHTTPExporter(opts OTLPOptions) *httpExporter {
+	return &httpExporter{
+		endpoint: opts.Endpoint,
+		headers:  opts.Headers,
+		client:   &http.Client{},
+	}
+}
+
+func (e *httpExporter) export(ctx context.Context, req []byte) error {
+	r, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for key, val := range e.headers {
+		r.Header.Set(key, val)
+	}
+
+	resp, err := e.client.Do(r)
+	if err != nil {
+		// Network errors are retryable
+		return &otlpError{err: err, retryable: true}
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &otlpError{err: fmt.Errorf("otlp receiver responded with %d", resp.StatusCode), retryable: true}
+	default:
+		return &otlpError{err: fmt.Errorf("otlp receiver responded with %d", resp.StatusCode)}
+	}
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// rawCodec implements encoding.Codec for sending and receiving already encoded protobuf messages.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type: %T", v)
+	}
+
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type: %T", v)
+	}
+
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// grpcExporter exports spans using OTLP/gRPC.
+type grpcExporter struct {
+	headers map[string]string
+	conn    *grpc.ClientConn
+}
+
+func newGRPCExporter(opts OTLPOptions) (*grpcExporter, error) {
+	var credsOpt grpc.DialOption
+	if opts.Insecure {
+		credsOpt = grpc.WithInsecure()
+	} else {
+		credsOpt = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	}
+
+	// Dialing is non-blocking, so an unavailable receiver does not fail creating the tracer
+	conn, err := grpc.Dial(opts.Endpoint, credsOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcExporter{
+		headers: opts.Headers,
+		conn:    conn,
+	}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req []byte) error {
+	for key, val := range e.headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, key, val)
+	}
+
+	var resp []byte
+	err := e.conn.Invoke(ctx, otlpExportMethod, req, &resp, grpc.ForceCodec(rawCodec{}))
+	if err == nil {
+		return nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return &otlpError{err: err, retryable: true}
+	default:
+		return &otlpError{err: err}
+	}
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+// otlpReporter implements jaeger.Reporter.
+// Spans are encoded when reported and exported in batches by a background goroutine.
+// Export requests and waits between retries are cancelled when the reporter is aborted (i.e. a shutdown deadline is passed).
+type otlpReporter struct {
+	name     string
+	opts     OTLPOptions
+	exporter otlpExporter
+	logger   *log.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	resourceOnce sync.Once
+	resource     []byte
+
+	// The closed state is checked under the same lock as queueing spans,
+	// so no span is queued after the queue is drained by closing the reporter.
+	mutex   sync.RWMutex
+	queue   chan []byte
+	closed  bool
+	flushed uint64
+	dropped uint64
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+func newOTLPReporter(name string, opts OTLPOptions, exporter otlpExporter, logger *log.Logger) *otlpReporter {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &otlpReporter{
+		name:     name,
+		opts:     opts,
+		exporter: exporter,
+		logger:   logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		queue:    make(chan []byte, opts.QueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Report queues a finished span for exporting.
+// If the queue is full or the reporter is closed, the span is dropped.
+func (r *otlpReporter) Report(span *jaeger.Span) {
+	r.resourceOnce.Do(func() {
+		var tags []opentracing.Tag
+		if tracer, ok := span.Tracer().(*jaeger.Tracer); ok {
+			tags = tracer.Tags()
+		}
+		r.resource = encodeResource(r.name, tags)
+	})
+
+	data := encodeSpan(span)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.closed {
+		atomic.AddUint64(&r.dropped, 1)
+		return
+	}
+
+	select {
+	case r.queue <- data:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Close exports all queued spans and releases the resources.
+func (r *otlpReporter) Close() {
+	r.closeOnce.Do(func() {
+		r.mutex.Lock()
+		r.closed = true
+		r.mutex.Unlock()
+
+		close(r.closing)
+		<-r.done
+		r.cancel()
+
+		if err := r.exporter.close(); err != nil {
+			r.logger.ErrorE(err, "failed to close otlp exporter")
+		}
+
+		if dropped := atomic.LoadUint64(&r.dropped); dropped > 0 {
+			r.logger.WarnKV("message", "otlp spans dropped", "dropped", dropped)
+		}
+	})
+}
+
+// abort cancels the ongoing export request and retries, so closing the reporter does not wait for them.
+// The spans not exported yet are dropped.
+func (r *otlpReporter) abort() {
+	r.cancel()
+}
+
+// Flushed returns the number of spans exported so far.
+func (r *otlpReporter) Flushed() uint64 {
+	return atomic.LoadUint64(&r.flushed)
+}
+
+// Dropped returns the number of spans dropped so far.
+func (r *otlpReporter) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+func (r *otlpReporter) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, r.opts.BatchSize)
+
+	for {
+		select {
+		case span := <-r.queue:
+			if batch = append(batch, span); len(batch) >= r.opts.BatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+
+		case <-r.closing:
+			// Drain the queue before returning
+			for {
+				select {
+				case span := <-r.queue:
+					if batch = append(batch, span); len(batch) >= r.opts.BatchSize {
+						r.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush exports a batch of spans and retries retryable failures with exponential backoff.
+// If the reporter is aborted, the batch is dropped without waiting for more retries.
+func (r *otlpReporter) flush(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	req := encodeExportRequest(r.resource, batch)
+	backoff := r.opts.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.Timeout)
+		err := r.exporter.export(ctx, req)
+		cancel()
+
+		if err == nil {
+			atomic.AddUint64(&r.flushed, uint64(len(batch)))
+			return
+		}
+
+		retry := isRetryable(err) && attempt < r.opts.MaxRetries
+		if retry {
+			retry = resilience.Wait(r.ctx, backoff) == nil
+		}
+
+		if !retry {
+			atomic.AddUint64(&r.dropped, uint64(len(batch)))
+			r.logger.ErrorE(err, "failed to export spans", "spans", len(batch), "attempts", attempt+1)
+			return
+		}
+
+		backoff *= 2
+	}
+}
+
+// NewOTLPTracer creates a new tracer exporting spans to an OpenTelemetry collector over OTLP.
+// The returned tracer is an opentracing tracer, so it can be used with xhttp and xgrpc packages unchanged.
+// Spans are only exported over OTLP, so an error will be returned if Reporter or LogReporter options are set.
+// If a Shutdown deadline is passed, the ongoing export request and retries are cancelled and the remaining spans are dropped.
+func NewOTLPTracer(opts Options, otlpOpts OTLPOptions) (opentracing.Tracer, io.Closer, error) {
+	if opts.Reporter != nil || opts.LogReporter != nil {
+		return nil, nil, errors.New("reporter options cannot be used with otlp tracer")
+	}
+
+	if opts.Name == "" {
+		opts.Name = "tracer"
+	}
+
+	otlpOpts.setDefaults()
+
+	var exporter otlpExporter
+	switch otlpOpts.Protocol {
+	case OTLPHTTP:
+		exporter = newHTTPExporter(otlpOpts)
+	case OTLPGRPC:
+		var err error
+		if exporter, err = newGRPCExporter(otlpOpts); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid otlp protocol: %d", otlpOpts.Protocol)
+	}
+
+	logger := log.NewVoidLogger()
+	if opts.Logger != nil {
+		logger = opts.Logger.Named(otlpLoggerName)
+	}
+
+	reporter := newOTLPReporter(opts.Name, otlpOpts, exporter, logger)
+
+	return newTracer(opts, reporter)
+}
@@ -0,0 +1,267 @@
+package trace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// This file encodes finished spans in OTLP protobuf wire format without generated code.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+
+const otlpScopeName = "github.com/moorara/observe/trace"
+
+// Field numbers of OTLP messages.
+const (
+	// ExportTraceServiceRequest
+	fieldRequestResourceSpans protowire.Number = 1
+	// ResourceSpans
+	fieldResourceSpansResource   protowire.Number = 1
+	fieldResourceSpansScopeSpans protowire.Number = 2
+	// Resource
+	fieldResourceAttributes protowire.Number = 1
+	// ScopeSpans
+	fieldScopeSpansScope protowire.Number = 1
+	fieldScopeSpansSpans protowire.Number = 2
+	// InstrumentationScope
+	fieldScopeName protowire.Number = 1
+	// Span
+	fieldSpanTraceID      protowire.Number = 1
+	fieldSpanSpanID       protowire.Number = 2
+	fieldSpanParentSpanID protowire.Number = 4
+	fieldSpanName         protowire.Number = 5
+	fieldSpanKind         protowire.Number = 6
+	fieldSpanStartTime    protowire.Number = 7
+	fieldSpanEndTime      protowire.Number = 8
+	fieldSpanAttributes   protowire.Number = 9
+	fieldSpanEvents       protowire.Number = 11
+	fieldSpanLinks        protowire.Number = 13
+	fieldSpanStatus       protowire.Number = 15
+	// Event
+	fieldEventTime       protowire.Number = 1
+	fieldEventName       protowire.Number = 2
+	fieldEventAttributes protowire.Number = 3
+	// Link
+	fieldLinkTraceID protowire.Number = 1
+	fieldLinkSpanID  protowire.Number = 2
+	// Status
+	fieldStatusCode protowire.Number = 3
+	// KeyValue
+	fieldKeyValueKey   protowire.Number = 1
+	fieldKeyValueValue protowire.Number = 2
+	// AnyValue
+	fieldAnyValueString protowire.Number = 1
+	fieldAnyValueBool   protowire.Number = 2
+	fieldAnyValueInt    protowire.Number = 3
+	fieldAnyValueDouble protowire.Number = 4
+)
+
+// OTLP span kinds.
+const (
+	otlpSpanKindInternal uint64 = 1
+	otlpSpanKindServer   uint64 = 2
+	otlpSpanKindClient   uint64 = 3
+	otlpSpanKindProducer uint64 = 4
+	otlpSpanKindConsumer uint64 = 5
+)
+
+// OTLP status codes.
+const otlpStatusCodeError uint64 = 2
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func encodeTraceID(id jaeger.TraceID) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], id.High)
+	binary.BigEndian.PutUint64(b[8:], id.Low)
+	return b
+}
+
+func encodeSpanID(id jaeger.SpanID) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func encodeAnyValue(val interface{}) []byte {
+	var b []byte
+
+	switch v := val.(type) {
+	case string:
+		b = appendString(b, fieldAnyValueString, v)
+	case bool:
+		b = appendVarint(b, fieldAnyValueBool, protowire.EncodeBool(v))
+	case int:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case int8:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case int16:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case int32:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case int64:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case uint:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case uint8:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case uint16:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case uint32:
+		b = appendVarint(b, fieldAnyValueInt, uint64(v))
+	case uint64:
+		b = appendVarint(b, fieldAnyValueInt, v)
+	case float32:
+		b = appendFixed64(b, fieldAnyValueDouble, math.Float64bits(float64(v)))
+	case float64:
+		b = appendFixed64(b, fieldAnyValueDouble, math.Float64bits(v))
+	case error:
+		b = appendString(b, fieldAnyValueString, v.Error())
+	default:
+		b = appendString(b, fieldAnyValueString, fmt.Sprint(v))
+	}
+
+	return b
+}
+
+func encodeKeyValue(key string, val interface{}) []byte {
+	var b []byte
+	b = appendString(b, fieldKeyValueKey, key)
+	b = appendMessage(b, fieldKeyValueValue, encodeAnyValue(val))
+	return b
+}
+
+// encodeResource encodes an OTLP Resource message.
+func encodeResource(serviceName string, tags []opentracing.Tag) []byte {
+	var b []byte
+	b = appendMessage(b, fieldResourceAttributes, encodeKeyValue("service.name", serviceName))
+	for _, tag := range tags {
+		b = appendMessage(b, fieldResourceAttributes, encodeKeyValue(tag.Key, tag.Value))
+	}
+
+	return b
+}
+
+func otlpSpanKind(kind interface{}) uint64 {
+	switch fmt.Sprint(kind) {
+	case string(ext.SpanKindRPCServerEnum):
+		return otlpSpanKindServer
+	case string(ext.SpanKindRPCClientEnum):
+		return otlpSpanKindClient
+	case string(ext.SpanKindProducerEnum):
+		return otlpSpanKindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return otlpSpanKindConsumer
+	default:
+		return otlpSpanKindInternal
+	}
+}
+
+func encodeEvent(record opentracing.LogRecord) []byte {
+	var b []byte
+	name := "log"
+	var attrs []byte
+
+	for _, f := range record.Fields {
+		if f.Key() == "event" {
+			name = fmt.Sprint(f.Value())
+			continue
+		}
+
+		attrs = appendMessage(attrs, fieldEventAttributes, encodeKeyValue(f.Key(), f.Value()))
+	}
+
+	b = appendFixed64(b, fieldEventTime, uint64(record.Timestamp.UnixNano()))
+	b = appendString(b, fieldEventName, name)
+	return append(b, attrs...)
+}
+
+// encodeSpan encodes a finished Jaeger span as an OTLP Span message.
+func encodeSpan(span *jaeger.Span) []byte {
+	var b []byte
+	ctx := span.SpanContext()
+	start := span.StartTime()
+	end := start.Add(span.Duration())
+
+	b = appendMessage(b, fieldSpanTraceID, encodeTraceID(ctx.TraceID()))
+	b = appendMessage(b, fieldSpanSpanID, encodeSpanID(ctx.SpanID()))
+	if ctx.ParentID() != 0 {
+		b = appendMessage(b, fieldSpanParentSpanID, encodeSpanID(ctx.ParentID()))
+	}
+
+	b = appendString(b, fieldSpanName, span.OperationName())
+
+	tags := span.Tags()
+	b = appendVarint(b, fieldSpanKind, otlpSpanKind(tags[string(ext.SpanKind)]))
+	b = appendFixed64(b, fieldSpanStartTime, uint64(start.UnixNano()))
+	b = appendFixed64(b, fieldSpanEndTime, uint64(end.UnixNano()))
+
+	for key, val := range tags {
+		if key == string(ext.SpanKind) {
+			continue
+		}
+		b = appendMessage(b, fieldSpanAttributes, encodeKeyValue(key, val))
+	}
+
+	for _, record := range span.Logs() {
+		b = appendMessage(b, fieldSpanEvents, encodeEvent(record))
+	}
+
+	// References other than the parent are exported as links
+	for _, ref := range span.References() {
+		if refCtx, ok := ref.ReferencedContext.(jaeger.SpanContext); ok {
+			if ref.Type == opentracing.ChildOfRef && refCtx.SpanID() == ctx.ParentID() {
+				continue
+			}
+
+			var link []byte
+			link = appendMessage(link, fieldLinkTraceID, encodeTraceID(refCtx.TraceID()))
+			link = appendMessage(link, fieldLinkSpanID, encodeSpanID(refCtx.SpanID()))
+			b = appendMessage(b, fieldSpanLinks, link)
+		}
+	}
+
+	if isError, ok := tags[string(ext.Error)].(bool); ok && isError {
+		b = appendMessage(b, fieldSpanStatus, appendVarint(nil, fieldStatusCode, otlpStatusCodeError))
+	}
+
+	return b
+}
+
+// encodeExportRequest encodes an OTLP ExportTraceServiceRequest message from an encoded resource and encoded spans.
+func encodeExportRequest(resource []byte, spans [][]byte) []byte {
+	var scopeSpans []byte
+	scopeSpans = appendMessage(scopeSpans, fieldScopeSpansScope, appendString(nil, fieldScopeName, otlpScopeName))
+	for _, span := range spans {
+		scopeSpans = appendMessage(scopeSpans, fieldScopeSpansSpans, span)
+	}
+
+	var resourceSpans []byte
+	resourceSpans = appendMessage(resourceSpans, fieldResourceSpansResource, resource)
+	resourceSpans = appendMessage(resourceSpans, fieldResourceSpansScopeSpans, scopeSpans)
+
+	return appendMessage(nil, fieldRequestResourceSpans, resourceSpans)
+}
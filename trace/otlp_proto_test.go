@@ -0,0 +1,253 @@
+package trace
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	opentracingLog "github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoMessage is a decoded protobuf message.
+// Values are []byte for length-delimited fields and uint64 for varint and fixed64 fields.
+type protoMessage map[protowire.Number][]interface{}
+
+func decodeMessage(t *testing.T, b []byte) protoMessage {
+	msg := protoMessage{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.True(t, n >= 0, "invalid tag")
+		b = b[n:]
+
+		var val interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			require.True(t, n >= 0, "invalid varint")
+			val, b = v, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			require.True(t, n >= 0, "invalid fixed64")
+			val, b = v, b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			require.True(t, n >= 0, "invalid bytes")
+			val, b = v, b[n:]
+		default:
+			t.Fatalf("unexpected wire type: %d", typ)
+		}
+
+		msg[num] = append(msg[num], val)
+	}
+
+	return msg
+}
+
+func (m protoMessage) message(t *testing.T, num protowire.Number) protoMessage {
+	require.Len(t, m[num], 1)
+	return decodeMessage(t, m[num][0].([]byte))
+}
+
+func (m protoMessage) messages(t *testing.T, num protowire.Number) []protoMessage {
+	msgs := []protoMessage{}
+	for _, v := range m[num] {
+		msgs = append(msgs, decodeMessage(t, v.([]byte)))
+	}
+
+	return msgs
+}
+
+func (m protoMessage) bytes(num protowire.Number) []byte {
+	if len(m[num]) == 0 {
+		return nil
+	}
+	return m[num][0].([]byte)
+}
+
+func (m protoMessage) uint(num protowire.Number) uint64 {
+	if len(m[num]) == 0 {
+		return 0
+	}
+	return m[num][0].(uint64)
+}
+
+// attributes decodes a list of KeyValue messages into a map.
+func (m protoMessage) attributes(t *testing.T, num protowire.Number) map[string]interface{} {
+	attrs := map[string]interface{}{}
+
+	for _, kv := range m.messages(t, num) {
+		key := string(kv.bytes(fieldKeyValueKey))
+		val := kv.message(t, fieldKeyValueValue)
+
+		switch {
+		case len(val[fieldAnyValueString]) > 0:
+			attrs[key] = string(val.bytes(fieldAnyValueString))
+		case len(val[fieldAnyValueBool]) > 0:
+			attrs[key] = protowire.DecodeBool(val.uint(fieldAnyValueBool))
+		case len(val[fieldAnyValueInt]) > 0:
+			attrs[key] = int64(val.uint(fieldAnyValueInt))
+		case len(val[fieldAnyValueDouble]) > 0:
+			attrs[key] = math.Float64frombits(val.uint(fieldAnyValueDouble))
+		}
+	}
+
+	return attrs
+}
+
+func TestEncodeAnyValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		val           interface{}
+		expectedField protowire.Number
+		expectedValue interface{}
+	}{
+		{"String", "value", fieldAnyValueString, []byte("value")},
+		{"Bool", true, fieldAnyValueBool, uint64(1)},
+		{"Int", 27, fieldAnyValueInt, uint64(27)},
+		{"NegativeInt", int64(-1), fieldAnyValueInt, uint64(math.MaxUint64)},
+		{"Uint", uint16(27), fieldAnyValueInt, uint64(27)},
+		{"Float", 0.5, fieldAnyValueDouble, math.Float64bits(0.5)},
+		{"Error", errors.New("test error"), fieldAnyValueString, []byte("test error")},
+		{"Other", []int{1, 2}, fieldAnyValueString, []byte("[1 2]")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := decodeMessage(t, encodeAnyValue(tc.val))
+			assert.Len(t, msg, 1)
+			assert.Equal(t, []interface{}{tc.expectedValue}, msg[tc.expectedField])
+		})
+	}
+}
+
+func TestOTLPSpanKind(t *testing.T) {
+	tests := []struct {
+		kind         interface{}
+		expectedKind uint64
+	}{
+		{nil, otlpSpanKindInternal},
+		{ext.SpanKindRPCServerEnum, otlpSpanKindServer},
+		{ext.SpanKindRPCClientEnum, otlpSpanKindClient},
+		{"producer", otlpSpanKindProducer},
+		{"consumer", otlpSpanKindConsumer},
+		{"unknown", otlpSpanKindInternal},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedKind, otlpSpanKind(tc.kind))
+	}
+}
+
+func TestEncodeResource(t *testing.T) {
+	resource := encodeResource("service", []opentracing.Tag{
+		{Key: "hostname", Value: "localhost"},
+	})
+
+	msg := decodeMessage(t, resource)
+	attrs := msg.attributes(t, fieldResourceAttributes)
+	assert.Equal(t, map[string]interface{}{
+		"service.name": "service",
+		"hostname":     "localhost",
+	}, attrs)
+}
+
+func TestEncodeSpan(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("service", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	linked := tracer.StartSpan("linked")
+	linked.Finish()
+
+	parent := tracer.StartSpan("parent")
+	span := tracer.StartSpan("child",
+		opentracing.ChildOf(parent.Context()),
+		opentracing.FollowsFrom(linked.Context()),
+	)
+	ext.SpanKindRPCServer.Set(span)
+	ext.Error.Set(span, true)
+	span.SetTag("http.status_code", 500)
+	span.LogFields(
+		opentracingLog.String("event", "retry"),
+		opentracingLog.Int("attempt", 2),
+	)
+	span.LogFields(opentracingLog.Error(errors.New("test error")))
+	span.Finish()
+	parent.Finish()
+
+	jspan := span.(*jaeger.Span)
+	ctx := jspan.SpanContext()
+	msg := decodeMessage(t, encodeSpan(jspan))
+
+	traceID := msg.bytes(fieldSpanTraceID)
+	assert.Equal(t, ctx.TraceID().High, binary.BigEndian.Uint64(traceID[:8]))
+	assert.Equal(t, ctx.TraceID().Low, binary.BigEndian.Uint64(traceID[8:]))
+	assert.Equal(t, uint64(ctx.SpanID()), binary.BigEndian.Uint64(msg.bytes(fieldSpanSpanID)))
+	assert.Equal(t, uint64(ctx.ParentID()), binary.BigEndian.Uint64(msg.bytes(fieldSpanParentSpanID)))
+	assert.Equal(t, "child", string(msg.bytes(fieldSpanName)))
+	assert.Equal(t, otlpSpanKindServer, msg.uint(fieldSpanKind))
+	assert.Equal(t, uint64(jspan.StartTime().UnixNano()), msg.uint(fieldSpanStartTime))
+	assert.Equal(t, uint64(jspan.StartTime().Add(jspan.Duration()).UnixNano()), msg.uint(fieldSpanEndTime))
+
+	attrs := msg.attributes(t, fieldSpanAttributes)
+	assert.NotContains(t, attrs, string(ext.SpanKind))
+	assert.Equal(t, true, attrs["error"])
+	assert.Equal(t, int64(500), attrs["http.status_code"])
+
+	events := msg.messages(t, fieldSpanEvents)
+	require.Len(t, events, 2)
+	assert.Equal(t, "retry", string(events[0].bytes(fieldEventName)))
+	assert.Equal(t, map[string]interface{}{"attempt": int64(2)}, events[0].attributes(t, fieldEventAttributes))
+	assert.Equal(t, "log", string(events[1].bytes(fieldEventName)))
+	assert.Equal(t, map[string]interface{}{"error": "test error"}, events[1].attributes(t, fieldEventAttributes))
+
+	links := msg.messages(t, fieldSpanLinks)
+	require.Len(t, links, 1)
+	linkedCtx := linked.Context().(jaeger.SpanContext)
+	assert.Equal(t, uint64(linkedCtx.SpanID()), binary.BigEndian.Uint64(links[0].bytes(fieldLinkSpanID)))
+
+	status := msg.message(t, fieldSpanStatus)
+	assert.Equal(t, otlpStatusCodeError, status.uint(fieldStatusCode))
+}
+
+func TestEncodeSpan_Root(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("service", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	span := tracer.StartSpan("root")
+	span.Finish()
+
+	msg := decodeMessage(t, encodeSpan(span.(*jaeger.Span)))
+	assert.Nil(t, msg.bytes(fieldSpanParentSpanID))
+	assert.Equal(t, otlpSpanKindInternal, msg.uint(fieldSpanKind))
+	assert.Empty(t, msg[fieldSpanStatus])
+	assert.Empty(t, msg[fieldSpanLinks])
+}
+
+func TestEncodeExportRequest(t *testing.T) {
+	resource := encodeResource("service", nil)
+	spans := [][]byte{
+		appendString(nil, fieldSpanName, "first"),
+		appendString(nil, fieldSpanName, "second"),
+	}
+
+	req := decodeMessage(t, encodeExportRequest(resource, spans))
+	resourceSpans := req.message(t, fieldRequestResourceSpans)
+	assert.Equal(t, resource, resourceSpans.bytes(fieldResourceSpansResource))
+
+	scopeSpans := resourceSpans.message(t, fieldResourceSpansScopeSpans)
+	scope := scopeSpans.message(t, fieldScopeSpansScope)
+	assert.Equal(t, otlpScopeName, string(scope.bytes(fieldScopeName)))
+
+	decoded := scopeSpans.messages(t, fieldScopeSpansSpans)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "first", string(decoded[0].bytes(fieldSpanName)))
+	assert.Equal(t, "second", string(decoded[1].bytes(fieldSpanName)))
+}
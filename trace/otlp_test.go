@@ -0,0 +1,472 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// otlpReceiver records export requests received by a local OTLP receiver.
+type otlpReceiver struct {
+	sync.Mutex
+	requests [][]byte
+	headers  []map[string]string
+}
+
+func (r *otlpReceiver) record(req []byte, headers map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+	r.requests = append(r.requests, req)
+	r.headers = append(r.headers, headers)
+}
+
+// spanNames returns the names of all spans received.
+func (r *otlpReceiver) spanNames(t *testing.T) []string {
+	r.Lock()
+	defer r.Unlock()
+
+	names := []string{}
+	for _, req := range r.requests {
+		resourceSpans := decodeMessage(t, req).message(t, fieldRequestResourceSpans)
+		scopeSpans := resourceSpans.message(t, fieldResourceSpansScopeSpans)
+		for _, span := range scopeSpans.messages(t, fieldScopeSpansSpans) {
+			names = append(names, string(span.bytes(fieldSpanName)))
+		}
+	}
+
+	return names
+}
+
+func newHTTPReceiver(t *testing.T, statusCodes ...int) (*otlpReceiver, *httptest.Server) {
+	receiver := &otlpReceiver{}
+	var calls int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		receiver.Lock()
+		calls++
+		call := calls
+		receiver.Unlock()
+
+		if call <= len(statusCodes) {
+			w.WriteHeader(statusCodes[call-1])
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		receiver.record(body, map[string]string{"Authorization": r.Header.Get("Authorization")})
+	}))
+
+	return receiver, server
+}
+
+func newGRPCReceiver(t *testing.T, errs ...error) (*otlpReceiver, string, func()) {
+	receiver := &otlpReceiver{}
+	var calls int
+
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		assert.Equal(t, otlpExportMethod, method)
+
+		receiver.Lock()
+		calls++
+		call := calls
+		receiver.Unlock()
+
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+
+		if call <= len(errs) {
+			return errs[call-1]
+		}
+
+		headers := map[string]string{}
+		if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+			if vals := md.Get("authorization"); len(vals) > 0 {
+				headers["Authorization"] = vals[0]
+			}
+		}
+
+		receiver.record(req, headers)
+		return stream.SendMsg([]byte{})
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.CustomCodec(serverCodec{}),
+		grpc.UnknownServiceHandler(handler),
+	)
+
+	go server.Serve(lis)
+
+	return receiver, lis.Addr().String(), server.Stop
+}
+
+// serverCodec implements grpc.Codec for receiving already encoded protobuf messages.
+type serverCodec struct {
+	rawCodec
+}
+
+func (serverCodec) String() string {
+	return "proto"
+}
+
+// mockExporter is an otlpExporter for testing reporters.
+type mockExporter struct {
+	sync.Mutex
+	block    chan struct{}
+	err      error
+	requests int
+}
+
+func (e *mockExporter) export(ctx context.Context, req []byte) error {
+	if e.block != nil {
+		<-e.block
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.requests++
+	return e.err
+}
+
+func (e *mockExporter) close() error {
+	return nil
+}
+
+func TestOTLPProtocol(t *testing.T) {
+	tests := []struct {
+		protocol       OTLPProtocol
+		expectedString string
+	}{
+		{OTLPHTTP, "http"},
+		{OTLPGRPC, "grpc"},
+		{OTLPProtocol(-1), ""},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedString, tc.protocol.String())
+	}
+}
+
+func TestOTLPOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             OTLPOptions
+		expectedEndpoint string
+	}{
+		{"HTTP", OTLPOptions{}, "http://localhost:4318/v1/traces"},
+		{"GRPC", OTLPOptions{Protocol: OTLPGRPC}, "localhost:4317"},
+		{"Endpoint", OTLPOptions{Endpoint: "otel-collector:4317"}, "otel-collector:4317"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.setDefaults()
+			assert.Equal(t, tc.expectedEndpoint, tc.opts.Endpoint)
+			assert.Equal(t, defaultOTLPTimeout, tc.opts.Timeout)
+			assert.Equal(t, defaultOTLPQueueSize, tc.opts.QueueSize)
+			assert.Equal(t, defaultOTLPBatchSize, tc.opts.BatchSize)
+			assert.Equal(t, defaultOTLPFlushInterval, tc.opts.FlushInterval)
+			assert.Equal(t, defaultOTLPMaxRetries, tc.opts.MaxRetries)
+			assert.Equal(t, defaultOTLPRetryBackoff, tc.opts.RetryBackoff)
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Error", errors.New("error"), false},
+		{"NonRetryable", &otlpError{err: errors.New("error")}, false},
+		{"Retryable", &otlpError{err: errors.New("error"), retryable: true}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isRetryable(tc.err))
+		})
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	codec := rawCodec{}
+	assert.Equal(t, "proto", codec.Name())
+
+	b, err := codec.Marshal([]byte("data"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), b)
+
+	_, err = codec.Marshal("data")
+	assert.Error(t, err)
+
+	var out []byte
+	assert.NoError(t, codec.Unmarshal([]byte("data"), &out))
+	assert.Equal(t, []byte("data"), out)
+
+	assert.Error(t, codec.Unmarshal([]byte("data"), out))
+}
+
+func TestOTLPReporter_Batching(t *testing.T) {
+	exporter := &mockExporter{}
+	opts := OTLPOptions{BatchSize: 2, FlushInterval: time.Hour}
+	opts.setDefaults()
+	reporter := newOTLPReporter("service", opts, exporter, log.NewVoidLogger())
+
+	tracer, closer, err := newTracer(Options{Name: "service"}, reporter)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		tracer.StartSpan("span").Finish()
+	}
+
+	closer.Close()
+
+	// Two full batches and one partial batch flushed on close
+	assert.Equal(t, 3, exporter.requests)
+	assert.Equal(t, uint64(0), reporter.Dropped())
+
+	// Spans reported after close are dropped
+	tracer.StartSpan("span").Finish()
+	assert.Equal(t, uint64(1), reporter.Dropped())
+}
+
+func TestOTLPReporter_QueueFull(t *testing.T) {
+	exporter := &mockExporter{block: make(chan struct{})}
+	opts := OTLPOptions{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour}
+	opts.setDefaults()
+	reporter := newOTLPReporter("service", opts, exporter, log.NewVoidLogger())
+
+	tracer, closer, err := newTracer(Options{Name: "service"}, reporter)
+	require.NoError(t, err)
+
+	// The first span blocks the exporter, the second span fills the queue, and the rest are dropped
+	tracer.StartSpan("span").Finish()
+	assert.Eventually(t, func() bool { return len(reporter.queue) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		tracer.StartSpan("span").Finish()
+	}
+
+	assert.Equal(t, uint64(3), reporter.Dropped())
+
+	close(exporter.block)
+	closer.Close()
+	assert.Equal(t, 2, exporter.requests)
+}
+
+func TestOTLPReporter_ReportClose(t *testing.T) {
+	exporter := &mockExporter{}
+	opts := OTLPOptions{FlushInterval: time.Hour}
+	opts.setDefaults()
+	reporter := newOTLPReporter("service", opts, exporter, log.NewVoidLogger())
+
+	tracer, closer, err := newTracer(Options{Name: "service"}, reporter)
+	require.NoError(t, err)
+
+	// Every span reported concurrently with closing is either exported or counted as dropped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tracer.StartSpan("span").Finish()
+			}
+		}()
+	}
+
+	closer.Close()
+	wg.Wait()
+
+	assert.Equal(t, uint64(400), reporter.Flushed()+reporter.Dropped())
+}
+
+func TestOTLPReporter_Retry(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		maxRetries       int
+		expectedRequests int
+		expectedDropped  uint64
+	}{
+		{"Success", nil, 2, 1, 0},
+		{"NonRetryable", &otlpError{err: errors.New("bad request")}, 2, 1, 1},
+		{"Retryable", &otlpError{err: errors.New("unavailable"), retryable: true}, 2, 3, 1},
+		{"DefaultRetries", &otlpError{err: errors.New("unavailable"), retryable: true}, 0, 4, 1},
+		{"RetriesDisabled", &otlpError{err: errors.New("unavailable"), retryable: true}, -1, 1, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := &mockExporter{err: tc.err}
+			opts := OTLPOptions{MaxRetries: tc.maxRetries, RetryBackoff: time.Millisecond}
+			opts.setDefaults()
+			reporter := newOTLPReporter("service", opts, exporter, log.NewVoidLogger())
+
+			tracer, closer, err := newTracer(Options{Name: "service"}, reporter)
+			require.NoError(t, err)
+
+			tracer.StartSpan("span").Finish()
+			closer.Close()
+
+			assert.Equal(t, tc.expectedRequests, exporter.requests)
+			assert.Equal(t, tc.expectedDropped, reporter.Dropped())
+		})
+	}
+}
+
+func TestOTLPReporter_ShutdownDeadline(t *testing.T) {
+	exporter := &mockExporter{err: &otlpError{err: errors.New("unavailable"), retryable: true}}
+	opts := OTLPOptions{FlushInterval: time.Hour, RetryBackoff: time.Hour}
+	opts.setDefaults()
+	reporter := newOTLPReporter("service", opts, exporter, log.NewVoidLogger())
+
+	tracer, closer, err := newTracer(Options{Name: "service"}, reporter)
+	require.NoError(t, err)
+
+	tracer.StartSpan("span").Finish()
+
+	// Passing the deadline stops waiting for retries and drops the remaining spans
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	stats, err := Shutdown(ctx, closer)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, uint64(1), stats.Reported)
+
+	assert.Eventually(t, func() bool { return reporter.Dropped() == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, closer.Close())
+	assert.Equal(t, 1, exporter.requests)
+}
+
+func TestNewOTLPTracer_HTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCodes   []int
+		expectedSpans []string
+	}{
+		{"Success", nil, []string{"child", "parent"}},
+		{"RetrySuccess", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, []string{"child", "parent"}},
+		{"NonRetryable", []int{http.StatusBadRequest}, []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receiver, server := newHTTPReceiver(t, tc.statusCodes...)
+			defer server.Close()
+
+			tracer, closer, err := NewOTLPTracer(
+				Options{Name: "service", Logger: log.NewVoidLogger()},
+				OTLPOptions{
+					Endpoint:     server.URL + "/v1/traces",
+					Headers:      map[string]string{"Authorization": "Bearer token"},
+					MaxRetries:   2,
+					RetryBackoff: time.Millisecond,
+				},
+			)
+			require.NoError(t, err)
+
+			parent := tracer.StartSpan("parent")
+			child := tracer.StartSpan("child", ext.RPCServerOption(parent.Context()))
+			child.Finish()
+			parent.Finish()
+			assert.NoError(t, closer.Close())
+
+			assert.Equal(t, tc.expectedSpans, receiver.spanNames(t))
+			for _, headers := range receiver.headers {
+				assert.Equal(t, "Bearer token", headers["Authorization"])
+			}
+		})
+	}
+}
+
+func TestNewOTLPTracer_GRPC(t *testing.T) {
+	tests := []struct {
+		name          string
+		errs          []error
+		expectedSpans []string
+	}{
+		{"Success", nil, []string{"span"}},
+		{"RetrySuccess", []error{status.Error(codes.Unavailable, "unavailable")}, []string{"span"}},
+		{"NonRetryable", []error{status.Error(codes.InvalidArgument, "invalid")}, []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receiver, addr, stop := newGRPCReceiver(t, tc.errs...)
+			defer stop()
+
+			tracer, closer, err := NewOTLPTracer(
+				Options{Name: "service"},
+				OTLPOptions{
+					Protocol:     OTLPGRPC,
+					Endpoint:     addr,
+					Headers:      map[string]string{"Authorization": "Bearer token"},
+					Insecure:     true,
+					MaxRetries:   2,
+					RetryBackoff: time.Millisecond,
+				},
+			)
+			require.NoError(t, err)
+
+			tracer.StartSpan("span").Finish()
+			assert.NoError(t, closer.Close())
+
+			assert.Equal(t, tc.expectedSpans, receiver.spanNames(t))
+			for _, headers := range receiver.headers {
+				assert.Equal(t, "Bearer token", headers["Authorization"])
+			}
+		})
+	}
+}
+
+func TestNewOTLPTracer_ReporterOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"Reporter", Options{Reporter: NewAgentReporter("localhost:6831", false)}},
+		{"LogReporter", Options{LogReporter: &LogReporterOptions{}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, closer, err := NewOTLPTracer(tc.opts, OTLPOptions{})
+			assert.EqualError(t, err, "reporter options cannot be used with otlp tracer")
+			assert.Nil(t, tracer)
+			assert.Nil(t, closer)
+		})
+	}
+}
+
+func TestNewOTLPTracer_InvalidProtocol(t *testing.T) {
+	tracer, closer, err := NewOTLPTracer(Options{}, OTLPOptions{Protocol: OTLPProtocol(-1)})
+	assert.EqualError(t, err, "invalid otlp protocol: -1")
+	assert.Nil(t, tracer)
+	assert.Nil(t, closer)
+}
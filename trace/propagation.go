@@ -0,0 +1,540 @@
+package trace
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	w3cTraceParentHeader = "traceparent"
+	w3cTraceStateHeader  = "tracestate"
+	w3cBaggageHeader     = "baggage"
+	w3cVersion           = "00"
+
+	b3SingleHeader       = "b3"
+	b3TraceIDHeader      = "x-b3-traceid"
+	b3SpanIDHeader       = "x-b3-spanid"
+	b3ParentSpanIDHeader = "x-b3-parentspanid"
+	b3SampledHeader      = "x-b3-sampled"
+	b3FlagsHeader        = "x-b3-flags"
+	b3Debug              = "d"
+
+	// tracestateBaggageKey is the baggage item carrying the W3C tracestate header along a trace.
+	tracestateBaggageKey = "w3c-tracestate"
+)
+
+// Propagator injects span contexts into and extracts span contexts from carriers such as HTTP headers and gRPC metadata.
+type Propagator interface {
+	Inject(ctx jaeger.SpanContext, carrier opentracing.TextMapWriter) error
+	Extract(carrier opentracing.TextMapReader) (jaeger.SpanContext, error)
+}
+
+// propagatorCodec implements jaeger.Injector and jaeger.Extractor for a propagator.
+type propagatorCodec struct {
+	propagator Propagator
+}
+
+func (c *propagatorCodec) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	return c.propagator.Inject(ctx, writer)
+}
+
+func (c *propagatorCodec) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+
+	return c.propagator.Extract(reader)
+}
+
+// readHeaders reads all key-value pairs from a carrier with lower-case keys.
+// Keys are case-insensitive in both HTTP headers and gRPC metadata.
+func readHeaders(carrier opentracing.TextMapReader) (map[string]string, error) {
+	headers := map[string]string{}
+	err := carrier.ForeachKey(func(key, val string) error {
+		headers[strings.ToLower(key)] = val
+		return nil
+	})
+
+	return headers, err
+}
+
+// formatTraceID formats a trace id as a 32-character hex string.
+func formatTraceID(id jaeger.TraceID) string {
+	return fmt.Sprintf("%016x%016x", id.High, id.Low)
+}
+
+// formatSpanID formats a span id as a 16-character hex string.
+func formatSpanID(id jaeger.SpanID) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+// parseHex verifies a string is a lower-case hex string of a given length.
+func parseHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseIDs parses a trace id with 16 or 32 hex characters and a span id with 16 hex characters.
+func parseIDs(traceID, spanID string) (jaeger.TraceID, jaeger.SpanID, error) {
+	if !parseHex(traceID, 16) && !parseHex(traceID, 32) {
+		return jaeger.TraceID{}, 0, opentracing.ErrSpanContextCorrupted
+	}
+
+	if !parseHex(spanID, 16) {
+		return jaeger.TraceID{}, 0, opentracing.ErrSpanContextCorrupted
+	}
+
+	tid, err := jaeger.TraceIDFromString(traceID)
+	if err != nil || !tid.IsValid() {
+		return jaeger.TraceID{}, 0, opentracing.ErrSpanContextCorrupted
+	}
+
+	sid, err := jaeger.SpanIDFromString(spanID)
+	if err != nil || sid == 0 {
+		return jaeger.TraceID{}, 0, opentracing.ErrSpanContextCorrupted
+	}
+
+	return tid, sid, nil
+}
+
+// withoutBaggageItem returns a copy of a span context without a baggage item while keeping the sampling flags.
+func withoutBaggageItem(ctx jaeger.SpanContext, key string) jaeger.SpanContext {
+	found := false
+	ctx.ForeachBaggageItem(func(k, _ string) bool {
+		found = k == key
+		return !found
+	})
+
+	if !found {
+		return ctx
+	}
+
+	c, err := jaeger.ContextFromString(ctx.String())
+	if err != nil {
+		return ctx
+	}
+
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if k != key {
+			c = c.WithBaggageItem(k, v)
+		}
+		return true
+	})
+
+	return c
+}
+
+// jaegerPropagator propagates span contexts using uber-trace-id and uberctx-* headers.
+type jaegerPropagator struct {
+	propagator *jaeger.TextMapPropagator
+}
+
+// NewJaegerPropagator creates a propagator for the Jaeger uber-trace-id header and uberctx-* baggage headers.
+func NewJaegerPropagator() Propagator {
+	headers := (&jaeger.HeadersConfig{}).ApplyDefaults()
+	return &jaegerPropagator{
+		propagator: jaeger.NewHTTPHeaderPropagator(headers, *jaeger.NewNullMetrics()),
+	}
+}
+
+func (p *jaegerPropagator) Inject(ctx jaeger.SpanContext, carrier opentracing.TextMapWriter) error {
+	return p.propagator.Inject(withoutBaggageItem(ctx, tracestateBaggageKey), carrier)
+}
+
+func (p *jaegerPropagator) Extract(carrier opentracing.TextMapReader) (jaeger.SpanContext, error) {
+	return p.propagator.Extract(carrier)
+}
+
+// formatBaggage formats the baggage items of a span context as a W3C baggage header.
+// Items are sorted by keys and values are percent-encoded.
+func formatBaggage(ctx jaeger.SpanContext) string {
+	items := []string{}
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if k != tracestateBaggageKey {
+			items = append(items, k+"="+url.PathEscape(v))
+		}
+		return true
+	})
+
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
+
+// parseBaggage parses a W3C baggage header into baggage items.
+// Properties of list members are ignored and invalid list members are skipped.
+func parseBaggage(header string, baggage map[string]string) {
+	for _, member := range strings.Split(header, ",") {
+		// Properties are separated by semicolons (i.e. key=value;property)
+		member = strings.SplitN(member, ";", 2)[0]
+
+		kv := strings.SplitN(member, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(kv[0])
+		val, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if key == "" || key == tracestateBaggageKey || err != nil {
+			continue
+		}
+
+		baggage[key] = val
+	}
+}
+
+// w3cPropagator propagates span contexts using W3C Trace Context and W3C Baggage headers.
+type w3cPropagator struct{}
+
+// NewW3CPropagator creates a propagator for the W3C Trace Context traceparent and tracestate headers
+// and the W3C Baggage baggage header.
+// See https://www.w3.org/TR/trace-context and https://www.w3.org/TR/baggage
+func NewW3CPropagator() Propagator {
+	return &w3cPropagator{}
+}
+
+func (p *w3cPropagator) Inject(ctx jaeger.SpanContext, carrier opentracing.TextMapWriter) error {
+	flags := "00"
+	if ctx.IsSampled() {
+		flags = "01"
+	}
+
+	carrier.Set(w3cTraceParentHeader, fmt.Sprintf("%s-%s-%s-%s", w3cVersion, formatTraceID(ctx.TraceID()), formatSpanID(ctx.SpanID()), flags))
+
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if k == tracestateBaggageKey {
+			carrier.Set(w3cTraceStateHeader, v)
+			return false
+		}
+		return true
+	})
+
+	if baggage := formatBaggage(ctx); baggage != "" {
+		carrier.Set(w3cBaggageHeader, baggage)
+	}
+
+	return nil
+}
+
+func (p *w3cPropagator) Extract(carrier opentracing.TextMapReader) (jaeger.SpanContext, error) {
+	headers, err := readHeaders(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	baggage := map[string]string{}
+	if header := headers[w3cBaggageHeader]; header != "" {
+		parseBaggage(header, baggage)
+	}
+
+	traceparent, ok := headers[w3cTraceParentHeader]
+	if !ok {
+		// A span context with only baggage is used for propagating the baggage to a new trace
+		if len(baggage) > 0 {
+			return jaeger.NewSpanContext(jaeger.TraceID{}, 0, 0, false, baggage), nil
+		}
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	// Future versions may append fields, so only the version 00 length is strict
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || !parseHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == w3cVersion && len(parts) != 4) {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	if !parseHex(parts[1], 32) || !parseHex(parts[3], 2) {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+
+	traceID, spanID, err := parseIDs(parts[1], parts[2])
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	flags, _ := strconv.ParseUint(parts[3], 16, 8)
+	sampled := flags&1 == 1
+
+	if tracestate := strings.TrimSpace(headers[w3cTraceStateHeader]); tracestate != "" {
+		baggage[tracestateBaggageKey] = tracestate
+	}
+
+	return jaeger.NewSpanContext(traceID, spanID, 0, sampled, baggage), nil
+}
+
+// b3Propagator propagates span contexts using Zipkin B3 headers.
+type b3Propagator struct {
+	single bool
+}
+
+// NewB3SinglePropagator creates a propagator for the Zipkin B3 single header (b3).
+// See https://github.com/openzipkin/b3-propagation
+func NewB3SinglePropagator() Propagator {
+	return &b3Propagator{single: true}
+}
+
+// NewB3MultiPropagator creates a propagator for the Zipkin B3 multiple headers (x-b3-*).
+// See https://github.com/openzipkin/b3-propagation
+func NewB3MultiPropagator() Propagator {
+	return &b3Propagator{single: false}
+}
+
+func (p *b3Propagator) Inject(ctx jaeger.SpanContext, carrier opentracing.TextMapWriter) error {
+	traceID := formatTraceID(ctx.TraceID())
+	if ctx.TraceID().High == 0 {
+		traceID = traceID[16:]
+	}
+
+	sampled := "0"
+	if ctx.IsSampled() {
+		sampled = "1"
+	}
+
+	if p.single {
+		if ctx.IsDebug() {
+			sampled = b3Debug
+		}
+
+		val := fmt.Sprintf("%s-%s-%s", traceID, formatSpanID(ctx.SpanID()), sampled)
+		if ctx.ParentID() != 0 {
+			val += "-" + formatSpanID(ctx.ParentID())
+		}
+		carrier.Set(b3SingleHeader, val)
+		return nil
+	}
+
+	carrier.Set(b3TraceIDHeader, traceID)
+	carrier.Set(b3SpanIDHeader, formatSpanID(ctx.SpanID()))
+	if ctx.ParentID() != 0 {
+		carrier.Set(b3ParentSpanIDHeader, formatSpanID(ctx.ParentID()))
+	}
+
+	// Debug implies an accept decision, so the sampled header is not sent with the debug flag
+	if ctx.IsDebug() {
+		carrier.Set(b3FlagsHeader, "1")
+	} else {
+		carrier.Set(b3SampledHeader, sampled)
+	}
+
+	return nil
+}
+
+func (p *b3Propagator) Extract(carrier opentracing.TextMapReader) (jaeger.SpanContext, error) {
+	headers, err := readHeaders(carrier)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	if p.single {
+		return extractB3Single(headers)
+	}
+
+	return extractB3Multi(headers)
+}
+
+// newB3SpanContext creates a span context extracted from B3 headers.
+// The debug flag of a span context can only be set through its string representation.
+func newB3SpanContext(traceID jaeger.TraceID, spanID, parentID jaeger.SpanID, sampled, debug bool) jaeger.SpanContext {
+	ctx := jaeger.NewSpanContext(traceID, spanID, parentID, sampled, nil)
+	if !debug {
+		return ctx
+	}
+
+	// The flags are formatted as a decimal number (1 = sampled, 2 = debug)
+	c, err := jaeger.ContextFromString(fmt.Sprintf("%s:%s:%s:3", traceID, spanID, parentID))
+	if err != nil {
+		return ctx
+	}
+
+	return c
+}
+
+// parseB3Sampled parses a B3 sampling state.
+// The debug state (d) implies the trace is sampled.
+func parseB3Sampled(val string) (bool, error) {
+	switch val {
+	case "1", b3Debug, "true":
+		return true, nil
+	case "", "0", "false":
+		return false, nil
+	default:
+		return false, opentracing.ErrSpanContextCorrupted
+	}
+}
+
+func extractB3Single(headers map[string]string) (jaeger.SpanContext, error) {
+	val, ok := headers[b3SingleHeader]
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}
+	parts := strings.Split(strings.TrimSpace(val), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		// A sampling state only (i.e. b3: 0) does not carry a span context
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	traceID, spanID, err := parseIDs(parts[0], parts[1])
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	// Sample by default when the sampling state is deferred
+	sampled := true
+	if len(parts) > 2 {
+		if sampled, err = parseB3Sampled(parts[2]); err != nil {
+			return jaeger.SpanContext{}, err
+		}
+	}
+
+	var parentID jaeger.SpanID
+	if len(parts) > 3 {
+		if !parseHex(parts[3], 16) {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+		parentID, _ = jaeger.SpanIDFromString(parts[3])
+	}
+
+	debug := len(parts) > 2 && parts[2] == b3Debug
+
+	return newB3SpanContext(traceID, spanID, parentID, sampled, debug), nil
+}
+
+func extractB3Multi(headers map[string]string) (jaeger.SpanContext, error) {
+	traceIDVal, ok1 := headers[b3TraceIDHeader]
+	spanIDVal, ok2 := headers[b3SpanIDHeader]
+	if !ok1 && !ok2 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	traceID, spanID, err := parseIDs(traceIDVal, spanIDVal)
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	// Sample by default when the sampling state is deferred
+	sampled := true
+	if val, ok := headers[b3SampledHeader]; ok {
+		if sampled, err = parseB3Sampled(val); err != nil {
+			return jaeger.SpanContext{}, err
+		}
+	}
+
+	debug := headers[b3FlagsHeader] == "1"
+	if debug {
+		sampled = true
+	}
+
+	var parentID jaeger.SpanID
+	if val, ok := headers[b3ParentSpanIDHeader]; ok {
+		if !parseHex(val, 16) {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+		parentID, _ = jaeger.SpanIDFromString(val)
+	}
+
+	return newB3SpanContext(traceID, spanID, parentID, sampled, debug), nil
+}
+
+// compositePropagator combines multiple propagators.
+type compositePropagator struct {
+	propagators []Propagator
+}
+
+// NewCompositePropagator creates a propagator that injects span contexts using all propagators
+// and extracts a span context using the first propagator that finds one in the carrier.
+func NewCompositePropagator(propagators ...Propagator) Propagator {
+	return &compositePropagator{
+		propagators: propagators,
+	}
+}
+
+func (p *compositePropagator) Inject(ctx jaeger.SpanContext, carrier opentracing.TextMapWriter) error {
+	for _, propagator := range p.propagators {
+		if err := propagator.Inject(ctx, carrier); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *compositePropagator) Extract(carrier opentracing.TextMapReader) (jaeger.SpanContext, error) {
+	var fallback *jaeger.SpanContext
+	err := opentracing.ErrSpanContextNotFound
+
+	for _, propagator := range p.propagators {
+		ctx, e := propagator.Extract(carrier)
+		if e == nil {
+			if ctx.IsValid() {
+				return ctx, nil
+			}
+
+			// A span context with only baggage or a debug id is used if no other propagator finds a valid one
+			if fallback == nil {
+				fallback = &ctx
+			}
+			continue
+		}
+
+		// Report a corrupted span context only if no other propagator finds a span context
+		if e != opentracing.ErrSpanContextNotFound {
+			err = e
+		}
+	}
+
+	if fallback != nil {
+		return *fallback, nil
+	}
+
+	return jaeger.SpanContext{}, err
+}
+
+// ParsePropagator creates a propagator from a comma-separated list of propagator names.
+// Supported names are jaeger, w3c (or tracecontext), b3 (single header), and b3multi.
+// A list of more than one name creates a composite propagator.
+func ParsePropagator(spec string) (Propagator, error) {
+	propagators := []Propagator{}
+
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "jaeger":
+			propagators = append(propagators, NewJaegerPropagator())
+		case "w3c", "tracecontext":
+			propagators = append(propagators, NewW3CPropagator())
+		case "b3":
+			propagators = append(propagators, NewB3SinglePropagator())
+		case "b3multi":
+			propagators = append(propagators, NewB3MultiPropagator())
+		default:
+			return nil, fmt.Errorf("invalid propagator: %q", name)
+		}
+	}
+
+	if len(propagators) == 1 {
+		return propagators[0], nil
+	}
+
+	return NewCompositePropagator(propagators...), nil
+}
@@ -0,0 +1,654 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+)
+
+var (
+	testTraceID = jaeger.TraceID{High: 0x4bf92f3577b34da6, Low: 0xa3ce929d0e0e4736}
+	testSpanID  = jaeger.SpanID(0x00f067aa0ba902b7)
+)
+
+func baggageOf(ctx jaeger.SpanContext) map[string]string {
+	baggage := map[string]string{}
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		baggage[k] = v
+		return true
+	})
+
+	return baggage
+}
+
+func TestPropagatorCodec(t *testing.T) {
+	codec := &propagatorCodec{NewW3CPropagator()}
+	ctx := jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, nil)
+
+	assert.Equal(t, opentracing.ErrInvalidCarrier, codec.Inject(ctx, "carrier"))
+	_, err := codec.Extract("carrier")
+	assert.Equal(t, opentracing.ErrInvalidCarrier, err)
+
+	carrier := opentracing.TextMapCarrier{}
+	assert.NoError(t, codec.Inject(ctx, carrier))
+	extracted, err := codec.Extract(carrier)
+	assert.NoError(t, err)
+	assert.Equal(t, testTraceID, extracted.TraceID())
+}
+
+func TestWithoutBaggageItem(t *testing.T) {
+	ctx := jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, map[string]string{
+		"tenant":             "acme",
+		tracestateBaggageKey: "vendor=value",
+	})
+
+	c := withoutBaggageItem(ctx, tracestateBaggageKey)
+	assert.Equal(t, testTraceID, c.TraceID())
+	assert.Equal(t, testSpanID, c.SpanID())
+	assert.True(t, c.IsSampled())
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggageOf(c))
+
+	c = withoutBaggageItem(c, tracestateBaggageKey)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggageOf(c))
+}
+
+func TestJaegerPropagator(t *testing.T) {
+	propagator := NewJaegerPropagator()
+	ctx := jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, map[string]string{
+		"tenant":             "acme",
+		tracestateBaggageKey: "vendor=value",
+	})
+
+	carrier := opentracing.TextMapCarrier{}
+	assert.NoError(t, propagator.Inject(ctx, carrier))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0000000000000000:1", carrier["uber-trace-id"])
+	assert.Equal(t, "acme", carrier["uberctx-tenant"])
+	assert.NotContains(t, carrier, "uberctx-"+tracestateBaggageKey)
+
+	extracted, err := propagator.Extract(carrier)
+	assert.NoError(t, err)
+	assert.Equal(t, testTraceID, extracted.TraceID())
+	assert.Equal(t, testSpanID, extracted.SpanID())
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggageOf(extracted))
+
+	_, err = propagator.Extract(opentracing.TextMapCarrier{})
+	assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+}
+
+func TestW3CPropagator_Inject(t *testing.T) {
+	tests := []struct {
+		name            string
+		ctx             jaeger.SpanContext
+		expectedCarrier opentracing.TextMapCarrier
+	}{
+		{
+			name: "Sampled",
+			ctx:  jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			name: "NotSampled64BitTraceID",
+			ctx:  jaeger.NewSpanContext(jaeger.TraceID{Low: 0x1}, testSpanID, 0, false, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"traceparent": "00-00000000000000000000000000000001-00f067aa0ba902b7-00",
+			},
+		},
+		{
+			name: "TraceState",
+			ctx:  jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, map[string]string{tracestateBaggageKey: "vendor=value"}),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"tracestate":  "vendor=value",
+			},
+		},
+		{
+			name: "Baggage",
+			ctx: jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, map[string]string{
+				tracestateBaggageKey: "vendor=value",
+				"tenant":             "acme",
+				"user":               "jane doe,admin;1",
+			}),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"tracestate":  "vendor=value",
+				"baggage":     "tenant=acme,user=jane%20doe%2Cadmin%3B1",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			carrier := opentracing.TextMapCarrier{}
+			err := NewW3CPropagator().Inject(tc.ctx, carrier)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCarrier, carrier)
+		})
+	}
+}
+
+func TestW3CPropagator_Extract(t *testing.T) {
+	tests := []struct {
+		name            string
+		carrier         opentracing.TextMapCarrier
+		expectedError   error
+		expectedSampled bool
+		expectedBaggage map[string]string
+	}{
+		{
+			name:          "NotFound",
+			carrier:       opentracing.TextMapCarrier{},
+			expectedError: opentracing.ErrSpanContextNotFound,
+		},
+		{
+			name: "Sampled",
+			carrier: opentracing.TextMapCarrier{
+				"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedSampled: true,
+			expectedBaggage: map[string]string{},
+		},
+		{
+			name: "NotSampledWithTraceState",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+				"tracestate":  "vendor=value",
+			},
+			expectedSampled: false,
+			expectedBaggage: map[string]string{tracestateBaggageKey: "vendor=value"},
+		},
+		{
+			name: "Baggage",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"Baggage":     "tenant=acme, user=jane%20doe%2Cadmin;prop=1,invalid,=empty,w3c-tracestate=forged,bad=%zz",
+			},
+			expectedSampled: true,
+			expectedBaggage: map[string]string{"tenant": "acme", "user": "jane doe,admin"},
+		},
+		{
+			name: "FutureVersion",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			},
+			expectedSampled: true,
+			expectedBaggage: map[string]string{},
+		},
+		{
+			name: "InvalidVersion",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name: "ExtraFields",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name: "ShortTraceID",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name: "ZeroTraceID",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name: "ZeroSpanID",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name: "UpperCase",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := NewW3CPropagator().Extract(tc.carrier)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testTraceID, ctx.TraceID())
+				assert.Equal(t, testSpanID, ctx.SpanID())
+				assert.Equal(t, tc.expectedSampled, ctx.IsSampled())
+				assert.Equal(t, tc.expectedBaggage, baggageOf(ctx))
+			}
+		})
+	}
+}
+
+func TestW3CPropagator_ExtractBaggageOnly(t *testing.T) {
+	ctx, err := NewW3CPropagator().Extract(opentracing.TextMapCarrier{
+		"baggage": "tenant=acme",
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, ctx.IsValid())
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggageOf(ctx))
+
+	// The baggage is propagated to a new trace
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	span := tracer.StartSpan("handle", opentracing.ChildOf(ctx))
+	defer span.Finish()
+	assert.True(t, span.Context().(jaeger.SpanContext).IsValid())
+	assert.Equal(t, "acme", span.BaggageItem("tenant"))
+}
+
+func testDebugSpanContext(t *testing.T) jaeger.SpanContext {
+	ctx, err := jaeger.ContextFromString("4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:3")
+	assert.NoError(t, err)
+	return ctx
+}
+
+func TestB3Propagator_Inject(t *testing.T) {
+	tests := []struct {
+		name            string
+		propagator      Propagator
+		ctx             jaeger.SpanContext
+		expectedCarrier opentracing.TextMapCarrier
+	}{
+		{
+			name:       "Single",
+			propagator: NewB3SinglePropagator(),
+			ctx:        jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+			},
+		},
+		{
+			name:       "SingleWithParent",
+			propagator: NewB3SinglePropagator(),
+			ctx:        jaeger.NewSpanContext(jaeger.TraceID{Low: 0xa3ce929d0e0e4736}, testSpanID, 0x1, false, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"b3": "a3ce929d0e0e4736-00f067aa0ba902b7-0-0000000000000001",
+			},
+		},
+		{
+			name:       "Multi",
+			propagator: NewB3MultiPropagator(),
+			ctx:        jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-sampled": "1",
+			},
+		},
+		{
+			name:       "MultiWithParent",
+			propagator: NewB3MultiPropagator(),
+			ctx:        jaeger.NewSpanContext(jaeger.TraceID{Low: 0xa3ce929d0e0e4736}, testSpanID, 0x1, false, nil),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"x-b3-traceid":      "a3ce929d0e0e4736",
+				"x-b3-spanid":       "00f067aa0ba902b7",
+				"x-b3-parentspanid": "0000000000000001",
+				"x-b3-sampled":      "0",
+			},
+		},
+		{
+			name:       "SingleDebug",
+			propagator: NewB3SinglePropagator(),
+			ctx:        testDebugSpanContext(t),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-d",
+			},
+		},
+		{
+			name:       "MultiDebug",
+			propagator: NewB3MultiPropagator(),
+			ctx:        testDebugSpanContext(t),
+			expectedCarrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-flags":   "1",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			carrier := opentracing.TextMapCarrier{}
+			err := tc.propagator.Inject(tc.ctx, carrier)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCarrier, carrier)
+		})
+	}
+}
+
+func TestB3Propagator_Extract(t *testing.T) {
+	tests := []struct {
+		name             string
+		propagator       Propagator
+		carrier          opentracing.TextMapCarrier
+		expectedError    error
+		expectedSampled  bool
+		expectedDebug    bool
+		expectedParentID jaeger.SpanID
+	}{
+		{
+			name:          "SingleNotFound",
+			propagator:    NewB3SinglePropagator(),
+			carrier:       opentracing.TextMapCarrier{},
+			expectedError: opentracing.ErrSpanContextNotFound,
+		},
+		{
+			name:          "SingleSamplingOnly",
+			propagator:    NewB3SinglePropagator(),
+			carrier:       opentracing.TextMapCarrier{"b3": "0"},
+			expectedError: opentracing.ErrSpanContextNotFound,
+		},
+		{
+			name:            "SingleDeferred",
+			propagator:      NewB3SinglePropagator(),
+			carrier:         opentracing.TextMapCarrier{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+			expectedSampled: true,
+		},
+		{
+			name:             "SingleNotSampled",
+			propagator:       NewB3SinglePropagator(),
+			carrier:          opentracing.TextMapCarrier{"B3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0-0000000000000001"},
+			expectedSampled:  false,
+			expectedParentID: 0x1,
+		},
+		{
+			name:            "SingleDebug",
+			propagator:      NewB3SinglePropagator(),
+			carrier:         opentracing.TextMapCarrier{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-d"},
+			expectedSampled: true,
+			expectedDebug:   true,
+		},
+		{
+			name:          "SingleInvalidSampled",
+			propagator:    NewB3SinglePropagator(),
+			carrier:       opentracing.TextMapCarrier{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x"},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:          "SingleInvalidParent",
+			propagator:    NewB3SinglePropagator(),
+			carrier:       opentracing.TextMapCarrier{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1-01"},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:          "SingleInvalidTraceID",
+			propagator:    NewB3SinglePropagator(),
+			carrier:       opentracing.TextMapCarrier{"b3": "4bf92f35-00f067aa0ba902b7-1"},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:          "MultiNotFound",
+			propagator:    NewB3MultiPropagator(),
+			carrier:       opentracing.TextMapCarrier{},
+			expectedError: opentracing.ErrSpanContextNotFound,
+		},
+		{
+			name:       "MultiSampled",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"X-B3-Traceid":      "4bf92f3577b34da6a3ce929d0e0e4736",
+				"X-B3-Spanid":       "00f067aa0ba902b7",
+				"X-B3-Parentspanid": "0000000000000001",
+				"X-B3-Sampled":      "1",
+			},
+			expectedSampled:  true,
+			expectedParentID: 0x1,
+		},
+		{
+			name:       "MultiNotSampled",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-sampled": "0",
+			},
+			expectedSampled: false,
+		},
+		{
+			name:       "MultiDebug",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-flags":   "1",
+			},
+			expectedSampled: true,
+			expectedDebug:   true,
+		},
+		{
+			name:       "MultiMissingSpanID",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:       "MultiInvalidSampled",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-sampled": "yes",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:       "MultiInvalidParent",
+			propagator: NewB3MultiPropagator(),
+			carrier: opentracing.TextMapCarrier{
+				"x-b3-traceid":      "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":       "00f067aa0ba902b7",
+				"x-b3-parentspanid": "parent",
+			},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := tc.propagator.Extract(tc.carrier)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testTraceID, ctx.TraceID())
+				assert.Equal(t, testSpanID, ctx.SpanID())
+				assert.Equal(t, tc.expectedParentID, ctx.ParentID())
+				assert.Equal(t, tc.expectedSampled, ctx.IsSampled())
+				assert.Equal(t, tc.expectedDebug, ctx.IsDebug())
+			}
+		})
+	}
+}
+
+func TestB3Propagator_DebugRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		propagator Propagator
+	}{
+		{"Single", NewB3SinglePropagator()},
+		{"Multi", NewB3MultiPropagator()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			carrier := opentracing.TextMapCarrier{}
+			assert.NoError(t, tc.propagator.Inject(testDebugSpanContext(t), carrier))
+
+			ctx, err := tc.propagator.Extract(carrier)
+			assert.NoError(t, err)
+			assert.Equal(t, testTraceID, ctx.TraceID())
+			assert.Equal(t, testSpanID, ctx.SpanID())
+			assert.True(t, ctx.IsSampled())
+			assert.True(t, ctx.IsDebug())
+		})
+	}
+}
+
+func TestCompositePropagator(t *testing.T) {
+	propagator := NewCompositePropagator(NewJaegerPropagator(), NewW3CPropagator(), NewB3MultiPropagator())
+	ctx := jaeger.NewSpanContext(testTraceID, testSpanID, 0, true, nil)
+
+	t.Run("InjectAll", func(t *testing.T) {
+		carrier := opentracing.TextMapCarrier{}
+		assert.NoError(t, propagator.Inject(ctx, carrier))
+		assert.Contains(t, carrier, "uber-trace-id")
+		assert.Contains(t, carrier, "traceparent")
+		assert.Contains(t, carrier, "x-b3-traceid")
+	})
+
+	tests := []struct {
+		name            string
+		carrier         opentracing.TextMapCarrier
+		expectedError   error
+		expectedTraceID jaeger.TraceID
+		expectedBaggage map[string]string
+	}{
+		{
+			name:          "NotFound",
+			carrier:       opentracing.TextMapCarrier{},
+			expectedError: opentracing.ErrSpanContextNotFound,
+		},
+		{
+			name:            "W3C",
+			carrier:         opentracing.TextMapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			expectedTraceID: testTraceID,
+			expectedBaggage: map[string]string{},
+		},
+		{
+			name:            "B3",
+			carrier:         opentracing.TextMapCarrier{"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736", "x-b3-spanid": "00f067aa0ba902b7"},
+			expectedTraceID: testTraceID,
+			expectedBaggage: map[string]string{},
+		},
+		{
+			name: "CorruptedAndValid",
+			carrier: opentracing.TextMapCarrier{
+				"traceparent":  "00-invalid",
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+			},
+			expectedTraceID: testTraceID,
+			expectedBaggage: map[string]string{},
+		},
+		{
+			name:          "Corrupted",
+			carrier:       opentracing.TextMapCarrier{"traceparent": "00-invalid"},
+			expectedError: opentracing.ErrSpanContextCorrupted,
+		},
+		{
+			name:            "BaggageOnly",
+			carrier:         opentracing.TextMapCarrier{"uberctx-tenant": "acme"},
+			expectedTraceID: jaeger.TraceID{},
+			expectedBaggage: map[string]string{"tenant": "acme"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := propagator.Extract(tc.carrier)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTraceID, ctx.TraceID())
+				assert.Equal(t, tc.expectedBaggage, baggageOf(ctx))
+			}
+		})
+	}
+}
+
+func TestParsePropagator(t *testing.T) {
+	tests := []struct {
+		spec               string
+		expectedPropagator Propagator
+		expectedError      string
+	}{
+		{"w3c", NewW3CPropagator(), ""},
+		{"tracecontext", NewW3CPropagator(), ""},
+		{"B3", NewB3SinglePropagator(), ""},
+		{"b3multi", NewB3MultiPropagator(), ""},
+		{"w3c, b3multi", NewCompositePropagator(NewW3CPropagator(), NewB3MultiPropagator()), ""},
+		{"", nil, `invalid propagator: ""`},
+		{"w3c,zipkin", nil, `invalid propagator: "zipkin"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			propagator, err := ParsePropagator(tc.spec)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPropagator, propagator)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	propagator, err := ParsePropagator("jaeger")
+	assert.NoError(t, err)
+	assert.IsType(t, &jaegerPropagator{}, propagator)
+}
+
+func TestNewTracer_Propagator(t *testing.T) {
+	tracer, closer, err := NewTracer(Options{
+		Name:       "service",
+		Reporter:   NewAgentReporter("localhost:6831", false),
+		Propagator: NewCompositePropagator(NewW3CPropagator(), NewB3SinglePropagator()),
+	})
+	require.NoError(t, err)
+	defer closer.Close()
+
+	// HTTP headers
+	header := http.Header{}
+	header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parentCtx, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	require.NoError(t, err)
+
+	span := tracer.StartSpan("test", opentracing.ChildOf(parentCtx))
+	defer span.Finish()
+
+	spanCtx := span.Context().(jaeger.SpanContext)
+	assert.Equal(t, testTraceID, spanCtx.TraceID())
+	assert.Equal(t, testSpanID, spanCtx.ParentID())
+
+	header = http.Header{}
+	err = tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	assert.NoError(t, err)
+	assert.Contains(t, header.Get("Traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Contains(t, header.Get("B3"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Empty(t, header.Get("Uber-Trace-Id"))
+
+	// Text map
+	carrier := opentracing.TextMapCarrier{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"}
+	parentCtx, err = tracer.Extract(opentracing.TextMap, carrier)
+	require.NoError(t, err)
+	assert.Equal(t, testTraceID, parentCtx.(jaeger.SpanContext).TraceID())
+}
@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/moorara/observe/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+// LogReporterOptions contains options for a reporter logging finished spans.
+//   Logger is the logger for spans (if not set, a new logger writing to standard output is created).
+//   Format is the output format (JSON or Logfmt) for the new logger if Logger is not set.
+type LogReporterOptions struct {
+	Logger *log.Logger
+	Format log.Format
+}
+
+// jsonValue converts errors to strings, since errors are encoded as empty objects in JSON.
+func jsonValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+
+	return v
+}
+
+// spanTags are the tags of a logged span.
+// They are encoded as an object in JSON and as a string in logfmt.
+type spanTags opentracing.Tags
+
+func (t spanTags) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(t))
+	for key, val := range t {
+		m[key] = jsonValue(val)
+	}
+
+	return json.Marshal(m)
+}
+
+func (t spanTags) String() string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, t[key])
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// spanLogs are the logs of a logged span.
+// They are encoded as an array of objects in JSON and as a string in logfmt.
+type spanLogs []opentracing.LogRecord
+
+func (l spanLogs) MarshalJSON() ([]byte, error) {
+	records := make([]map[string]interface{}, len(l))
+	for i, record := range l {
+		records[i] = map[string]interface{}{
+			"timestamp": record.Timestamp.UTC().Format(time.RFC3339Nano),
+		}
+		for _, f := range record.Fields {
+			records[i][f.Key()] = jsonValue(f.Value())
+		}
+	}
+
+	return json.Marshal(records)
+}
+
+func (l spanLogs) String() string {
+	records := make([]string, len(l))
+	for i, record := range l {
+		pairs := make([]string, len(record.Fields))
+		for j, f := range record.Fields {
+			pairs[j] = fmt.Sprintf("%s=%v", f.Key(), f.Value())
+		}
+		records[i] = strings.Join(pairs, " ")
+	}
+
+	return strings.Join(records, "; ")
+}
+
+// logReporter is a Jaeger reporter logging every finished span as a structured log entry.
+type logReporter struct {
+	logger  *log.Logger
+	flushed uint64
+}
+
+func newLogReporter(name string, opts LogReporterOptions) *logReporter {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.NewLogger(log.Options{
+			Name:   name,
+			Format: opts.Format,
+		})
+	}
+
+	return &logReporter{
+		logger: logger,
+	}
+}
+
+// Report logs a finished span.
+// Spans tagged with error are logged in error level and other spans are logged in info level.
+func (r *logReporter) Report(span *jaeger.Span) {
+	sc := span.SpanContext()
+	tags := span.Tags()
+
+	kv := []interface{}{
+		"message", "span finished",
+		"traceId", sc.TraceID().String(),
+		"spanId", sc.SpanID().String(),
+		"parentId", sc.ParentID().String(),
+		"operation", span.OperationName(),
+		"startTime", span.StartTime().UTC().Format(time.RFC3339Nano),
+		"duration", span.Duration().String(),
+	}
+
+	if len(tags) > 0 {
+		kv = append(kv, "tags", spanTags(tags))
+	}
+
+	if logs := span.Logs(); len(logs) > 0 {
+		kv = append(kv, "logs", spanLogs(logs))
+	}
+
+	if isError, ok := tags["error"].(bool); ok && isError {
+		r.logger.ErrorKV(kv...)
+	} else {
+		r.logger.InfoKV(kv...)
+	}
+
+	atomic.AddUint64(&r.flushed, 1)
+}
+
+// Flushed returns the number of spans logged so far.
+func (r *logReporter) Flushed() uint64 {
+	return atomic.LoadUint64(&r.flushed)
+}
+
+// Close does nothing since spans are logged synchronously.
+func (r *logReporter) Close() {}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/log/logtest"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestSpanTags(t *testing.T) {
+	tags := spanTags{"http.method": "GET", "http.status_code": 200, "error.object": errors.New("timeout")}
+
+	b, err := tags.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"error.object":"timeout","http.method":"GET","http.status_code":200}`, string(b))
+	assert.Equal(t, "error.object=timeout http.method=GET http.status_code=200", tags.String())
+}
+
+func TestSpanLogs(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logs := spanLogs{
+		{Timestamp: ts, Fields: []otlog.Field{otlog.String("event", "query"), otlog.Int("rows", 2)}},
+		{Timestamp: ts, Fields: []otlog.Field{otlog.String("event", "error")}},
+	}
+
+	b, err := logs.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"timestamp":"2020-01-01T00:00:00Z","event":"query","rows":2},
+		{"timestamp":"2020-01-01T00:00:00Z","event":"error"}
+	]`, string(b))
+	assert.Equal(t, "event=query rows=2; event=error", logs.String())
+}
+
+func TestNewLogReporter(t *testing.T) {
+	logger := log.NewVoidLogger()
+
+	tests := []struct {
+		name string
+		opts LogReporterOptions
+	}{
+		{"Default", LogReporterOptions{}},
+		{"WithFormat", LogReporterOptions{Format: log.Logfmt}},
+		{"WithLogger", LogReporterOptions{Logger: logger}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newLogReporter("service", tc.opts)
+			assert.NotNil(t, r.logger)
+
+			if tc.opts.Logger != nil {
+				assert.Equal(t, tc.opts.Logger, r.logger)
+			}
+		})
+	}
+}
+
+func TestLogReporter(t *testing.T) {
+	logger, logs := logtest.New()
+	r := newLogReporter("service", LogReporterOptions{Logger: logger})
+	tracer, closer := jaeger.NewTracer("service", jaeger.NewConstSampler(true), r)
+	defer closer.Close()
+
+	span := tracer.StartSpan("handle")
+	child := tracer.StartSpan("query", opentracing.ChildOf(span.Context()))
+	ext.Error.Set(child, true)
+	child.LogFields(otlog.Error(errors.New("connection refused")))
+	child.Finish()
+	span.SetTag("http.status_code", 500)
+	span.Finish()
+
+	sc := span.Context().(jaeger.SpanContext)
+	childSC := child.Context().(jaeger.SpanContext)
+
+	entries := logs.Find(log.ErrorLevel, "span finished",
+		"traceId", childSC.TraceID().String(),
+		"spanId", childSC.SpanID().String(),
+		"parentId", sc.SpanID().String(),
+		"operation", "query",
+	)
+	assert.Len(t, entries, 1)
+	assert.NotEmpty(t, entries[0].Fields["startTime"])
+	assert.NotEmpty(t, entries[0].Fields["duration"])
+	assert.Equal(t, true, entries[0].Fields["tags"].(map[string]interface{})["error"])
+	if l, ok := entries[0].Fields["logs"].([]interface{}); assert.True(t, ok) && assert.Len(t, l, 1) {
+		assert.Equal(t, "connection refused", l[0].(map[string]interface{})["error"])
+	}
+
+	entries = logs.Find(log.InfoLevel, "span finished",
+		"traceId", sc.TraceID().String(),
+		"spanId", sc.SpanID().String(),
+		"parentId", "0",
+		"operation", "handle",
+	)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, float64(500), entries[0].Fields["tags"].(map[string]interface{})["http.status_code"])
+}
+
+func TestLogReporterLogfmt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger(log.Options{Format: log.Logfmt, Writer: buf})
+	r := newLogReporter("service", LogReporterOptions{Logger: logger})
+	tracer, closer := jaeger.NewTracer("service", jaeger.NewConstSampler(true), r)
+	defer closer.Close()
+
+	span := tracer.StartSpan("handle")
+	span.SetTag("http.method", "GET")
+	span.LogFields(otlog.String("event", "done"))
+	span.Finish()
+
+	out := buf.String()
+	assert.Contains(t, out, `message="span finished"`)
+	assert.Contains(t, out, "operation=handle")
+	assert.Contains(t, out, `tags="http.method=GET`)
+	assert.Contains(t, out, `logs="event=done"`)
+}
+
+func TestNewTracerWithLogReporter(t *testing.T) {
+	logger, logs := logtest.New()
+	tracer, closer, err := NewTracer(Options{
+		Name:        "service",
+		LogReporter: &LogReporterOptions{Logger: logger},
+	})
+	assert.NoError(t, err)
+
+	tracer.StartSpan("handle").Finish()
+	closer.Close()
+
+	logs.AssertLogged(t, log.InfoLevel, "span finished", "operation", "handle")
+}
@@ -0,0 +1,155 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// OperationTag is the span tag used by the adaptive sampler as the operation of a span instead of the span name.
+	// xhttp server middleware sets this tag to the request method and the route template (or path) and xgrpc server interceptor sets it to the full method.
+	// The tag is namespaced, so it does not clash with the tags set by applications.
+	OperationTag = "sampler.operation"
+
+	// DebugHeader is the request header (or gRPC metadata key) for forcing the sampling of a trace.
+	// If an incoming request has this header with any non-empty value, the server span will be sampled regardless of the sampler.
+	DebugHeader = "X-Trace-Debug"
+
+	defaultMaxOperations = 500
+)
+
+// AdaptiveSamplerOptions contains options for an adaptive per-operation sampler.
+//   LowerBound is the guaranteed number of traces per second sampled for each operation.
+//   Probability is the sampling probability between 0 and 1 for operations not in Operations.
+//   Operations are the sampling probabilities for specific operations.
+//   MaxOperations is the maximum number of operations tracked (other operations are sampled only by Probability).
+type AdaptiveSamplerOptions struct {
+	LowerBound    float64
+	Probability   float64
+	Operations    map[string]float64
+	MaxOperations int
+}
+
+// adaptiveSampler is a Jaeger sampler making sampling decisions per operation.
+// Each operation is sampled probabilistically while at least a minimum rate of traces are sampled for every operation.
+// The operation of a span is the value of the operation tag or the span name if the span does not have this tag.
+type adaptiveSampler struct {
+	jaeger.SamplerV2Base
+	sync.Mutex
+	opts           AdaptiveSamplerOptions
+	defaultSampler *jaeger.ProbabilisticSampler
+	samplers       map[string]*jaeger.GuaranteedThroughputProbabilisticSampler
+}
+
+// NewAdaptiveSampler creates a new adaptive per-operation sampler.
+// The sampler does not need a remote sampling server.
+func NewAdaptiveSampler(opts AdaptiveSamplerOptions) (jaeger.Sampler, error) {
+	if opts.MaxOperations <= 0 {
+		opts.MaxOperations = defaultMaxOperations
+	}
+
+	if opts.LowerBound < 0 {
+		return nil, fmt.Errorf("invalid adaptive sampler lower bound: %v", opts.LowerBound)
+	}
+
+	if opts.Probability < 0 || opts.Probability > 1 {
+		return nil, fmt.Errorf("invalid adaptive sampler probability: %v", opts.Probability)
+	}
+
+	for op, probability := range opts.Operations {
+		if probability < 0 || probability > 1 {
+			return nil, fmt.Errorf("invalid adaptive sampler probability for %q: %v", op, probability)
+		}
+	}
+
+	// The errors are always nil since the probabilities are already validated
+	defaultSampler, _ := jaeger.NewProbabilisticSampler(opts.Probability)
+
+	s := &adaptiveSampler{
+		opts:           opts,
+		defaultSampler: defaultSampler,
+		samplers:       map[string]*jaeger.GuaranteedThroughputProbabilisticSampler{},
+	}
+
+	for op, probability := range opts.Operations {
+		s.samplers[op], _ = jaeger.NewGuaranteedThroughputProbabilisticSampler(opts.LowerBound, probability)
+	}
+
+	return s, nil
+}
+
+// getSampler returns the sampler for an operation.
+func (s *adaptiveSampler) getSampler(op string) jaeger.Sampler {
+	s.Lock()
+	defer s.Unlock()
+
+	if sampler, ok := s.samplers[op]; ok {
+		return sampler
+	}
+
+	if len(s.samplers) >= s.opts.MaxOperations {
+		return s.defaultSampler
+	}
+
+	sampler, _ := jaeger.NewGuaranteedThroughputProbabilisticSampler(s.opts.LowerBound, s.defaultSampler.SamplingRate())
+	s.samplers[op] = sampler
+
+	return sampler
+}
+
+// decide makes a final sampling decision for a span using the sampler of an operation.
+func (s *adaptiveSampler) decide(span *jaeger.Span, op string) jaeger.SamplingDecision {
+	sampled, tags := s.getSampler(op).IsSampled(span.SpanContext().TraceID(), op)
+	return jaeger.SamplingDecision{Sample: sampled, Retryable: false, Tags: tags}
+}
+
+// OnCreateSpan leaves the sampling decision for a new trace to be made later.
+// The decision is made when the operation tag is set, the span name is changed, a child span is created, or the span is finished.
+func (s *adaptiveSampler) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	sc := span.SpanContext()
+	if sc.ParentID() == 0 {
+		return jaeger.SamplingDecision{Sample: false, Retryable: true}
+	}
+
+	// A child span is created before the sampling decision is made for its local root span
+	return s.decide(span, span.OperationName())
+}
+
+// OnSetOperationName makes a sampling decision for a span using the new span name.
+func (s *adaptiveSampler) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	return s.decide(span, operationName)
+}
+
+// OnSetTag makes a sampling decision for a span if the tag is the operation tag.
+func (s *adaptiveSampler) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	if op, ok := value.(string); ok && key == OperationTag {
+		return s.decide(span, op)
+	}
+
+	return jaeger.SamplingDecision{Sample: false, Retryable: true}
+}
+
+// OnFinishSpan makes a sampling decision for a span using the span name.
+func (s *adaptiveSampler) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.decide(span, span.OperationName())
+}
+
+// Close closes all underlying samplers.
+func (s *adaptiveSampler) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, sampler := range s.samplers {
+		sampler.Close()
+	}
+	s.defaultSampler.Close()
+}
+
+// ForceSampling forces a span and its trace to be sampled regardless of the sampler.
+func ForceSampling(span opentracing.Span) {
+	ext.SamplingPriority.Set(span, 1)
+}
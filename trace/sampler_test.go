@@ -0,0 +1,171 @@
+package trace
+
+import (
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestNewAdaptiveSampler(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          AdaptiveSamplerOptions
+		expectedError string
+	}{
+		{
+			name: "InvalidLowerBound",
+			opts: AdaptiveSamplerOptions{
+				LowerBound: -1,
+			},
+			expectedError: "invalid adaptive sampler lower bound: -1",
+		},
+		{
+			name: "InvalidProbability",
+			opts: AdaptiveSamplerOptions{
+				Probability: 2,
+			},
+			expectedError: "invalid adaptive sampler probability: 2",
+		},
+		{
+			name: "InvalidOperationProbability",
+			opts: AdaptiveSamplerOptions{
+				Probability: 0.1,
+				Operations:  map[string]float64{"GET /health": -1},
+			},
+			expectedError: "invalid adaptive sampler probability for \"GET /health\": -1",
+		},
+		{
+			name: "Success",
+			opts: AdaptiveSamplerOptions{
+				LowerBound:  0.1,
+				Probability: 0.01,
+				Operations:  map[string]float64{"GET /health": 0},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sampler, err := NewAdaptiveSampler(tc.opts)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, sampler)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, sampler)
+				sampler.Close()
+			}
+		})
+	}
+}
+
+func TestAdaptiveSampler(t *testing.T) {
+	sampler, err := NewAdaptiveSampler(AdaptiveSamplerOptions{
+		LowerBound:    1,
+		Probability:   0,
+		Operations:    map[string]float64{"GET /users": 1},
+		MaxOperations: 3,
+	})
+	assert.NoError(t, err)
+
+	tracer, closer := jaeger.NewTracer("test", sampler, jaeger.NewNullReporter())
+	defer closer.Close()
+
+	isSampled := func(span opentracing.Span) bool {
+		return span.Context().(jaeger.SpanContext).IsSampled()
+	}
+
+	startSpan := func(op string) opentracing.Span {
+		return tracer.StartSpan("http-server-request", opentracing.Tag{Key: OperationTag, Value: op})
+	}
+
+	t.Run("LowerBound", func(t *testing.T) {
+		// Every operation is guaranteed to be sampled once per second
+		span := startSpan("GET /orders")
+		assert.True(t, isSampled(span))
+		span = startSpan("GET /orders")
+		assert.False(t, isSampled(span))
+
+		span = startSpan("GET /items")
+		assert.True(t, isSampled(span))
+	})
+
+	t.Run("OperationProbability", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			span := startSpan("GET /users")
+			assert.True(t, isSampled(span))
+		}
+	})
+
+	t.Run("MaxOperations", func(t *testing.T) {
+		// Other operations are sampled by the default probability
+		span := startSpan("GET /carts")
+		assert.False(t, isSampled(span))
+	})
+
+	t.Run("SpanName", func(t *testing.T) {
+		span := tracer.StartSpan("GET /users")
+		span.SetTag("http.method", "GET")
+		span.Finish()
+		assert.True(t, isSampled(span))
+	})
+
+	t.Run("ChildSpan", func(t *testing.T) {
+		span := tracer.StartSpan("job")
+		child := tracer.StartSpan("GET /users", opentracing.ChildOf(span.Context()))
+		assert.True(t, isSampled(child))
+		assert.True(t, isSampled(span))
+	})
+
+	t.Run("SetOperationName", func(t *testing.T) {
+		span := tracer.StartSpan("http-server-request")
+		span.SetOperationName("GET /users")
+		assert.True(t, isSampled(span))
+	})
+
+	t.Run("ForceSampling", func(t *testing.T) {
+		span := startSpan("GET /orders")
+		assert.False(t, isSampled(span))
+		ForceSampling(span)
+		assert.True(t, isSampled(span))
+	})
+}
+
+func TestNewTracerWithAdaptiveSampler(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		expectedError string
+	}{
+		{
+			name: "InvalidSampler",
+			opts: Options{
+				AdaptiveSampler: &AdaptiveSamplerOptions{Probability: -1},
+			},
+			expectedError: "invalid adaptive sampler probability: -1",
+		},
+		{
+			name: "Success",
+			opts: Options{
+				AdaptiveSampler: &AdaptiveSamplerOptions{LowerBound: 0.1, Probability: 0.01},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, closer, err := NewTracer(tc.opts)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, tracer)
+				closer.Close()
+			}
+		})
+	}
+}
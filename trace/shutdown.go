@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uber/jaeger-client-go"
+	jmetrics "github.com/uber/jaeger-lib/metrics"
+)
+
+// SpanStats contains the number of spans handled by a tracer.
+//   Reported is the number of finished spans reported by the tracer.
+//   Flushed is the number of spans successfully sent to Jaeger, exported over OTLP, or logged.
+//   Dropped is the number of spans dropped due to full queues, buffer limits, or failed requests.
+// Spans discarded by tail-based sampling are neither flushed nor dropped.
+type SpanStats struct {
+	Reported uint64
+	Flushed  uint64
+	Dropped  uint64
+}
+
+// flushedCounter is implemented by reporters counting flushed spans.
+type flushedCounter interface {
+	Flushed() uint64
+}
+
+// droppedCounter is implemented by reporters counting dropped spans.
+type droppedCounter interface {
+	Dropped() uint64
+}
+
+// aborter is implemented by reporters that can stop flushing pending spans when a shutdown deadline is passed.
+type aborter interface {
+	abort()
+}
+
+// countingCounter is a Jaeger metrics counter that also counts in memory.
+type countingCounter struct {
+	jmetrics.Counter
+	count *uint64
+}
+
+func (c countingCounter) Inc(delta int64) {
+	c.Counter.Inc(delta)
+	atomic.AddUint64(c.count, uint64(delta))
+}
+
+// jaegerReporterStats counts the spans flushed and dropped by Jaeger reporters using the reporter metrics.
+type jaegerReporterStats struct {
+	flushed uint64
+	dropped uint64
+}
+
+// instrument replaces the reporter counters of Jaeger metrics with counting counters.
+func (s *jaegerReporterStats) instrument(m *jaeger.Metrics) *jaeger.Metrics {
+	m.ReporterSuccess = countingCounter{m.ReporterSuccess, &s.flushed}
+	m.ReporterFailure = countingCounter{m.ReporterFailure, &s.dropped}
+	m.ReporterDropped = countingCounter{m.ReporterDropped, &s.dropped}
+	return m
+}
+
+func (s *jaegerReporterStats) Flushed() uint64 {
+	return atomic.LoadUint64(&s.flushed)
+}
+
+func (s *jaegerReporterStats) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// statsReporter is a Jaeger reporter counting the spans reported by a tracer.
+type statsReporter struct {
+	jaeger.Reporter
+	reported uint64
+}
+
+func (r *statsReporter) Report(span *jaeger.Span) {
+	atomic.AddUint64(&r.reported, 1)
+	r.Reporter.Report(span)
+}
+
+// tracerCloser closes a tracer and provides the statistics of its spans.
+type tracerCloser struct {
+	closer   io.Closer
+	reporter *statsReporter
+	counters []interface{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+func newTracerCloser(closer io.Closer, reporter *statsReporter, counters ...interface{}) *tracerCloser {
+	return &tracerCloser{
+		closer:   closer,
+		reporter: reporter,
+		counters: counters,
+		done:     make(chan struct{}),
+	}
+}
+
+// Stats returns the statistics of the spans reported by the tracer so far.
+func (c *tracerCloser) Stats() SpanStats {
+	stats := SpanStats{
+		Reported: atomic.LoadUint64(&c.reporter.reported),
+	}
+
+	for _, counter := range c.counters {
+		if fc, ok := counter.(flushedCounter); ok {
+			stats.Flushed += fc.Flushed()
+		}
+		if dc, ok := counter.(droppedCounter); ok {
+			stats.Dropped += dc.Dropped()
+		}
+	}
+
+	return stats
+}
+
+// Shutdown closes the tracer and flushes all pending spans.
+// If the context is done before all spans are flushed, the context error will be returned
+// and the remaining spans will be flushed in the background.
+// Reporters that can be aborted (i.e. OTLP reporters) stop retrying and drop the remaining spans instead.
+func (c *tracerCloser) Shutdown(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		go func() {
+			defer close(c.done)
+			c.err = c.closer.Close()
+		}()
+	})
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		for _, counter := range c.counters {
+			if a, ok := counter.(aborter); ok {
+				a.abort()
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// Close closes the tracer and waits until all pending spans are flushed.
+func (c *tracerCloser) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown closes a tracer created by NewTracer or NewOTLPTracer within the deadline of a context.
+// It returns the statistics of the spans reported by the tracer.
+// If the context is done before all pending spans are flushed, the context error will be returned.
+func Shutdown(ctx context.Context, closer io.Closer) (SpanStats, error) {
+	c, ok := closer.(*tracerCloser)
+	if !ok {
+		c = newTracerCloser(closer, &statsReporter{})
+	}
+
+	err := c.Shutdown(ctx)
+
+	return c.Stats(), err
+}
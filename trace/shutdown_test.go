@@ -0,0 +1,152 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+	jmetrics "github.com/uber/jaeger-lib/metrics"
+)
+
+type mockCloser struct {
+	delay         time.Duration
+	CloseCalled   int
+	CloseOutError error
+}
+
+func (m *mockCloser) Close() error {
+	time.Sleep(m.delay)
+	m.CloseCalled++
+	return m.CloseOutError
+}
+
+type mockCounter struct {
+	flushed uint64
+	dropped uint64
+}
+
+func (m *mockCounter) Flushed() uint64 {
+	return m.flushed
+}
+
+func (m *mockCounter) Dropped() uint64 {
+	return m.dropped
+}
+
+func TestJaegerReporterStats(t *testing.T) {
+	stats := new(jaegerReporterStats)
+	m := stats.instrument(jaeger.NewMetrics(jmetrics.NullFactory, nil))
+
+	m.ReporterSuccess.Inc(5)
+	m.ReporterFailure.Inc(2)
+	m.ReporterDropped.Inc(1)
+
+	assert.Equal(t, uint64(5), stats.Flushed())
+	assert.Equal(t, uint64(3), stats.Dropped())
+}
+
+func TestTracerCloser(t *testing.T) {
+	tests := []struct {
+		name          string
+		closer        *mockCloser
+		timeout       time.Duration
+		expectedError string
+	}{
+		{
+			name:    "Success",
+			closer:  &mockCloser{},
+			timeout: time.Second,
+		},
+		{
+			name:          "CloseError",
+			closer:        &mockCloser{CloseOutError: errors.New("close error")},
+			timeout:       time.Second,
+			expectedError: "close error",
+		},
+		{
+			name:          "DeadlineExceeded",
+			closer:        &mockCloser{delay: 100 * time.Millisecond},
+			timeout:       10 * time.Millisecond,
+			expectedError: "context deadline exceeded",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reporter := &statsReporter{Reporter: jaeger.NewNullReporter(), reported: 10}
+			c := newTracerCloser(tc.closer, reporter, &mockCounter{flushed: 7, dropped: 1}, &mockCounter{dropped: 2}, reporter)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+
+			err := c.Shutdown(ctx)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, SpanStats{Reported: 10, Flushed: 7, Dropped: 3}, c.Stats())
+
+			// The tracer is closed only once
+			c.Close()
+			assert.Equal(t, 1, tc.closer.CloseCalled)
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("OtherCloser", func(t *testing.T) {
+		closer := &mockCloser{}
+		stats, err := Shutdown(context.Background(), closer)
+
+		assert.NoError(t, err)
+		assert.Equal(t, SpanStats{}, stats)
+		assert.Equal(t, 1, closer.CloseCalled)
+	})
+
+	t.Run("LogReporter", func(t *testing.T) {
+		tracer, closer, err := NewTracer(Options{
+			LogReporter: &LogReporterOptions{Logger: log.NewVoidLogger()},
+		})
+		assert.NoError(t, err)
+
+		tracer.StartSpan("first").Finish()
+		tracer.StartSpan("second").Finish()
+
+		stats, err := Shutdown(context.Background(), closer)
+		assert.NoError(t, err)
+		assert.Equal(t, SpanStats{Reported: 2, Flushed: 2}, stats)
+	})
+
+	t.Run("TailSampling", func(t *testing.T) {
+		tracer, closer, err := NewTracer(Options{
+			LogReporter:  &LogReporterOptions{Logger: log.NewVoidLogger()},
+			TailSampling: &TailSamplingOptions{Probability: 1, MaxTraces: 1},
+		})
+		assert.NoError(t, err)
+
+		tracer.StartSpan("first").Finish()
+		tracer.StartSpan("second").Finish()
+
+		stats, err := Shutdown(context.Background(), closer)
+		assert.NoError(t, err)
+		assert.Equal(t, SpanStats{Reported: 2, Flushed: 1, Dropped: 1}, stats)
+	})
+
+	t.Run("AgentReporter", func(t *testing.T) {
+		tracer, closer, err := NewTracer(Options{})
+		assert.NoError(t, err)
+
+		tracer.StartSpan("first").Finish()
+
+		stats, err := Shutdown(context.Background(), closer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), stats.Reported)
+		assert.Equal(t, uint64(1), stats.Flushed+stats.Dropped)
+	})
+}
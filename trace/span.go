@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/request"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	opentracingLog "github.com/opentracing/opentracing-go/log"
+	"github.com/uber/jaeger-client-go"
+)
+
+// spanOptions contains optional parameters for spans created by Start and Do.
+type spanOptions struct {
+	tracer      opentracing.Tracer
+	tags        opentracing.Tags
+	metrics     *metrics.OpMetrics
+	followsFrom opentracing.SpanContext
+}
+
+// SpanOption sets optional parameters for spans created by Start and Do.
+type SpanOption func(*spanOptions)
+
+// WithTracer is the option for creating spans using a given tracer.
+// By default, the tracer of the span in the context is used and if there is no span, the global tracer is used.
+func WithTracer(tracer opentracing.Tracer) SpanOption {
+	return func(o *spanOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithTag is the option for setting a tag on spans.
+func WithTag(key string, val interface{}) SpanOption {
+	return func(o *spanOptions) {
+		if o.tags == nil {
+			o.tags = opentracing.Tags{}
+		}
+		o.tags[key] = val
+	}
+}
+
+// WithOpMetrics is the option for recording the duration of spans in seconds.
+// The metrics should have two labels for the span name and the operation success ("true" or "false") in order.
+func WithOpMetrics(m *metrics.OpMetrics) SpanOption {
+	return func(o *spanOptions) {
+		o.metrics = m
+	}
+}
+
+// followsFrom is the option for creating spans following from a span context instead of the span in the context.
+func followsFrom(spanCtx opentracing.SpanContext) SpanOption {
+	return func(o *spanOptions) {
+		o.followsFrom = spanCtx
+	}
+}
+
+// Start creates a new span as a child of the span in a context.
+// The returned context holds the new span, the request id, and a logger with the span fields.
+// The returned function finishes the span and should be deferred with a pointer to the returned error of the caller.
+// If the error is not nil or the caller panics, the span will be tagged with error.
+//
+//   ctx, finish := trace.Start(ctx, "create-user")
+//   defer finish(&err)
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, func(*error)) {
+	o := &spanOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	parent := opentracing.SpanFromContext(ctx)
+
+	tracer := o.tracer
+	if tracer == nil && parent != nil {
+		tracer = parent.Tracer()
+	}
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+
+	spanOpts := []opentracing.StartSpanOption{o.tags}
+	if o.followsFrom != nil {
+		spanOpts = append(spanOpts, opentracing.FollowsFrom(o.followsFrom))
+	} else if parent != nil {
+		spanOpts = append(spanOpts, opentracing.ChildOf(parent.Context()))
+	}
+
+	span := tracer.StartSpan(name, spanOpts...)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	logger := log.LoggerFromContext(ctx).With("operation", name)
+	if requestID, ok := request.IDFromContext(ctx); ok {
+		span.SetTag("requestId", requestID)
+	}
+	if sc, ok := span.Context().(jaeger.SpanContext); ok {
+		logger = logger.With("traceId", sc.TraceID().String(), "spanId", sc.SpanID().String())
+	}
+	ctx = log.ContextWithLogger(ctx, logger)
+
+	start := time.Now()
+
+	finish := func(errp *error) {
+		var err error
+		if errp != nil {
+			err = *errp
+		}
+
+		// recover only works here if finish is deferred by the caller
+		r := recover()
+		if r != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(
+				opentracingLog.String("event", "panic"),
+				opentracingLog.String("message", fmt.Sprint(r)),
+			)
+		} else if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(
+				opentracingLog.String("event", "error"),
+				opentracingLog.Error(err),
+			)
+		}
+
+		span.Finish()
+
+		if o.metrics != nil {
+			duration := time.Since(start).Seconds()
+			success := strconv.FormatBool(r == nil && err == nil)
+			if o.metrics.OpLatencyHist != nil {
+				o.metrics.OpLatencyHist.WithLabelValues(name, success).Observe(duration)
+			}
+			if o.metrics.OpLatencySumm != nil {
+				o.metrics.OpLatencySumm.WithLabelValues(name, success).Observe(duration)
+			}
+		}
+
+		if r != nil {
+			panic(r)
+		}
+	}
+
+	return ctx, finish
+}
+
+// Do calls a function in a new span created as a child of the span in a context.
+// The span will be tagged with error if the function returns an error or panics.
+// Panics are propagated to the caller after the span is finished.
+func Do(ctx context.Context, name string, f func(context.Context) error, opts ...SpanOption) (err error) {
+	ctx, finish := Start(ctx, name, opts...)
+	defer finish(&err)
+
+	return f(ctx)
+}
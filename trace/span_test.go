@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/log/logtest"
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/trace/tracetest"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanOptions(t *testing.T) {
+	tracer, _ := tracetest.New()
+	m := &metrics.OpMetrics{}
+	spanCtx := tracer.StartSpan("parent").Context()
+
+	tests := []struct {
+		name                string
+		opt                 SpanOption
+		expectedSpanOptions spanOptions
+	}{
+		{
+			"WithTracer",
+			WithTracer(tracer),
+			spanOptions{tracer: tracer},
+		},
+		{
+			"WithTag",
+			WithTag("db.type", "sql"),
+			spanOptions{tags: opentracing.Tags{"db.type": "sql"}},
+		},
+		{
+			"WithOpMetrics",
+			WithOpMetrics(m),
+			spanOptions{metrics: m},
+		},
+		{
+			"followsFrom",
+			followsFrom(spanCtx),
+			spanOptions{followsFrom: spanCtx},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := spanOptions{}
+			tc.opt(&o)
+
+			assert.Equal(t, tc.expectedSpanOptions, o)
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	t.Run("ChildOfContextSpan", func(t *testing.T) {
+		ctx, rec, finishParent := tracetest.ContextForTest(context.Background(), "handle")
+		ctx = request.ContextWithID(ctx, "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+		logger, logs := logtest.New()
+		ctx = log.ContextWithLogger(ctx, logger)
+
+		ctx, finish := Start(ctx, "query", WithTag("db.type", "sql"))
+		assert.NotNil(t, opentracing.SpanFromContext(ctx))
+		log.LoggerFromContext(ctx).Info("querying")
+		finish(nil)
+		finishParent()
+
+		rec.AssertChildOf(t, "query", "handle")
+		rec.AssertSpan(t, "query", "db.type", "sql", "requestId", "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+		rec.AssertNoError(t, "query")
+		logs.AssertLogged(t, log.InfoLevel, "querying", "operation", "query")
+	})
+
+	t.Run("WithTracer", func(t *testing.T) {
+		tracer, rec := tracetest.New()
+
+		_, finish := Start(context.Background(), "query", WithTracer(tracer))
+		finish(nil)
+
+		rec.AssertSpan(t, "query")
+		assert.Len(t, rec.Roots(), 1)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		tracer, rec := tracetest.New()
+
+		err := errors.New("connection refused")
+		_, finish := Start(context.Background(), "query", WithTracer(tracer))
+		finish(&err)
+
+		rec.AssertError(t, "query")
+		rec.AssertLogged(t, "query", "event", "error", "error", "connection refused")
+	})
+
+	t.Run("JaegerSpan", func(t *testing.T) {
+		tracer, closer, err := NewTracer(Options{})
+		assert.NoError(t, err)
+		defer closer.Close()
+
+		logger, logs := logtest.New()
+		ctx := log.ContextWithLogger(context.Background(), logger)
+
+		ctx, finish := Start(ctx, "query", WithTracer(tracer))
+		log.LoggerFromContext(ctx).Info("querying")
+		finish(nil)
+
+		entries := logs.Find(log.InfoLevel, "querying")
+		assert.Len(t, entries, 1)
+		assert.NotEmpty(t, entries[0].Fields["traceId"])
+		assert.NotEmpty(t, entries[0].Fields["spanId"])
+	})
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name            string
+		f               func(context.Context) error
+		expectedError   error
+		expectedPanic   bool
+		expectedSuccess string
+	}{
+		{
+			name: "Success",
+			f: func(ctx context.Context) error {
+				assert.NotNil(t, opentracing.SpanFromContext(ctx))
+				return nil
+			},
+			expectedSuccess: "true",
+		},
+		{
+			name: "Error",
+			f: func(ctx context.Context) error {
+				return errors.New("connection refused")
+			},
+			expectedError:   errors.New("connection refused"),
+			expectedSuccess: "false",
+		},
+		{
+			name: "Panic",
+			f: func(ctx context.Context) error {
+				panic("nil map")
+			},
+			expectedPanic:   true,
+			expectedSuccess: "false",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, rec := tracetest.New()
+			m := &metrics.OpMetrics{
+				OpLatencyHist: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "op_latency_seconds"}, []string{"op", "success"}),
+				OpLatencySumm: prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "op_latency_quantiles_seconds"}, []string{"op", "success"}),
+			}
+
+			call := func() error {
+				return Do(context.Background(), "query", tc.f, WithTracer(tracer), WithOpMetrics(m))
+			}
+
+			if tc.expectedPanic {
+				assert.PanicsWithValue(t, "nil map", func() { _ = call() })
+				rec.AssertError(t, "query")
+				rec.AssertLogged(t, "query", "event", "panic", "message", "nil map")
+			} else if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, call())
+				rec.AssertError(t, "query")
+			} else {
+				assert.NoError(t, call())
+				rec.AssertNoError(t, "query")
+			}
+
+			assert.Equal(t, 1, testutil.CollectAndCount(m.OpLatencyHist))
+			assert.Equal(t, 1, testutil.CollectAndCount(m.OpLatencySumm))
+			assert.True(t, m.OpLatencyHist.DeleteLabelValues("query", tc.expectedSuccess))
+			assert.True(t, m.OpLatencySumm.DeleteLabelValues("query", tc.expectedSuccess))
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package trace
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	defaultTailWindow           = 10 * time.Second
+	defaultTailMaxTraces        = 10000
+	defaultTailMaxSpansPerTrace = 1000
+	defaultTailMaxDecidedTraces = 100000
+
+	tailDecisionKept       = "kept"
+	tailDecisionSampledOut = "sampled_out"
+	tailDecisionDropped    = "dropped"
+)
+
+// TailSamplingOptions contains options for tail-based sampling.
+// Finished spans are buffered per trace and the sampling decision is made for the whole trace after the window.
+// The head sampler should sample all traces, so all spans are available for tail-based sampling.
+//   Window is the duration for buffering the spans of a trace after its first span is finished (default 10s).
+//   LatencyThreshold keeps traces having a span with a duration longer than or equal to it (zero disables it).
+//   Predicate keeps traces having a span whose tags match it (optional).
+//   Probability is the sampling probability between 0 and 1 for other traces (traces with errors are always kept).
+//   MaxTraces is the maximum number of traces buffered at the same time (default 10000).
+//   MaxSpansPerTrace is the maximum number of spans buffered for each trace (default 1000).
+//   MaxDecidedTraces is the maximum number of recently decided traces remembered for late spans (default 100000).
+// Spans finished after the decision for their trace (i.e. slow roots or asynchronous children) get the same decision,
+// so kept traces are not partial.
+type TailSamplingOptions struct {
+	Window           time.Duration
+	LatencyThreshold time.Duration
+	Predicate        func(opentracing.Tags) bool
+	Probability      float64
+	MaxTraces        int
+	MaxSpansPerTrace int
+	MaxDecidedTraces int
+}
+
+func (o *TailSamplingOptions) setDefaults() {
+	if o.Window <= 0 {
+		o.Window = defaultTailWindow
+	}
+
+	if o.MaxTraces <= 0 {
+		o.MaxTraces = defaultTailMaxTraces
+	}
+
+	if o.MaxSpansPerTrace <= 0 {
+		o.MaxSpansPerTrace = defaultTailMaxSpansPerTrace
+	}
+
+	if o.MaxDecidedTraces <= 0 {
+		o.MaxDecidedTraces = defaultTailMaxDecidedTraces
+	}
+}
+
+// tailTrace is a trace buffered by the tail-sampling reporter.
+type tailTrace struct {
+	spans    []*jaeger.Span
+	deadline time.Time
+	keep     bool
+}
+
+// tailDecision is the sampling decision made for a trace (kept, sampled_out, or dropped).
+type tailDecision struct {
+	traceID  jaeger.TraceID
+	decision string
+}
+
+// tailDecisions is a bounded set of recently decided traces evicting the least recently used ones.
+type tailDecisions struct {
+	max     int
+	list    *list.List
+	entries map[jaeger.TraceID]*list.Element
+}
+
+func newTailDecisions(max int) *tailDecisions {
+	return &tailDecisions{
+		max:     max,
+		list:    list.New(),
+		entries: map[jaeger.TraceID]*list.Element{},
+	}
+}
+
+// get returns the decision made for a trace if any.
+func (d *tailDecisions) get(traceID jaeger.TraceID) (string, bool) {
+	e, ok := d.entries[traceID]
+	if !ok {
+		return "", false
+	}
+
+	d.list.MoveToFront(e)
+
+	return e.Value.(tailDecision).decision, true
+}
+
+// add remembers the decision made for a trace.
+func (d *tailDecisions) add(traceID jaeger.TraceID, decision string) {
+	if e, ok := d.entries[traceID]; ok {
+		e.Value = tailDecision{traceID, decision}
+		d.list.MoveToFront(e)
+		return
+	}
+
+	d.entries[traceID] = d.list.PushFront(tailDecision{traceID, decision})
+
+	if d.list.Len() > d.max {
+		e := d.list.Back()
+		d.list.Remove(e)
+		delete(d.entries, e.Value.(tailDecision).traceID)
+	}
+}
+
+// tailMetrics includes metrics for the tail-sampling reporter.
+type tailMetrics struct {
+	buffered     prometheus.Gauge
+	traces       *prometheus.CounterVec
+	droppedSpans prometheus.Counter
+}
+
+// newTailMetrics creates the metrics for the tail-sampling reporter namespaced by the name of tracer.
+// If the metrics are already registered (i.e. by another tracer with the same name), the existing metrics are used.
+func newTailMetrics(name string, reg prometheus.Registerer) (*tailMetrics, error) {
+	namespace := metrics.LabelName(name)
+
+	m := &tailMetrics{
+		buffered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "trace_tail_sampling_buffered_traces",
+			Help:      "gauge metric for number of traces buffered for tail-based sampling",
+		}),
+		traces: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "trace_tail_sampling_traces_total",
+			Help:      "counter metric for total number of traces by tail-based sampling decision",
+		}, []string{"decision"}),
+		droppedSpans: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "trace_tail_sampling_dropped_spans_total",
+			Help:      "counter metric for total number of spans dropped due to tail-based sampling buffer limits",
+		}),
+	}
+
+	c, err := registerCollector(reg, m.buffered)
+	if err != nil {
+		return nil, err
+	}
+	m.buffered = c.(prometheus.Gauge)
+
+	if c, err = registerCollector(reg, m.traces); err != nil {
+		return nil, err
+	}
+	m.traces = c.(*prometheus.CounterVec)
+
+	if c, err = registerCollector(reg, m.droppedSpans); err != nil {
+		return nil, err
+	}
+	m.droppedSpans = c.(prometheus.Counter)
+
+	return m, nil
+}
+
+// registerCollector registers a collector and returns the existing one if it is already registered.
+func registerCollector(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// tailReporter is a Jaeger reporter implementing tail-based sampling.
+// The spans of kept traces are reported to the next reporter.
+type tailReporter struct {
+	sync.Mutex
+	opts    TailSamplingOptions
+	next    jaeger.Reporter
+	metrics *tailMetrics
+	rand    *rand.Rand
+	traces  map[jaeger.TraceID]*tailTrace
+	decided *tailDecisions
+	closed  bool
+	dropped uint64
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+func newTailReporter(name string, opts TailSamplingOptions, next jaeger.Reporter, reg prometheus.Registerer) (*tailReporter, error) {
+	if opts.Probability < 0 || opts.Probability > 1 {
+		return nil, fmt.Errorf("invalid tail sampling probability: %v", opts.Probability)
+	}
+
+	opts.setDefaults()
+
+	r := &tailReporter{
+		opts:    opts,
+		next:    next,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		traces:  map[jaeger.TraceID]*tailTrace{},
+		decided: newTailDecisions(opts.MaxDecidedTraces),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if reg != nil {
+		var err error
+		if r.metrics, err = newTailMetrics(name, reg); err != nil {
+			return nil, err
+		}
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// interesting returns true if a span is errored, slow, or matches the predicate.
+func (r *tailReporter) interesting(span *jaeger.Span) bool {
+	tags := span.Tags()
+
+	if isError, ok := tags["error"].(bool); ok && isError {
+		return true
+	}
+
+	if r.opts.LatencyThreshold > 0 && span.Duration() >= r.opts.LatencyThreshold {
+		return true
+	}
+
+	return r.opts.Predicate != nil && r.opts.Predicate(tags)
+}
+
+func (r *tailReporter) dropSpan(span *jaeger.Span) {
+	atomic.AddUint64(&r.dropped, 1)
+	if r.metrics != nil {
+		r.metrics.droppedSpans.Inc()
+	}
+	span.Release()
+}
+
+// Report buffers a finished span until the sampling decision is made for its trace.
+// If the decision is already made for its trace, the span gets the same decision.
+// If the buffer limits are reached, the span is dropped.
+// If the maximum number of traces is reached, the trace is dropped, so all of its spans are dropped.
+func (r *tailReporter) Report(span *jaeger.Span) {
+	span.Retain()
+	traceID := span.SpanContext().TraceID()
+	interesting := r.interesting(span)
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closed {
+		r.dropSpan(span)
+		return
+	}
+
+	if decision, ok := r.decided.get(traceID); ok {
+		switch decision {
+		case tailDecisionKept:
+			r.next.Report(span)
+			span.Release()
+		case tailDecisionDropped:
+			r.dropSpan(span)
+		default:
+			span.Release()
+		}
+		return
+	}
+
+	t, ok := r.traces[traceID]
+	if !ok {
+		if len(r.traces) >= r.opts.MaxTraces {
+			// The trace is counted once and its next spans are dropped by the decision
+			r.decided.add(traceID, tailDecisionDropped)
+			if r.metrics != nil {
+				r.metrics.traces.WithLabelValues(tailDecisionDropped).Inc()
+			}
+			r.dropSpan(span)
+			return
+		}
+
+		t = &tailTrace{deadline: time.Now().Add(r.opts.Window)}
+		r.traces[traceID] = t
+		if r.metrics != nil {
+			r.metrics.buffered.Inc()
+		}
+	}
+
+	if len(t.spans) >= r.opts.MaxSpansPerTrace {
+		r.dropSpan(span)
+		return
+	}
+
+	t.spans = append(t.spans, span)
+	t.keep = t.keep || interesting
+}
+
+// expired removes and returns the buffered traces whose windows are passed and makes the sampling decisions for them.
+// The decisions are remembered, so late spans of the traces get the same decisions.
+// If all is true, all buffered traces are returned and no more spans will be buffered.
+func (r *tailReporter) expired(now time.Time, all bool) []*tailTrace {
+	r.Lock()
+	defer r.Unlock()
+
+	r.closed = all
+
+	traces := []*tailTrace{}
+	for id, t := range r.traces {
+		if all || !now.Before(t.deadline) {
+			t.keep = t.keep || r.rand.Float64() < r.opts.Probability
+			if t.keep {
+				r.decided.add(id, tailDecisionKept)
+			} else {
+				r.decided.add(id, tailDecisionSampledOut)
+			}
+			traces = append(traces, t)
+			delete(r.traces, id)
+		}
+	}
+
+	if r.metrics != nil {
+		r.metrics.buffered.Sub(float64(len(traces)))
+	}
+
+	return traces
+}
+
+// decide reports the spans of kept traces.
+func (r *tailReporter) decide(traces []*tailTrace) {
+	for _, t := range traces {
+		if r.metrics != nil {
+			if t.keep {
+				r.metrics.traces.WithLabelValues(tailDecisionKept).Inc()
+			} else {
+				r.metrics.traces.WithLabelValues(tailDecisionSampledOut).Inc()
+			}
+		}
+
+		for _, span := range t.spans {
+			if t.keep {
+				r.next.Report(span)
+			}
+			span.Release()
+		}
+	}
+}
+
+func (r *tailReporter) run() {
+	defer close(r.done)
+
+	// Traces are checked a few times per window, so the decisions are not delayed much after the windows
+	ticker := time.NewTicker(r.opts.Window / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.decide(r.expired(now, false))
+
+		case <-r.closing:
+			r.decide(r.expired(time.Now(), true))
+			return
+		}
+	}
+}
+
+// Close makes sampling decisions for all buffered traces and closes the next reporter.
+func (r *tailReporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closing)
+		<-r.done
+		r.next.Close()
+	})
+}
+
+// Dropped returns the number of spans dropped so far due to the buffer limits.
+func (r *tailReporter) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
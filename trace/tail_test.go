@@ -0,0 +1,366 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+// memReporter keeps the spans after closing.
+type memReporter struct {
+	*jaeger.InMemoryReporter
+}
+
+func (r memReporter) Close() {}
+
+func TestNewTailReporter(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          TailSamplingOptions
+		reg           prometheus.Registerer
+		expectedError string
+		expectedOpts  TailSamplingOptions
+	}{
+		{
+			name:          "InvalidProbability",
+			opts:          TailSamplingOptions{Probability: 2},
+			expectedError: "invalid tail sampling probability: 2",
+		},
+		{
+			name: "Defaults",
+			opts: TailSamplingOptions{},
+			expectedOpts: TailSamplingOptions{
+				Window:           defaultTailWindow,
+				MaxTraces:        defaultTailMaxTraces,
+				MaxSpansPerTrace: defaultTailMaxSpansPerTrace,
+				MaxDecidedTraces: defaultTailMaxDecidedTraces,
+			},
+		},
+		{
+			name: "WithMetrics",
+			opts: TailSamplingOptions{
+				Window:           time.Second,
+				LatencyThreshold: 100 * time.Millisecond,
+				Probability:      0.1,
+				MaxTraces:        100,
+				MaxSpansPerTrace: 10,
+				MaxDecidedTraces: 1000,
+			},
+			reg: prometheus.NewRegistry(),
+			expectedOpts: TailSamplingOptions{
+				Window:           time.Second,
+				LatencyThreshold: 100 * time.Millisecond,
+				Probability:      0.1,
+				MaxTraces:        100,
+				MaxSpansPerTrace: 10,
+				MaxDecidedTraces: 1000,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newTailReporter("test", tc.opts, jaeger.NewNullReporter(), tc.reg)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, r)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedOpts, r.opts)
+				assert.Equal(t, tc.reg != nil, r.metrics != nil)
+				r.Close()
+			}
+		})
+	}
+
+	t.Run("SharedMetrics", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		r1, err := newTailReporter("service", TailSamplingOptions{}, jaeger.NewNullReporter(), reg)
+		assert.NoError(t, err)
+		defer r1.Close()
+
+		// Tracers with the same name share the metrics
+		r2, err := newTailReporter("service", TailSamplingOptions{}, jaeger.NewNullReporter(), reg)
+		assert.NoError(t, err)
+		defer r2.Close()
+		assert.True(t, r1.metrics.buffered == r2.metrics.buffered)
+
+		// Tracers with different names have their own metrics
+		r3, err := newTailReporter("worker", TailSamplingOptions{}, jaeger.NewNullReporter(), reg)
+		assert.NoError(t, err)
+		defer r3.Close()
+		assert.False(t, r1.metrics.buffered == r3.metrics.buffered)
+
+		families, err := reg.Gather()
+		assert.NoError(t, err)
+		names := []string{}
+		for _, family := range families {
+			names = append(names, family.GetName())
+		}
+		assert.Contains(t, names, "service_trace_tail_sampling_buffered_traces")
+		assert.Contains(t, names, "worker_trace_tail_sampling_buffered_traces")
+	})
+}
+
+func TestTailReporter(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          TailSamplingOptions
+		trace         func(opentracing.Tracer)
+		expectedSpans int
+	}{
+		{
+			name: "SampledOut",
+			opts: TailSamplingOptions{Probability: 0},
+			trace: func(tracer opentracing.Tracer) {
+				span := tracer.StartSpan("handle")
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				span.Finish()
+			},
+			expectedSpans: 0,
+		},
+		{
+			name: "Probability",
+			opts: TailSamplingOptions{Probability: 1},
+			trace: func(tracer opentracing.Tracer) {
+				span := tracer.StartSpan("handle")
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				span.Finish()
+			},
+			expectedSpans: 2,
+		},
+		{
+			name: "Error",
+			opts: TailSamplingOptions{Probability: 0},
+			trace: func(tracer opentracing.Tracer) {
+				span := tracer.StartSpan("handle")
+				child := tracer.StartSpan("query", opentracing.ChildOf(span.Context()))
+				ext.Error.Set(child, true)
+				child.Finish()
+				span.Finish()
+			},
+			expectedSpans: 2,
+		},
+		{
+			name: "LatencyThreshold",
+			opts: TailSamplingOptions{Probability: 0, LatencyThreshold: time.Second},
+			trace: func(tracer opentracing.Tracer) {
+				start := time.Now()
+				span := tracer.StartSpan("handle", opentracing.StartTime(start))
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				span.FinishWithOptions(opentracing.FinishOptions{FinishTime: start.Add(2 * time.Second)})
+			},
+			expectedSpans: 2,
+		},
+		{
+			name: "Predicate",
+			opts: TailSamplingOptions{
+				Probability: 0,
+				Predicate: func(tags opentracing.Tags) bool {
+					return tags["tenant"] == "acme"
+				},
+			},
+			trace: func(tracer opentracing.Tracer) {
+				span := tracer.StartSpan("handle")
+				span.SetTag("tenant", "acme")
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				span.Finish()
+			},
+			expectedSpans: 2,
+		},
+		{
+			name: "MaxTraces",
+			opts: TailSamplingOptions{Probability: 1, MaxTraces: 1},
+			trace: func(tracer opentracing.Tracer) {
+				tracer.StartSpan("first").Finish()
+				tracer.StartSpan("second").Finish()
+			},
+			expectedSpans: 1,
+		},
+		{
+			name: "MaxSpansPerTrace",
+			opts: TailSamplingOptions{Probability: 1, MaxSpansPerTrace: 2},
+			trace: func(tracer opentracing.Tracer) {
+				span := tracer.StartSpan("handle")
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+				span.Finish()
+			},
+			expectedSpans: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Window = 20 * time.Millisecond
+			next := jaeger.NewInMemoryReporter()
+			r, err := newTailReporter("test", tc.opts, next, nil)
+			assert.NoError(t, err)
+			defer r.Close()
+
+			tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), r)
+			defer closer.Close()
+
+			tc.trace(tracer)
+
+			// Spans are reported after the window
+			assert.Equal(t, 0, next.SpansSubmitted())
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, tc.expectedSpans, next.SpansSubmitted())
+		})
+	}
+}
+
+func TestTailReporterLateSpans(t *testing.T) {
+	tests := []struct {
+		name          string
+		probability   float64
+		expectedSpans int
+	}{
+		{"Kept", 1, 2},
+		{"SampledOut", 0, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next := jaeger.NewInMemoryReporter()
+			r, err := newTailReporter("test", TailSamplingOptions{Window: 20 * time.Millisecond, Probability: tc.probability}, next, nil)
+			assert.NoError(t, err)
+			defer r.Close()
+
+			tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), r)
+			defer closer.Close()
+
+			span := tracer.StartSpan("handle")
+			tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, tc.expectedSpans/2, next.SpansSubmitted())
+
+			// The root span finished after the decision gets the same decision
+			span.Finish()
+			assert.Equal(t, tc.expectedSpans, next.SpansSubmitted())
+		})
+	}
+}
+
+func TestTailDecisions(t *testing.T) {
+	d := newTailDecisions(2)
+	id1 := jaeger.TraceID{Low: 1}
+	id2 := jaeger.TraceID{Low: 2}
+	id3 := jaeger.TraceID{Low: 3}
+
+	d.add(id1, tailDecisionKept)
+	d.add(id2, tailDecisionSampledOut)
+
+	decision, ok := d.get(id1)
+	assert.True(t, ok)
+	assert.Equal(t, tailDecisionKept, decision)
+
+	// The least recently used decision is evicted
+	d.add(id3, tailDecisionDropped)
+	_, ok = d.get(id2)
+	assert.False(t, ok)
+
+	decision, ok = d.get(id1)
+	assert.True(t, ok)
+	assert.Equal(t, tailDecisionKept, decision)
+
+	decision, ok = d.get(id3)
+	assert.True(t, ok)
+	assert.Equal(t, tailDecisionDropped, decision)
+}
+
+func TestTailReporterDroppedTrace(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	next := jaeger.NewInMemoryReporter()
+	r, err := newTailReporter("test", TailSamplingOptions{Window: time.Hour, Probability: 1, MaxTraces: 1}, next, reg)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), r)
+	defer closer.Close()
+
+	tracer.StartSpan("first").Finish()
+
+	// All spans of a trace over the limit are dropped, but the trace is counted once
+	span := tracer.StartSpan("second")
+	for i := 0; i < 5; i++ {
+		tracer.StartSpan("query", opentracing.ChildOf(span.Context())).Finish()
+	}
+	span.Finish()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.buffered))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.traces.WithLabelValues(tailDecisionDropped)))
+	assert.Equal(t, float64(6), testutil.ToFloat64(r.metrics.droppedSpans))
+	assert.Equal(t, uint64(6), r.Dropped())
+}
+
+func TestTailReporterClose(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	next := memReporter{jaeger.NewInMemoryReporter()}
+	r, err := newTailReporter("test", TailSamplingOptions{Window: time.Hour, Probability: 1, MaxTraces: 1}, next, reg)
+	assert.NoError(t, err)
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), r)
+
+	tracer.StartSpan("first").Finish()
+	tracer.StartSpan("second").Finish()
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.buffered))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.traces.WithLabelValues(tailDecisionDropped)))
+
+	// Closing the tracer closes the reporter and reports all buffered traces
+	closer.Close()
+	assert.Equal(t, 1, next.SpansSubmitted())
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.metrics.buffered))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.traces.WithLabelValues(tailDecisionKept)))
+
+	// Spans reported after closing are dropped
+	tracer.StartSpan("third").Finish()
+	assert.Equal(t, 1, next.SpansSubmitted())
+	assert.Equal(t, uint64(2), r.Dropped())
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.droppedSpans))
+}
+
+func TestNewTracerWithTailSampling(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		expectedError string
+	}{
+		{
+			name: "InvalidProbability",
+			opts: Options{
+				TailSampling: &TailSamplingOptions{Probability: -1},
+			},
+			expectedError: "invalid tail sampling probability: -1",
+		},
+		{
+			name: "Success",
+			opts: Options{
+				PromReg:      prometheus.NewRegistry(),
+				TailSampling: &TailSamplingOptions{LatencyThreshold: time.Second, Probability: 0.1},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, closer, err := NewTracer(tc.opts)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, tracer)
+				closer.Close()
+			}
+		})
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
 	jconfig "github.com/uber/jaeger-client-go/config"
 	jmetrics "github.com/uber/jaeger-lib/metrics"
 	jprometheus "github.com/uber/jaeger-lib/metrics/prometheus"
 )
 
+const jaegerLoggerName = "jaeger"
+
 // jaegerLogger implements jaeger.Logger.
 type jaegerLogger struct {
 	logger *log.Logger
@@ -93,12 +96,20 @@ func NewCollectorReporter(collectorAddr string, logSpans bool) *jconfig.Reporter
 }
 
 // Options contains optional options for Tracer.
+// If AdaptiveSampler is set, it will be used instead of Sampler.
+// If Propagator is not set, span contexts are propagated using Jaeger headers.
+// If LogReporter is set, finished spans are logged instead of being reported to Jaeger.
+// If TailSampling is set, finished spans are buffered per trace and only errored, slow, or sampled traces are reported.
 type Options struct {
-	Name     string
-	Sampler  *jconfig.SamplerConfig
-	Reporter *jconfig.ReporterConfig
-	Logger   *log.Logger
-	PromReg  prometheus.Registerer
+	Name            string
+	Sampler         *jconfig.SamplerConfig
+	AdaptiveSampler *AdaptiveSamplerOptions
+	Reporter        *jconfig.ReporterConfig
+	Propagator      Propagator
+	Logger          *log.Logger
+	PromReg         prometheus.Registerer
+	TailSampling    *TailSamplingOptions
+	LogReporter     *LogReporterOptions
 }
 
 // NewTracer creates a new tracer.
@@ -107,33 +118,106 @@ func NewTracer(opts Options) (opentracing.Tracer, io.Closer, error) {
 		opts.Name = "tracer"
 	}
 
-	if opts.Sampler == nil {
-		opts.Sampler = NewConstSampler(true)
-	}
-
 	if opts.Reporter == nil {
 		opts.Reporter = NewAgentReporter("localhost:6831", false)
 	}
 
-	jgOpts := []jconfig.Option{}
+	var reporter jaeger.Reporter
+	if opts.LogReporter != nil {
+		reporter = newLogReporter(opts.Name, *opts.LogReporter)
+	}
+
+	return newTracer(opts, reporter)
+}
+
+// newTracer creates a new Jaeger tracer.
+// If reporter is nil, a reporter will be created from the reporter options.
+// The returned closer can be used with Shutdown.
+func newTracer(opts Options, reporter jaeger.Reporter) (opentracing.Tracer, io.Closer, error) {
+	var jgOpts []jconfig.Option
+
+	if opts.Sampler == nil {
+		opts.Sampler = NewConstSampler(true)
+	}
+
 	jgConfig := &jconfig.Configuration{
 		ServiceName: opts.Name,
 		Sampler:     opts.Sampler,
 		Reporter:    opts.Reporter,
 	}
 
+	if opts.AdaptiveSampler != nil {
+		sampler, err := NewAdaptiveSampler(*opts.AdaptiveSampler)
+		if err != nil {
+			return nil, nil, err
+		}
+		jgOpts = append(jgOpts, jconfig.Sampler(sampler))
+	}
+
+	if opts.Propagator != nil {
+		// HTTP headers are used by xhttp package and text maps are used by xgrpc package
+		codec := &propagatorCodec{opts.Propagator}
+		jgOpts = append(jgOpts,
+			jconfig.Injector(opentracing.HTTPHeaders, codec),
+			jconfig.Extractor(opentracing.HTTPHeaders, codec),
+			jconfig.Injector(opentracing.TextMap, codec),
+			jconfig.Extractor(opentracing.TextMap, codec),
+		)
+	}
+
+	var jlogger jaeger.Logger = jaeger.NullLogger
 	if opts.Logger != nil {
-		jlogger := &jaegerLogger{opts.Logger}
+		// The tracer logger is named, so its level can be overridden independently (i.e. "info,jaeger=warn")
+		jlogger = &jaegerLogger{opts.Logger.Named(jaegerLoggerName)}
 		loggerOpt := jconfig.Logger(jlogger)
 		jgOpts = append(jgOpts, loggerOpt)
 	}
 
+	var factory jmetrics.Factory = jmetrics.NullFactory
 	if opts.PromReg != nil {
 		regOpt := jprometheus.WithRegisterer(opts.PromReg)
-		factory := jprometheus.New(regOpt).Namespace(jmetrics.NSOptions{Name: opts.Name})
+		factory = jprometheus.New(regOpt).Namespace(jmetrics.NSOptions{Name: opts.Name})
 		metricsOpt := jconfig.Metrics(factory)
 		jgOpts = append(jgOpts, metricsOpt)
 	}
 
-	return jgConfig.NewTracer(jgOpts...)
+	// The reporter is created here, so the flushed and dropped spans can be counted
+	counters := []interface{}{}
+	if reporter == nil {
+		if opts.Reporter == nil {
+			opts.Reporter = &jconfig.ReporterConfig{}
+		}
+
+		stats := new(jaegerReporterStats)
+		reporterMetrics := stats.instrument(jaeger.NewMetrics(factory, nil))
+
+		var err error
+		if reporter, err = opts.Reporter.NewReporter(opts.Name, reporterMetrics, jlogger); err != nil {
+			return nil, nil, err
+		}
+		counters = append(counters, stats)
+	} else {
+		counters = append(counters, reporter)
+	}
+
+	if opts.TailSampling != nil {
+		tailReporter, err := newTailReporter(opts.Name, *opts.TailSampling, reporter, opts.PromReg)
+		if err != nil {
+			reporter.Close()
+			return nil, nil, err
+		}
+		reporter = tailReporter
+		counters = append(counters, tailReporter)
+	}
+
+	statsReporter := &statsReporter{Reporter: reporter}
+	jgOpts = append(jgOpts, jconfig.Reporter(statsReporter))
+
+	tracer, closer, err := jgConfig.NewTracer(jgOpts...)
+	if err != nil {
+		reporter.Close()
+		return nil, nil, err
+	}
+
+	return tracer, newTracerCloser(closer, statsReporter, counters...), nil
 }
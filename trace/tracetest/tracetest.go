@@ -0,0 +1,356 @@
+// Package tracetest provides a recording tracer and assertion helpers for testing traces.
+package tracetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// TestingT is the subset of testing.TB used by assertion helpers.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Span is a finished span captured by a recorder.
+type Span = mocktracer.MockSpan
+
+// Tree is the expected shape of a trace.
+// A tree matches a span if the operation names are equal and every child tree matches a distinct child span.
+type Tree struct {
+	Operation string
+	Children  []Tree
+}
+
+// String returns the expected trace as nested operation names.
+func (t Tree) String() string {
+	if len(t.Children) == 0 {
+		return t.Operation
+	}
+
+	children := make([]string, len(t.Children))
+	for i, c := range t.Children {
+		children[i] = c.String()
+	}
+
+	return fmt.Sprintf("%s(%s)", t.Operation, strings.Join(children, ", "))
+}
+
+// equal returns true if a captured value and an expected value are equal.
+// Values are also compared by their string representations, so int and int64 values or string-ified values match.
+func equal(actual, expected interface{}) bool {
+	return reflect.DeepEqual(actual, expected) || fmt.Sprint(actual) == fmt.Sprint(expected)
+}
+
+// hasTags returns true if the span has all tag key-value pairs.
+func hasTags(span *Span, kv ...interface{}) bool {
+	tags := span.Tags()
+	for i := 0; i+1 < len(kv); i += 2 {
+		v, ok := tags[fmt.Sprint(kv[i])]
+		if !ok || !equal(v, kv[i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasLog returns true if the span has a log record with all field key-value pairs.
+func hasLog(span *Span, kv ...interface{}) bool {
+	for _, record := range span.Logs() {
+		fields := map[string]string{}
+		for _, f := range record.Fields {
+			fields[f.Key] = f.ValueString
+		}
+
+		matched := true
+		for i := 0; i+1 < len(kv); i += 2 {
+			v, ok := fields[fmt.Sprint(kv[i])]
+			if !ok || v != fmt.Sprint(kv[i+1]) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasError returns true if the span is tagged with error.
+func hasError(span *Span) bool {
+	v, ok := span.Tag("error").(bool)
+	return ok && v
+}
+
+// Recorder captures finished spans of a tracer.
+type Recorder struct {
+	tracer *mocktracer.MockTracer
+}
+
+// Tracer returns the recording tracer.
+func (r *Recorder) Tracer() opentracing.Tracer {
+	return r.tracer
+}
+
+// Spans returns all captured spans ordered by their start times.
+func (r *Recorder) Spans() []*Span {
+	spans := r.tracer.FinishedSpans()
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+
+	return spans
+}
+
+// Reset removes all captured spans.
+func (r *Recorder) Reset() {
+	r.tracer.Reset()
+}
+
+// FindSpans returns the captured spans with a given operation name and tag key-value pairs.
+func (r *Recorder) FindSpans(operation string, kv ...interface{}) []*Span {
+	spans := []*Span{}
+	for _, s := range r.Spans() {
+		if s.OperationName == operation && hasTags(s, kv...) {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// Parent returns the captured parent of a span.
+// It returns nil if the span is a root span or its parent is not captured (i.e. a remote parent).
+func (r *Recorder) Parent(span *Span) *Span {
+	if span.ParentID == 0 {
+		return nil
+	}
+
+	for _, s := range r.Spans() {
+		if s.SpanContext.TraceID == span.SpanContext.TraceID && s.SpanContext.SpanID == span.ParentID {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// Children returns the captured child spans of a span.
+func (r *Recorder) Children(span *Span) []*Span {
+	spans := []*Span{}
+	for _, s := range r.Spans() {
+		if s.SpanContext.TraceID == span.SpanContext.TraceID && s.ParentID == span.SpanContext.SpanID {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// Roots returns the captured spans that have no captured parent.
+func (r *Recorder) Roots() []*Span {
+	spans := []*Span{}
+	for _, s := range r.Spans() {
+		if r.Parent(s) == nil {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// matches returns true if a tree matches a span and its descendants.
+func (r *Recorder) matches(span *Span, tree Tree) bool {
+	if span.OperationName != tree.Operation {
+		return false
+	}
+
+	children := r.Children(span)
+	if len(children) != len(tree.Children) {
+		return false
+	}
+
+	used := make([]bool, len(children))
+	var match func(i int) bool
+	match = func(i int) bool {
+		if i == len(tree.Children) {
+			return true
+		}
+
+		for j, child := range children {
+			if !used[j] && r.matches(child, tree.Children[i]) {
+				used[j] = true
+				if match(i + 1) {
+					return true
+				}
+				used[j] = false
+			}
+		}
+
+		return false
+	}
+
+	return match(0)
+}
+
+// AssertSpan asserts a span with a given operation name and tag key-value pairs is captured.
+func (r *Recorder) AssertSpan(t TestingT, operation string, kv ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if len(r.FindSpans(operation, kv...)) == 0 {
+		t.Errorf("no span with operation %q and tags %v found in:\n%s", operation, kv, r)
+		return false
+	}
+
+	return true
+}
+
+// AssertNoSpan asserts no span with a given operation name and tag key-value pairs is captured.
+func (r *Recorder) AssertNoSpan(t TestingT, operation string, kv ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if len(r.FindSpans(operation, kv...)) > 0 {
+		t.Errorf("unexpected span with operation %q and tags %v found in:\n%s", operation, kv, r)
+		return false
+	}
+
+	return true
+}
+
+// AssertChildOf asserts a span with a given operation name is captured as a child of a span with another operation name.
+func (r *Recorder) AssertChildOf(t TestingT, child, parent string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, s := range r.FindSpans(child) {
+		if p := r.Parent(s); p != nil && p.OperationName == parent {
+			return true
+		}
+	}
+
+	t.Errorf("no span with operation %q as a child of span with operation %q found in:\n%s", child, parent, r)
+	return false
+}
+
+// AssertLogged asserts a span with a given operation name has a log record with given field key-value pairs.
+func (r *Recorder) AssertLogged(t TestingT, operation string, kv ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, s := range r.FindSpans(operation) {
+		if hasLog(s, kv...) {
+			return true
+		}
+	}
+
+	t.Errorf("no span with operation %q and log fields %v found in:\n%s", operation, kv, r)
+	return false
+}
+
+// AssertError asserts a span with a given operation name is tagged with error.
+func (r *Recorder) AssertError(t TestingT, operation string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, s := range r.FindSpans(operation) {
+		if hasError(s) {
+			return true
+		}
+	}
+
+	t.Errorf("no span with operation %q tagged with error found in:\n%s", operation, r)
+	return false
+}
+
+// AssertNoError asserts no span with a given operation name is tagged with error.
+func (r *Recorder) AssertNoError(t TestingT, operation string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, s := range r.FindSpans(operation) {
+		if hasError(s) {
+			t.Errorf("unexpected span with operation %q tagged with error found in:\n%s", operation, r)
+			return false
+		}
+	}
+
+	return true
+}
+
+// AssertTree asserts a trace with a given shape is captured.
+func (r *Recorder) AssertTree(t TestingT, tree Tree) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, s := range r.Roots() {
+		if r.matches(s, tree) {
+			return true
+		}
+	}
+
+	t.Errorf("no trace matching %s found in:\n%s", tree, r)
+	return false
+}
+
+// write writes a span and its descendants one per line.
+func (r *Recorder) write(buf *bytes.Buffer, span *Span, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(span.OperationName)
+	if tags := span.Tags(); len(tags) > 0 {
+		fmt.Fprintf(buf, " %v", tags)
+	}
+	buf.WriteByte('\n')
+
+	for _, c := range r.Children(span) {
+		r.write(buf, c, depth+1)
+	}
+}
+
+// String returns the captured traces with child spans indented under their parents.
+func (r *Recorder) String() string {
+	var buf bytes.Buffer
+	for _, s := range r.Roots() {
+		r.write(&buf, s, 0)
+	}
+
+	return buf.String()
+}
+
+// New creates a new tracer capturing all finished spans.
+// The tracer propagates span contexts using the OpenTracing mock format.
+func New() (opentracing.Tracer, *Recorder) {
+	r := &Recorder{
+		tracer: mocktracer.New(),
+	}
+
+	return r.tracer, r
+}
+
+// ContextForTest takes in a context and inserts a new span created by a recording tracer.
+// For use in tests only, to assert on spans of functions expecting a span in their context.
+// The returned function finishes the span.
+func ContextForTest(ctx context.Context, operation string) (context.Context, *Recorder, func()) {
+	tracer, r := New()
+	span := tracer.StartSpan(operation)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	return ctx, r, span.Finish
+}
@@ -0,0 +1,260 @@
+package tracetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockT struct {
+	ErrorfCalled bool
+	ErrorfMsg    string
+}
+
+func (m *mockT) Errorf(format string, args ...interface{}) {
+	m.ErrorfCalled = true
+	m.ErrorfMsg = fmt.Sprintf(format, args...)
+}
+
+// record creates the following trace:
+//
+//	handle
+//	  query (db.type=sql)
+//	  call (error=true)
+//	    retry
+func record() *Recorder {
+	tracer, r := New()
+
+	root := tracer.StartSpan("handle")
+	root.SetTag("http.method", "GET")
+	root.SetTag("http.status_code", 500)
+
+	query := tracer.StartSpan("query", opentracing.ChildOf(root.Context()))
+	query.SetTag("db.type", "sql")
+	query.Finish()
+
+	call := tracer.StartSpan("call", opentracing.ChildOf(root.Context()))
+	ext.Error.Set(call, true)
+	call.LogKV("event", "error", "message", "connection refused")
+
+	retry := tracer.StartSpan("retry", opentracing.ChildOf(call.Context()))
+	retry.Finish()
+
+	call.Finish()
+	root.Finish()
+
+	return r
+}
+
+func TestTreeString(t *testing.T) {
+	tests := []struct {
+		name           string
+		tree           Tree
+		expectedString string
+	}{
+		{
+			name:           "Leaf",
+			tree:           Tree{Operation: "handle"},
+			expectedString: "handle",
+		},
+		{
+			name: "Nested",
+			tree: Tree{
+				Operation: "handle",
+				Children: []Tree{
+					{Operation: "query"},
+					{Operation: "call", Children: []Tree{{Operation: "retry"}}},
+				},
+			},
+			expectedString: "handle(query, call(retry))",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedString, tc.tree.String())
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name          string
+		actual        interface{}
+		expected      interface{}
+		expectedEqual bool
+	}{
+		{"Equal", "GET", "GET", true},
+		{"DifferentTypes", int64(500), 500, true},
+		{"StringValue", 500, "500", true},
+		{"NotEqual", "GET", "POST", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedEqual, equal(tc.actual, tc.expected))
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := record()
+
+	spans := r.Spans()
+	assert.Len(t, spans, 4)
+	assert.Equal(t, "handle", spans[0].OperationName)
+
+	roots := r.Roots()
+	assert.Len(t, roots, 1)
+	assert.Equal(t, "handle", roots[0].OperationName)
+	assert.Nil(t, r.Parent(roots[0]))
+
+	children := r.Children(roots[0])
+	assert.Len(t, children, 2)
+	assert.Equal(t, "query", children[0].OperationName)
+	assert.Equal(t, "call", children[1].OperationName)
+	assert.Equal(t, roots[0], r.Parent(children[1]))
+
+	assert.Len(t, r.FindSpans("query"), 1)
+	assert.Len(t, r.FindSpans("query", "db.type", "sql"), 1)
+	assert.Len(t, r.FindSpans("query", "db.type", "nosql"), 0)
+	assert.Len(t, r.FindSpans("handle", "http.status_code", "500"), 1)
+
+	assert.Equal(t, "handle map[http.method:GET http.status_code:500]\n  query map[db.type:sql]\n  call map[error:true]\n    retry\n", r.String())
+
+	r.Reset()
+	assert.Len(t, r.Spans(), 0)
+	assert.Equal(t, "", r.String())
+}
+
+func TestRecorderAssertions(t *testing.T) {
+	r := record()
+
+	tests := []struct {
+		name           string
+		assert         func(TestingT) bool
+		expectedResult bool
+	}{
+		{
+			name:           "AssertSpan",
+			assert:         func(t TestingT) bool { return r.AssertSpan(t, "handle", "http.method", "GET") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertSpanFails",
+			assert:         func(t TestingT) bool { return r.AssertSpan(t, "handle", "http.method", "POST") },
+			expectedResult: false,
+		},
+		{
+			name:           "AssertNoSpan",
+			assert:         func(t TestingT) bool { return r.AssertNoSpan(t, "publish") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertNoSpanFails",
+			assert:         func(t TestingT) bool { return r.AssertNoSpan(t, "query") },
+			expectedResult: false,
+		},
+		{
+			name:           "AssertChildOf",
+			assert:         func(t TestingT) bool { return r.AssertChildOf(t, "retry", "call") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertChildOfFails",
+			assert:         func(t TestingT) bool { return r.AssertChildOf(t, "retry", "handle") },
+			expectedResult: false,
+		},
+		{
+			name:           "AssertLogged",
+			assert:         func(t TestingT) bool { return r.AssertLogged(t, "call", "event", "error") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertLoggedFails",
+			assert:         func(t TestingT) bool { return r.AssertLogged(t, "query", "event", "error") },
+			expectedResult: false,
+		},
+		{
+			name:           "AssertError",
+			assert:         func(t TestingT) bool { return r.AssertError(t, "call") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertErrorFails",
+			assert:         func(t TestingT) bool { return r.AssertError(t, "query") },
+			expectedResult: false,
+		},
+		{
+			name:           "AssertNoError",
+			assert:         func(t TestingT) bool { return r.AssertNoError(t, "query") },
+			expectedResult: true,
+		},
+		{
+			name:           "AssertNoErrorFails",
+			assert:         func(t TestingT) bool { return r.AssertNoError(t, "call") },
+			expectedResult: false,
+		},
+		{
+			name: "AssertTree",
+			assert: func(t TestingT) bool {
+				return r.AssertTree(t, Tree{
+					Operation: "handle",
+					Children: []Tree{
+						{Operation: "call", Children: []Tree{{Operation: "retry"}}},
+						{Operation: "query"},
+					},
+				})
+			},
+			expectedResult: true,
+		},
+		{
+			name: "AssertTreeFails",
+			assert: func(t TestingT) bool {
+				return r.AssertTree(t, Tree{
+					Operation: "handle",
+					Children: []Tree{
+						{Operation: "call"},
+						{Operation: "query"},
+					},
+				})
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mt := new(mockT)
+			result := tc.assert(mt)
+
+			assert.Equal(t, tc.expectedResult, result)
+			assert.Equal(t, !tc.expectedResult, mt.ErrorfCalled)
+			if !tc.expectedResult {
+				assert.Contains(t, mt.ErrorfMsg, "handle")
+			}
+		})
+	}
+}
+
+func TestContextForTest(t *testing.T) {
+	ctx, r, finish := ContextForTest(context.Background(), "test")
+
+	span := opentracing.SpanFromContext(ctx)
+	assert.NotNil(t, span)
+
+	child, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.Tracer(), "child")
+	ext.Error.Set(child, true)
+	child.LogKV("error", errors.New("failed"))
+	child.Finish()
+	finish()
+
+	r.AssertTree(t, Tree{Operation: "test", Children: []Tree{{Operation: "child"}}})
+	r.AssertError(t, "child")
+	r.AssertLogged(t, "child", "error", "failed")
+}
@@ -9,11 +9,13 @@ import (
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/resilience"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	opentracingLog "github.com/opentracing/opentracing-go/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -32,6 +34,12 @@ type ClientInterceptor struct {
 	logger  *log.Logger
 	metrics *metrics.RequestMetrics
 	tracer  opentracing.Tracer
+
+	mf                *metrics.Factory
+	retry             *retryPolicy
+	timeout           time.Duration
+	breakers          *resilience.Breakers
+	resilienceMetrics *resilienceMetrics
 }
 
 // ClientInterceptorOption sets optional parameters for client interceptor.
@@ -54,6 +62,7 @@ func ClientMetrics(mf *metrics.Factory) ClientInterceptorOption {
 	}
 
 	return func(i *ClientInterceptor) {
+		i.mf = mf
 		i.metrics = metrics
 	}
 }
@@ -80,6 +89,27 @@ func ClientFilter(pkg, service, method string) ClientInterceptorOption {
 	}
 }
 
+// ClientRetry is the option for client interceptor to retry failed requests with exponential backoff by RetryInterceptor.
+func ClientRetry(opts RetryOptions) ClientInterceptorOption {
+	return func(i *ClientInterceptor) {
+		i.retry = newRetryPolicy(opts)
+	}
+}
+
+// ClientTimeout is the option for client interceptor to apply a timeout to every attempt of requests by TimeoutInterceptor.
+func ClientTimeout(timeout time.Duration) ClientInterceptorOption {
+	return func(i *ClientInterceptor) {
+		i.timeout = timeout
+	}
+}
+
+// ClientCircuitBreaker is the option for client interceptor to use a circuit breaker per target by CircuitBreakerInterceptor.
+func ClientCircuitBreaker(opts resilience.BreakerOptions) ClientInterceptorOption {
+	return func(i *ClientInterceptor) {
+		i.breakers = resilience.NewBreakers(opts, i.breakerStateChanged)
+	}
+}
+
 // NewClientInterceptor creates a new instance of gRPC client interceptor.
 func NewClientInterceptor(name string, opts ...ClientInterceptorOption) *ClientInterceptor {
 	ci := &ClientInterceptor{
@@ -91,9 +121,30 @@ func NewClientInterceptor(name string, opts ...ClientInterceptorOption) *ClientI
 		opt(ci)
 	}
 
+	// Metrics for retries, timeouts, and circuit breakers are created only if they are enabled
+	if ci.mf != nil && (ci.retry != nil || ci.timeout > 0 || ci.breakers != nil) {
+		ci.resilienceMetrics = newResilienceMetrics(ci.mf)
+	}
+
 	return ci
 }
 
+// observed parses a full method and determines whether or not it is observed (not filtered).
+func (i *ClientInterceptor) observed(fullMethod string) (string, string, string, bool) {
+	pkg, service, method, ok := parseMethod(fullMethod)
+	if !ok {
+		return "", "", "", false
+	}
+
+	for _, f := range i.filters {
+		if f.matches(pkg, service, method) {
+			return "", "", "", false
+		}
+	}
+
+	return pkg, service, method, true
+}
+
 func (i *ClientInterceptor) createSpan(ctx context.Context) opentracing.Span {
 	var span opentracing.Span
 
@@ -180,6 +231,7 @@ func (i *ClientInterceptor) UnaryInterceptor(ctx context.Context, fullMethod str
 
 		// Propagate the current trace
 		ctx = i.injectSpan(ctx, span)
+		ctx = opentracing.ContextWithSpan(ctx, span)
 	}
 
 	// Invoke the gRPC method
@@ -190,6 +242,7 @@ func (i *ClientInterceptor) UnaryInterceptor(ctx context.Context, fullMethod str
 
 	// Logging
 	if i.logger != nil {
+		message := fmt.Sprintf("%s %s.%s.%s %f", clientKind, pkg, service, method, duration)
 		pairs := []interface{}{
 			"grpc.kind", clientKind,
 			"grpc.package", pkg,
@@ -198,7 +251,6 @@ func (i *ClientInterceptor) UnaryInterceptor(ctx context.Context, fullMethod str
 			"grpc.stream", stream,
 			"grpc.success", success,
 			"responseTime", duration,
-			"message", fmt.Sprintf("%s %s.%s.%s %f", clientKind, pkg, service, method, duration),
 		}
 
 		if err != nil {
@@ -209,9 +261,9 @@ func (i *ClientInterceptor) UnaryInterceptor(ctx context.Context, fullMethod str
 		pairs = append(pairs, "requestId", requestID)
 
 		if success {
-			i.logger.InfoKV(pairs...)
+			i.logger.InfoKV(append(pairs, "message", message)...)
 		} else {
-			i.logger.ErrorKV(pairs...)
+			i.logger.ErrorE(err, message, pairs...)
 		}
 	}
 
@@ -241,6 +293,201 @@ func (i *ClientInterceptor) UnaryInterceptor(ctx context.Context, fullMethod str
 	return err
 }
 
+// startAttempt creates a child span for an attempt of a gRPC request.
+func (i *ClientInterceptor) startAttempt(ctx context.Context, attempt int) (context.Context, opentracing.Span) {
+	if i.tracer == nil {
+		return ctx, nil
+	}
+
+	spanOpts := []opentracing.StartSpanOption{opentracing.Tag{Key: "attempt", Value: attempt}}
+	if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
+		spanOpts = append(spanOpts, opentracing.ChildOf(parentSpan.Context()))
+	}
+
+	span := i.tracer.StartSpan(clientAttemptSpanName, spanOpts...)
+
+	return opentracing.ContextWithSpan(ctx, span), span
+}
+
+// RetryInterceptor is the gRPC UnaryClientInterceptor for retrying failed requests with exponential backoff and jitter.
+// Idempotent methods are retried for retryable status codes.
+// Every attempt is counted by metrics and traced by a child span, and every retry is logged.
+// It should be chained after UnaryInterceptor, so attempt spans are children of the client span.
+func (i *ClientInterceptor) RetryInterceptor(ctx context.Context, fullMethod string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if i.retry == nil {
+		return invoker(ctx, fullMethod, req, res, cc, opts...)
+	}
+
+	pkg, service, method, observed := i.observed(fullMethod)
+	retryable := i.retry.retryable(fullMethod)
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx := ctx
+		var span opentracing.Span
+		if observed {
+			attemptCtx, span = i.startAttempt(ctx, attempt)
+		}
+
+		// Invoke the gRPC method
+		err := invoker(attemptCtx, fullMethod, req, res, cc, opts...)
+
+		if observed {
+			if i.resilienceMetrics != nil {
+				i.resilienceMetrics.attempts.WithLabelValues(pkg, service, method, strconv.Itoa(attempt)).Inc()
+			}
+
+			if span != nil {
+				span.SetTag("grpc.code", status.Code(err).String())
+				if err != nil {
+					ext.Error.Set(span, true)
+					span.LogFields(
+						opentracingLog.String("grpc.error", err.Error()),
+					)
+				}
+				span.Finish()
+			}
+		}
+
+		if !retryable || attempt >= i.retry.maxAttempts || ctx.Err() != nil || !i.retry.shouldRetry(err) {
+			return err
+		}
+
+		delay := i.retry.backoff.Delay(attempt)
+
+		if observed && i.logger != nil {
+			pairs := []interface{}{
+				"grpc.kind", clientKind,
+				"grpc.package", pkg,
+				"grpc.service", service,
+				"grpc.method", method,
+				"grpc.error", err.Error(),
+				"attempt", attempt,
+				"delay", delay.Seconds(),
+				"message", fmt.Sprintf("retrying %s.%s.%s after attempt %d", pkg, service, method, attempt),
+			}
+
+			if requestID, _ := request.IDFromContext(ctx); requestID != "" {
+				pairs = append(pairs, "requestId", requestID)
+			}
+
+			i.logger.WarnKV(pairs...)
+		}
+
+		if err := resilience.Wait(ctx, delay); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+// TimeoutInterceptor is the gRPC UnaryClientInterceptor for applying a timeout to every attempt of requests.
+// Timed-out attempts are counted by metrics, logged, and logged on the span in the context if any.
+func (i *ClientInterceptor) TimeoutInterceptor(ctx context.Context, fullMethod string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if i.timeout <= 0 {
+		return invoker(ctx, fullMethod, req, res, cc, opts...)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	// Invoke the gRPC method
+	err := invoker(attemptCtx, fullMethod, req, res, cc, opts...)
+
+	// Only timeouts of this interceptor are reported and not the ones of the original context
+	if err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		if pkg, service, method, ok := i.observed(fullMethod); ok {
+			if i.resilienceMetrics != nil {
+				i.resilienceMetrics.timeouts.WithLabelValues(pkg, service, method).Inc()
+			}
+
+			if i.logger != nil {
+				pairs := []interface{}{
+					"grpc.kind", clientKind,
+					"grpc.package", pkg,
+					"grpc.service", service,
+					"grpc.method", method,
+					"timeout", i.timeout.Seconds(),
+					"message", fmt.Sprintf("%s.%s.%s timed out after %s", pkg, service, method, i.timeout),
+				}
+
+				if requestID, _ := request.IDFromContext(ctx); requestID != "" {
+					pairs = append(pairs, "requestId", requestID)
+				}
+
+				i.logger.WarnKV(pairs...)
+			}
+
+			if span := opentracing.SpanFromContext(ctx); span != nil {
+				span.LogFields(
+					opentracingLog.String("event", "timeout"),
+					opentracingLog.Float64("timeout", i.timeout.Seconds()),
+				)
+			}
+		}
+	}
+
+	return err
+}
+
+// CircuitBreakerInterceptor is the gRPC UnaryClientInterceptor for stopping requests to a target after consecutive failures.
+// Unknown, DeadlineExceeded, Internal, Unavailable, and DataLoss status codes are counted as failures.
+// When the circuit breaker of a target is open, requests fail with resilience.ErrOpen without being sent.
+// Rejected requests are counted by metrics and state changes are logged and reported by a gauge metric.
+func (i *ClientInterceptor) CircuitBreakerInterceptor(ctx context.Context, fullMethod string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if i.breakers == nil {
+		return invoker(ctx, fullMethod, req, res, cc, opts...)
+	}
+
+	target := cc.Target()
+	breaker := i.breakers.Get(target)
+
+	generation, err := breaker.Allow()
+	if err != nil {
+		if _, _, _, ok := i.observed(fullMethod); ok {
+			if i.resilienceMetrics != nil {
+				i.resilienceMetrics.breakerRejections.WithLabelValues(target).Inc()
+			}
+
+			if span := opentracing.SpanFromContext(ctx); span != nil {
+				span.LogFields(
+					opentracingLog.String("event", "circuit breaker open"),
+					opentracingLog.String("target", target),
+				)
+			}
+		}
+
+		return err
+	}
+
+	// Invoke the gRPC method
+	err = invoker(ctx, fullMethod, req, res, cc, opts...)
+
+	// Requests cancelled by callers are neither failures nor successes of the target
+	if ctx.Err() != nil {
+		breaker.Cancel(generation)
+	} else {
+		breaker.Record(generation, !breakerFailureCodes[status.Code(err)])
+	}
+
+	return err
+}
+
+// breakerStateChanged reports a state change of the circuit breaker of a target.
+func (i *ClientInterceptor) breakerStateChanged(target string, from, to resilience.State) {
+	if i.resilienceMetrics != nil {
+		i.resilienceMetrics.breakerState.WithLabelValues(target).Set(float64(to))
+	}
+
+	if i.logger != nil {
+		i.logger.WarnKV(
+			"grpc.kind", clientKind,
+			"target", target,
+			"from", from.String(),
+			"to", to.String(),
+			"message", fmt.Sprintf("circuit breaker for %s changed from %s to %s", target, from, to),
+		)
+	}
+}
+
 // StreamInterceptor is the gRPC StreamClientInterceptor for logging, metrics, and tracing.
 func (i *ClientInterceptor) StreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, fullMethod string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
 	stream := "true"
@@ -288,6 +535,7 @@ func (i *ClientInterceptor) StreamInterceptor(ctx context.Context, desc *grpc.St
 
 	// Logging
 	if i.logger != nil {
+		message := fmt.Sprintf("%s %s.%s.%s %f", clientKind, pkg, service, method, duration)
 		pairs := []interface{}{
 			"grpc.kind", clientKind,
 			"grpc.package", pkg,
@@ -296,7 +544,6 @@ func (i *ClientInterceptor) StreamInterceptor(ctx context.Context, desc *grpc.St
 			"grpc.stream", stream,
 			"grpc.success", success,
 			"responseTime", duration,
-			"message", fmt.Sprintf("%s %s.%s.%s %f", clientKind, pkg, service, method, duration),
 		}
 
 		if err != nil {
@@ -307,9 +554,9 @@ func (i *ClientInterceptor) StreamInterceptor(ctx context.Context, desc *grpc.St
 		pairs = append(pairs, "requestId", requestID)
 
 		if success {
-			i.logger.InfoKV(pairs...)
+			i.logger.InfoKV(append(pairs, "message", message)...)
 		} else {
-			i.logger.ErrorKV(pairs...)
+			i.logger.ErrorE(err, message, pairs...)
 		}
 	}
 
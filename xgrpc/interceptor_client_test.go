@@ -12,6 +12,7 @@ import (
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/resilience"
 	"github.com/moorara/observe/trace"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
@@ -19,8 +20,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	promModel "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func extractSpanContext(ctx context.Context, tracer opentracing.Tracer) opentracing.SpanContext {
@@ -86,6 +90,22 @@ func TestClientInterceptorOptions(t *testing.T) {
 				tracer: tracer,
 			},
 		},
+		{
+			"ClientRetry",
+			ClientInterceptor{},
+			ClientRetry(RetryOptions{MaxAttempts: 5}),
+			ClientInterceptor{
+				retry: newRetryPolicy(RetryOptions{MaxAttempts: 5}),
+			},
+		},
+		{
+			"ClientTimeout",
+			ClientInterceptor{},
+			ClientTimeout(time.Second),
+			ClientInterceptor{
+				timeout: time.Second,
+			},
+		},
 		{
 			"ClientFilter",
 			ClientInterceptor{},
@@ -551,6 +571,8 @@ func TestUnaryClientInterceptor(t *testing.T) {
 
 				if tc.mockRespError != nil {
 					assert.Equal(t, tc.mockRespError.Error(), log["grpc.error"])
+					assert.Equal(t, tc.mockRespError.Error(), log["error"])
+					assert.NotEmpty(t, log["error.chain"])
 				}
 
 				if tc.requestID != "" {
@@ -911,6 +933,8 @@ func TestStreamClientInterceptor(t *testing.T) {
 
 				if tc.mockRespError != nil {
 					assert.Equal(t, tc.mockRespError.Error(), log["grpc.error"])
+					assert.Equal(t, tc.mockRespError.Error(), log["error"])
+					assert.NotEmpty(t, log["error.chain"])
 				}
 
 				if tc.requestID != "" {
@@ -988,3 +1012,355 @@ func TestStreamClientInterceptor(t *testing.T) {
 		})
 	}
 }
+
+func TestClientInterceptorPropagation(t *testing.T) {
+	tracer, closer, err := trace.NewTracer(trace.Options{
+		Propagator: trace.NewCompositePropagator(
+			trace.NewW3CPropagator(),
+			trace.NewB3SinglePropagator(),
+		),
+	})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	parentSpan := tracer.StartSpan("parent-span")
+	defer parentSpan.Finish()
+	traceID := parentSpan.Context().(jaeger.SpanContext).TraceID().String()
+
+	var md metadata.MD
+	i := &ClientInterceptor{tracer: tracer}
+	invoker := func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := opentracing.ContextWithSpan(context.Background(), parentSpan)
+	err = i.UnaryInterceptor(ctx, "/package.service/method", nil, nil, nil, invoker)
+	assert.NoError(t, err)
+
+	assert.Len(t, md.Get("traceparent"), 1)
+	assert.Contains(t, md.Get("traceparent")[0], traceID)
+	assert.Len(t, md.Get("b3"), 1)
+	assert.Contains(t, md.Get("b3")[0], traceID)
+	assert.Empty(t, md.Get("uber-trace-id"))
+}
+
+func TestClientInterceptorRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             RetryOptions
+		method           string
+		errors           []error
+		expectedAttempts int
+		expectedCode     codes.Code
+	}{
+		{
+			name:             "Success",
+			opts:             RetryOptions{RetryNonIdempotent: true},
+			method:           "/userPB.UserManager/GetUser",
+			errors:           []error{nil},
+			expectedAttempts: 1,
+			expectedCode:     codes.OK,
+		},
+		{
+			name: "RetryIdempotent",
+			opts: RetryOptions{
+				Backoff:           resilience.Backoff{Initial: time.Millisecond},
+				IdempotentMethods: []string{"/userPB.UserManager/GetUser"},
+			},
+			method: "/userPB.UserManager/GetUser",
+			errors: []error{
+				status.Error(codes.Unavailable, "service unavailable"),
+				nil,
+			},
+			expectedAttempts: 2,
+			expectedCode:     codes.OK,
+		},
+		{
+			name:   "NotIdempotent",
+			opts:   RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method: "/userPB.UserManager/CreateUser",
+			errors: []error{
+				status.Error(codes.Unavailable, "service unavailable"),
+			},
+			expectedAttempts: 1,
+			expectedCode:     codes.Unavailable,
+		},
+		{
+			name: "NotRetryableCode",
+			opts: RetryOptions{
+				Backoff:            resilience.Backoff{Initial: time.Millisecond},
+				RetryNonIdempotent: true,
+			},
+			method: "/userPB.UserManager/GetUser",
+			errors: []error{
+				status.Error(codes.Internal, "internal error"),
+			},
+			expectedAttempts: 1,
+			expectedCode:     codes.Internal,
+		},
+		{
+			name: "MaxAttempts",
+			opts: RetryOptions{
+				MaxAttempts:        2,
+				Backoff:            resilience.Backoff{Initial: time.Millisecond},
+				RetryNonIdempotent: true,
+			},
+			method: "/userPB.UserManager/GetUser",
+			errors: []error{
+				status.Error(codes.Unavailable, "service unavailable"),
+				status.Error(codes.Unavailable, "service unavailable"),
+				nil,
+			},
+			expectedAttempts: 2,
+			expectedCode:     codes.Unavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			promReg := prometheus.NewRegistry()
+			mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+			tracer := mocktracer.New()
+
+			i := NewClientInterceptor("test-client",
+				ClientLogging(logger),
+				ClientMetrics(mf),
+				ClientTracing(tracer),
+				ClientRetry(tc.opts),
+			)
+
+			var attempts int
+			invoker := func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				err := tc.errors[attempts]
+				attempts++
+				return err
+			}
+
+			parentSpan := tracer.StartSpan("parent")
+			ctx := opentracing.ContextWithSpan(context.Background(), parentSpan)
+
+			err := i.RetryInterceptor(ctx, tc.method, nil, nil, &grpc.ClientConn{}, invoker)
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			assert.Equal(t, tc.expectedAttempts, attempts)
+
+			// Verify logs
+			for n := 1; n < tc.expectedAttempts; n++ {
+				var log map[string]interface{}
+				err = json.NewDecoder(buff).Decode(&log)
+				assert.NoError(t, err)
+				assert.Equal(t, "warn", log["level"])
+				assert.Equal(t, float64(n), log["attempt"])
+			}
+
+			// Verify metrics
+			metricFamilies, err := promReg.Gather()
+			assert.NoError(t, err)
+			for _, metricFamily := range metricFamilies {
+				if *metricFamily.Name == clientAttemptsMetricName {
+					assert.Len(t, metricFamily.Metric, tc.expectedAttempts)
+				}
+			}
+
+			// Verify traces
+			spans := tracer.FinishedSpans()
+			assert.Len(t, spans, tc.expectedAttempts)
+			for n, span := range spans {
+				assert.Equal(t, clientAttemptSpanName, span.OperationName)
+				assert.Equal(t, parentSpan.Context().(mocktracer.MockSpanContext).SpanID, span.ParentID)
+				assert.Equal(t, n+1, span.Tag("attempt"))
+			}
+		})
+	}
+}
+
+func TestClientInterceptorTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		delay           time.Duration
+		expectedTimeout bool
+	}{
+		{
+			name:            "NoTimeout",
+			timeout:         0,
+			delay:           10 * time.Millisecond,
+			expectedTimeout: false,
+		},
+		{
+			name:            "InTime",
+			timeout:         time.Second,
+			delay:           10 * time.Millisecond,
+			expectedTimeout: false,
+		},
+		{
+			name:            "TimedOut",
+			timeout:         10 * time.Millisecond,
+			delay:           time.Second,
+			expectedTimeout: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			tracer := mocktracer.New()
+
+			i := NewClientInterceptor("test-client",
+				ClientLogging(logger),
+				ClientTracing(tracer),
+				ClientTimeout(tc.timeout),
+			)
+
+			invoker := func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				select {
+				case <-time.After(tc.delay):
+					return nil
+				case <-ctx.Done():
+					return status.FromContextError(ctx.Err()).Err()
+				}
+			}
+
+			span := tracer.StartSpan("parent")
+			ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+			err := i.TimeoutInterceptor(ctx, "/userPB.UserManager/GetUser", nil, nil, &grpc.ClientConn{}, invoker)
+			span.Finish()
+
+			if tc.expectedTimeout {
+				assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+				assert.Contains(t, buff.String(), "timed out")
+
+				logs := tracer.FinishedSpans()[0].Logs()
+				assert.Len(t, logs, 1)
+				assert.Equal(t, "timeout", logs[0].Fields[0].ValueString)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, buff.String())
+				assert.Empty(t, tracer.FinishedSpans()[0].Logs())
+			}
+		})
+	}
+}
+
+func TestClientInterceptorCircuitBreaker(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Writer: buff})
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+	i := NewClientInterceptor("test-client",
+		ClientLogging(logger),
+		ClientMetrics(mf),
+		ClientCircuitBreaker(resilience.BreakerOptions{
+			FailureThreshold: 2,
+			OpenTimeout:      time.Minute,
+		}),
+	)
+	assert.NotNil(t, i.breakers)
+	assert.NotNil(t, i.resilienceMetrics)
+
+	usersConn, err := grpc.Dial("users-service:9090", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer usersConn.Close()
+
+	ordersConn, err := grpc.Dial("orders-service:9090", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer ordersConn.Close()
+
+	var calls int
+	invoker := func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if cc.Target() == "users-service:9090" {
+			return status.Error(codes.Unavailable, "service unavailable")
+		}
+		return nil
+	}
+
+	// Status codes not indicating failures of the target do not open the breaker
+	err = i.CircuitBreakerInterceptor(context.Background(), "/userPB.UserManager/GetUser", nil, nil, ordersConn, func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "user not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Consecutive failures open the breaker of a target
+	for n := 0; n < 2; n++ {
+		err = i.CircuitBreakerInterceptor(context.Background(), "/userPB.UserManager/GetUser", nil, nil, usersConn, invoker)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+
+	err = i.CircuitBreakerInterceptor(context.Background(), "/userPB.UserManager/GetUser", nil, nil, usersConn, invoker)
+	assert.Equal(t, resilience.ErrOpen, err)
+	assert.Equal(t, 2, calls)
+
+	// Breakers of other targets are not affected
+	err = i.CircuitBreakerInterceptor(context.Background(), "/orderPB.OrderManager/GetOrder", nil, nil, ordersConn, invoker)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, resilience.Closed, i.breakers.Get("orders-service:9090").State())
+
+	// Verify logs
+	var log map[string]interface{}
+	err = json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "users-service:9090", log["target"])
+	assert.Equal(t, "closed", log["from"])
+	assert.Equal(t, "open", log["to"])
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+	for _, metricFamily := range metricFamilies {
+		switch *metricFamily.Name {
+		case clientBreakerStateMetricName:
+			assert.Equal(t, float64(resilience.Open), *metricFamily.Metric[0].Gauge.Value)
+		case clientBreakerRejectionsMetricName:
+			assert.Equal(t, float64(1), *metricFamily.Metric[0].Counter.Value)
+		}
+	}
+}
+
+func TestClientInterceptorCircuitBreakerCancel(t *testing.T) {
+	i := NewClientInterceptor("test-client",
+		ClientCircuitBreaker(resilience.BreakerOptions{
+			FailureThreshold: 1,
+			OpenTimeout:      10 * time.Millisecond,
+		}),
+	)
+
+	conn, err := grpc.Dial("users-service:9090", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	invoker := func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return status.Error(codes.Unavailable, "service unavailable")
+	}
+
+	// A failure opens the breaker
+	err = i.CircuitBreakerInterceptor(context.Background(), "/userPB.UserManager/GetUser", nil, nil, conn, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	breaker := i.breakers.Get("users-service:9090")
+	assert.Equal(t, resilience.Open, breaker.State())
+
+	// A trial request cancelled by the caller keeps the breaker half-open
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = i.CircuitBreakerInterceptor(ctx, "/userPB.UserManager/GetUser", nil, nil, conn, invoker)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Equal(t, resilience.HalfOpen, breaker.State())
+
+	// The trial slot is released for another request
+	err = i.CircuitBreakerInterceptor(context.Background(), "/userPB.UserManager/GetUser", nil, nil, conn, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, resilience.Open, breaker.State())
+}
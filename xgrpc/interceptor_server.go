@@ -9,6 +9,7 @@ import (
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/trace"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	opentracingLog "github.com/opentracing/opentracing-go/log"
@@ -37,8 +38,11 @@ const (
 type ServerInterceptor struct {
 	filters []filter
 	logger  *log.Logger
+	mf      *metrics.Factory
 	metrics *metrics.RequestMetrics
 	tracer  opentracing.Tracer
+	baggage trace.BaggagePromoter
+	debug   func(context.Context) bool
 }
 
 // ServerInterceptorOption sets optional parameters for server interceptor.
@@ -53,15 +57,8 @@ func ServerLogging(logger *log.Logger) ServerInterceptorOption {
 
 // ServerMetrics is the option for server interceptor to enable metrics for every request.
 func ServerMetrics(mf *metrics.Factory) ServerInterceptorOption {
-	metrics := &metrics.RequestMetrics{
-		ReqGauge:        mf.Gauge(serverGaugeMetricName, "gauge metric for number of active server-side grpc requests", []string{"package", "service", "method", "stream"}),
-		ReqCounter:      mf.Counter(serverCounterMetricName, "counter metric for total number of server-side grpc requests", []string{"package", "service", "method", "stream", "success"}),
-		ReqDurationHist: mf.Histogram(serverHistogramMetricName, "histogram metric for duration of server-side grpc requests in seconds", []string{"package", "service", "method", "stream", "success"}),
-		ReqDurationSumm: mf.Summary(serverSummaryMetricName, "summary metric for duration of server-side grpc requests in seconds", []string{"package", "service", "method", "stream", "success"}),
-	}
-
 	return func(i *ServerInterceptor) {
-		i.metrics = metrics
+		i.mf = mf
 	}
 }
 
@@ -87,6 +84,28 @@ func ServerFilter(pkg, service, method string) ServerInterceptorOption {
 	}
 }
 
+// ServerBaggage is the option for server interceptor to promote baggage items of incoming requests
+// to span tags, log fields, and metric labels (baggage.<key> for tags and fields and baggage_<key> for labels).
+// Only the baggage items with the given keys are promoted.
+// Each metric label keeps up to 100 distinct values and the rest of values are reported as "other".
+func ServerBaggage(keys ...string) ServerInterceptorOption {
+	return func(i *ServerInterceptor) {
+		i.baggage.Add(keys...)
+	}
+}
+
+// ServerTraceDebug is the option for server interceptor to force sampling of requests having the X-Trace-Debug metadata.
+// The metadata is only honored for requests for which the trusted function returns true (i.e. authenticated peers).
+// If the trusted function is nil, the metadata is honored for all requests, so any client can force sampling.
+func ServerTraceDebug(trusted func(context.Context) bool) ServerInterceptorOption {
+	return func(i *ServerInterceptor) {
+		if trusted == nil {
+			trusted = func(context.Context) bool { return true }
+		}
+		i.debug = trusted
+	}
+}
+
 // NewServerInterceptor creates a new instance of gRPC server interceptor.
 func NewServerInterceptor(opts ...ServerInterceptorOption) *ServerInterceptor {
 	si := &ServerInterceptor{
@@ -97,9 +116,49 @@ func NewServerInterceptor(opts ...ServerInterceptorOption) *ServerInterceptor {
 		opt(si)
 	}
 
+	// Metrics are created after all options are applied, so they can have labels for baggage items
+	if si.mf != nil {
+		labels := si.baggage.Labels()
+
+		si.metrics = &metrics.RequestMetrics{
+			ReqGauge:        si.mf.Gauge(serverGaugeMetricName, "gauge metric for number of active server-side grpc requests", append([]string{"package", "service", "method", "stream"}, labels...)),
+			ReqCounter:      si.mf.Counter(serverCounterMetricName, "counter metric for total number of server-side grpc requests", append([]string{"package", "service", "method", "stream", "success"}, labels...)),
+			ReqDurationHist: si.mf.Histogram(serverHistogramMetricName, "histogram metric for duration of server-side grpc requests in seconds", append([]string{"package", "service", "method", "stream", "success"}, labels...)),
+			ReqDurationSumm: si.mf.Summary(serverSummaryMetricName, "summary metric for duration of server-side grpc requests in seconds", append([]string{"package", "service", "method", "stream", "success"}, labels...)),
+		}
+	}
+
 	return si
 }
 
+// extract returns the span context extracted from incoming metadata if any.
+// The span context is extracted once per request and used for both baggage items and the server span.
+func (i *ServerInterceptor) extract(ctx context.Context) opentracing.SpanContext {
+	if i.tracer == nil {
+		return nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	carrier := &metadataTextMap{md}
+	// In case of error, we just create a new span without parent and start a new trace!
+	spanCtx, _ := i.tracer.Extract(opentracing.TextMap, carrier)
+
+	return spanCtx
+}
+
+// getBaggage returns the promoted baggage items of an extracted span context.
+func (i *ServerInterceptor) getBaggage(spanCtx opentracing.SpanContext) map[string]string {
+	if i.baggage.Len() == 0 {
+		return map[string]string{}
+	}
+
+	return i.baggage.Items(spanCtx)
+}
+
 func (i *ServerInterceptor) getRequestMetadata(ctx context.Context) (string, string) {
 	var id, name string
 
@@ -120,17 +179,8 @@ func (i *ServerInterceptor) getRequestMetadata(ctx context.Context) (string, str
 	return id, name
 }
 
-func (i *ServerInterceptor) createSpan(ctx context.Context) opentracing.Span {
+func (i *ServerInterceptor) createSpan(ctx context.Context, parentSpanContext opentracing.SpanContext, fullMethod string) opentracing.Span {
 	var span opentracing.Span
-	var parentSpanContext opentracing.SpanContext
-
-	// Get trace information from incoming metadata
-	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		carrier := &metadataTextMap{md}
-		parentSpanContext, _ = i.tracer.Extract(opentracing.TextMap, carrier)
-		// In case of error, we just create a new span without parent and start a new trace!
-	}
 
 	if parentSpanContext == nil {
 		span = i.tracer.StartSpan(serverSpanName)
@@ -138,6 +188,15 @@ func (i *ServerInterceptor) createSpan(ctx context.Context) opentracing.Span {
 		span = i.tracer.StartSpan(serverSpanName, opentracing.ChildOf(parentSpanContext))
 	}
 
+	// Sampling should be forced before any tag is set, so tags are not dropped by the sampler
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vals := md.Get(trace.DebugHeader); i.debug != nil && len(vals) > 0 && vals[0] != "" && i.debug(ctx) {
+		trace.ForceSampling(span)
+	}
+
+	// The operation tag is used by the adaptive sampler for making sampling decisions per method
+	span.SetTag(trace.OperationTag, fullMethod)
+
 	return span
 }
 
@@ -159,10 +218,14 @@ func (i *ServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{
 	// Get request metadata
 	requestID, clientName := i.getRequestMetadata(ctx)
 	ctx = request.ContextWithID(ctx, requestID)
+	parentSpanCtx := i.extract(ctx)
+	baggage := i.getBaggage(parentSpanCtx)
 
+	var baggageValues []string
 	if i.metrics != nil {
 		// Increment guage metric
-		i.metrics.ReqGauge.WithLabelValues(pkg, service, method, stream).Inc()
+		baggageValues = i.baggage.LabelValues(baggage)
+		i.metrics.ReqGauge.WithLabelValues(append([]string{pkg, service, method, stream}, baggageValues...)...).Inc()
 	}
 
 	var logger *log.Logger
@@ -178,13 +241,17 @@ func (i *ServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{
 			"grpc.stream", stream,
 		)
 
+		if fields := i.baggage.Fields(baggage); len(fields) > 0 {
+			logger = logger.With(fields...)
+		}
+
 		ctx = log.ContextWithLogger(ctx, logger)
 	}
 
 	var span opentracing.Span
 	if i.tracer != nil {
 		// Create a new span
-		span = i.createSpan(ctx)
+		span = i.createSpan(ctx, parentSpanCtx, info.FullMethod)
 		defer span.Finish()
 
 		ctx = opentracing.ContextWithSpan(ctx, span)
@@ -198,10 +265,10 @@ func (i *ServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{
 
 	// Logging
 	if i.logger != nil {
+		message := fmt.Sprintf("%s %s.%s.%s %f", serverKind, pkg, service, method, duration)
 		pairs := []interface{}{
 			"grpc.success", success,
 			"responseTime", duration,
-			"message", fmt.Sprintf("%s %s.%s.%s %f", serverKind, pkg, service, method, duration),
 		}
 
 		if err != nil {
@@ -209,19 +276,20 @@ func (i *ServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{
 		}
 
 		if success {
-			logger.InfoKV(pairs...)
+			logger.InfoKV(append(pairs, "message", message)...)
 		} else {
-			logger.ErrorKV(pairs...)
+			logger.ErrorE(err, message, pairs...)
 		}
 	}
 
 	// Metrics
 	if i.metrics != nil {
 		successText := strconv.FormatBool(success)
-		i.metrics.ReqGauge.WithLabelValues(pkg, service, method, stream).Dec()
-		i.metrics.ReqCounter.WithLabelValues(pkg, service, method, stream, successText).Inc()
-		i.metrics.ReqDurationHist.WithLabelValues(pkg, service, method, stream, successText).Observe(duration)
-		i.metrics.ReqDurationSumm.WithLabelValues(pkg, service, method, stream, successText).Observe(duration)
+		labelValues := append([]string{pkg, service, method, stream, successText}, baggageValues...)
+		i.metrics.ReqGauge.WithLabelValues(append([]string{pkg, service, method, stream}, baggageValues...)...).Dec()
+		i.metrics.ReqCounter.WithLabelValues(labelValues...).Inc()
+		i.metrics.ReqDurationHist.WithLabelValues(labelValues...).Observe(duration)
+		i.metrics.ReqDurationSumm.WithLabelValues(labelValues...).Observe(duration)
 	}
 
 	// Tracing
@@ -230,6 +298,8 @@ func (i *ServerInterceptor) UnaryInterceptor(ctx context.Context, req interface{
 		ext.SpanKind.Set(span, ext.SpanKindRPCServerEnum)
 		span.SetTag("grpc.package", pkg).SetTag("grpc.service", service).SetTag("grpc.method", method).SetTag("grpc.stream", stream).SetTag("grpc.success", success)
 
+		i.baggage.SetTags(span, baggage)
+
 		if err != nil {
 			ext.Error.Set(span, true)
 			span.LogFields(
@@ -261,10 +331,14 @@ func (i *ServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStr
 	// Get request metadata
 	requestID, clientName := i.getRequestMetadata(ctx)
 	ctx = request.ContextWithID(ctx, requestID)
+	parentSpanCtx := i.extract(ctx)
+	baggage := i.getBaggage(parentSpanCtx)
 
+	var baggageValues []string
 	if i.metrics != nil {
 		// Increment guage metric
-		i.metrics.ReqGauge.WithLabelValues(pkg, service, method, stream).Inc()
+		baggageValues = i.baggage.LabelValues(baggage)
+		i.metrics.ReqGauge.WithLabelValues(append([]string{pkg, service, method, stream}, baggageValues...)...).Inc()
 	}
 
 	var logger *log.Logger
@@ -280,13 +354,17 @@ func (i *ServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStr
 			"grpc.stream", stream,
 		)
 
+		if fields := i.baggage.Fields(baggage); len(fields) > 0 {
+			logger = logger.With(fields...)
+		}
+
 		ctx = log.ContextWithLogger(ctx, logger)
 	}
 
 	var span opentracing.Span
 	if i.tracer != nil {
 		// Create a new span
-		span = i.createSpan(ctx)
+		span = i.createSpan(ctx, parentSpanCtx, info.FullMethod)
 		defer span.Finish()
 
 		ctx = opentracing.ContextWithSpan(ctx, span)
@@ -302,10 +380,10 @@ func (i *ServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStr
 
 	// Logging
 	if i.logger != nil {
+		message := fmt.Sprintf("%s %s.%s.%s %f", serverKind, pkg, service, method, duration)
 		pairs := []interface{}{
 			"grpc.success", success,
 			"responseTime", duration,
-			"message", fmt.Sprintf("%s %s.%s.%s %f", serverKind, pkg, service, method, duration),
 		}
 
 		if err != nil {
@@ -313,19 +391,20 @@ func (i *ServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStr
 		}
 
 		if success {
-			logger.InfoKV(pairs...)
+			logger.InfoKV(append(pairs, "message", message)...)
 		} else {
-			logger.ErrorKV(pairs...)
+			logger.ErrorE(err, message, pairs...)
 		}
 	}
 
 	// Metrics
 	if i.metrics != nil {
 		successText := strconv.FormatBool(success)
-		i.metrics.ReqGauge.WithLabelValues(pkg, service, method, stream).Dec()
-		i.metrics.ReqCounter.WithLabelValues(pkg, service, method, stream, successText).Inc()
-		i.metrics.ReqDurationHist.WithLabelValues(pkg, service, method, stream, successText).Observe(duration)
-		i.metrics.ReqDurationSumm.WithLabelValues(pkg, service, method, stream, successText).Observe(duration)
+		labelValues := append([]string{pkg, service, method, stream, successText}, baggageValues...)
+		i.metrics.ReqGauge.WithLabelValues(append([]string{pkg, service, method, stream}, baggageValues...)...).Dec()
+		i.metrics.ReqCounter.WithLabelValues(labelValues...).Inc()
+		i.metrics.ReqDurationHist.WithLabelValues(labelValues...).Observe(duration)
+		i.metrics.ReqDurationSumm.WithLabelValues(labelValues...).Observe(duration)
 	}
 
 	// Tracing
@@ -334,6 +413,8 @@ func (i *ServerInterceptor) StreamInterceptor(srv interface{}, ss grpc.ServerStr
 		ext.SpanKind.Set(span, ext.SpanKindRPCServerEnum)
 		span.SetTag("grpc.package", pkg).SetTag("grpc.service", service).SetTag("grpc.method", method).SetTag("grpc.stream", stream).SetTag("grpc.success", success)
 
+		i.baggage.SetTags(span, baggage)
+
 		if err != nil {
 			ext.Error.Set(span, true)
 			span.LogFields(
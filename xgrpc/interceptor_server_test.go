@@ -19,10 +19,22 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	promModel "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
+// extractCounter is a tracer counting the span contexts extracted.
+type extractCounter struct {
+	*mocktracer.MockTracer
+	extracts int
+}
+
+func (t *extractCounter) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	t.extracts++
+	return t.MockTracer.Extract(format, carrier)
+}
+
 func injectSpan(ctx context.Context, tracer opentracing.Tracer, span opentracing.Span) context.Context {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
@@ -98,6 +110,17 @@ func TestServerInterceptorOptions(t *testing.T) {
 				tracer: tracer,
 			},
 		},
+		{
+			"ServerBaggage",
+			ServerInterceptor{},
+			ServerBaggage("tenant", "user-id"),
+			ServerInterceptor{
+				baggage: func() (p trace.BaggagePromoter) {
+					p.Add("tenant", "user-id")
+					return p
+				}(),
+			},
+		},
 		{
 			"ServerFilter",
 			ServerInterceptor{},
@@ -402,6 +425,8 @@ func TestUnaryServerInterceptor(t *testing.T) {
 
 				if tc.mockRespError != nil {
 					assert.Equal(t, tc.mockRespError.Error(), log["grpc.error"])
+					assert.Equal(t, tc.mockRespError.Error(), log["error"])
+					assert.NotEmpty(t, log["error.chain"])
 				}
 
 				if tc.requestID != "" {
@@ -703,6 +728,8 @@ func TestStreamServerInterceptor(t *testing.T) {
 
 				if tc.mockRespError != nil {
 					assert.Equal(t, tc.mockRespError.Error(), log["grpc.error"])
+					assert.Equal(t, tc.mockRespError.Error(), log["error"])
+					assert.NotEmpty(t, log["error.chain"])
 				}
 
 				if tc.requestID != "" {
@@ -782,3 +809,270 @@ func TestStreamServerInterceptor(t *testing.T) {
 		})
 	}
 }
+
+func TestServerInterceptorSampling(t *testing.T) {
+	trusted := func(ctx context.Context) bool {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return len(md.Get("authorization")) > 0
+	}
+
+	tests := []struct {
+		name              string
+		debug             func(context.Context) bool
+		md                metadata.MD
+		expectedSampled   bool
+		expectedOperation string
+	}{
+		{
+			name:            "Default",
+			md:              metadata.New(nil),
+			expectedSampled: false,
+		},
+		{
+			name:            "DebugHeaderNotEnabled",
+			md:              metadata.Pairs(trace.DebugHeader, "true"),
+			expectedSampled: false,
+		},
+		{
+			name:              "DebugHeaderTrusted",
+			debug:             trusted,
+			md:                metadata.Pairs(trace.DebugHeader, "true", "authorization", "Bearer token"),
+			expectedSampled:   true,
+			expectedOperation: "/package.service/method",
+		},
+		{
+			name:            "DebugHeaderUntrusted",
+			debug:           trusted,
+			md:              metadata.Pairs(trace.DebugHeader, "true"),
+			expectedSampled: false,
+		},
+	}
+
+	// Spans are not sampled unless forced
+	tracer, closer, err := trace.NewTracer(trace.Options{Sampler: trace.NewConstSampler(false)})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var span *jaeger.Span
+
+			i := &ServerInterceptor{tracer: tracer, debug: tc.debug}
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			info := &grpc.UnaryServerInfo{FullMethod: "/package.service/method"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				span = opentracing.SpanFromContext(ctx).(*jaeger.Span)
+				return nil, nil
+			}
+
+			_, err := i.UnaryInterceptor(ctx, nil, info, handler)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSampled, span.SpanContext().IsSampled())
+			if tc.expectedSampled {
+				assert.Equal(t, tc.expectedOperation, span.Tags()[trace.OperationTag])
+			}
+		})
+	}
+}
+
+func TestServerTraceDebug(t *testing.T) {
+	i := &ServerInterceptor{}
+	ServerTraceDebug(nil)(i)
+	assert.True(t, i.debug(context.Background()))
+}
+
+func TestServerInterceptorPropagation(t *testing.T) {
+	tracer, closer, err := trace.NewTracer(trace.Options{
+		Propagator: trace.NewCompositePropagator(
+			trace.NewJaegerPropagator(),
+			trace.NewW3CPropagator(),
+			trace.NewB3SinglePropagator(),
+			trace.NewB3MultiPropagator(),
+		),
+	})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	tests := []struct {
+		name            string
+		md              metadata.MD
+		expectedTraceID string
+	}{
+		{
+			name:            "NoMetadata",
+			md:              metadata.New(nil),
+			expectedTraceID: "",
+		},
+		{
+			name:            "Jaeger",
+			md:              metadata.Pairs("uber-trace-id", "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1"),
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:            "W3C",
+			md:              metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:            "B3Single",
+			md:              metadata.Pairs("b3", "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"),
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:            "B3Multi",
+			md:              metadata.Pairs("x-b3-traceid", "4bf92f3577b34da6a3ce929d0e0e4736", "x-b3-spanid", "00f067aa0ba902b7"),
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var spanCtx jaeger.SpanContext
+
+			i := &ServerInterceptor{tracer: tracer}
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			info := &grpc.UnaryServerInfo{FullMethod: "/package.service/method"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				spanCtx = opentracing.SpanFromContext(ctx).Context().(jaeger.SpanContext)
+				return nil, nil
+			}
+
+			_, err := i.UnaryInterceptor(ctx, nil, info, handler)
+			assert.NoError(t, err)
+
+			if tc.expectedTraceID == "" {
+				assert.Equal(t, jaeger.SpanID(0), spanCtx.ParentID())
+			} else {
+				assert.Equal(t, tc.expectedTraceID, spanCtx.TraceID().String())
+				assert.Equal(t, jaeger.SpanID(0x00f067aa0ba902b7), spanCtx.ParentID())
+			}
+		})
+	}
+}
+
+func TestServerInterceptorExtractOnce(t *testing.T) {
+	tracer := &extractCounter{MockTracer: mocktracer.New()}
+	i := NewServerInterceptor(
+		ServerTracing(tracer),
+		ServerBaggage("tenant"),
+	)
+
+	md := metadata.Pairs(
+		"mockpfx-ids-traceid", "1",
+		"mockpfx-ids-spanid", "2",
+		"mockpfx-ids-sampled", "true",
+		"mockpfx-baggage-tenant", "acme",
+	)
+
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	info := &grpc.UnaryServerInfo{FullMethod: "/package.service/method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	_, err := i.UnaryInterceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tracer.extracts)
+
+	span := tracer.FinishedSpans()[0]
+	assert.Equal(t, 2, span.ParentID)
+	assert.Equal(t, "acme", span.Tag("baggage.tenant"))
+}
+
+func TestServerInterceptorBaggage(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          []string
+		md            metadata.MD
+		expectedItems map[string]string
+	}{
+		{
+			name:          "NoBaggage",
+			keys:          []string{"tenant"},
+			md:            metadata.New(nil),
+			expectedItems: map[string]string{},
+		},
+		{
+			name: "AllowedBaggage",
+			keys: []string{"tenant", "region"},
+			md: metadata.Pairs(
+				"mockpfx-ids-traceid", "1",
+				"mockpfx-ids-spanid", "2",
+				"mockpfx-ids-sampled", "true",
+				"mockpfx-baggage-tenant", "acme",
+				"mockpfx-baggage-user", "jane",
+			),
+			expectedItems: map[string]string{
+				"tenant": "acme",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			promReg := prometheus.NewRegistry()
+			mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+			tracer := mocktracer.New()
+
+			i := NewServerInterceptor(
+				ServerLogging(logger),
+				ServerMetrics(mf),
+				ServerTracing(tracer),
+				ServerBaggage(tc.keys...),
+			)
+
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			info := &grpc.UnaryServerInfo{FullMethod: "/package.service/method"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			}
+
+			_, err := i.UnaryInterceptor(ctx, nil, info, handler)
+			assert.NoError(t, err)
+
+			// Verify logs
+			var log map[string]interface{}
+			err = json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			for _, key := range tc.keys {
+				if val, ok := tc.expectedItems[key]; ok {
+					assert.Equal(t, val, log["baggage."+key])
+				} else {
+					assert.NotContains(t, log, "baggage."+key)
+				}
+			}
+
+			// Verify span tags
+			span := tracer.FinishedSpans()[0]
+			for _, key := range tc.keys {
+				if val, ok := tc.expectedItems[key]; ok {
+					assert.Equal(t, val, span.Tag("baggage."+key))
+				} else {
+					assert.Nil(t, span.Tag("baggage."+key))
+				}
+			}
+
+			// Verify metric labels
+			metricFamilies, err := promReg.Gather()
+			assert.NoError(t, err)
+			for _, metricFamily := range metricFamilies {
+				switch *metricFamily.Name {
+				case serverGaugeMetricName, serverCounterMetricName, serverHistogramMetricName, serverSummaryMetricName:
+				default:
+					continue
+				}
+
+				labels := map[string]string{}
+				for _, l := range metricFamily.Metric[0].Label {
+					labels[*l.Name] = *l.Value
+				}
+
+				for _, key := range tc.keys {
+					assert.Equal(t, tc.expectedItems[key], labels["baggage_"+key])
+				}
+			}
+		})
+	}
+}
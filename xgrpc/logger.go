@@ -0,0 +1,89 @@
+package xgrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moorara/observe/log"
+	"google.golang.org/grpc/grpclog"
+)
+
+const (
+	grpcLoggerName = "grpc"
+	// grpcCallerSkip is the number of stack frames of grpclog functions and grpcLogger methods above the caller.
+	grpcCallerSkip = 2
+)
+
+// grpcLogger implements grpclog.LoggerV2.
+type grpcLogger struct {
+	logger    *log.Logger
+	verbosity int
+}
+
+// NewLoggerV2 creates a grpclog.LoggerV2 that logs gRPC internal messages using a logger.
+// The logger is named "grpc", so its level can be overridden independently (i.e. "info,grpc=warn").
+// The caller of logs is the caller of grpclog functions.
+// verbosity is the verbosity level reported by V().
+// You can use grpclog.SetLoggerV2 for setting the gRPC logger before any gRPC functions are called.
+func NewLoggerV2(logger *log.Logger, verbosity int) grpclog.LoggerV2 {
+	return &grpcLogger{
+		logger:    logger.Named(grpcLoggerName).WithCallerSkip(grpcCallerSkip),
+		verbosity: verbosity,
+	}
+}
+
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+func (l *grpcLogger) Info(args ...interface{}) {
+	l.logger.Info(fmt.Sprint(args...))
+}
+
+func (l *grpcLogger) Infoln(args ...interface{}) {
+	l.logger.Info(sprintln(args...))
+}
+
+func (l *grpcLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(format, args...)
+}
+
+func (l *grpcLogger) Warning(args ...interface{}) {
+	l.logger.Warn(fmt.Sprint(args...))
+}
+
+func (l *grpcLogger) Warningln(args ...interface{}) {
+	l.logger.Warn(sprintln(args...))
+}
+
+func (l *grpcLogger) Warningf(format string, args ...interface{}) {
+	l.logger.Warnf(format, args...)
+}
+
+func (l *grpcLogger) Error(args ...interface{}) {
+	l.logger.Error(fmt.Sprint(args...))
+}
+
+func (l *grpcLogger) Errorln(args ...interface{}) {
+	l.logger.Error(sprintln(args...))
+}
+
+func (l *grpcLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
+
+func (l *grpcLogger) Fatal(args ...interface{}) {
+	l.logger.Fatal(fmt.Sprint(args...))
+}
+
+func (l *grpcLogger) Fatalln(args ...interface{}) {
+	l.logger.Fatal(sprintln(args...))
+}
+
+func (l *grpcLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Fatalf(format, args...)
+}
+
+func (l *grpcLogger) V(level int) bool {
+	return level <= l.verbosity
+}
@@ -0,0 +1,91 @@
+package xgrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/moorara/observe/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/grpclog"
+)
+
+func TestNewLoggerV2(t *testing.T) {
+	logger := NewLoggerV2(log.NewVoidLogger(), 2)
+	assert.NotNil(t, logger)
+}
+
+func TestGRPCLogger(t *testing.T) {
+	tests := []struct {
+		name            string
+		log             func(*grpcLogger)
+		expectedLevel   string
+		expectedMessage string
+	}{
+		{"Info", func(l *grpcLogger) { l.Info("server ", "started") }, "info", "server started"},
+		{"Infoln", func(l *grpcLogger) { l.Infoln("server", "started") }, "info", "server started"},
+		{"Infof", func(l *grpcLogger) { l.Infof("server %s", "started") }, "info", "server started"},
+		{"Warning", func(l *grpcLogger) { l.Warning("slow ", "connection") }, "warn", "slow connection"},
+		{"Warningln", func(l *grpcLogger) { l.Warningln("slow", "connection") }, "warn", "slow connection"},
+		{"Warningf", func(l *grpcLogger) { l.Warningf("slow %s", "connection") }, "warn", "slow connection"},
+		{"Error", func(l *grpcLogger) { l.Error("connection ", "failed") }, "error", "connection failed"},
+		{"Errorln", func(l *grpcLogger) { l.Errorln("connection", "failed") }, "error", "connection failed"},
+		{"Errorf", func(l *grpcLogger) { l.Errorf("connection %s", "failed") }, "error", "connection failed"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Name: "service", Writer: buff})
+			tc.log(NewLoggerV2(logger, 0).(*grpcLogger))
+
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, "service."+grpcLoggerName, log["logger"])
+			assert.Equal(t, tc.expectedLevel, log["level"])
+			assert.Equal(t, tc.expectedMessage, log["message"])
+		})
+	}
+}
+
+func TestGRPCLoggerCaller(t *testing.T) {
+	buff := &bytes.Buffer{}
+	grpclog.SetLoggerV2(NewLoggerV2(log.NewLogger(log.Options{Writer: buff}), 0))
+	defer grpclog.SetLoggerV2(grpclog.NewLoggerV2(ioutil.Discard, ioutil.Discard, os.Stderr))
+
+	_, file, line, _ := runtime.Caller(0)
+	grpclog.Infof("server %s", "started")
+
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "server started", log["message"])
+	assert.Equal(t, fmt.Sprintf("%s:%d", filepath.Base(file), line+1), log["caller"])
+}
+
+func TestGRPCLoggerLevelOverride(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Level: "info,grpc=error", Writer: buff})
+	l := NewLoggerV2(logger, 0)
+
+	l.Info("server started")
+	l.Warning("slow connection")
+	assert.Empty(t, buff.String())
+
+	l.Error("connection failed")
+	assert.NotEmpty(t, buff.String())
+}
+
+func TestGRPCLoggerV(t *testing.T) {
+	l := NewLoggerV2(log.NewVoidLogger(), 2)
+
+	assert.True(t, l.V(0))
+	assert.True(t, l.V(2))
+	assert.False(t, l.V(3))
+}
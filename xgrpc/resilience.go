@@ -0,0 +1,118 @@
+package xgrpc
+
+import (
+	"errors"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	clientAttemptSpanName             = "grpc-client-attempt"
+	clientAttemptsMetricName          = "grpc_client_attempts_total"
+	clientTimeoutsMetricName          = "grpc_client_timeouts_total"
+	clientBreakerStateMetricName      = "grpc_client_circuit_breaker_state"
+	clientBreakerRejectionsMetricName = "grpc_client_circuit_breaker_rejections_total"
+)
+
+const defaultMaxAttempts = 3
+
+var defaultRetryCodes = []codes.Code{codes.Unavailable}
+
+// breakerFailureCodes are the status codes counted as failures by circuit breakers.
+var breakerFailureCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.DeadlineExceeded: true,
+	codes.Internal:         true,
+	codes.Unavailable:      true,
+	codes.DataLoss:         true,
+}
+
+// RetryOptions contains options for retrying failed requests.
+//   MaxAttempts is the maximum number of attempts including the first one (default 3).
+//   Backoff is the exponential backoff between attempts.
+//   Codes are the status codes for which requests are retried (default Unavailable).
+//   IdempotentMethods are the full names of idempotent methods that can be retried (i.e. /package.service/method).
+//   RetryNonIdempotent enables retrying all methods.
+// Since gRPC methods have no idempotency semantics, only the methods declared as idempotent are retried by default.
+type RetryOptions struct {
+	MaxAttempts        int
+	Backoff            resilience.Backoff
+	Codes              []codes.Code
+	IdempotentMethods  []string
+	RetryNonIdempotent bool
+}
+
+// retryPolicy determines whether and when requests are retried.
+type retryPolicy struct {
+	maxAttempts   int
+	backoff       resilience.Backoff
+	codes         map[codes.Code]bool
+	idempotent    map[string]bool
+	nonIdempotent bool
+}
+
+func newRetryPolicy(opts RetryOptions) *retryPolicy {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	retryCodes := opts.Codes
+	if len(retryCodes) == 0 {
+		retryCodes = defaultRetryCodes
+	}
+
+	p := &retryPolicy{
+		maxAttempts:   maxAttempts,
+		backoff:       opts.Backoff,
+		codes:         map[codes.Code]bool{},
+		idempotent:    map[string]bool{},
+		nonIdempotent: opts.RetryNonIdempotent,
+	}
+
+	for _, code := range retryCodes {
+		p.codes[code] = true
+	}
+
+	for _, method := range opts.IdempotentMethods {
+		p.idempotent[method] = true
+	}
+
+	return p
+}
+
+// retryable determines whether or not a method can be retried.
+func (p *retryPolicy) retryable(fullMethod string) bool {
+	return p.nonIdempotent || p.idempotent[fullMethod]
+}
+
+// shouldRetry determines whether or not an attempt should be retried by its error.
+// Requests rejected by a circuit breaker are not retried.
+func (p *retryPolicy) shouldRetry(err error) bool {
+	if err == nil || errors.Is(err, resilience.ErrOpen) {
+		return false
+	}
+
+	return p.codes[status.Code(err)]
+}
+
+// resilienceMetrics are the metrics for retries, timeouts, and circuit breakers of client requests.
+type resilienceMetrics struct {
+	attempts          *prometheus.CounterVec
+	timeouts          *prometheus.CounterVec
+	breakerState      *prometheus.GaugeVec
+	breakerRejections *prometheus.CounterVec
+}
+
+func newResilienceMetrics(mf *metrics.Factory) *resilienceMetrics {
+	return &resilienceMetrics{
+		attempts:          mf.Counter(clientAttemptsMetricName, "counter metric for total number of attempts of client-side grpc requests", []string{"package", "service", "method", "attempt"}),
+		timeouts:          mf.Counter(clientTimeoutsMetricName, "counter metric for total number of timed-out attempts of client-side grpc requests", []string{"package", "service", "method"}),
+		breakerState:      mf.Gauge(clientBreakerStateMetricName, "gauge metric for state of circuit breakers of client-side grpc requests (0: closed, 1: half-open, 2: open)", []string{"target"}),
+		breakerRejections: mf.Counter(clientBreakerRejectionsMetricName, "counter metric for total number of client-side grpc requests rejected by circuit breakers", []string{"target"}),
+	}
+}
@@ -0,0 +1,105 @@
+package xgrpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name                string
+		opts                RetryOptions
+		expectedMaxAttempts int
+		expectedCodes       map[codes.Code]bool
+		expectedIdempotent  map[string]bool
+	}{
+		{
+			name:                "Defaults",
+			opts:                RetryOptions{},
+			expectedMaxAttempts: 3,
+			expectedCodes:       map[codes.Code]bool{codes.Unavailable: true},
+			expectedIdempotent:  map[string]bool{},
+		},
+		{
+			name: "WithOptions",
+			opts: RetryOptions{
+				MaxAttempts:       5,
+				Codes:             []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+				IdempotentMethods: []string{"/userPB.UserManager/GetUser"},
+			},
+			expectedMaxAttempts: 5,
+			expectedCodes:       map[codes.Code]bool{codes.Unavailable: true, codes.ResourceExhausted: true},
+			expectedIdempotent:  map[string]bool{"/userPB.UserManager/GetUser": true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newRetryPolicy(tc.opts)
+
+			assert.Equal(t, tc.expectedMaxAttempts, p.maxAttempts)
+			assert.Equal(t, tc.expectedCodes, p.codes)
+			assert.Equal(t, tc.expectedIdempotent, p.idempotent)
+		})
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	tests := []struct {
+		name              string
+		opts              RetryOptions
+		fullMethod        string
+		expectedRetryable bool
+	}{
+		{"NotIdempotent", RetryOptions{}, "/userPB.UserManager/CreateUser", false},
+		{"Idempotent", RetryOptions{IdempotentMethods: []string{"/userPB.UserManager/GetUser"}}, "/userPB.UserManager/GetUser", true},
+		{"NonIdempotent", RetryOptions{RetryNonIdempotent: true}, "/userPB.UserManager/CreateUser", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newRetryPolicy(tc.opts)
+			assert.Equal(t, tc.expectedRetryable, p.retryable(tc.fullMethod))
+		})
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedRetry bool
+	}{
+		{"NoError", nil, false},
+		{"CircuitBreakerOpen", fmt.Errorf("request failed: %w", resilience.ErrOpen), false},
+		{"NotStatusError", errors.New("unknown error"), false},
+		{"Internal", status.Error(codes.Internal, "internal error"), false},
+		{"Unavailable", status.Error(codes.Unavailable, "service unavailable"), true},
+	}
+
+	p := newRetryPolicy(RetryOptions{})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRetry, p.shouldRetry(tc.err))
+		})
+	}
+}
+
+func TestNewResilienceMetrics(t *testing.T) {
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: prometheus.NewRegistry()})
+	m := newResilienceMetrics(mf)
+
+	assert.NotNil(t, m.attempts)
+	assert.NotNil(t, m.timeouts)
+	assert.NotNil(t, m.breakerState)
+	assert.NotNil(t, m.breakerRejections)
+}
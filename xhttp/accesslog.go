@@ -0,0 +1,248 @@
+package xhttp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	w3cDateFormat = "2006-01-02"
+	w3cTimeFormat = "15:04:05"
+	w3cFields     = "date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(Referer) cs(User-Agent)"
+)
+
+// AccessLogFormat is the format of access logs.
+type AccessLogFormat int
+
+const (
+	// CommonLogFormat is the NCSA Common Log Format.
+	//   remote-addr - user [time] "request-line" status bytes
+	CommonLogFormat AccessLogFormat = iota
+	// CombinedLogFormat is the NCSA Combined Log Format.
+	//   remote-addr - user [time] "request-line" status bytes "referer" "user-agent"
+	CombinedLogFormat
+	// W3CLogFormat is the W3C Extended Log File Format with the following fields in UTC.
+	//   date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(Referer) cs(User-Agent)
+	W3CLogFormat
+)
+
+// AccessLogOptions contains options for access logs.
+//   Writer is the dedicated writer for access logs (default os.Stdout).
+//   Format is the format of access logs (default CommonLogFormat).
+//   TrustedProxies are the IP addresses or CIDR ranges of proxies trusted for X-Forwarded-For and Forwarded headers.
+//   Filter determines which requests are logged (default all requests).
+type AccessLogOptions struct {
+	Writer         io.Writer
+	Format         AccessLogFormat
+	TrustedProxies []string
+	Filter         func(*http.Request) bool
+}
+
+// accessLog writes access logs of requests to a writer.
+type accessLog struct {
+	sync.Mutex
+	writer        io.Writer
+	format        AccessLogFormat
+	capture       *capture
+	filter        func(*http.Request) bool
+	headerWritten bool
+}
+
+func newAccessLog(opts AccessLogOptions) *accessLog {
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	return &accessLog{
+		writer:  writer,
+		format:  opts.Format,
+		capture: newCapture(CaptureOptions{TrustedProxies: opts.TrustedProxies}),
+		filter:  opts.Filter,
+	}
+}
+
+// enabled determines whether or not a request is logged.
+func (l *accessLog) enabled(r *http.Request) bool {
+	return l.filter == nil || l.filter(r)
+}
+
+// accessEntry is the information about a request logged by an access log.
+type accessEntry struct {
+	remoteAddr string
+	user       string
+	start      time.Time
+	method     string
+	uri        string
+	path       string
+	query      string
+	proto      string
+	statusCode int
+	size       int
+	referer    string
+	userAgent  string
+	duration   time.Duration
+}
+
+func newAccessEntry(r *http.Request, clientIP string, start time.Time, statusCode, size int, duration time.Duration) accessEntry {
+	var user string
+	if r.URL.User != nil {
+		user = r.URL.User.Username()
+	} else if username, _, ok := r.BasicAuth(); ok {
+		user = username
+	}
+
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	// Forwarded identifiers that are not IP addresses (i.e. obfuscated or unknown) are controlled by clients
+	remoteAddr := clientIP
+	if net.ParseIP(remoteAddr) == nil {
+		remoteAddr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+	}
+
+	return accessEntry{
+		remoteAddr: remoteAddr,
+		user:       user,
+		start:      start,
+		method:     r.Method,
+		uri:        uri,
+		path:       r.URL.Path,
+		query:      r.URL.RawQuery,
+		proto:      r.Proto,
+		statusCode: statusCode,
+		size:       size,
+		referer:    r.Referer(),
+		userAgent:  r.UserAgent(),
+		duration:   duration,
+	}
+}
+
+// write writes an entry to the access log.
+// Each entry is written as a single line using a single write.
+func (l *accessLog) write(e accessEntry) {
+	var line string
+	switch l.format {
+	case CombinedLogFormat:
+		line = fmt.Sprintf("%s \"%s\" \"%s\"\n", e.common(), clfValue(clfEscape(e.referer)), clfValue(clfEscape(e.userAgent)))
+	case W3CLogFormat:
+		line = e.w3c() + "\n"
+	default:
+		line = e.common() + "\n"
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	// The W3C directives are written once before the first entry
+	if l.format == W3CLogFormat && !l.headerWritten {
+		line = fmt.Sprintf("#Version: 1.0\n#Date: %s %s\n#Fields: %s\n%s",
+			e.start.UTC().Format(w3cDateFormat), e.start.UTC().Format(w3cTimeFormat), w3cFields, line)
+		l.headerWritten = true
+	}
+
+	_, _ = io.WriteString(l.writer, line)
+}
+
+// common formats an entry in the Common Log Format.
+func (e accessEntry) common() string {
+	size := "-"
+	if e.size > 0 {
+		size = strconv.Itoa(e.size)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s\" %d %s",
+		clfValue(clfEscape(e.remoteAddr)),
+		clfValue(clfEscape(e.user)),
+		e.start.Format(clfTimeFormat),
+		clfEscape(e.method+" "+e.uri+" "+e.proto),
+		e.statusCode,
+		size,
+	)
+}
+
+// w3c formats an entry in the W3C Extended Log File Format.
+func (e accessEntry) w3c() string {
+	start := e.start.UTC()
+
+	return strings.Join([]string{
+		start.Format(w3cDateFormat),
+		start.Format(w3cTimeFormat),
+		w3cValue(e.remoteAddr),
+		w3cValue(e.user),
+		w3cValue(e.method),
+		w3cValue(e.path),
+		w3cValue(e.query),
+		strconv.Itoa(e.statusCode),
+		strconv.Itoa(e.size),
+		strconv.FormatFloat(e.duration.Seconds(), 'f', 3, 64),
+		w3cValue(e.referer),
+		w3cValue(e.userAgent),
+	}, " ")
+}
+
+// clfValue returns a value for the Common Log Format or - if the value is empty.
+func clfValue(val string) string {
+	if val == "" {
+		return "-"
+	}
+
+	return val
+}
+
+// clfEscape escapes quotes, backslashes, and control characters in a value for the Common Log Format,
+// so values controlled by clients cannot forge log lines.
+func clfEscape(val string) string {
+	var b strings.Builder
+	for _, c := range val {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// w3cValue returns a value for the W3C Extended Log File Format or - if the value is empty.
+// Values with spaces or quotes are quoted and control characters are replaced by spaces.
+func w3cValue(val string) string {
+	if val == "" {
+		return "-"
+	}
+
+	val = strings.Map(func(c rune) rune {
+		if c < 0x20 || c == 0x7f {
+			return ' '
+		}
+		return c
+	}, val)
+
+	if strings.ContainsAny(val, " \"") {
+		return `"` + strings.Replace(val, `"`, `""`, -1) + `"`
+	}
+
+	return val
+}
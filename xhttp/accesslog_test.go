@@ -0,0 +1,210 @@
+package xhttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAccessLog(t *testing.T) {
+	l := newAccessLog(AccessLogOptions{})
+	assert.Equal(t, os.Stdout, l.writer)
+	assert.Equal(t, CommonLogFormat, l.format)
+	assert.True(t, l.enabled(httptest.NewRequest("GET", "/health", nil)))
+
+	buff := &bytes.Buffer{}
+	l = newAccessLog(AccessLogOptions{
+		Writer: buff,
+		Format: W3CLogFormat,
+		Filter: func(r *http.Request) bool {
+			return r.URL.Path != "/health"
+		},
+	})
+	assert.Equal(t, buff, l.writer)
+	assert.Equal(t, W3CLogFormat, l.format)
+	assert.False(t, l.enabled(httptest.NewRequest("GET", "/health", nil)))
+	assert.True(t, l.enabled(httptest.NewRequest("GET", "/v1/users", nil)))
+}
+
+func TestNewAccessEntry(t *testing.T) {
+	start := time.Date(2020, 10, 10, 13, 55, 36, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		req           func() *http.Request
+		clientIP      string
+		statusCode    int
+		expectedEntry accessEntry
+	}{
+		{
+			name: "Minimal",
+			req: func() *http.Request {
+				r, _ := http.NewRequest("GET", "http://users-service:8080/v1/users?limit=10", nil)
+				return r
+			},
+			clientIP:   "10.0.0.1",
+			statusCode: 0,
+			expectedEntry: accessEntry{
+				remoteAddr: "10.0.0.1",
+				start:      start,
+				method:     "GET",
+				uri:        "/v1/users?limit=10",
+				path:       "/v1/users",
+				query:      "limit=10",
+				proto:      "HTTP/1.1",
+				statusCode: 200,
+				size:       42,
+				duration:   time.Second,
+			},
+		},
+		{
+			name: "Full",
+			req: func() *http.Request {
+				r := httptest.NewRequest("POST", "/v1/users", nil)
+				r.SetBasicAuth("frank", "secret")
+				r.Header.Set("Referer", "http://example.com/")
+				r.Header.Set("User-Agent", "Mozilla/5.0")
+				return r
+			},
+			clientIP:   "10.0.0.1",
+			statusCode: 201,
+			expectedEntry: accessEntry{
+				remoteAddr: "10.0.0.1",
+				user:       "frank",
+				start:      start,
+				method:     "POST",
+				uri:        "/v1/users",
+				path:       "/v1/users",
+				proto:      "HTTP/1.1",
+				statusCode: 201,
+				size:       42,
+				referer:    "http://example.com/",
+				userAgent:  "Mozilla/5.0",
+				duration:   time.Second,
+			},
+		},
+		{
+			name: "ObfuscatedClient",
+			req: func() *http.Request {
+				r := httptest.NewRequest("GET", "/v1/users", nil)
+				r.RemoteAddr = "10.0.0.2:51234"
+				return r
+			},
+			clientIP:   "_hidden\" 200 \"",
+			statusCode: 200,
+			expectedEntry: accessEntry{
+				remoteAddr: "10.0.0.2",
+				start:      start,
+				method:     "GET",
+				uri:        "/v1/users",
+				path:       "/v1/users",
+				proto:      "HTTP/1.1",
+				statusCode: 200,
+				size:       42,
+				duration:   time.Second,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newAccessEntry(tc.req(), tc.clientIP, start, tc.statusCode, 42, time.Second)
+			assert.Equal(t, tc.expectedEntry, e)
+		})
+	}
+}
+
+func TestAccessLogWrite(t *testing.T) {
+	start := time.Date(2020, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60))
+
+	entries := []accessEntry{
+		{
+			remoteAddr: "127.0.0.1",
+			user:       "frank",
+			start:      start,
+			method:     "GET",
+			uri:        "/apache_pb.gif?size=large",
+			path:       "/apache_pb.gif",
+			query:      "size=large",
+			proto:      "HTTP/1.0",
+			statusCode: 200,
+			size:       2326,
+			referer:    "http://www.example.com/start.html",
+			userAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			duration:   1500 * time.Millisecond,
+		},
+		{
+			remoteAddr: "127.0.0.1",
+			start:      start,
+			method:     "GET",
+			uri:        "/\"injected\"\n",
+			path:       "/\"injected\"\n",
+			proto:      "HTTP/1.1",
+			statusCode: 304,
+		},
+		{
+			remoteAddr: "pipe\"\n",
+			start:      start,
+			method:     "GET",
+			uri:        "/",
+			path:       "/",
+			proto:      "HTTP/1.1",
+			statusCode: 200,
+		},
+	}
+
+	tests := []struct {
+		name           string
+		format         AccessLogFormat
+		expectedOutput string
+	}{
+		{
+			name:   "Common",
+			format: CommonLogFormat,
+			expectedOutput: `127.0.0.1 - frank [10/Oct/2020:13:55:36 -0700] "GET /apache_pb.gif?size=large HTTP/1.0" 200 2326
+127.0.0.1 - - [10/Oct/2020:13:55:36 -0700] "GET /\"injected\"\x0a HTTP/1.1" 304 -
+pipe\"\x0a - - [10/Oct/2020:13:55:36 -0700] "GET / HTTP/1.1" 200 -
+`,
+		},
+		{
+			name:   "Combined",
+			format: CombinedLogFormat,
+			expectedOutput: `127.0.0.1 - frank [10/Oct/2020:13:55:36 -0700] "GET /apache_pb.gif?size=large HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"
+127.0.0.1 - - [10/Oct/2020:13:55:36 -0700] "GET /\"injected\"\x0a HTTP/1.1" 304 - "-" "-"
+pipe\"\x0a - - [10/Oct/2020:13:55:36 -0700] "GET / HTTP/1.1" 200 - "-" "-"
+`,
+		},
+		{
+			name:   "W3C",
+			format: W3CLogFormat,
+			expectedOutput: `#Version: 1.0
+#Date: 2020-10-10 20:55:36
+#Fields: date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(Referer) cs(User-Agent)
+2020-10-10 20:55:36 127.0.0.1 frank GET /apache_pb.gif size=large 200 2326 1.500 http://www.example.com/start.html "Mozilla/4.08 [en] (Win98; I ;Nav)"
+2020-10-10 20:55:36 127.0.0.1 - GET "/""injected"" " - 304 0 0.000 - -
+2020-10-10 20:55:36 "pipe"" " - GET / - 200 0 0.000 - -
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			l := newAccessLog(AccessLogOptions{
+				Writer: buff,
+				Format: tc.format,
+			})
+
+			for _, e := range entries {
+				l.write(e)
+			}
+
+			assert.Equal(t, tc.expectedOutput, buff.String())
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package xhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	bodyEvent          = "http.body"
+	defaultBodyMaxSize = 4096
+)
+
+// BodyOptions contains options for capturing request and response bodies in debug logs and span logs.
+//   MaxSize is the maximum number of bytes captured from each body (default 4096).
+//   Filter determines whether or not bodies are captured for a request (i.e. per route). By default, bodies of all requests are captured.
+//   OnlyErrors captures bodies only for 4xx and 5xx responses and failed requests.
+//   Redact transforms captured bodies before they are logged (i.e. for masking secrets and personal data).
+// Bodies with binary content types are not captured and JSON bodies are pretty-printed.
+type BodyOptions struct {
+	MaxSize    int
+	Filter     func(*http.Request) bool
+	OnlyErrors bool
+	Redact     func(body string) string
+}
+
+// bodyCapture captures request and response bodies.
+type bodyCapture struct {
+	maxSize    int
+	filter     func(*http.Request) bool
+	onlyErrors bool
+	redact     func(string) string
+}
+
+func newBodyCapture(opts BodyOptions) *bodyCapture {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultBodyMaxSize
+	}
+
+	return &bodyCapture{
+		maxSize:    maxSize,
+		filter:     opts.Filter,
+		onlyErrors: opts.OnlyErrors,
+		redact:     opts.Redact,
+	}
+}
+
+// enabled determines whether or not bodies should be captured for a request.
+func (c *bodyCapture) enabled(r *http.Request) bool {
+	return c.filter == nil || c.filter(r)
+}
+
+// report determines whether or not captured bodies should be reported for a status code.
+// A negative status code means the request failed.
+func (c *bodyCapture) report(statusCode int) bool {
+	return !c.onlyErrors || statusCode >= 400 || statusCode < 0
+}
+
+// bodyBuffer keeps up to a maximum number of bytes of a body and counts all bytes.
+type bodyBuffer struct {
+	sync.Mutex
+	max  int
+	data []byte
+	size int64
+}
+
+func newBodyBuffer(max int) *bodyBuffer {
+	return &bodyBuffer{
+		max: max,
+	}
+}
+
+func (b *bodyBuffer) write(p []byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	if n := b.max - len(b.data); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		b.data = append(b.data, p[:n]...)
+	}
+
+	b.size += int64(len(p))
+}
+
+// fields returns the log fields for a body with a given prefix (req or res).
+// Binary bodies are only reported by their size and printable bodies are redacted by an optional function.
+func (b *bodyBuffer) fields(prefix, contentType string, redact func(string) string) []interface{} {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.size == 0 {
+		return nil
+	}
+
+	kv := []interface{}{prefix + ".bodySize", b.size}
+	if body, ok := formatBody(contentType, b.data, b.size > int64(len(b.data))); ok {
+		if redact != nil {
+			body = redact(body)
+		}
+		kv = append(kv, prefix+".body", body)
+	}
+	if b.size > int64(len(b.data)) {
+		kv = append(kv, prefix+".bodyTruncated", true)
+	}
+
+	return kv
+}
+
+// bodyReader captures a body while it is being read.
+type bodyReader struct {
+	io.ReadCloser
+	buf *bodyBuffer
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.write(p[:n])
+
+	return n, err
+}
+
+// closeBody captures a response body while it is being read and calls a function once the body is closed.
+type closeBody struct {
+	bodyReader
+	once    sync.Once
+	onClose func()
+}
+
+func (b *closeBody) Close() error {
+	err := b.bodyReader.Close()
+	b.once.Do(b.onClose)
+
+	return err
+}
+
+// bodyWriter captures a response body while it is being written.
+type bodyWriter struct {
+	http.ResponseWriter
+	buf        *bodyBuffer
+	statusCode int
+}
+
+func (w *bodyWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.buf.write(b[:n])
+
+	return n, err
+}
+
+// Flush sends any buffered data to the client, so streaming responses are not affected.
+func (w *bodyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// isTextual determines whether or not a media type is textual.
+func isTextual(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded", "application/graphql":
+		return true
+	}
+
+	return false
+}
+
+// formatBody returns the printable form of a body or false if the body is binary.
+// If the content type is not known, it is detected from the body.
+// Complete JSON bodies are pretty-printed.
+func formatBody(contentType string, data []byte, truncated bool) (string, bool) {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !isTextual(mediaType) {
+		return "", false
+	}
+
+	if !truncated && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		out := new(bytes.Buffer)
+		if err := json.Indent(out, data, "", "  "); err == nil {
+			return out.String(), true
+		}
+	}
+
+	return string(data), true
+}
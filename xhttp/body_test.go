@@ -0,0 +1,205 @@
+package xhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBodyCapture(t *testing.T) {
+	tests := []struct {
+		name               string
+		opts               BodyOptions
+		expectedMaxSize    int
+		expectedOnlyErrors bool
+	}{
+		{
+			name:            "Defaults",
+			opts:            BodyOptions{},
+			expectedMaxSize: 4096,
+		},
+		{
+			name: "WithOptions",
+			opts: BodyOptions{
+				MaxSize:    1024,
+				OnlyErrors: true,
+			},
+			expectedMaxSize:    1024,
+			expectedOnlyErrors: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newBodyCapture(tc.opts)
+
+			assert.Equal(t, tc.expectedMaxSize, c.maxSize)
+			assert.Equal(t, tc.expectedOnlyErrors, c.onlyErrors)
+		})
+	}
+}
+
+func TestBodyCapture(t *testing.T) {
+	c := newBodyCapture(BodyOptions{
+		Filter: func(r *http.Request) bool {
+			return r.URL.Path != "/health"
+		},
+		OnlyErrors: true,
+	})
+
+	assert.True(t, c.enabled(httptest.NewRequest("GET", "/v1/users", nil)))
+	assert.False(t, c.enabled(httptest.NewRequest("GET", "/health", nil)))
+
+	assert.False(t, c.report(200))
+	assert.True(t, c.report(404))
+	assert.True(t, c.report(500))
+	assert.True(t, c.report(-1))
+
+	c = newBodyCapture(BodyOptions{})
+	assert.True(t, c.enabled(httptest.NewRequest("GET", "/health", nil)))
+	assert.True(t, c.report(200))
+}
+
+func TestBodyBuffer(t *testing.T) {
+	tests := []struct {
+		name           string
+		max            int
+		contentType    string
+		writes         []string
+		redact         func(string) string
+		expectedFields []interface{}
+	}{
+		{
+			name:           "Empty",
+			max:            16,
+			contentType:    "application/json",
+			writes:         nil,
+			expectedFields: nil,
+		},
+		{
+			name:           "JSON",
+			max:            16,
+			contentType:    "application/json",
+			writes:         []string{`{"id":`, `"1234"}`},
+			expectedFields: []interface{}{"res.bodySize", int64(13), "res.body", "{\n  \"id\": \"1234\"\n}"},
+		},
+		{
+			name:           "Truncated",
+			max:            8,
+			contentType:    "application/json",
+			writes:         []string{`{"id":`, `"1234"}`},
+			expectedFields: []interface{}{"res.bodySize", int64(13), "res.body", `{"id":"1`, "res.bodyTruncated", true},
+		},
+		{
+			name:           "Binary",
+			max:            16,
+			contentType:    "application/octet-stream",
+			writes:         []string{"\x00\x01\x02"},
+			expectedFields: []interface{}{"res.bodySize", int64(3)},
+		},
+		{
+			name:           "Redacted",
+			max:            32,
+			contentType:    "application/x-www-form-urlencoded",
+			writes:         []string{"user=jane&password=secret"},
+			redact:         func(body string) string { return strings.Replace(body, "secret", "***", -1) },
+			expectedFields: []interface{}{"res.bodySize", int64(25), "res.body", "user=jane&password=***"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBodyBuffer(tc.max)
+			for _, w := range tc.writes {
+				b.write([]byte(w))
+			}
+
+			assert.Equal(t, tc.expectedFields, b.fields("res", tc.contentType, tc.redact))
+		})
+	}
+}
+
+func TestCloseBody(t *testing.T) {
+	buf := newBodyBuffer(16)
+	closed := 0
+	b := &closeBody{
+		bodyReader: bodyReader{ReadCloser: ioutil.NopCloser(bytes.NewReader([]byte("hello, world"))), buf: buf},
+		onClose:    func() { closed++ },
+	}
+
+	data, err := ioutil.ReadAll(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world", string(data))
+
+	assert.NoError(t, b.Close())
+	assert.NoError(t, b.Close())
+	assert.Equal(t, 1, closed)
+	assert.Equal(t, "hello, world", string(buf.data))
+}
+
+func TestBodyReader(t *testing.T) {
+	buf := newBodyBuffer(4)
+	r := &bodyReader{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader([]byte("hello, world"))),
+		buf:        buf,
+	}
+
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world", string(data))
+	assert.Equal(t, "hell", string(buf.data))
+	assert.Equal(t, int64(12), buf.size)
+}
+
+func TestBodyWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &bodyWriter{ResponseWriter: rec, buf: newBodyBuffer(4)}
+
+	var _ http.Flusher = w
+	_, err := w.Write([]byte("hello, world"))
+	assert.NoError(t, err)
+	w.Flush()
+
+	assert.Equal(t, 200, w.statusCode)
+	assert.Equal(t, "hello, world", rec.Body.String())
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "hell", string(w.buf.data))
+	assert.Equal(t, int64(12), w.buf.size)
+}
+
+func TestFormatBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		data         string
+		truncated    bool
+		expectedBody string
+		expectedOK   bool
+	}{
+		{"JSON", "application/json; charset=utf-8", `{"id":"1234"}`, false, "{\n  \"id\": \"1234\"\n}", true},
+		{"ProblemJSON", "application/problem+json", `{"status":400}`, false, "{\n  \"status\": 400\n}", true},
+		{"TruncatedJSON", "application/json", `{"id":"12`, true, `{"id":"12`, true},
+		{"InvalidJSON", "application/json", `{id}`, false, `{id}`, true},
+		{"Text", "text/plain", "hello", false, "hello", true},
+		{"Form", "application/x-www-form-urlencoded", "name=john", false, "name=john", true},
+		{"XML", "application/xml", "<id>1234</id>", false, "<id>1234</id>", true},
+		{"Binary", "image/png", "\x89PNG", false, "", false},
+		{"InvalidContentType", "invalid;", "hello", false, "", false},
+		{"DetectText", "", "hello", false, "hello", true},
+		{"DetectBinary", "", "\x00\x01\x02", false, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, ok := formatBody(tc.contentType, []byte(tc.data), tc.truncated)
+
+			assert.Equal(t, tc.expectedBody, body)
+			assert.Equal(t, tc.expectedOK, ok)
+		})
+	}
+}
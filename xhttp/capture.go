@@ -0,0 +1,247 @@
+package xhttp
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// alwaysRedacted are the headers whose values are always redacted.
+var alwaysRedacted = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// CaptureOptions contains options for capturing details of requests and responses in log fields and span tags.
+// Nothing is captured by default.
+//   RequestHeaders are the allow-listed request headers (req.header.<name> fields and http.request.header.<name> tags).
+//   ResponseHeaders are the allow-listed response headers (res.header.<name> fields and http.response.header.<name> tags).
+//   QueryParams are the allow-listed query parameters (req.query.<name> fields and http.request.query.<name> tags).
+//   RemoteIP captures the IP address of clients (req.remoteIp field and http.request.remote_ip tag) for server middleware.
+//   TrustedProxies are the IP addresses or CIDR ranges of proxies trusted for X-Forwarded-For and Forwarded headers (invalid entries are ignored).
+//   UserAgent captures the user agent of requests (req.userAgent field).
+//   Redact are the names of additional headers and query parameters whose values are redacted.
+// The values of Authorization, Proxy-Authorization, Cookie, and Set-Cookie headers are always redacted.
+type CaptureOptions struct {
+	RequestHeaders  []string
+	ResponseHeaders []string
+	QueryParams     []string
+	RemoteIP        bool
+	TrustedProxies  []string
+	UserAgent       bool
+	Redact          []string
+}
+
+// captured is a captured value with its log field and span tag names.
+type captured struct {
+	field string
+	tag   string
+	val   string
+}
+
+// capture captures details of requests and responses.
+type capture struct {
+	requestHeaders  []string
+	responseHeaders []string
+	queryParams     []string
+	remoteIP        bool
+	userAgent       bool
+	proxies         []*net.IPNet
+	redact          map[string]bool
+}
+
+func newCapture(opts CaptureOptions) *capture {
+	c := &capture{
+		requestHeaders:  opts.RequestHeaders,
+		responseHeaders: opts.ResponseHeaders,
+		queryParams:     opts.QueryParams,
+		remoteIP:        opts.RemoteIP,
+		userAgent:       opts.UserAgent,
+		proxies:         []*net.IPNet{},
+		redact:          map[string]bool{},
+	}
+
+	for _, proxy := range opts.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				c.proxies = append(c.proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		} else if _, ipNet, err := net.ParseCIDR(proxy); err == nil {
+			c.proxies = append(c.proxies, ipNet)
+		}
+	}
+
+	for _, name := range append(alwaysRedacted, opts.Redact...) {
+		c.redact[strings.ToLower(name)] = true
+	}
+
+	return c
+}
+
+// value returns a value or the redacted value if the name should be redacted.
+func (c *capture) value(name, val string) string {
+	if c.redact[strings.ToLower(name)] {
+		return redactedValue
+	}
+
+	return val
+}
+
+// trusted determines whether or not an IP address belongs to a trusted proxy.
+func (c *capture) trusted(ip net.IP) bool {
+	for _, proxy := range c.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP address of the client sending a request.
+// X-Forwarded-For and Forwarded headers are only used if the request is received from a trusted proxy.
+// The addresses in these headers are checked from right to left and the first untrusted address is the client.
+func (c *capture) clientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	ip := net.ParseIP(peer)
+	if ip == nil || !c.trusted(ip) {
+		return peer
+	}
+
+	addrs := forwardedFor(r.Header)
+	if len(addrs) == 0 {
+		return peer
+	}
+
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := net.ParseIP(addrs[i])
+		if ip == nil {
+			// Obfuscated identifiers and unknown are not IP addresses
+			return addrs[i]
+		}
+		if !c.trusted(ip) {
+			return addrs[i]
+		}
+	}
+
+	// All addresses are trusted proxies
+	return addrs[0]
+}
+
+// forwardedFor returns the addresses of clients and proxies from Forwarded or X-Forwarded-For headers in order.
+// The Forwarded header has priority over X-Forwarded-For header.
+func forwardedFor(h http.Header) []string {
+	addrs := []string{}
+
+	// Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+	for _, header := range h.Values("Forwarded") {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					addrs = append(addrs, stripPort(strings.Trim(kv[1], `"`)))
+				}
+			}
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	// X-Forwarded-For: 203.0.113.195, 70.41.3.18, 150.172.238.178
+	for _, header := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, stripPort(addr))
+			}
+		}
+	}
+
+	return addrs
+}
+
+// stripPort removes the port and the brackets from an address if any.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// request returns the captured details of a request.
+// The remote IP is only captured for server requests.
+func (c *capture) request(r *http.Request, server bool) []captured {
+	values := []captured{}
+
+	for _, name := range c.requestHeaders {
+		if val := strings.Join(r.Header.Values(name), ", "); val != "" {
+			key := strings.ToLower(name)
+			values = append(values, captured{"req.header." + key, "http.request.header." + key, c.value(name, val)})
+		}
+	}
+
+	query := r.URL.Query()
+	for _, name := range c.queryParams {
+		if val := strings.Join(query[name], ", "); val != "" {
+			values = append(values, captured{"req.query." + name, "http.request.query." + name, c.value(name, val)})
+		}
+	}
+
+	if c.remoteIP && server {
+		values = append(values, captured{"req.remoteIp", "http.request.remote_ip", c.clientIP(r)})
+	}
+
+	if c.userAgent {
+		if val := r.UserAgent(); val != "" {
+			// The user agent is always tagged on spans as http.user_agent
+			values = append(values, captured{"req.userAgent", "", val})
+		}
+	}
+
+	return values
+}
+
+// response returns the captured headers of a response.
+func (c *capture) response(h http.Header) []captured {
+	values := []captured{}
+
+	for _, name := range c.responseHeaders {
+		if val := strings.Join(h.Values(name), ", "); val != "" {
+			key := strings.ToLower(name)
+			values = append(values, captured{"res.header." + key, "http.response.header." + key, c.value(name, val)})
+		}
+	}
+
+	return values
+}
+
+// capturedFields returns the log fields for captured values.
+func capturedFields(values []captured) []interface{} {
+	kv := []interface{}{}
+	for _, v := range values {
+		kv = append(kv, v.field, v.val)
+	}
+
+	return kv
+}
+
+// capturedTags returns the span tags for captured values.
+func capturedTags(values []captured) map[string]string {
+	t := map[string]string{}
+	for _, v := range values {
+		if v.tag != "" {
+			t[v.tag] = v.val
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,171 @@
+package xhttp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCapture(t *testing.T) {
+	c := newCapture(CaptureOptions{
+		RequestHeaders: []string{"Tenant"},
+		TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1", "invalid", "10.0.0.0/99"},
+		Redact:         []string{"X-API-Key", "token"},
+	})
+
+	assert.Equal(t, []string{"Tenant"}, c.requestHeaders)
+	assert.Len(t, c.proxies, 3)
+	assert.True(t, c.trusted(net.ParseIP("10.1.2.3")))
+	assert.True(t, c.trusted(net.ParseIP("192.0.2.1")))
+	assert.False(t, c.trusted(net.ParseIP("192.0.2.2")))
+	assert.True(t, c.trusted(net.ParseIP("2001:db8::1")))
+	assert.False(t, c.trusted(net.ParseIP("2001:db8::2")))
+	assert.Equal(t, map[string]bool{
+		"authorization":       true,
+		"proxy-authorization": true,
+		"cookie":              true,
+		"set-cookie":          true,
+		"x-api-key":           true,
+		"token":               true,
+	}, c.redact)
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		expectedAddrs []string
+	}{
+		{
+			name:          "None",
+			headers:       map[string]string{},
+			expectedAddrs: []string{},
+		},
+		{
+			name:          "XForwardedFor",
+			headers:       map[string]string{"X-Forwarded-For": "203.0.113.195, 70.41.3.18,150.172.238.178"},
+			expectedAddrs: []string{"203.0.113.195", "70.41.3.18", "150.172.238.178"},
+		},
+		{
+			name:          "Forwarded",
+			headers:       map[string]string{"Forwarded": `for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`},
+			expectedAddrs: []string{"192.0.2.60", "2001:db8:cafe::17"},
+		},
+		{
+			name: "ForwardedPriority",
+			headers: map[string]string{
+				"Forwarded":       "for=192.0.2.60",
+				"X-Forwarded-For": "203.0.113.195",
+			},
+			expectedAddrs: []string{"192.0.2.60"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tc.headers {
+				h.Set(k, v)
+			}
+
+			assert.Equal(t, tc.expectedAddrs, forwardedFor(h))
+		})
+	}
+}
+
+func TestCaptureClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		expectedIP string
+	}{
+		{"NoProxy", "203.0.113.10:5000", "", "203.0.113.10"},
+		{"UntrustedPeer", "203.0.113.10:5000", "198.51.100.1", "203.0.113.10"},
+		{"TrustedPeerNoHeader", "10.0.0.1:5000", "", "10.0.0.1"},
+		{"TrustedPeer", "10.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"SpoofedHeader", "10.0.0.1:5000", "1.1.1.1, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"AllTrusted", "10.0.0.1:5000", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"Unknown", "10.0.0.1:5000", "unknown", "unknown"},
+	}
+
+	c := newCapture(CaptureOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+
+			assert.Equal(t, tc.expectedIP, c.clientIP(r))
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	c := newCapture(CaptureOptions{
+		RequestHeaders:  []string{"Tenant", "Authorization", "X-API-Key", "Missing"},
+		ResponseHeaders: []string{"Content-Type", "Set-Cookie"},
+		QueryParams:     []string{"page", "token"},
+		RemoteIP:        true,
+		UserAgent:       true,
+		Redact:          []string{"X-API-Key", "token"},
+	})
+
+	r := httptest.NewRequest("GET", "/v1/users?page=2&token=secret&other=1", nil)
+	r.Header.Set("Tenant", "acme")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-API-Key", "secret")
+	r.Header.Set("User-Agent", "test-client/1.0")
+
+	t.Run("ServerRequest", func(t *testing.T) {
+		values := c.request(r, true)
+
+		assert.Equal(t, []interface{}{
+			"req.header.tenant", "acme",
+			"req.header.authorization", "[REDACTED]",
+			"req.header.x-api-key", "[REDACTED]",
+			"req.query.page", "2",
+			"req.query.token", "[REDACTED]",
+			"req.remoteIp", "192.0.2.1",
+			"req.userAgent", "test-client/1.0",
+		}, capturedFields(values))
+
+		assert.Equal(t, map[string]string{
+			"http.request.header.tenant":        "acme",
+			"http.request.header.authorization": "[REDACTED]",
+			"http.request.header.x-api-key":     "[REDACTED]",
+			"http.request.query.page":           "2",
+			"http.request.query.token":          "[REDACTED]",
+			"http.request.remote_ip":            "192.0.2.1",
+		}, capturedTags(values))
+	})
+
+	t.Run("ClientRequest", func(t *testing.T) {
+		values := c.request(r, false)
+		assert.NotContains(t, capturedFields(values), "req.remoteIp")
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Content-Type", "application/json")
+		h.Add("Set-Cookie", "session=secret")
+
+		values := c.response(h)
+
+		assert.Equal(t, []interface{}{
+			"res.header.content-type", "application/json",
+			"res.header.set-cookie", "[REDACTED]",
+		}, capturedFields(values))
+
+		assert.Equal(t, map[string]string{
+			"http.response.header.content-type": "application/json",
+			"http.response.header.set-cookie":   "[REDACTED]",
+		}, capturedTags(values))
+	})
+}
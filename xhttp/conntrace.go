@@ -0,0 +1,167 @@
+package xhttp
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracingLog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	clientPhaseMetricName = "http_client_phase_duration_seconds"
+	clientConnMetricName  = "http_client_connections_total"
+)
+
+// Connection-level phases of client requests.
+//   dns is the duration of DNS lookups.
+//   connect is the duration of establishing new connections.
+//   tls is the duration of TLS handshakes.
+//   ttfb is the duration from writing a request to receiving the first byte of its response (time to first byte).
+const (
+	dnsPhase     = "dns"
+	connectPhase = "connect"
+	tlsPhase     = "tls"
+	ttfbPhase    = "ttfb"
+)
+
+// connMetrics are the metrics for connection-level events of client requests.
+type connMetrics struct {
+	phaseHist   *prometheus.HistogramVec
+	connCounter *prometheus.CounterVec
+}
+
+func newConnMetrics(mf *metrics.Factory) *connMetrics {
+	return &connMetrics{
+		phaseHist:   mf.Histogram(clientPhaseMetricName, "histogram metric for duration of connection-level phases of client-side http requests in seconds", []string{"host", "phase"}),
+		connCounter: mf.Counter(clientConnMetricName, "counter metric for total number of connections obtained for client-side http requests", []string{"host", "reused"}),
+	}
+}
+
+// connTrace records connection-level events of a client request on a span and metrics.
+// Events are recorded until the request is done, since some of them can happen in the background (i.e. dialing a connection for the pool).
+type connTrace struct {
+	sync.Mutex
+	host    string
+	span    opentracing.Span
+	metrics *connMetrics
+	starts  map[string]time.Time
+	done    bool
+}
+
+func newConnTrace(host string, span opentracing.Span, metrics *connMetrics) *connTrace {
+	return &connTrace{
+		host:    host,
+		span:    span,
+		metrics: metrics,
+		starts:  map[string]time.Time{},
+	}
+}
+
+// start records the start of a phase.
+// The key distinguishes concurrent occurrences of a phase (i.e. connecting to multiple addresses).
+func (t *connTrace) start(key string) {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.done {
+		t.starts[key] = time.Now()
+	}
+}
+
+// finish records the end of a phase.
+func (t *connTrace) finish(phase, key string, err error) {
+	t.Lock()
+	defer t.Unlock()
+
+	start, ok := t.starts[key]
+	if t.done || !ok {
+		return
+	}
+
+	delete(t.starts, key)
+	duration := time.Since(start).Seconds()
+
+	if t.span != nil {
+		fields := []opentracingLog.Field{
+			opentracingLog.String("event", "http."+phase),
+			opentracingLog.Float64("duration", duration),
+		}
+		if err != nil {
+			fields = append(fields, opentracingLog.Error(err))
+		}
+		t.span.LogFields(fields...)
+	}
+
+	if t.metrics != nil {
+		t.metrics.phaseHist.WithLabelValues(t.host, phase).Observe(duration)
+	}
+}
+
+// gotConn records obtaining a connection for the request.
+func (t *connTrace) gotConn(info httptrace.GotConnInfo) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.done {
+		return
+	}
+
+	if t.span != nil {
+		t.span.SetTag("http.conn_reused", info.Reused)
+		t.span.LogFields(
+			opentracingLog.String("event", "http.got_conn"),
+			opentracingLog.Bool("reused", info.Reused),
+			opentracingLog.Bool("wasIdle", info.WasIdle),
+			opentracingLog.Float64("idleTime", info.IdleTime.Seconds()),
+		)
+	}
+
+	if t.metrics != nil {
+		t.metrics.connCounter.WithLabelValues(t.host, strconv.FormatBool(info.Reused)).Inc()
+	}
+}
+
+// close stops recording events.
+func (t *connTrace) close() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.done = true
+}
+
+// clientTrace creates the httptrace.ClientTrace hooks for recording events.
+func (t *connTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.start(dnsPhase)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.finish(dnsPhase, dnsPhase, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			t.start(connectPhase + ":" + network + ":" + addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.finish(connectPhase, connectPhase+":"+network+":"+addr, err)
+		},
+		TLSHandshakeStart: func() {
+			t.start(tlsPhase)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.finish(tlsPhase, tlsPhase, err)
+		},
+		GotConn: t.gotConn,
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.start(ttfbPhase)
+		},
+		GotFirstResponseByte: func() {
+			t.finish(ttfbPhase, ttfbPhase, nil)
+		},
+	}
+}
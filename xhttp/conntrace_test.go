@@ -0,0 +1,106 @@
+package xhttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func spanLogEvents(span *mocktracer.MockSpan) []string {
+	events := []string{}
+	for _, l := range span.Logs() {
+		for _, f := range l.Fields {
+			if f.Key == "event" {
+				events = append(events, f.ValueString)
+			}
+		}
+	}
+
+	return events
+}
+
+func TestNewConnMetrics(t *testing.T) {
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+	m := newConnMetrics(mf)
+
+	assert.NotNil(t, m.phaseHist)
+	assert.NotNil(t, m.connCounter)
+}
+
+func TestConnTrace(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test").(*mocktracer.MockSpan)
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+	ct := newConnTrace("users-service:8080", span, newConnMetrics(mf))
+	trace := ct.clientTrace()
+
+	trace.DNSStart(httptrace.DNSStartInfo{Host: "users-service"})
+	trace.DNSDone(httptrace.DNSDoneInfo{})
+	trace.ConnectStart("tcp", "10.0.0.1:8080")
+	trace.ConnectStart("tcp", "10.0.0.2:8080")
+	trace.ConnectDone("tcp", "10.0.0.2:8080", nil)
+	trace.ConnectDone("tcp", "10.0.0.1:8080", errors.New("connection refused"))
+	trace.TLSHandshakeStart()
+	trace.TLSHandshakeDone(tls.ConnectionState{}, nil)
+	trace.GotConn(httptrace.GotConnInfo{Reused: false})
+	trace.WroteRequest(httptrace.WroteRequestInfo{})
+	time.Sleep(5 * time.Millisecond)
+	trace.GotFirstResponseByte()
+
+	// Events after the request is done are not recorded
+	ct.close()
+	trace.DNSStart(httptrace.DNSStartInfo{Host: "users-service"})
+	trace.DNSDone(httptrace.DNSDoneInfo{})
+	trace.GotConn(httptrace.GotConnInfo{Reused: true})
+
+	// Verify span logs
+	assert.Equal(t, []string{"http.dns", "http.connect", "http.connect", "http.tls", "http.got_conn", "http.ttfb"}, spanLogEvents(span))
+	assert.Equal(t, false, span.Tag("http.conn_reused"))
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+
+	for _, metricFamily := range metricFamilies {
+		switch *metricFamily.Name {
+		case clientPhaseMetricName:
+			assert.Equal(t, promModel.MetricType_HISTOGRAM, *metricFamily.Type)
+			counts := map[string]uint64{}
+			for _, m := range metricFamily.Metric {
+				for _, l := range m.Label {
+					if *l.Name == "phase" {
+						counts[*l.Value] = *m.Histogram.SampleCount
+					}
+				}
+			}
+			assert.Equal(t, map[string]uint64{"dns": 1, "connect": 2, "tls": 1, "ttfb": 1}, counts)
+		case clientConnMetricName:
+			assert.Equal(t, promModel.MetricType_COUNTER, *metricFamily.Type)
+			assert.Len(t, metricFamily.Metric, 1)
+			assert.Equal(t, float64(1), *metricFamily.Metric[0].Counter.Value)
+		}
+	}
+}
+
+func TestConnTraceNoSpanNoMetrics(t *testing.T) {
+	ct := newConnTrace("users-service:8080", nil, nil)
+	trace := ct.clientTrace()
+
+	trace.DNSStart(httptrace.DNSStartInfo{Host: "users-service"})
+	trace.DNSDone(httptrace.DNSDoneInfo{})
+	trace.GotConn(httptrace.GotConnInfo{Reused: true})
+	trace.GotFirstResponseByte()
+
+	assert.Empty(t, ct.starts)
+}
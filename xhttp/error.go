@@ -0,0 +1,337 @@
+package xhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/request"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	maxErrorBodySize   = 64 * 1024
+	upstreamDetail     = "An upstream request failed."
+)
+
+var (
+	// ErrClient is matched by errors.Is for errors with 4xx status codes.
+	ErrClient = errors.New("http client error")
+	// ErrServer is matched by errors.Is for errors with 5xx status codes.
+	ErrServer = errors.New("http server error")
+)
+
+// Problem is a problem details object for http apis (RFC 7807).
+//   Type is a URI reference identifying the problem type (default about:blank).
+//   Title is a short summary of the problem type.
+//   Status is the http status code.
+//   Detail is an explanation specific to this occurrence of the problem.
+//   Instance is a URI reference identifying this occurrence of the problem.
+//   Extensions are additional members of the problem details object.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// problemMembers are the standard members of a problem details object.
+type problemMembers struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, so extensions are encoded as top-level members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+
+	std := map[string]interface{}{
+		"type":     p.Type,
+		"title":    p.Title,
+		"status":   p.Status,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+	}
+
+	for k, v := range std {
+		if v != "" && v != 0 {
+			members[k] = v
+		} else {
+			delete(members, k)
+		}
+	}
+
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, so top-level members other than the standard ones are decoded as extensions.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var std problemMembers
+	if err := json.Unmarshal(data, &std); err != nil {
+		return err
+	}
+
+	var members map[string]interface{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, k)
+	}
+
+	if len(members) == 0 {
+		members = nil
+	}
+
+	*p = Problem{
+		Type:       std.Type,
+		Title:      std.Title,
+		Status:     std.Status,
+		Detail:     std.Detail,
+		Instance:   std.Instance,
+		Extensions: members,
+	}
+
+	return nil
+}
+
+// Error is an http error.
+//   Request is the request that failed.
+//   StatusCode is the status code of the response.
+//   Message is the detail of the problem or the body of the response.
+//   Problem is the problem details object if the response body is application/problem+json.
+//   RequestID is the request id of the failed request.
+//   TraceID is the id of the trace the failed request belongs to.
+// Only errors created by NewProblemError are exposed by WriteError.
+type Error struct {
+	Request    *http.Request
+	StatusCode int
+	Message    string
+	Problem    *Problem
+	RequestID  string
+	TraceID    string
+
+	public bool
+}
+
+// NewProblemError creates a new instance of Error for responding to the current request.
+// Unlike other errors, the status code and the problem details of this error are exposed by WriteError.
+// If the status of the problem is not set, it will be 500.
+func NewProblemError(problem Problem) *Error {
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+
+	return &Error{
+		StatusCode: problem.Status,
+		Message:    problem.message(),
+		Problem:    &problem,
+		public:     true,
+	}
+}
+
+// NewError creates a new instance of Error.
+// Up to 64KB of the response body is read and application/problem+json bodies are parsed into Problem.
+// The request id and the trace id are taken from the response headers or the request context.
+func NewError(res *http.Response) *Error {
+	err := &Error{
+		Request:    res.Request,
+		StatusCode: res.StatusCode,
+	}
+
+	if res.Body != nil {
+		if data, e := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize)); e == nil {
+			err.Message = string(data)
+
+			if isProblem(res.Header.Get("Content-Type")) {
+				problem := new(Problem)
+				if e := json.Unmarshal(data, problem); e == nil {
+					err.Problem = problem
+					err.Message = problem.message()
+				}
+			}
+		}
+	}
+
+	err.RequestID = res.Header.Get(requestIDHeader)
+
+	if res.Request != nil {
+		ctx := res.Request.Context()
+
+		if err.RequestID == "" {
+			err.RequestID, _ = request.IDFromContext(ctx)
+		}
+
+		err.TraceID = traceID(opentracing.SpanFromContext(ctx))
+	}
+
+	return err
+}
+
+func (e *Error) Error() string {
+	if e.Request == nil || e.Request.URL == nil {
+		return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("%s %s %d: %s", e.Request.Method, e.Request.URL.Path, e.StatusCode, e.Message)
+}
+
+// Is implements the interface used by errors.Is for matching errors by their status classes (ErrClient and ErrServer).
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrClient:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrServer:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	default:
+		return false
+	}
+}
+
+// KV implements log.KVError, so the context of the error is logged by log.ErrorE.
+func (e *Error) KV() []interface{} {
+	kv := []interface{}{"http.statusCode", e.StatusCode}
+
+	if e.Problem != nil && e.Problem.Type != "" {
+		kv = append(kv, "problem.type", e.Problem.Type)
+	}
+
+	if e.RequestID != "" {
+		kv = append(kv, "requestId", e.RequestID)
+	}
+
+	if e.TraceID != "" {
+		kv = append(kv, "traceId", e.TraceID)
+	}
+
+	return kv
+}
+
+// WriteError writes an error as an application/problem+json response and logs it using the logger of the request.
+// If the error is created by NewProblemError, its status code and problem details are used.
+// If the error is an Error for a failed upstream request (i.e. created by NewError), the status code will be 502
+// with a generic detail, so the upstream response is not exposed. Otherwise, the status code will be 500
+// and the message of the error is not exposed. The request id and the trace id are added as extensions.
+// Errors with 5xx status codes are logged in error level and the rest are logged in warn level.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	problem := Problem{}
+
+	var e *Error
+	if errors.As(err, &e) {
+		if e.public {
+			problem = *e.Problem
+			problem.Status = e.StatusCode
+		} else if e.Request != nil {
+			problem.Status = http.StatusBadGateway
+			problem.Detail = upstreamDetail
+		}
+	}
+
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	writeProblem(w, r, problem)
+
+	// Log the error
+	logger := log.LoggerFromContext(ctx)
+	message := fmt.Sprintf("%s %s %d: %s", r.Method, r.URL.Path, problem.Status, problem.Title)
+	if problem.Status >= 500 {
+		logger.ErrorE(err, message)
+	} else {
+		logger.WarnKV("message", message, "error", err.Error())
+	}
+}
+
+// writeProblem writes a problem details response with the request id and the trace id of a request as extensions.
+// Missing standard members of the problem are set from its status code and the request.
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	ctx := r.Context()
+
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+
+	extensions := map[string]interface{}{}
+	for k, v := range problem.Extensions {
+		extensions[k] = v
+	}
+
+	requestID, _ := request.IDFromContext(ctx)
+	if requestID == "" {
+		requestID = r.Header.Get(requestIDHeader)
+	}
+
+	if requestID != "" {
+		extensions["requestId"] = requestID
+	}
+
+	if id := traceID(opentracing.SpanFromContext(ctx)); id != "" {
+		extensions["traceId"] = id
+	}
+
+	if len(extensions) > 0 {
+		problem.Extensions = extensions
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// message returns the most specific message of a problem.
+func (p *Problem) message() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+
+	return p.Title
+}
+
+// isProblem determines whether or not a content type is application/problem+json.
+func isProblem(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == problemContentType
+}
+
+// traceID returns the trace id of a span if it is a Jaeger span.
+func traceID(span opentracing.Span) string {
+	if span == nil {
+		return ""
+	}
+
+	if sc, ok := span.Context().(jaeger.SpanContext); ok && sc.IsValid() {
+		return sc.TraceID().String()
+	}
+
+	return ""
+}
@@ -0,0 +1,429 @@
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/moorara/observe/log"
+	"github.com/moorara/observe/request"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestProblemJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		problem      Problem
+		expectedJSON string
+	}{
+		{
+			"Empty",
+			Problem{},
+			`{}`,
+		},
+		{
+			"Standard",
+			Problem{
+				Type:     "https://example.com/probs/out-of-credit",
+				Title:    "You do not have enough credit.",
+				Status:   403,
+				Detail:   "Your current balance is 30, but that costs 50.",
+				Instance: "/account/12345/msgs/abc",
+			},
+			`{"detail":"Your current balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc","status":403,"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}`,
+		},
+		{
+			"WithExtensions",
+			Problem{
+				Type:   "https://example.com/probs/out-of-credit",
+				Status: 403,
+				Extensions: map[string]interface{}{
+					"balance": float64(30),
+					"status":  "overridden",
+				},
+			},
+			`{"balance":30,"status":403,"type":"https://example.com/probs/out-of-credit"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.problem)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expectedJSON, string(data))
+
+			problem := Problem{}
+			err = json.Unmarshal(data, &problem)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.problem.Type, problem.Type)
+			assert.Equal(t, tc.problem.Status, problem.Status)
+			assert.Equal(t, tc.problem.Detail, problem.Detail)
+			if balance, ok := tc.problem.Extensions["balance"]; ok {
+				assert.Equal(t, map[string]interface{}{"balance": balance}, problem.Extensions)
+			} else {
+				assert.Nil(t, problem.Extensions)
+			}
+		})
+	}
+}
+
+func TestProblemUnmarshalJSONError(t *testing.T) {
+	problem := Problem{}
+	err := json.Unmarshal([]byte(`{"status":"invalid"}`), &problem)
+	assert.Error(t, err)
+}
+
+func TestNewError(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	span := tracer.StartSpan("test")
+	defer span.Finish()
+
+	ctx := context.Background()
+	ctx = request.ContextWithID(ctx, "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb")
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users/1", nil)
+	reqWithContext := req.WithContext(ctx)
+
+	tests := []struct {
+		name              string
+		request           *http.Request
+		statusCode        int
+		header            http.Header
+		body              string
+		expectedMessage   string
+		expectedProblem   *Problem
+		expectedRequestID string
+		expectedTraceID   string
+		expectedError     string
+	}{
+		{
+			name:            "400",
+			request:         &http.Request{Method: "GET", URL: &url.URL{Path: "/"}},
+			statusCode:      http.StatusBadRequest,
+			header:          http.Header{},
+			body:            "Invalid request",
+			expectedMessage: "Invalid request",
+			expectedError:   "GET / 400: Invalid request",
+		},
+		{
+			name:            "500",
+			request:         &http.Request{Method: "POST", URL: &url.URL{Path: "/"}},
+			statusCode:      http.StatusInternalServerError,
+			header:          http.Header{},
+			body:            "Internal error",
+			expectedMessage: "Internal error",
+			expectedError:   "POST / 500: Internal error",
+		},
+		{
+			name:              "NoRequest",
+			request:           nil,
+			statusCode:        http.StatusServiceUnavailable,
+			header:            http.Header{"Request-Id": []string{"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"}},
+			body:              "Unavailable",
+			expectedMessage:   "Unavailable",
+			expectedRequestID: "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			expectedError:     "503: Unavailable",
+		},
+		{
+			name:              "LargeBody",
+			request:           reqWithContext,
+			statusCode:        http.StatusBadGateway,
+			header:            http.Header{},
+			body:              strings.Repeat("x", maxErrorBodySize+100),
+			expectedMessage:   strings.Repeat("x", maxErrorBodySize),
+			expectedRequestID: "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb",
+			expectedTraceID:   span.Context().(jaeger.SpanContext).TraceID().String(),
+			expectedError:     "GET /v1/users/1 502: " + strings.Repeat("x", maxErrorBodySize),
+		},
+		{
+			name:            "Problem",
+			request:         reqWithContext,
+			statusCode:      http.StatusNotFound,
+			header:          http.Header{"Content-Type": []string{"application/problem+json; charset=utf-8"}, "Request-Id": []string{"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"}},
+			body:            `{"type":"https://example.com/probs/user-not-found","title":"User not found","status":404,"detail":"No user with id 1","userId":"1"}`,
+			expectedMessage: "No user with id 1",
+			expectedProblem: &Problem{
+				Type:       "https://example.com/probs/user-not-found",
+				Title:      "User not found",
+				Status:     404,
+				Detail:     "No user with id 1",
+				Extensions: map[string]interface{}{"userId": "1"},
+			},
+			expectedRequestID: "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			expectedTraceID:   span.Context().(jaeger.SpanContext).TraceID().String(),
+			expectedError:     "GET /v1/users/1 404: No user with id 1",
+		},
+		{
+			name:            "InvalidProblem",
+			request:         &http.Request{Method: "GET", URL: &url.URL{Path: "/"}},
+			statusCode:      http.StatusNotFound,
+			header:          http.Header{"Content-Type": []string{"application/problem+json"}},
+			body:            `not json`,
+			expectedMessage: "not json",
+			expectedError:   "GET / 404: not json",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{
+				Request:    tc.request,
+				StatusCode: tc.statusCode,
+				Header:     tc.header,
+				Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+			}
+
+			err := NewError(res)
+			assert.Equal(t, tc.request, err.Request)
+			assert.Equal(t, tc.statusCode, err.StatusCode)
+			assert.Equal(t, tc.expectedMessage, err.Message)
+			assert.Equal(t, tc.expectedProblem, err.Problem)
+			assert.Equal(t, tc.expectedRequestID, err.RequestID)
+			assert.Equal(t, tc.expectedTraceID, err.TraceID)
+
+			var e error = err
+			assert.Equal(t, tc.expectedError, e.Error())
+		})
+	}
+}
+
+func TestNewProblemError(t *testing.T) {
+	tests := []struct {
+		name           string
+		problem        Problem
+		expectedStatus int
+		expectedError  string
+	}{
+		{"DefaultStatus", Problem{Title: "Database unavailable"}, 500, "500: Database unavailable"},
+		{"WithDetail", Problem{Title: "Not Found", Status: 404, Detail: "No user with id 1"}, 404, "404: No user with id 1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewProblemError(tc.problem)
+
+			assert.True(t, err.public)
+			assert.Equal(t, tc.expectedStatus, err.StatusCode)
+			assert.Equal(t, tc.expectedStatus, err.Problem.Status)
+			assert.Equal(t, tc.expectedError, err.Error())
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedClient bool
+		expectedServer bool
+	}{
+		{"302", &Error{StatusCode: 302}, false, false},
+		{"404", &Error{StatusCode: 404}, true, false},
+		{"503", &Error{StatusCode: 503}, false, true},
+		{"Wrapped", fmt.Errorf("get user: %w", &Error{StatusCode: 500}), false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedClient, errors.Is(tc.err, ErrClient))
+			assert.Equal(t, tc.expectedServer, errors.Is(tc.err, ErrServer))
+
+			var e *Error
+			assert.True(t, errors.As(tc.err, &e))
+		})
+	}
+}
+
+func TestErrorKV(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		expectedKV []interface{}
+	}{
+		{
+			"Minimal",
+			&Error{StatusCode: 500},
+			[]interface{}{"http.statusCode", 500},
+		},
+		{
+			"Full",
+			&Error{
+				StatusCode: 404,
+				Problem:    &Problem{Type: "https://example.com/probs/user-not-found"},
+				RequestID:  "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+				TraceID:    "1234abcd",
+			},
+			[]interface{}{
+				"http.statusCode", 404,
+				"problem.type", "https://example.com/probs/user-not-found",
+				"requestId", "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+				"traceId", "1234abcd",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedKV, tc.err.KV())
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	jaegerTracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	tests := []struct {
+		name            string
+		tracer          opentracing.Tracer
+		requestID       string
+		err             error
+		expectedStatus  int
+		expectedProblem map[string]interface{}
+		expectedLevel   string
+	}{
+		{
+			name:           "GenericError",
+			tracer:         mocktracer.New(),
+			err:            errors.New("database connection lost"),
+			expectedStatus: 500,
+			expectedProblem: map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Internal Server Error",
+				"status":   float64(500),
+				"instance": "/v1/users/1",
+			},
+			expectedLevel: "error",
+		},
+		{
+			name:           "Error",
+			tracer:         mocktracer.New(),
+			requestID:      "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			err:            NewProblemError(Problem{Status: 404, Detail: "No user with id 1"}),
+			expectedStatus: 404,
+			expectedProblem: map[string]interface{}{
+				"type":      "about:blank",
+				"title":     "Not Found",
+				"status":    float64(404),
+				"detail":    "No user with id 1",
+				"instance":  "/v1/users/1",
+				"requestId": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			},
+			expectedLevel: "warn",
+		},
+		{
+			name:      "WrappedProblem",
+			tracer:    jaegerTracer,
+			requestID: "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			err: fmt.Errorf("get user: %w", NewProblemError(Problem{
+				Type:       "https://example.com/probs/maintenance",
+				Title:      "Under maintenance",
+				Status:     503,
+				Extensions: map[string]interface{}{"retryAfter": float64(60)},
+			})),
+			expectedStatus: 503,
+			expectedProblem: map[string]interface{}{
+				"type":       "https://example.com/probs/maintenance",
+				"title":      "Under maintenance",
+				"status":     float64(503),
+				"instance":   "/v1/users/1",
+				"retryAfter": float64(60),
+				"requestId":  "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+			},
+			expectedLevel: "error",
+		},
+		{
+			name:   "UpstreamError",
+			tracer: mocktracer.New(),
+			err: fmt.Errorf("get user: %w", &Error{
+				Request:    httptest.NewRequest("GET", "http://users-service:8080/v1/users/1", nil),
+				StatusCode: 404,
+				Message:    "No user with id 1 in table users",
+				Problem: &Problem{
+					Title:      "Not Found",
+					Status:     404,
+					Detail:     "No user with id 1 in table users",
+					Instance:   "/v1/users/1",
+					Extensions: map[string]interface{}{"query": "SELECT * FROM users"},
+				},
+			}),
+			expectedStatus: 502,
+			expectedProblem: map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Bad Gateway",
+				"status":   float64(502),
+				"detail":   "An upstream request failed.",
+				"instance": "/v1/users/1",
+			},
+			expectedLevel: "error",
+		},
+		{
+			name:           "UnexposedError",
+			tracer:         mocktracer.New(),
+			err:            &Error{StatusCode: 404, Message: "No user with id 1"},
+			expectedStatus: 500,
+			expectedProblem: map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Internal Server Error",
+				"status":   float64(500),
+				"instance": "/v1/users/1",
+			},
+			expectedLevel: "error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+
+			span := tc.tracer.StartSpan("test")
+			defer span.Finish()
+
+			ctx := context.Background()
+			ctx = log.ContextWithLogger(ctx, logger)
+			ctx = opentracing.ContextWithSpan(ctx, span)
+			if tc.requestID != "" {
+				ctx = request.ContextWithID(ctx, tc.requestID)
+			}
+
+			r := httptest.NewRequest("GET", "/v1/users/1", nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			WriteError(w, r, tc.err)
+
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatus, res.StatusCode)
+			assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+
+			if sc, ok := span.Context().(jaeger.SpanContext); ok {
+				tc.expectedProblem["traceId"] = sc.TraceID().String()
+			}
+
+			var problem map[string]interface{}
+			err := json.NewDecoder(res.Body).Decode(&problem)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProblem, problem)
+
+			var entry map[string]interface{}
+			err = json.NewDecoder(buff).Decode(&entry)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLevel, entry["level"])
+			assert.Equal(t, fmt.Sprintf("GET /v1/users/1 %d: %s", tc.expectedStatus, tc.expectedProblem["title"]), entry["message"])
+		})
+	}
+}
@@ -21,20 +21,17 @@ func (c *client) call() {
 	time.Sleep(time.Duration(d) * time.Second)
 
 	// Create an http client
-	client := http.Client{
+	client := c.mid.Client(&http.Client{
 		Timeout:   10 * time.Second,
 		Transport: &http.Transport{},
-	}
-
-	// Create an http request
-	req, _ := http.NewRequest("GET", serverAddress+"/", nil)
+	})
 
 	// Make the request to http server
-	doer := c.mid.Metrics(c.mid.RequestID(c.mid.Tracing(c.mid.Logging(client.Do))))
-	res, err := doer(req)
+	res, err := client.Get(serverAddress + "/")
 	if err != nil {
 		panic(err)
 	}
+	defer res.Body.Close()
 
 	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
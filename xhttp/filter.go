@@ -0,0 +1,114 @@
+package xhttp
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Pillar is a pillar of observability.
+type Pillar int
+
+const (
+	// LoggingPillar is the pillar for logging.
+	LoggingPillar Pillar = 1 << iota
+	// MetricsPillar is the pillar for metrics.
+	MetricsPillar
+	// TracingPillar is the pillar for tracing.
+	TracingPillar
+	// AllPillars is the combination of all pillars.
+	AllPillars = LoggingPillar | MetricsPillar | TracingPillar
+)
+
+// Filter is used for excluding requests from being observed.
+//   Paths are the exact paths of requests to exclude (i.e. /health).
+//   Prefixes are the path prefixes of requests to exclude (i.e. /debug/).
+//   Regexps are the regular expressions matching the paths of requests to exclude.
+//   Methods are the methods of requests to exclude (i.e. OPTIONS).
+//   Predicate is a custom function for excluding requests.
+//   Pillars are the pillars of observability from which requests are excluded (default all).
+// A request is excluded if it matches all specified criteria (i.e. both a method and a path).
+// A filter without any criteria does not exclude any request.
+type Filter struct {
+	Paths     []string
+	Prefixes  []string
+	Regexps   []*regexp.Regexp
+	Methods   []string
+	Predicate func(*http.Request) bool
+	Pillars   Pillar
+}
+
+// matchesPath determines whether or not a filter matches the path of a request.
+// If the filter has no criteria for paths, it matches any path.
+func (f *Filter) matchesPath(path string) bool {
+	if len(f.Paths) == 0 && len(f.Prefixes) == 0 && len(f.Regexps) == 0 {
+		return true
+	}
+
+	for _, p := range f.Paths {
+		if path == p {
+			return true
+		}
+	}
+
+	for _, p := range f.Prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+
+	for _, re := range f.Regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesMethod determines whether or not a filter matches the method of a request.
+// If the filter has no criteria for methods, it matches any method.
+func (f *Filter) matchesMethod(method string) bool {
+	if len(f.Methods) == 0 {
+		return true
+	}
+
+	for _, m := range f.Methods {
+		if strings.EqualFold(method, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludes determines whether or not a filter excludes a request from a pillar.
+func (f *Filter) excludes(r *http.Request, pillar Pillar) bool {
+	pillars := f.Pillars
+	if pillars == 0 {
+		pillars = AllPillars
+	}
+
+	if pillars&pillar == 0 {
+		return false
+	}
+
+	if len(f.Paths) == 0 && len(f.Prefixes) == 0 && len(f.Regexps) == 0 && len(f.Methods) == 0 && f.Predicate == nil {
+		return false
+	}
+
+	return f.matchesMethod(r.Method) &&
+		f.matchesPath(r.URL.Path) &&
+		(f.Predicate == nil || f.Predicate(r))
+}
+
+// excluded determines whether or not any of filters excludes a request from a pillar.
+func excluded(filters []Filter, r *http.Request, pillar Pillar) bool {
+	for i := range filters {
+		if filters[i].excludes(r, pillar) {
+			return true
+		}
+	}
+
+	return false
+}
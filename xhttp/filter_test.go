@@ -0,0 +1,142 @@
+package xhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterExcludes(t *testing.T) {
+	tests := []struct {
+		name             string
+		filter           Filter
+		method           string
+		path             string
+		pillar           Pillar
+		expectedExcluded bool
+	}{
+		{
+			name:             "NoCriteria",
+			filter:           Filter{},
+			method:           "GET",
+			path:             "/health",
+			pillar:           LoggingPillar,
+			expectedExcluded: false,
+		},
+		{
+			name:             "PathMatches",
+			filter:           Filter{Paths: []string{"/health", "/metrics"}},
+			method:           "GET",
+			path:             "/metrics",
+			pillar:           LoggingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "PathNotMatches",
+			filter:           Filter{Paths: []string{"/health"}},
+			method:           "GET",
+			path:             "/health/db",
+			pillar:           LoggingPillar,
+			expectedExcluded: false,
+		},
+		{
+			name:             "PrefixMatches",
+			filter:           Filter{Prefixes: []string{"/debug/"}},
+			method:           "GET",
+			path:             "/debug/pprof/heap",
+			pillar:           MetricsPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "RegexpMatches",
+			filter:           Filter{Regexps: []*regexp.Regexp{regexp.MustCompile(`\.(ico|png)$`)}},
+			method:           "GET",
+			path:             "/favicon.ico",
+			pillar:           TracingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "MethodMatches",
+			filter:           Filter{Methods: []string{"OPTIONS"}},
+			method:           "options",
+			path:             "/v1/users",
+			pillar:           TracingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "MethodAndPathMatch",
+			filter:           Filter{Methods: []string{"GET"}, Paths: []string{"/health"}},
+			method:           "GET",
+			path:             "/health",
+			pillar:           LoggingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "MethodMatchesPathNotMatches",
+			filter:           Filter{Methods: []string{"GET"}, Paths: []string{"/health"}},
+			method:           "GET",
+			path:             "/v1/users",
+			pillar:           LoggingPillar,
+			expectedExcluded: false,
+		},
+		{
+			name:             "PathMatchesMethodNotMatches",
+			filter:           Filter{Methods: []string{"GET"}, Paths: []string{"/health"}},
+			method:           "POST",
+			path:             "/health",
+			pillar:           LoggingPillar,
+			expectedExcluded: false,
+		},
+		{
+			name: "PredicateMatches",
+			filter: Filter{Predicate: func(r *http.Request) bool {
+				return r.Header.Get("User-Agent") == "kube-probe/1.18"
+			}},
+			method:           "GET",
+			path:             "/v1/users",
+			pillar:           LoggingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "PillarIncluded",
+			filter:           Filter{Paths: []string{"/health"}, Pillars: LoggingPillar | TracingPillar},
+			method:           "GET",
+			path:             "/health",
+			pillar:           TracingPillar,
+			expectedExcluded: true,
+		},
+		{
+			name:             "PillarNotIncluded",
+			filter:           Filter{Paths: []string{"/health"}, Pillars: LoggingPillar | TracingPillar},
+			method:           "GET",
+			path:             "/health",
+			pillar:           MetricsPillar,
+			expectedExcluded: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			r.Header.Set("User-Agent", "kube-probe/1.18")
+
+			assert.Equal(t, tc.expectedExcluded, tc.filter.excludes(r, tc.pillar))
+		})
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	filters := []Filter{
+		{Paths: []string{"/health"}, Pillars: LoggingPillar},
+		{Prefixes: []string{"/debug/"}},
+	}
+
+	assert.True(t, excluded(filters, httptest.NewRequest("GET", "/health", nil), LoggingPillar))
+	assert.False(t, excluded(filters, httptest.NewRequest("GET", "/health", nil), MetricsPillar))
+	assert.True(t, excluded(filters, httptest.NewRequest("GET", "/debug/vars", nil), MetricsPillar))
+	assert.False(t, excluded(filters, httptest.NewRequest("GET", "/v1/users", nil), LoggingPillar))
+	assert.False(t, excluded(nil, httptest.NewRequest("GET", "/health", nil), LoggingPillar))
+}
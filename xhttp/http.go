@@ -2,44 +2,23 @@ package xhttp
 
 import (
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 const requestIDHeader = "Request-Id"
 
-// Error is an http error.
-type Error struct {
-	Request    *http.Request
-	StatusCode int
-	Message    string
-}
-
-// NewError creates a new instance of Error.
-func NewError(res *http.Response) *Error {
-	err := &Error{
-		Request:    res.Request,
-		StatusCode: res.StatusCode,
-	}
-
-	if res.Body != nil {
-		if data, e := ioutil.ReadAll(res.Body); e == nil {
-			err.Message = string(data)
-		}
-	}
-
-	return err
-}
-
-func (e *Error) Error() string {
-	return fmt.Sprintf("%s %s %d: %s", e.Request.Method, e.Request.URL.Path, e.StatusCode, e.Message)
-}
-
 // ResponseWriter extends the functionality of standard http.ResponseWriter.
+// It records the status code and the number of bytes written for the response body.
 type ResponseWriter struct {
 	http.ResponseWriter
 	StatusCode  int
 	StatusClass string
+	Size        int
 }
 
 // NewResponseWriter creates a new response writer.
@@ -59,3 +38,47 @@ func (r *ResponseWriter) WriteHeader(statusCode int) {
 		r.StatusClass = fmt.Sprintf("%dxx", statusCode/100)
 	}
 }
+
+// Write overrides the default implementation of http.Write.
+// If the status code is not written yet, it will be 200 (http.StatusOK).
+func (r *ResponseWriter) Write(b []byte) (int, error) {
+	if r.StatusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.Size += n
+
+	return n, err
+}
+
+// Flush implements http.Flusher, so streaming responses are not affected.
+// If the status code is not written yet, it will be 200 (http.StatusOK).
+func (r *ResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.StatusCode == 0 {
+			r.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// setPeerTags sets the peer tags of a span from an address in host:port or host form.
+func setPeerTags(span opentracing.Span, addr string) {
+	if addr == "" {
+		return
+	}
+
+	ext.PeerAddress.Set(span, addr)
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		ext.PeerHostname.Set(span, addr)
+		return
+	}
+
+	ext.PeerHostname.Set(span, host)
+	if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+		ext.PeerPort.Set(span, uint16(p))
+	}
+}
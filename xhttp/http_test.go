@@ -1,72 +1,13 @@
 package xhttp
 
 import (
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
-	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestError(t *testing.T) {
-	tests := []struct {
-		name          string
-		request       *http.Request
-		statusCode    int
-		body          string
-		expectedError string
-	}{
-		{
-			"400",
-			&http.Request{
-				Method: "GET",
-				URL: &url.URL{
-					Path: "/",
-				},
-			},
-			http.StatusBadRequest,
-			"Invalid request",
-			"GET / 400: Invalid request",
-		},
-		{
-			"500",
-			&http.Request{
-				Method: "POST",
-				URL: &url.URL{
-					Path: "/",
-				},
-			},
-			http.StatusInternalServerError,
-			"Internal error",
-			"POST / 500: Internal error",
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			br := strings.NewReader(tc.body)
-			rc := ioutil.NopCloser(br)
-
-			res := &http.Response{
-				Request:    tc.request,
-				StatusCode: tc.statusCode,
-				Body:       rc,
-			}
-
-			err := NewError(res)
-			assert.Equal(t, tc.request, err.Request)
-			assert.Equal(t, tc.statusCode, err.StatusCode)
-			assert.Equal(t, tc.body, err.Message)
-
-			var e error = err
-			assert.Equal(t, tc.expectedError, e.Error())
-		})
-	}
-}
-
 func TestResponseWriter(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -108,3 +49,48 @@ func TestResponseWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseWriterWrite(t *testing.T) {
+	tests := []struct {
+		name               string
+		statusCode         int
+		body               []string
+		expectedStatusCode int
+		expectedSize       int
+	}{
+		{"ImplicitStatus", 0, []string{"hello"}, 200, 5},
+		{"ExplicitStatus", 201, []string{"hello", ", world"}, 201, 12},
+		{"NoBody", 204, nil, 204, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rw := NewResponseWriter(w)
+
+			if tc.statusCode != 0 {
+				rw.WriteHeader(tc.statusCode)
+			}
+			for _, b := range tc.body {
+				_, err := rw.Write([]byte(b))
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedStatusCode, rw.StatusCode)
+			assert.Equal(t, tc.expectedSize, rw.Size)
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+		})
+	}
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := NewResponseWriter(w)
+
+	var _ http.Flusher = rw
+	rw.Flush()
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, 200, rw.StatusCode)
+	assert.Equal(t, 200, w.Code)
+}
@@ -0,0 +1,109 @@
+package xhttp
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	serverShedMetricName  = "http_server_shed_requests_total"
+	serverLimitMetricName = "http_server_concurrency_limit"
+)
+
+const (
+	defaultRetryAfter = time.Second
+
+	// shedURLLimit is the maximum number of distinct url label values of shed requests without a known route.
+	shedURLLimit = 100
+)
+
+// LimitOptions contains options for limiting concurrent requests.
+//   Limit is the algorithm for the maximum number of in-flight requests (default resilience.FixedLimit(100)).
+//   RetryAfter is the duration suggested to clients for retrying shed requests (default 1s).
+//   Filter determines which requests are limited (default all requests).
+// Static limits can be set using resilience.FixedLimit and adaptive limits using resilience.NewAIMDLimit or resilience.NewGradientLimit.
+type LimitOptions struct {
+	Limit      resilience.Limit
+	RetryAfter time.Duration
+	Filter     func(*http.Request) bool
+}
+
+// concurrencyLimit sheds requests exceeding a concurrency limit.
+type concurrencyLimit struct {
+	limiter    *resilience.Limiter
+	retryAfter string
+	filter     func(*http.Request) bool
+}
+
+func newConcurrencyLimit(opts LimitOptions) *concurrencyLimit {
+	limit := opts.Limit
+	if limit == nil {
+		limit = resilience.FixedLimit(100)
+	}
+
+	retryAfter := opts.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	return &concurrencyLimit{
+		limiter:    resilience.NewLimiter(limit),
+		retryAfter: strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+		filter:     opts.Filter,
+	}
+}
+
+// limited determines whether or not a request is subject to the limit.
+func (l *concurrencyLimit) limited(r *http.Request) bool {
+	return l.filter == nil || l.filter(r)
+}
+
+// outcome determines the outcome of a request for the limit.
+// Requests are dropped if they are timed out or the response status code is 503 or 504.
+// Requests cancelled by clients are ignored, since they say nothing about the load.
+func outcome(r *http.Request, statusCode int) resilience.Outcome {
+	switch r.Context().Err() {
+	case context.DeadlineExceeded:
+		return resilience.Dropped
+	case context.Canceled:
+		return resilience.Ignored
+	}
+
+	if statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout {
+		return resilience.Dropped
+	}
+
+	return resilience.Succeeded
+}
+
+// limitMetrics are the metrics for concurrency limits of server requests.
+type limitMetrics struct {
+	shed  *prometheus.CounterVec
+	limit prometheus.Gauge
+	urls  *metrics.LabelLimiter
+}
+
+func newLimitMetrics(mf *metrics.Factory) *limitMetrics {
+	return &limitMetrics{
+		shed:  mf.Counter(serverShedMetricName, "counter metric for total number of server-side http requests shed by concurrency limits", []string{"method", "url"}),
+		limit: mf.Gauge(serverLimitMetricName, "gauge metric for current concurrency limit of server-side http requests", []string{}).WithLabelValues(),
+		urls:  metrics.NewLabelLimiter(shedURLLimit),
+	}
+}
+
+// url returns the url label value of a shed request.
+// Requests are shed under load, so raw paths are bounded by a label limiter if the route is not known.
+func (m *limitMetrics) url(r *http.Request, route string) string {
+	if route != "" {
+		return route
+	}
+
+	return m.urls.Value(r.URL.Path)
+}
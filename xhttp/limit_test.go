@@ -0,0 +1,118 @@
+package xhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name               string
+		opts               LimitOptions
+		expectedLimit      int
+		expectedRetryAfter string
+	}{
+		{
+			name:               "Defaults",
+			opts:               LimitOptions{},
+			expectedLimit:      100,
+			expectedRetryAfter: "1",
+		},
+		{
+			name: "WithOptions",
+			opts: LimitOptions{
+				Limit:      resilience.FixedLimit(10),
+				RetryAfter: 2500 * time.Millisecond,
+			},
+			expectedLimit:      10,
+			expectedRetryAfter: "3",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newConcurrencyLimit(tc.opts)
+
+			assert.Equal(t, tc.expectedLimit, l.limiter.Limit())
+			assert.Equal(t, tc.expectedRetryAfter, l.retryAfter)
+		})
+	}
+}
+
+func TestConcurrencyLimitLimited(t *testing.T) {
+	l := newConcurrencyLimit(LimitOptions{})
+	assert.True(t, l.limited(httptest.NewRequest("GET", "/health", nil)))
+
+	l = newConcurrencyLimit(LimitOptions{
+		Filter: func(r *http.Request) bool {
+			return r.URL.Path != "/health"
+		},
+	})
+	assert.False(t, l.limited(httptest.NewRequest("GET", "/health", nil)))
+	assert.True(t, l.limited(httptest.NewRequest("GET", "/v1/users", nil)))
+}
+
+func TestOutcome(t *testing.T) {
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		statusCode      int
+		expectedOutcome resilience.Outcome
+	}{
+		{"OK", context.Background(), 200, resilience.Succeeded},
+		{"InternalServerError", context.Background(), 500, resilience.Succeeded},
+		{"ServiceUnavailable", context.Background(), 503, resilience.Dropped},
+		{"GatewayTimeout", context.Background(), 504, resilience.Dropped},
+		{"DeadlineExceeded", expiredCtx, 200, resilience.Dropped},
+		{"Cancelled", cancelledCtx, 200, resilience.Ignored},
+		{"CancelledUnavailable", cancelledCtx, 503, resilience.Ignored},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users", nil).WithContext(tc.ctx)
+			assert.Equal(t, tc.expectedOutcome, outcome(r, tc.statusCode))
+		})
+	}
+}
+
+func TestNewLimitMetrics(t *testing.T) {
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: prometheus.NewRegistry()})
+	m := newLimitMetrics(mf)
+
+	assert.NotNil(t, m.shed)
+	assert.NotNil(t, m.limit)
+	assert.NotNil(t, m.urls)
+}
+
+func TestLimitMetricsURL(t *testing.T) {
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: prometheus.NewRegistry()})
+	m := newLimitMetrics(mf)
+
+	// Routes are bounded, so they are not limited
+	assert.Equal(t, "/v1/users/{id}", m.url(httptest.NewRequest("GET", "/v1/users/1", nil), "/v1/users/{id}"))
+
+	for i := 0; i < shedURLLimit; i++ {
+		path := fmt.Sprintf("/v1/users/%d", i)
+		assert.Equal(t, path, m.url(httptest.NewRequest("GET", path, nil), ""))
+	}
+
+	// Paths seen after the limit is reached are reported as other
+	assert.Equal(t, metrics.OverflowLabelValue, m.url(httptest.NewRequest("GET", "/v1/users/new", nil), ""))
+	assert.Equal(t, "/v1/users/0", m.url(httptest.NewRequest("GET", "/v1/users/0", nil), ""))
+}
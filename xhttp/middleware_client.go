@@ -3,13 +3,17 @@ package xhttp
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"time"
 
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/resilience"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	opentracingLog "github.com/opentracing/opentracing-go/log"
@@ -29,9 +33,22 @@ type Doer func(*http.Request) (*http.Response, error)
 
 // ClientMiddleware is an http client middleware for logging, metrics, tracing, etc.
 type ClientMiddleware struct {
+	filters []Filter
 	logger  *log.Logger
 	metrics *metrics.RequestMetrics
 	tracer  opentracing.Tracer
+	tags    func(*http.Request) opentracing.Tags
+	capture *capture
+	body    *bodyCapture
+
+	connTracing bool
+	connMetrics *connMetrics
+
+	mf                *metrics.Factory
+	retry             *retryPolicy
+	timeout           time.Duration
+	breakers          *resilience.Breakers
+	resilienceMetrics *resilienceMetrics
 }
 
 // ClientMiddlewareOption sets optional parameters for client middleware.
@@ -54,6 +71,7 @@ func ClientMetrics(mf *metrics.Factory) ClientMiddlewareOption {
 	}
 
 	return func(i *ClientMiddleware) {
+		i.mf = mf
 		i.metrics = metrics
 	}
 }
@@ -65,6 +83,75 @@ func ClientTracing(tracer opentracing.Tracer) ClientMiddlewareOption {
 	}
 }
 
+// ClientFilter is the option for excluding requests from being observed.
+// Requests can be excluded by exact paths, path prefixes, regular expressions, methods, or a predicate,
+// from all pillars of observability or only some of them (i.e. keep metrics for /health but skip logging and tracing).
+// You can use this option multiple times for filtering different requests.
+func ClientFilter(f Filter) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.filters = append(i.filters, f)
+	}
+}
+
+// ClientSpanTags is the option for client middleware to set custom tags from requests on client spans.
+func ClientSpanTags(tags func(*http.Request) opentracing.Tags) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.tags = tags
+	}
+}
+
+// ClientCapture is the option for client middleware to capture allow-listed headers, query parameters,
+// and user agent of requests and responses in log fields and span tags.
+func ClientCapture(opts CaptureOptions) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.capture = newCapture(opts)
+	}
+}
+
+// ClientBody is the option for client middleware to capture request and response bodies for debugging.
+// Bodies are captured by the Body middleware in debug logs and span logs.
+func ClientBody(opts BodyOptions) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.body = newBodyCapture(opts)
+	}
+}
+
+// ClientHTTPTrace is the option for client middleware to trace connection-level events of requests.
+// DNS lookups, connecting, TLS handshakes, time to first byte, and connection reuse are recorded by the HTTPTrace middleware.
+// Events are logged on client spans and if mf is not nil, they are also observed by histogram and counter metrics.
+func ClientHTTPTrace(mf *metrics.Factory) ClientMiddlewareOption {
+	var metrics *connMetrics
+	if mf != nil {
+		metrics = newConnMetrics(mf)
+	}
+
+	return func(i *ClientMiddleware) {
+		i.connTracing = true
+		i.connMetrics = metrics
+	}
+}
+
+// ClientRetry is the option for client middleware to retry failed requests with exponential backoff by the Retry middleware.
+func ClientRetry(opts RetryOptions) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.retry = newRetryPolicy(opts)
+	}
+}
+
+// ClientTimeout is the option for client middleware to apply a timeout to every attempt of requests by the Timeout middleware.
+func ClientTimeout(timeout time.Duration) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.timeout = timeout
+	}
+}
+
+// ClientCircuitBreaker is the option for client middleware to use a circuit breaker per host by the CircuitBreaker middleware.
+func ClientCircuitBreaker(opts resilience.BreakerOptions) ClientMiddlewareOption {
+	return func(i *ClientMiddleware) {
+		i.breakers = resilience.NewBreakers(opts, i.breakerStateChanged)
+	}
+}
+
 // NewClientMiddleware creates a new instance of http client middleware.
 func NewClientMiddleware(opts ...ClientMiddlewareOption) *ClientMiddleware {
 	cm := &ClientMiddleware{}
@@ -72,6 +159,11 @@ func NewClientMiddleware(opts ...ClientMiddlewareOption) *ClientMiddleware {
 		opt(cm)
 	}
 
+	// Metrics for retries, timeouts, and circuit breakers are created only if they are enabled
+	if cm.mf != nil && (cm.retry != nil || cm.timeout > 0 || cm.breakers != nil) {
+		cm.resilienceMetrics = newResilienceMetrics(cm.mf)
+	}
+
 	return cm
 }
 
@@ -104,6 +196,10 @@ func (m *ClientMiddleware) RequestID(next Doer) Doer {
 // Request id will be read from reqeust context if present.
 func (m *ClientMiddleware) Logging(next Doer) Doer {
 	return func(r *http.Request) (*http.Response, error) {
+		if excluded(m.filters, r, LoggingPillar) {
+			return next(r)
+		}
+
 		proto := r.Proto
 		method := r.Method
 		url := r.URL.Path
@@ -142,6 +238,13 @@ func (m *ClientMiddleware) Logging(next Doer) Doer {
 			pairs = append(pairs, "requestId", requestID)
 		}
 
+		if m.capture != nil {
+			pairs = append(pairs, capturedFields(m.capture.request(r, false))...)
+			if res != nil {
+				pairs = append(pairs, capturedFields(m.capture.response(res.Header))...)
+			}
+		}
+
 		// Logging
 		switch {
 		case statusCode >= 500:
@@ -161,6 +264,10 @@ func (m *ClientMiddleware) Logging(next Doer) Doer {
 // Metrics takes care of metrics for outgoing http requests.
 func (m *ClientMiddleware) Metrics(next Doer) Doer {
 	return func(r *http.Request) (*http.Response, error) {
+		if excluded(m.filters, r, MetricsPillar) {
+			return next(r)
+		}
+
 		method := r.Method
 		url := r.URL.Path
 
@@ -201,9 +308,9 @@ func (m *ClientMiddleware) createSpan(ctx context.Context) opentracing.Span {
 	parentSpan := opentracing.SpanFromContext(ctx)
 
 	if parentSpan == nil {
-		span = m.tracer.StartSpan(clientSpanName)
+		span = m.tracer.StartSpan(clientSpanName, ext.SpanKindRPCClient)
 	} else {
-		span = m.tracer.StartSpan(clientSpanName, opentracing.ChildOf(parentSpan.Context()))
+		span = m.tracer.StartSpan(clientSpanName, ext.SpanKindRPCClient, opentracing.ChildOf(parentSpan.Context()))
 	}
 
 	return span
@@ -222,8 +329,13 @@ func (m *ClientMiddleware) injectSpan(req *http.Request, span opentracing.Span)
 
 // Tracing takes care of tracing for outgoing http requests.
 // Trace information will be read from reqeust context if present.
+// Spans are tagged with error for 5xx responses and transport errors.
 func (m *ClientMiddleware) Tracing(next Doer) Doer {
 	return func(r *http.Request) (*http.Response, error) {
+		if excluded(m.filters, r, TracingPillar) {
+			return next(r)
+		}
+
 		proto := r.Proto
 		method := r.Method
 		url := r.URL.Path
@@ -233,26 +345,483 @@ func (m *ClientMiddleware) Tracing(next Doer) Doer {
 		defer span.Finish()
 		m.injectSpan(r, span)
 
-		// Call the next request doer
-		res, err := next(r)
+		// Tracing
+		// https://github.com/opentracing/specification/blob/master/semantic_conventions.md
+		host := r.URL.Host
+		if host == "" {
+			host = r.Host
+		}
+
+		span.SetTag("http.proto", proto)
+		span.SetTag("http.host", host)
+		ext.HTTPMethod.Set(span, method)
+		ext.HTTPUrl.Set(span, url)
+		setPeerTags(span, host)
+
+		if userAgent := r.UserAgent(); userAgent != "" {
+			span.SetTag("http.user_agent", userAgent)
+		}
+
+		if r.ContentLength >= 0 {
+			span.SetTag("http.request_size", r.ContentLength)
+		}
+
+		if m.tags != nil {
+			for key, val := range m.tags(r) {
+				span.SetTag(key, val)
+			}
+		}
+
+		if m.capture != nil {
+			for key, val := range capturedTags(m.capture.request(r, false)) {
+				span.SetTag(key, val)
+			}
+		}
+
+		// Call the next request doer with the new span in the request context
+		res, err := next(r.WithContext(opentracing.ContextWithSpan(r.Context(), span)))
 
 		var statusCode int
 		if err != nil {
 			statusCode = -1
+			ext.Error.Set(span, true)
+			span.LogFields(
+				opentracingLog.String("event", "error"),
+				opentracingLog.Error(err),
+			)
 		} else {
 			statusCode = res.StatusCode
+			if statusCode >= 500 {
+				ext.Error.Set(span, true)
+			}
+			if res.ContentLength >= 0 {
+				span.SetTag("http.response_size", res.ContentLength)
+			}
+			if m.capture != nil {
+				for key, val := range capturedTags(m.capture.response(res.Header)) {
+					span.SetTag(key, val)
+				}
+			}
 		}
 
-		// Tracing
-		// https://github.com/opentracing/specification/blob/master/semantic_conventions.md
-		span.SetTag("http.proto", proto)
-		ext.HTTPMethod.Set(span, method)
-		ext.HTTPUrl.Set(span, url)
 		ext.HTTPStatusCode.Set(span, uint16(statusCode))
-		/* span.LogFields(
-			opentracingLog.String("key", value),
-		) */
 
 		return res, err
 	}
 }
+
+// Body captures request and response bodies of outgoing http requests for debugging.
+// Bodies are captured while they are sent and read, so streaming is not affected.
+// Captured bodies are logged at debug level if logging is enabled once the response body is closed (or the request fails).
+// Since the span of the request is finished by then, only request bodies are logged on the span in the request context if any.
+func (m *ClientMiddleware) Body(next Doer) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		if m.body == nil || !m.body.enabled(r) {
+			return next(r)
+		}
+
+		req := r
+		reqBuf := newBodyBuffer(m.body.maxSize)
+		if r.Body != nil && r.Body != http.NoBody {
+			req = r.WithContext(r.Context())
+			req.Body = &bodyReader{ReadCloser: r.Body, buf: reqBuf}
+		}
+
+		// Call the next request doer
+		res, err := next(req)
+
+		statusCode := -1
+		if err == nil {
+			statusCode = res.StatusCode
+		}
+
+		if !m.body.report(statusCode) {
+			return res, err
+		}
+
+		reqFields := reqBuf.fields("req", r.Header.Get("Content-Type"), m.body.redact)
+		if span := opentracing.SpanFromContext(r.Context()); span != nil && len(reqFields) > 0 {
+			span.LogKV(append([]interface{}{"event", bodyEvent}, reqFields...)...)
+		}
+
+		if err != nil || res.Body == nil || res.Body == http.NoBody {
+			m.logBody(r, statusCode, reqFields)
+			return res, err
+		}
+
+		// The response body is logged once it is read and closed by the caller
+		resBuf := newBodyBuffer(m.body.maxSize)
+		contentType := res.Header.Get("Content-Type")
+		res.Body = &closeBody{
+			bodyReader: bodyReader{ReadCloser: res.Body, buf: resBuf},
+			onClose: func() {
+				m.logBody(r, statusCode, append(reqFields, resBuf.fields("res", contentType, m.body.redact)...))
+			},
+		}
+
+		return res, nil
+	}
+}
+
+// logBody logs the captured bodies of an outgoing http request at debug level.
+func (m *ClientMiddleware) logBody(r *http.Request, statusCode int, fields []interface{}) {
+	if m.logger == nil {
+		return
+	}
+
+	pairs := []interface{}{
+		"http.kind", clientKind,
+		"req.method", r.Method,
+		"req.url", r.URL.Path,
+		"res.statusCode", statusCode,
+		"message", "http body",
+	}
+
+	if requestID, _ := request.IDFromContext(r.Context()); requestID != "" {
+		pairs = append(pairs, "requestId", requestID)
+	}
+
+	m.logger.DebugKV(append(pairs, fields...)...)
+}
+
+// HTTPTrace traces connection-level events of outgoing http requests using httptrace.ClientTrace.
+// Events are logged on the span in the request context, so this middleware should be used inside the Tracing middleware.
+// It helps distinguish slow servers (time to first byte) from slow networks (DNS lookups, connecting, and TLS handshakes).
+func (m *ClientMiddleware) HTTPTrace(next Doer) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		if !m.connTracing {
+			return next(r)
+		}
+
+		var span opentracing.Span
+		if !excluded(m.filters, r, TracingPillar) {
+			span = opentracing.SpanFromContext(r.Context())
+		}
+
+		var metrics *connMetrics
+		if !excluded(m.filters, r, MetricsPillar) {
+			metrics = m.connMetrics
+		}
+
+		t := newConnTrace(r.URL.Host, span, metrics)
+		defer t.close()
+
+		ctx := httptrace.WithClientTrace(r.Context(), t.clientTrace())
+
+		// Call the next request doer
+		return next(r.WithContext(ctx))
+	}
+}
+
+// startAttempt creates a child span for an attempt of an outgoing http request.
+func (m *ClientMiddleware) startAttempt(r *http.Request, attempt int) (*http.Request, opentracing.Span) {
+	if m.tracer == nil || excluded(m.filters, r, TracingPillar) {
+		return r, nil
+	}
+
+	spanOpts := []opentracing.StartSpanOption{opentracing.Tag{Key: "attempt", Value: attempt}}
+	if parentSpan := opentracing.SpanFromContext(r.Context()); parentSpan != nil {
+		spanOpts = append(spanOpts, opentracing.ChildOf(parentSpan.Context()))
+	}
+
+	span := m.tracer.StartSpan(clientAttemptSpanName, spanOpts...)
+
+	return r.WithContext(opentracing.ContextWithSpan(r.Context(), span)), span
+}
+
+// finishAttempt records the result of an attempt of an outgoing http request.
+func (m *ClientMiddleware) finishAttempt(r *http.Request, span opentracing.Span, attempt int, res *http.Response, err error) {
+	if m.resilienceMetrics != nil && !excluded(m.filters, r, MetricsPillar) {
+		m.resilienceMetrics.attempts.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(attempt)).Inc()
+	}
+
+	if span != nil {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(
+				opentracingLog.String("event", "error"),
+				opentracingLog.Error(err),
+			)
+		} else {
+			ext.HTTPStatusCode.Set(span, uint16(res.StatusCode))
+			if res.StatusCode >= 500 {
+				ext.Error.Set(span, true)
+			}
+		}
+
+		span.Finish()
+	}
+}
+
+// Retry retries failed outgoing http requests with exponential backoff and jitter.
+// Idempotent requests are retried for transport errors and retryable status codes if their bodies can be rewound.
+// Every attempt is counted by metrics and traced by a child span, and every retry is logged.
+func (m *ClientMiddleware) Retry(next Doer) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		if m.retry == nil {
+			return next(r)
+		}
+
+		ctx := r.Context()
+		retryable := m.retry.retryable(r)
+
+		for attempt := 1; ; attempt++ {
+			req := r
+			if attempt > 1 && r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req = r.WithContext(ctx)
+				req.Body = body
+			}
+
+			// Call the next request doer
+			req, span := m.startAttempt(req, attempt)
+			res, err := next(req)
+			m.finishAttempt(req, span, attempt, res, err)
+
+			if !retryable || attempt >= m.retry.maxAttempts || ctx.Err() != nil || !m.retry.shouldRetry(res, err) {
+				return res, err
+			}
+
+			// Requests are not retried if the server asks for a longer delay than the maximum
+			delay, ok := m.retry.delay(attempt, res)
+			if !ok {
+				return res, err
+			}
+
+			if m.logger != nil && !excluded(m.filters, r, LoggingPillar) {
+				pairs := []interface{}{
+					"http.kind", clientKind,
+					"req.method", r.Method,
+					"req.url", r.URL.Path,
+					"attempt", attempt,
+					"delay", delay.Seconds(),
+					"message", fmt.Sprintf("retrying %s %s after attempt %d", r.Method, r.URL.Path, attempt),
+				}
+
+				if err != nil {
+					pairs = append(pairs, "error", err.Error())
+				} else {
+					pairs = append(pairs, "res.statusCode", res.StatusCode)
+				}
+
+				if requestID, _ := request.IDFromContext(ctx); requestID != "" {
+					pairs = append(pairs, "requestId", requestID)
+				}
+
+				m.logger.WarnKV(pairs...)
+			}
+
+			// Drain and close the response body, so the connection can be reused
+			if res != nil && res.Body != nil {
+				_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+				res.Body.Close()
+			}
+
+			if err := resilience.Wait(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Timeout applies a timeout to every attempt of outgoing http requests.
+// The timeout covers reading the response body too, so the response body should be read and closed.
+// Timed-out attempts are counted by metrics, logged, and logged on the span in the request context if any.
+func (m *ClientMiddleware) Timeout(next Doer) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		if m.timeout <= 0 {
+			return next(r)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), m.timeout)
+
+		// Call the next request doer
+		res, err := next(r.WithContext(ctx))
+
+		if err != nil {
+			// Only timeouts of this middleware are reported and not the ones of the original request
+			if ctx.Err() == context.DeadlineExceeded && r.Context().Err() == nil {
+				m.timedOut(r)
+			}
+			cancel()
+			return res, err
+		}
+
+		// The context is cancelled once the response body is closed
+		if res.Body == nil {
+			cancel()
+		} else {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+		}
+
+		return res, nil
+	}
+}
+
+// timedOut reports a timed-out attempt of an outgoing http request.
+func (m *ClientMiddleware) timedOut(r *http.Request) {
+	if m.resilienceMetrics != nil && !excluded(m.filters, r, MetricsPillar) {
+		m.resilienceMetrics.timeouts.WithLabelValues(r.Method, r.URL.Path).Inc()
+	}
+
+	if m.logger != nil && !excluded(m.filters, r, LoggingPillar) {
+		pairs := []interface{}{
+			"http.kind", clientKind,
+			"req.method", r.Method,
+			"req.url", r.URL.Path,
+			"timeout", m.timeout.Seconds(),
+			"message", fmt.Sprintf("%s %s timed out after %s", r.Method, r.URL.Path, m.timeout),
+		}
+
+		if requestID, _ := request.IDFromContext(r.Context()); requestID != "" {
+			pairs = append(pairs, "requestId", requestID)
+		}
+
+		m.logger.WarnKV(pairs...)
+	}
+
+	if span := opentracing.SpanFromContext(r.Context()); span != nil && !excluded(m.filters, r, TracingPillar) {
+		span.LogFields(
+			opentracingLog.String("event", "timeout"),
+			opentracingLog.Float64("timeout", m.timeout.Seconds()),
+		)
+	}
+}
+
+// CircuitBreaker stops sending outgoing http requests to a host after consecutive failures (transport errors and 5xx responses).
+// When the circuit breaker of a host is open, requests fail with resilience.ErrOpen without being sent.
+// Rejected requests are counted by metrics and state changes are logged and reported by a gauge metric.
+func (m *ClientMiddleware) CircuitBreaker(next Doer) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		if m.breakers == nil {
+			return next(r)
+		}
+
+		host := r.URL.Host
+		if host == "" {
+			host = r.Host
+		}
+
+		breaker := m.breakers.Get(host)
+		generation, err := breaker.Allow()
+		if err != nil {
+			if m.resilienceMetrics != nil && !excluded(m.filters, r, MetricsPillar) {
+				m.resilienceMetrics.breakerRejections.WithLabelValues(host).Inc()
+			}
+
+			if span := opentracing.SpanFromContext(r.Context()); span != nil && !excluded(m.filters, r, TracingPillar) {
+				span.LogFields(
+					opentracingLog.String("event", "circuit breaker open"),
+					opentracingLog.String("host", host),
+				)
+			}
+
+			return nil, err
+		}
+
+		// Call the next request doer
+		res, err := next(r)
+
+		// Requests cancelled by callers are neither failures nor successes of the host
+		if r.Context().Err() != nil {
+			breaker.Cancel(generation)
+		} else {
+			breaker.Record(generation, err == nil && res.StatusCode < 500)
+		}
+
+		return res, err
+	}
+}
+
+// breakerStateChanged reports a state change of the circuit breaker of a host.
+func (m *ClientMiddleware) breakerStateChanged(host string, from, to resilience.State) {
+	if m.resilienceMetrics != nil {
+		m.resilienceMetrics.breakerState.WithLabelValues(host).Set(float64(to))
+	}
+
+	if m.logger != nil {
+		m.logger.WarnKV(
+			"http.kind", clientKind,
+			"host", host,
+			"from", from.String(),
+			"to", to.String(),
+			"message", fmt.Sprintf("circuit breaker for %s changed from %s to %s", host, from, to),
+		)
+	}
+}
+
+// roundTripper is an http.RoundTripper that sends requests through a chain of client middleware.
+type roundTripper struct {
+	doer Doer
+}
+
+// RoundTrip implements http.RoundTripper.
+// Requests are cloned, so the middleware does not modify the original requests.
+func (t *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.doer(r.Clone(r.Context()))
+}
+
+// RoundTripper creates an http.RoundTripper that applies the client middleware to every request sent by a base round tripper.
+// Request id is always applied and logging, metrics, tracing, retries, circuit breakers, timeouts, body capture,
+// and connection tracing are applied if they are enabled by options.
+// If base is nil, http.DefaultTransport will be used.
+func (m *ClientMiddleware) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	doer := Doer(base.RoundTrip)
+
+	if m.connTracing {
+		doer = m.HTTPTrace(doer)
+	}
+
+	if m.body != nil {
+		doer = m.Body(doer)
+	}
+
+	if m.timeout > 0 {
+		doer = m.Timeout(doer)
+	}
+
+	if m.breakers != nil {
+		doer = m.CircuitBreaker(doer)
+	}
+
+	if m.retry != nil {
+		doer = m.Retry(doer)
+	}
+
+	if m.tracer != nil {
+		doer = m.Tracing(doer)
+	}
+
+	if m.metrics != nil {
+		doer = m.Metrics(doer)
+	}
+
+	if m.logger != nil {
+		doer = m.Logging(doer)
+	}
+
+	return &roundTripper{
+		doer: m.RequestID(doer),
+	}
+}
+
+// Client creates a copy of a base http client that applies the client middleware to every request.
+// If base is nil, a new http client with default settings will be created.
+// The returned client can be passed to third-party SDKs accepting an *http.Client.
+func (m *ClientMiddleware) Client(base *http.Client) *http.Client {
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+
+	client.Transport = m.RoundTripper(client.Transport)
+
+	return client
+}
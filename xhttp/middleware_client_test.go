@@ -5,20 +5,27 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/resilience"
+	"github.com/moorara/observe/trace"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/client_golang/prometheus"
 	promModel "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
 )
 
 func extractSpanContext(req *http.Request, tracer opentracing.Tracer) opentracing.SpanContext {
@@ -64,6 +71,56 @@ func TestClientMiddlewareOptions(t *testing.T) {
 				tracer: tracer,
 			},
 		},
+		{
+			"ClientCapture",
+			ClientMiddleware{},
+			ClientCapture(CaptureOptions{RequestHeaders: []string{"Tenant"}}),
+			ClientMiddleware{
+				capture: newCapture(CaptureOptions{RequestHeaders: []string{"Tenant"}}),
+			},
+		},
+		{
+			"ClientFilter",
+			ClientMiddleware{},
+			ClientFilter(Filter{Prefixes: []string{"/internal/"}}),
+			ClientMiddleware{
+				filters: []Filter{
+					{Prefixes: []string{"/internal/"}},
+				},
+			},
+		},
+		{
+			"ClientHTTPTrace",
+			ClientMiddleware{},
+			ClientHTTPTrace(nil),
+			ClientMiddleware{
+				connTracing: true,
+			},
+		},
+		{
+			"ClientRetry",
+			ClientMiddleware{},
+			ClientRetry(RetryOptions{MaxAttempts: 5}),
+			ClientMiddleware{
+				retry: newRetryPolicy(RetryOptions{MaxAttempts: 5}),
+			},
+		},
+		{
+			"ClientTimeout",
+			ClientMiddleware{},
+			ClientTimeout(time.Second),
+			ClientMiddleware{
+				timeout: time.Second,
+			},
+		},
+		{
+			"ClientBody",
+			ClientMiddleware{},
+			ClientBody(BodyOptions{MaxSize: 1024}),
+			ClientMiddleware{
+				body: newBodyCapture(BodyOptions{MaxSize: 1024}),
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -544,6 +601,7 @@ func TestClientMiddlewareTracing(t *testing.T) {
 		expectedMethod     string
 		expectedURL        string
 		expectedStatusCode int
+		expectedError      bool
 	}{
 		{
 			name:               "Error",
@@ -556,6 +614,7 @@ func TestClientMiddlewareTracing(t *testing.T) {
 			expectedMethod:     "GET",
 			expectedURL:        "/v1/items",
 			expectedStatusCode: -1,
+			expectedError:      true,
 		},
 		{
 			name:               "200",
@@ -604,6 +663,7 @@ func TestClientMiddlewareTracing(t *testing.T) {
 			expectedMethod:     "PUT",
 			expectedURL:        "/v1/items/1234",
 			expectedStatusCode: 500,
+			expectedError:      true,
 		},
 		{
 			name:               "WithParentSpan",
@@ -664,6 +724,20 @@ func TestClientMiddlewareTracing(t *testing.T) {
 			assert.Equal(t, tc.expectedMethod, span.Tag("http.method"))
 			assert.Equal(t, tc.expectedURL, span.Tag("http.url"))
 			assert.Equal(t, uint16(tc.expectedStatusCode), span.Tag("http.status_code"))
+			assert.Equal(t, ext.SpanKindRPCClientEnum, span.Tag("span.kind"))
+			assert.Equal(t, "example.com", span.Tag("http.host"))
+			assert.Equal(t, "example.com", span.Tag("peer.address"))
+			assert.Equal(t, "example.com", span.Tag("peer.hostname"))
+
+			if tc.expectedError {
+				assert.Equal(t, true, span.Tag("error"))
+			} else {
+				assert.Nil(t, span.Tag("error"))
+			}
+
+			if tc.resError != nil {
+				assert.Len(t, span.Logs(), 1)
+			}
 
 			if tc.parentSpan != nil {
 				parentSpan, ok := tc.parentSpan.(*mocktracer.MockSpan)
@@ -681,3 +755,856 @@ func TestClientMiddlewareTracing(t *testing.T) {
 		})
 	}
 }
+
+func TestClientMiddlewareTracingTags(t *testing.T) {
+	tracer := mocktracer.New()
+	mid := NewClientMiddleware(
+		ClientTracing(tracer),
+		ClientSpanTags(func(r *http.Request) opentracing.Tags {
+			return opentracing.Tags{"tenant": r.Header.Get("Tenant")}
+		}),
+	)
+
+	doer := mid.Tracing(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 201, ContentLength: 13}, nil
+	})
+
+	req, _ := http.NewRequest("POST", "http://users-service:8080/v1/users", bytes.NewReader([]byte(`{"name":"john"}`)))
+	req.Header.Set("Tenant", "acme")
+	req.Header.Set("User-Agent", "test-client/1.0")
+	_, err := doer(req)
+	assert.NoError(t, err)
+
+	span := tracer.FinishedSpans()[0]
+	assert.Equal(t, "acme", span.Tag("tenant"))
+	assert.Equal(t, "test-client/1.0", span.Tag("http.user_agent"))
+	assert.Equal(t, "users-service:8080", span.Tag("peer.address"))
+	assert.Equal(t, "users-service", span.Tag("peer.hostname"))
+	assert.Equal(t, uint16(8080), span.Tag("peer.port"))
+	assert.Equal(t, int64(15), span.Tag("http.request_size"))
+	assert.Equal(t, int64(13), span.Tag("http.response_size"))
+}
+
+func TestClientMiddlewareCapture(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Writer: buff})
+	tracer := mocktracer.New()
+
+	mid := NewClientMiddleware(
+		ClientLogging(logger),
+		ClientTracing(tracer),
+		ClientCapture(CaptureOptions{
+			RequestHeaders:  []string{"Tenant", "Authorization"},
+			ResponseHeaders: []string{"Content-Type"},
+			QueryParams:     []string{"page"},
+			RemoteIP:        true,
+			UserAgent:       true,
+		}),
+	)
+
+	doer := mid.Logging(mid.Tracing(func(r *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("Content-Type", "application/json")
+		return &http.Response{StatusCode: 200, Header: header}, nil
+	}))
+
+	req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users?page=2", nil)
+	req.Header.Set("Tenant", "acme")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("User-Agent", "test-client/1.0")
+	_, err := doer(req)
+	assert.NoError(t, err)
+
+	// Verify logs
+	var log map[string]interface{}
+	err = json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", log["req.header.tenant"])
+	assert.Equal(t, "[REDACTED]", log["req.header.authorization"])
+	assert.Equal(t, "2", log["req.query.page"])
+	assert.Equal(t, "test-client/1.0", log["req.userAgent"])
+	assert.Equal(t, "application/json", log["res.header.content-type"])
+	assert.NotContains(t, log, "req.remoteIp")
+
+	// Verify span tags
+	span := tracer.FinishedSpans()[0]
+	assert.Equal(t, "acme", span.Tag("http.request.header.tenant"))
+	assert.Equal(t, "[REDACTED]", span.Tag("http.request.header.authorization"))
+	assert.Equal(t, "2", span.Tag("http.request.query.page"))
+	assert.Equal(t, "application/json", span.Tag("http.response.header.content-type"))
+}
+
+func TestClientMiddlewareBody(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            BodyOptions
+		reqBody         string
+		resError        error
+		resStatusCode   int
+		resBody         string
+		unknownLength   bool
+		expectedLogged  bool
+		expectedReqBody string
+		expectedResBody string
+	}{
+		{
+			name:            "Error",
+			opts:            BodyOptions{OnlyErrors: true},
+			reqBody:         `{"name":"john"}`,
+			resError:        errors.New("connection refused"),
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"john\"\n}",
+		},
+		{
+			name:            "200",
+			opts:            BodyOptions{},
+			reqBody:         `{"name":"john"}`,
+			resStatusCode:   200,
+			resBody:         `{"id":"1234"}`,
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"john\"\n}",
+			expectedResBody: "{\n  \"id\": \"1234\"\n}",
+		},
+		{
+			name:            "Truncated",
+			opts:            BodyOptions{MaxSize: 8},
+			reqBody:         `{"name":"john"}`,
+			resStatusCode:   200,
+			resBody:         `{"id":"1234"}`,
+			expectedLogged:  true,
+			expectedReqBody: `{"name":`,
+			expectedResBody: `{"id":"1`,
+		},
+		{
+			name:            "UnknownLength",
+			opts:            BodyOptions{},
+			reqBody:         `{"name":"john"}`,
+			resStatusCode:   200,
+			resBody:         `{"id":"1234"}`,
+			unknownLength:   true,
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"john\"\n}",
+			expectedResBody: "{\n  \"id\": \"1234\"\n}",
+		},
+		{
+			name: "Redacted",
+			opts: BodyOptions{
+				Redact: func(body string) string {
+					return strings.Replace(body, "john", "***", -1)
+				},
+			},
+			reqBody:         `{"name":"john"}`,
+			resStatusCode:   200,
+			resBody:         `{"name":"john"}`,
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"***\"\n}",
+			expectedResBody: "{\n  \"name\": \"***\"\n}",
+		},
+		{
+			name:           "Filtered",
+			opts:           BodyOptions{Filter: func(r *http.Request) bool { return false }},
+			reqBody:        `{"name":"john"}`,
+			resStatusCode:  200,
+			resBody:        `{"id":"1234"}`,
+			expectedLogged: false,
+		},
+		{
+			name:           "OnlyErrorsSuccess",
+			opts:           BodyOptions{OnlyErrors: true},
+			reqBody:        `{"name":"john"}`,
+			resStatusCode:  201,
+			resBody:        `{"id":"1234"}`,
+			expectedLogged: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff, Level: "debug"})
+			tracer := mocktracer.New()
+			mid := NewClientMiddleware(
+				ClientLogging(logger),
+				ClientTracing(tracer),
+				ClientBody(tc.opts),
+			)
+
+			doer := mid.Tracing(mid.Body(func(r *http.Request) (*http.Response, error) {
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.reqBody, string(body))
+
+				if tc.resError != nil {
+					return nil, tc.resError
+				}
+
+				contentLength := int64(len(tc.resBody))
+				if tc.unknownLength {
+					contentLength = -1
+				}
+
+				return &http.Response{
+					StatusCode:    tc.resStatusCode,
+					Header:        http.Header{"Content-Type": []string{"application/json"}},
+					ContentLength: contentLength,
+					Body:          ioutil.NopCloser(bytes.NewReader([]byte(tc.resBody))),
+				}, nil
+			}))
+
+			req, _ := http.NewRequest("POST", "http://users-service:8080/v1/users", bytes.NewReader([]byte(tc.reqBody)))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := doer(req)
+
+			if tc.resError != nil {
+				assert.Equal(t, tc.resError, err)
+			} else {
+				assert.NoError(t, err)
+				body, err := ioutil.ReadAll(res.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.resBody, string(body))
+
+				// Bodies are logged once the response body is closed
+				assert.Empty(t, buff.String())
+				assert.NoError(t, res.Body.Close())
+			}
+
+			span := tracer.FinishedSpans()[0]
+
+			if !tc.expectedLogged {
+				assert.Empty(t, buff.String())
+				assert.Empty(t, span.Logs())
+				return
+			}
+
+			// Verify logs
+			var log map[string]interface{}
+			err = json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, "debug", log["level"])
+			assert.Equal(t, tc.expectedReqBody, log["req.body"])
+			if tc.expectedResBody != "" {
+				assert.Equal(t, tc.expectedResBody, log["res.body"])
+			} else {
+				assert.NotContains(t, log, "res.body")
+			}
+
+			// Verify span logs
+			fields := map[string]string{}
+			for _, f := range span.Logs()[0].Fields {
+				fields[f.Key] = f.ValueString
+			}
+			assert.Equal(t, bodyEvent, fields["event"])
+			assert.Equal(t, tc.expectedReqBody, fields["req.body"])
+		})
+	}
+}
+
+func TestClientMiddlewareFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		expectedLogged bool
+		expectedTraced bool
+	}{
+		{
+			name:           "NotFiltered",
+			method:         "GET",
+			url:            "http://users-service:8080/v1/users",
+			expectedLogged: true,
+			expectedTraced: true,
+		},
+		{
+			name:           "FilteredFromTracing",
+			method:         "GET",
+			url:            "http://users-service:8080/health",
+			expectedLogged: true,
+			expectedTraced: false,
+		},
+		{
+			name:           "FilteredByMethod",
+			method:         "OPTIONS",
+			url:            "http://users-service:8080/v1/users",
+			expectedLogged: false,
+			expectedTraced: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			tracer := mocktracer.New()
+
+			mid := NewClientMiddleware(
+				ClientLogging(logger),
+				ClientTracing(tracer),
+				ClientFilter(Filter{Paths: []string{"/health"}, Pillars: TracingPillar}),
+				ClientFilter(Filter{Methods: []string{"OPTIONS"}}),
+			)
+
+			doer := mid.Logging(mid.Tracing(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200}, nil
+			}))
+
+			req, _ := http.NewRequest(tc.method, tc.url, nil)
+			res, err := doer(req)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, tc.expectedLogged, buff.Len() > 0)
+			assert.Equal(t, tc.expectedTraced, len(tracer.FinishedSpans()) > 0)
+		})
+	}
+}
+
+func TestClientMiddlewareTracingPropagation(t *testing.T) {
+	tracer, closer, err := trace.NewTracer(trace.Options{
+		Propagator: trace.NewCompositePropagator(
+			trace.NewW3CPropagator(),
+			trace.NewB3MultiPropagator(),
+		),
+	})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	parentSpan := tracer.StartSpan("parent-span")
+	defer parentSpan.Finish()
+	traceID := parentSpan.Context().(jaeger.SpanContext).TraceID().String()
+
+	var header http.Header
+	mid := &ClientMiddleware{tracer: tracer}
+	doer := mid.Tracing(func(r *http.Request) (*http.Response, error) {
+		header = r.Header
+		return &http.Response{StatusCode: 200}, nil
+	})
+
+	req := httptest.NewRequest("GET", "/v1/items", nil)
+	req = req.WithContext(opentracing.ContextWithSpan(req.Context(), parentSpan))
+	_, err = doer(req)
+	assert.NoError(t, err)
+
+	assert.Contains(t, header.Get("Traceparent"), traceID)
+	assert.Contains(t, header.Get("X-B3-TraceId"), traceID)
+	assert.Empty(t, header.Get("Uber-Trace-Id"))
+}
+
+func TestClientMiddlewareRoundTripper(t *testing.T) {
+	var reqHeader http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqHeader = r.Header
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name           string
+		logging        bool
+		tracing        bool
+		expectedLogged bool
+		expectedTraced bool
+	}{
+		{
+			name:           "RequestIDOnly",
+			expectedLogged: false,
+			expectedTraced: false,
+		},
+		{
+			name:           "LoggingAndTracing",
+			logging:        true,
+			tracing:        true,
+			expectedLogged: true,
+			expectedTraced: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			tracer := mocktracer.New()
+
+			opts := []ClientMiddlewareOption{}
+			if tc.logging {
+				opts = append(opts, ClientLogging(log.NewLogger(log.Options{Writer: buff})))
+			}
+			if tc.tracing {
+				opts = append(opts, ClientTracing(tracer))
+			}
+
+			mid := NewClientMiddleware(opts...)
+			rt := mid.RoundTripper(nil)
+
+			req, _ := http.NewRequest("GET", ts.URL+"/v1/users", nil)
+			res, err := rt.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+			res.Body.Close()
+
+			// The original request should not be modified
+			assert.Empty(t, req.Header.Get(requestIDHeader))
+			assert.NotEmpty(t, reqHeader.Get(requestIDHeader))
+
+			assert.Equal(t, tc.expectedLogged, buff.Len() > 0)
+			assert.Equal(t, tc.expectedTraced, len(tracer.FinishedSpans()) > 0)
+			if tc.expectedTraced {
+				assert.NotEmpty(t, reqHeader.Get("Mockpfx-Ids-Traceid"))
+			}
+		})
+	}
+}
+
+func TestClientMiddlewareClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		base            *http.Client
+		expectedTimeout time.Duration
+	}{
+		{
+			name:            "NoBase",
+			base:            nil,
+			expectedTimeout: 0,
+		},
+		{
+			name: "WithBase",
+			base: &http.Client{
+				Timeout:   10 * time.Second,
+				Transport: &http.Transport{},
+			},
+			expectedTimeout: 10 * time.Second,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			mid := NewClientMiddleware(ClientTracing(tracer))
+
+			client := mid.Client(tc.base)
+			assert.Equal(t, tc.expectedTimeout, client.Timeout)
+			assert.IsType(t, &roundTripper{}, client.Transport)
+			if tc.base != nil {
+				assert.NotEqual(t, tc.base.Transport, client.Transport)
+			}
+
+			res, err := client.Get(ts.URL + "/v1/users")
+			assert.NoError(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+			res.Body.Close()
+
+			assert.Len(t, tracer.FinishedSpans(), 1)
+		})
+	}
+}
+
+func TestClientMiddlewareHTTPTrace(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+	mid := NewClientMiddleware(
+		ClientTracing(tracer),
+		ClientHTTPTrace(mf),
+	)
+
+	client := mid.Client(ts.Client())
+
+	// The first request establishes a new connection and the second one reuses it
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(ts.URL + "/v1/users")
+		assert.NoError(t, err)
+		_, _ = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	spans := tracer.FinishedSpans()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, false, spans[0].Tag("http.conn_reused"))
+	assert.Contains(t, spanLogEvents(spans[0]), "http.connect")
+	assert.Contains(t, spanLogEvents(spans[0]), "http.tls")
+	assert.Contains(t, spanLogEvents(spans[0]), "http.ttfb")
+
+	assert.Equal(t, true, spans[1].Tag("http.conn_reused"))
+	assert.NotContains(t, spanLogEvents(spans[1]), "http.connect")
+	assert.Contains(t, spanLogEvents(spans[1]), "http.ttfb")
+
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+
+	var names []string
+	for _, metricFamily := range metricFamilies {
+		names = append(names, *metricFamily.Name)
+	}
+	assert.Contains(t, names, clientPhaseMetricName)
+	assert.Contains(t, names, clientConnMetricName)
+}
+
+func TestClientMiddlewareRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             RetryOptions
+		method           string
+		body             []byte
+		responses        []int
+		errors           []error
+		retryAfter       string
+		expectedAttempts int
+		expectedStatus   int
+		expectedError    error
+	}{
+		{
+			name:             "Success",
+			opts:             RetryOptions{},
+			method:           "GET",
+			responses:        []int{200},
+			expectedAttempts: 1,
+			expectedStatus:   200,
+		},
+		{
+			name:             "RetryStatusCode",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "GET",
+			responses:        []int{503, 502, 200},
+			expectedAttempts: 3,
+			expectedStatus:   200,
+		},
+		{
+			name:             "RetryTransportError",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "PUT",
+			body:             []byte(`{"name":"john"}`),
+			responses:        []int{0, 201},
+			errors:           []error{errors.New("connection reset"), nil},
+			expectedAttempts: 2,
+			expectedStatus:   201,
+		},
+		{
+			name:             "MaxAttempts",
+			opts:             RetryOptions{MaxAttempts: 2, Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "GET",
+			responses:        []int{503, 503, 200},
+			expectedAttempts: 2,
+			expectedStatus:   503,
+		},
+		{
+			name:             "NotRetryableStatusCode",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "GET",
+			responses:        []int{500, 200},
+			expectedAttempts: 1,
+			expectedStatus:   500,
+		},
+		{
+			name:             "NonIdempotent",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "POST",
+			body:             []byte(`{"name":"john"}`),
+			responses:        []int{503, 201},
+			expectedAttempts: 1,
+			expectedStatus:   503,
+		},
+		{
+			name:             "RetryAfterTooLong",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "GET",
+			responses:        []int{503, 200},
+			retryAfter:       "86400",
+			expectedAttempts: 1,
+			expectedStatus:   503,
+		},
+		{
+			name:             "CircuitBreakerOpen",
+			opts:             RetryOptions{Backoff: resilience.Backoff{Initial: time.Millisecond}},
+			method:           "GET",
+			responses:        []int{0, 200},
+			errors:           []error{resilience.ErrOpen, nil},
+			expectedAttempts: 1,
+			expectedError:    resilience.ErrOpen,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			tracer := mocktracer.New()
+			promReg := prometheus.NewRegistry()
+			mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+			mid := NewClientMiddleware(
+				ClientLogging(logger),
+				ClientMetrics(mf),
+				ClientTracing(tracer),
+				ClientRetry(tc.opts),
+			)
+
+			var attempts int
+			doer := mid.Tracing(mid.Retry(func(r *http.Request) (*http.Response, error) {
+				i := attempts
+				attempts++
+
+				if r.Body != nil {
+					body, err := ioutil.ReadAll(r.Body)
+					assert.NoError(t, err)
+					assert.Equal(t, tc.body, body)
+				}
+
+				if tc.errors != nil && tc.errors[i] != nil {
+					return nil, tc.errors[i]
+				}
+
+				res := &http.Response{
+					StatusCode: tc.responses[i],
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+				}
+
+				if tc.retryAfter != "" {
+					res.Header.Set("Retry-After", tc.retryAfter)
+				}
+
+				return res, nil
+			}))
+
+			var body io.Reader
+			if tc.body != nil {
+				body = bytes.NewReader(tc.body)
+			}
+
+			req, _ := http.NewRequest(tc.method, "http://users-service:8080/v1/users", body)
+			res, err := doer(req)
+
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedStatus, res.StatusCode)
+			}
+
+			// Verify logs
+			retries := 0
+			dec := json.NewDecoder(buff)
+			for dec.More() {
+				var log map[string]interface{}
+				assert.NoError(t, dec.Decode(&log))
+				assert.Equal(t, "warn", log["level"])
+				retries++
+			}
+			assert.Equal(t, tc.expectedAttempts-1, retries)
+
+			// Verify spans
+			spans := tracer.FinishedSpans()
+			assert.Len(t, spans, tc.expectedAttempts+1)
+			clientSpan := spans[len(spans)-1]
+			for i, span := range spans[:len(spans)-1] {
+				assert.Equal(t, clientAttemptSpanName, span.OperationName)
+				assert.Equal(t, i+1, span.Tag("attempt"))
+				assert.Equal(t, clientSpan.SpanContext.SpanID, span.ParentID)
+			}
+
+			// Verify metrics
+			var counted float64
+			metricFamilies, err := promReg.Gather()
+			assert.NoError(t, err)
+			for _, metricFamily := range metricFamilies {
+				if *metricFamily.Name == clientAttemptsMetricName {
+					for _, m := range metricFamily.Metric {
+						counted += *m.Counter.Value
+					}
+				}
+			}
+			assert.Equal(t, float64(tc.expectedAttempts), counted)
+		})
+	}
+}
+
+func TestClientMiddlewareTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		delay           time.Duration
+		expectedTimeout bool
+	}{
+		{
+			name:            "NoTimeout",
+			timeout:         0,
+			delay:           10 * time.Millisecond,
+			expectedTimeout: false,
+		},
+		{
+			name:            "InTime",
+			timeout:         time.Second,
+			delay:           10 * time.Millisecond,
+			expectedTimeout: false,
+		},
+		{
+			name:            "TimedOut",
+			timeout:         10 * time.Millisecond,
+			delay:           time.Second,
+			expectedTimeout: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			tracer := mocktracer.New()
+
+			mid := NewClientMiddleware(
+				ClientLogging(logger),
+				ClientTracing(tracer),
+				ClientTimeout(tc.timeout),
+			)
+
+			var ctx context.Context
+			doer := mid.Tracing(mid.Timeout(func(r *http.Request) (*http.Response, error) {
+				ctx = r.Context()
+				select {
+				case <-time.After(tc.delay):
+					return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}))
+
+			req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+			res, err := doer(req)
+
+			if tc.expectedTimeout {
+				assert.Equal(t, context.DeadlineExceeded, err)
+				assert.Contains(t, buff.String(), "timed out")
+				assert.Contains(t, spanLogEvents(tracer.FinishedSpans()[0]), "timeout")
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, buff.String())
+
+				// The context is not cancelled until the response body is closed
+				assert.NoError(t, ctx.Err())
+				assert.NoError(t, res.Body.Close())
+				if tc.timeout > 0 {
+					assert.Equal(t, context.Canceled, ctx.Err())
+				}
+			}
+		})
+	}
+}
+
+func TestClientMiddlewareCircuitBreaker(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Writer: buff})
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+	mid := NewClientMiddleware(
+		ClientLogging(logger),
+		ClientMetrics(mf),
+		ClientCircuitBreaker(resilience.BreakerOptions{
+			FailureThreshold: 2,
+			OpenTimeout:      time.Minute,
+		}),
+	)
+	assert.NotNil(t, mid.breakers)
+	assert.NotNil(t, mid.resilienceMetrics)
+
+	var calls int
+	doer := mid.CircuitBreaker(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if r.URL.Host == "users-service:8080" {
+			return &http.Response{StatusCode: 503}, nil
+		}
+		return &http.Response{StatusCode: 200}, nil
+	})
+
+	// Consecutive failures open the breaker of a host
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+		res, err := doer(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 503, res.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+	res, err := doer(req)
+	assert.Nil(t, res)
+	assert.Equal(t, resilience.ErrOpen, err)
+	assert.Equal(t, 2, calls)
+
+	// Breakers of other hosts are not affected
+	req, _ = http.NewRequest("GET", "http://orders-service:8080/v1/orders", nil)
+	res, err = doer(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, 3, calls)
+
+	// Verify logs
+	var log map[string]interface{}
+	err = json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "users-service:8080", log["host"])
+	assert.Equal(t, "closed", log["from"])
+	assert.Equal(t, "open", log["to"])
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+	for _, metricFamily := range metricFamilies {
+		switch *metricFamily.Name {
+		case clientBreakerStateMetricName:
+			assert.Equal(t, float64(resilience.Open), *metricFamily.Metric[0].Gauge.Value)
+		case clientBreakerRejectionsMetricName:
+			assert.Equal(t, float64(1), *metricFamily.Metric[0].Counter.Value)
+		}
+	}
+}
+
+func TestClientMiddlewareCircuitBreakerCancel(t *testing.T) {
+	mid := NewClientMiddleware(
+		ClientCircuitBreaker(resilience.BreakerOptions{
+			FailureThreshold: 1,
+			OpenTimeout:      10 * time.Millisecond,
+		}),
+	)
+
+	doer := mid.CircuitBreaker(func(r *http.Request) (*http.Response, error) {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: 503}, nil
+	})
+
+	// A failure opens the breaker
+	req, _ := http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+	_, err := doer(req)
+	assert.NoError(t, err)
+
+	breaker := mid.breakers.Get("users-service:8080")
+	assert.Equal(t, resilience.Open, breaker.State())
+
+	// A trial request cancelled by the caller keeps the breaker half-open
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, _ = http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+	_, err = doer(req.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, resilience.HalfOpen, breaker.State())
+
+	// The trial slot is released for another request
+	req, _ = http.NewRequest("GET", "http://users-service:8080/v1/users", nil)
+	res, err := doer(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, resilience.Open, breaker.State())
+}
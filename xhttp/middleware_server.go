@@ -10,8 +10,10 @@ import (
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/trace"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	opentracingLog "github.com/opentracing/opentracing-go/log"
 )
 
 const (
@@ -33,9 +35,21 @@ func ContextForTest(ctx context.Context) context.Context {
 
 // ServerMiddleware is an http server middleware for logging, metrics, tracing, etc.
 type ServerMiddleware struct {
+	filters []Filter
 	logger  *log.Logger
+	mf      *metrics.Factory
 	metrics *metrics.RequestMetrics
 	tracer  opentracing.Tracer
+	baggage trace.BaggagePromoter
+	route   func(*http.Request) string
+	tags    func(*http.Request) opentracing.Tags
+	debug   func(*http.Request) bool
+	capture *capture
+	body    *bodyCapture
+
+	limit        *concurrencyLimit
+	limitMetrics *limitMetrics
+	accessLog    *accessLog
 }
 
 // ServerMiddlewareOption sets optional parameters for server middleware.
@@ -50,15 +64,8 @@ func ServerLogging(logger *log.Logger) ServerMiddlewareOption {
 
 // ServerMetrics is the option for server middleware to enable metrics for every request.
 func ServerMetrics(mf *metrics.Factory) ServerMiddlewareOption {
-	metrics := &metrics.RequestMetrics{
-		ReqGauge:        mf.Gauge(serverGaugeMetricName, "gauge metric for number of active server-side http requests", []string{"method", "url"}),
-		ReqCounter:      mf.Counter(serverCounterMetricName, "counter metric for total number of server-side http requests", []string{"method", "url", "statusCode", "statusClass"}),
-		ReqDurationHist: mf.Histogram(serverHistogramMetricName, "histogram metric for duration of server-side http requests in seconds", []string{"method", "url", "statusCode", "statusClass"}),
-		ReqDurationSumm: mf.Summary(serverSummaryMetricName, "summary metric for duration of server-side http requests in seconds", []string{"method", "url", "statusCode", "statusClass"}),
-	}
-
 	return func(i *ServerMiddleware) {
-		i.metrics = metrics
+		i.mf = mf
 	}
 }
 
@@ -69,6 +76,90 @@ func ServerTracing(tracer opentracing.Tracer) ServerMiddlewareOption {
 	}
 }
 
+// ServerFilter is the option for excluding requests from being observed.
+// Requests can be excluded by exact paths, path prefixes, regular expressions, methods, or a predicate,
+// from all pillars of observability or only some of them (i.e. keep metrics for /health but skip logging and tracing).
+// You can use this option multiple times for filtering different requests.
+func ServerFilter(f Filter) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.filters = append(i.filters, f)
+	}
+}
+
+// ServerBaggage is the option for server middleware to promote baggage items of incoming requests
+// to span tags, log fields, and metric labels (baggage.<key> for tags and fields and baggage_<key> for labels).
+// Only the baggage items with the given keys are promoted.
+// Each metric label keeps up to 100 distinct values and the rest of values are reported as "other".
+func ServerBaggage(keys ...string) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.baggage.Add(keys...)
+	}
+}
+
+// ServerRoute is the option for server middleware to name server spans by the route templates of requests.
+// The function should return the route template matched for a request (i.e. /users/{id}) or an empty string if unknown.
+// Spans are named by the request method and the route template (i.e. GET /users/{id}) instead of http-server-request.
+// The function is called before the next handler, so the route should be known by then (i.e. the middleware is used by the router).
+func ServerRoute(route func(*http.Request) string) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.route = route
+	}
+}
+
+// ServerTraceDebug is the option for server middleware to force sampling of requests having the X-Trace-Debug header.
+// The header is only honored for requests for which the trusted function returns true (i.e. requests from trusted proxies).
+// If the trusted function is nil, the header is honored for all requests, so any client can force sampling.
+func ServerTraceDebug(trusted func(*http.Request) bool) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		if trusted == nil {
+			trusted = func(*http.Request) bool { return true }
+		}
+		i.debug = trusted
+	}
+}
+
+// ServerSpanTags is the option for server middleware to set custom tags from requests on server spans.
+func ServerSpanTags(tags func(*http.Request) opentracing.Tags) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.tags = tags
+	}
+}
+
+// ServerCapture is the option for server middleware to capture allow-listed headers, query parameters,
+// remote IP address, and user agent of requests and responses in log fields and span tags.
+func ServerCapture(opts CaptureOptions) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.capture = newCapture(opts)
+	}
+}
+
+// ServerBody is the option for server middleware to capture request and response bodies for debugging.
+// Bodies are captured by the Body middleware in debug logs and span logs.
+func ServerBody(opts BodyOptions) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.body = newBodyCapture(opts)
+	}
+}
+
+// ServerLimit is the option for server middleware to shed requests exceeding a concurrency limit by the Limit middleware.
+// The limit can be static or adaptive based on observed latency.
+// Shed requests are counted by route templates if the ServerRoute option is used
+// and by up to 100 distinct paths otherwise (the rest of paths are reported as "other").
+func ServerLimit(opts LimitOptions) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.limit = newConcurrencyLimit(opts)
+	}
+}
+
+// ServerAccessLog is the option for server middleware to write access logs by the AccessLog middleware.
+// Access logs are written in Common, Combined, or W3C extended format to a dedicated writer,
+// independently of the structured logs written by the Logging middleware.
+func ServerAccessLog(opts AccessLogOptions) ServerMiddlewareOption {
+	return func(i *ServerMiddleware) {
+		i.accessLog = newAccessLog(opts)
+	}
+}
+
 // NewServerMiddleware creates a new instance of http server middleware.
 func NewServerMiddleware(opts ...ServerMiddlewareOption) *ServerMiddleware {
 	sm := &ServerMiddleware{}
@@ -76,9 +167,52 @@ func NewServerMiddleware(opts ...ServerMiddlewareOption) *ServerMiddleware {
 		opt(sm)
 	}
 
+	// Metrics are created after all options are applied, so they can have labels for baggage items
+	sm.createMetrics()
+
+	// Metrics for concurrency limits are created only if they are enabled
+	if sm.mf != nil && sm.limit != nil {
+		sm.limitMetrics = newLimitMetrics(sm.mf)
+		sm.limitMetrics.limit.Set(float64(sm.limit.limiter.Limit()))
+	}
+
 	return sm
 }
 
+// createMetrics creates the request metrics if metrics are enabled and not created yet.
+func (m *ServerMiddleware) createMetrics() {
+	if m.mf == nil || m.metrics != nil {
+		return
+	}
+
+	labels := m.baggage.Labels()
+
+	m.metrics = &metrics.RequestMetrics{
+		ReqGauge:        m.mf.Gauge(serverGaugeMetricName, "gauge metric for number of active server-side http requests", append([]string{"method", "url"}, labels...)),
+		ReqCounter:      m.mf.Counter(serverCounterMetricName, "counter metric for total number of server-side http requests", append([]string{"method", "url", "statusCode", "statusClass"}, labels...)),
+		ReqDurationHist: m.mf.Histogram(serverHistogramMetricName, "histogram metric for duration of server-side http requests in seconds", append([]string{"method", "url", "statusCode", "statusClass"}, labels...)),
+		ReqDurationSumm: m.mf.Summary(serverSummaryMetricName, "summary metric for duration of server-side http requests in seconds", append([]string{"method", "url", "statusCode", "statusClass"}, labels...)),
+	}
+}
+
+// getBaggage returns the promoted baggage items of a request.
+// Baggage items are read from the span in the request context or extracted from the request headers.
+func (m *ServerMiddleware) getBaggage(r *http.Request) map[string]string {
+	if m.baggage.Len() == 0 {
+		return nil
+	}
+
+	var spanCtx opentracing.SpanContext
+	if span := opentracing.SpanFromContext(r.Context()); span != nil {
+		spanCtx = span.Context()
+	} else if m.tracer != nil {
+		carrier := opentracing.HTTPHeadersCarrier(r.Header)
+		spanCtx, _ = m.tracer.Extract(opentracing.HTTPHeaders, carrier)
+	}
+
+	return m.baggage.Items(spanCtx)
+}
+
 // RequestID ensures incoming requests have unique ids.
 // This middleware ensures the request headers and context have a unique id.
 // A new request id will be generated if needed.
@@ -108,6 +242,11 @@ func (m *ServerMiddleware) RequestID(next http.HandlerFunc) http.HandlerFunc {
 // Request id will be read from reqeust headers if present.
 func (m *ServerMiddleware) Logging(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if excluded(m.filters, r, LoggingPillar) {
+			next(w, r)
+			return
+		}
+
 		proto := r.Proto
 		method := r.Method
 		url := r.URL.Path
@@ -124,6 +263,14 @@ func (m *ServerMiddleware) Logging(next http.HandlerFunc) http.HandlerFunc {
 			logger = logger.With("requestId", requestID)
 		}
 
+		if fields := m.baggage.Fields(m.getBaggage(r)); len(fields) > 0 {
+			logger = logger.With(fields...)
+		}
+
+		if m.capture != nil {
+			logger = logger.With(capturedFields(m.capture.request(r, true))...)
+		}
+
 		// Update request context
 		ctx := r.Context()
 		ctx = log.ContextWithLogger(ctx, logger)
@@ -144,6 +291,10 @@ func (m *ServerMiddleware) Logging(next http.HandlerFunc) http.HandlerFunc {
 			"message", fmt.Sprintf("%s %s %d %f", method, url, statusCode, duration),
 		}
 
+		if m.capture != nil {
+			pairs = append(pairs, capturedFields(m.capture.response(rw.Header()))...)
+		}
+
 		// Logging
 		switch {
 		case statusCode >= 500:
@@ -160,12 +311,20 @@ func (m *ServerMiddleware) Logging(next http.HandlerFunc) http.HandlerFunc {
 
 // Metrics takes care of metrics for incoming http requests.
 func (m *ServerMiddleware) Metrics(next http.HandlerFunc) http.HandlerFunc {
+	m.createMetrics()
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		if excluded(m.filters, r, MetricsPillar) {
+			next(w, r)
+			return
+		}
+
 		method := r.Method
 		url := r.URL.Path
+		baggageValues := m.baggage.LabelValues(m.getBaggage(r))
 
 		// Increment guage metric
-		m.metrics.ReqGauge.WithLabelValues(method, url).Inc()
+		m.metrics.ReqGauge.WithLabelValues(append([]string{method, url}, baggageValues...)...).Inc()
 
 		// Call the next http handler
 		start := time.Now()
@@ -177,22 +336,45 @@ func (m *ServerMiddleware) Metrics(next http.HandlerFunc) http.HandlerFunc {
 
 		// Metrics
 		statusText := strconv.Itoa(statusCode)
-		m.metrics.ReqGauge.WithLabelValues(method, url).Dec()
-		m.metrics.ReqCounter.WithLabelValues(method, url, statusText, statusClass).Inc()
-		m.metrics.ReqDurationHist.WithLabelValues(method, url, statusText, statusClass).Observe(duration)
-		m.metrics.ReqDurationSumm.WithLabelValues(method, url, statusText, statusClass).Observe(duration)
+		labelValues := append([]string{method, url, statusText, statusClass}, baggageValues...)
+		m.metrics.ReqGauge.WithLabelValues(append([]string{method, url}, baggageValues...)...).Dec()
+		m.metrics.ReqCounter.WithLabelValues(labelValues...).Inc()
+		m.metrics.ReqDurationHist.WithLabelValues(labelValues...).Observe(duration)
+		m.metrics.ReqDurationSumm.WithLabelValues(labelValues...).Observe(duration)
 	}
 }
 
 func (m *ServerMiddleware) createSpan(r *http.Request) opentracing.Span {
-	var span opentracing.Span
+	// Raw paths are not used as operations since they can have unbounded values (i.e. ids)
+	name := serverSpanName
+	operation := r.Method
+
+	var route string
+	if m.route != nil {
+		if route = m.route(r); route != "" {
+			name = r.Method + " " + route
+			operation = name
+		}
+	}
 
+	spanOpts := []opentracing.StartSpanOption{ext.SpanKindRPCServer}
 	carrier := opentracing.HTTPHeadersCarrier(r.Header)
-	parentSpanContext, err := m.tracer.Extract(opentracing.HTTPHeaders, carrier)
-	if err != nil {
-		span = m.tracer.StartSpan(serverSpanName)
-	} else {
-		span = m.tracer.StartSpan(serverSpanName, opentracing.ChildOf(parentSpanContext))
+	if parentSpanContext, err := m.tracer.Extract(opentracing.HTTPHeaders, carrier); err == nil {
+		spanOpts = append(spanOpts, opentracing.ChildOf(parentSpanContext))
+	}
+
+	span := m.tracer.StartSpan(name, spanOpts...)
+
+	// Sampling should be forced before any tag is set, so tags are not dropped by the sampler
+	if m.debug != nil && r.Header.Get(trace.DebugHeader) != "" && m.debug(r) {
+		trace.ForceSampling(span)
+	}
+
+	// The operation tag is used by the adaptive sampler for making sampling decisions per endpoint
+	span.SetTag(trace.OperationTag, operation)
+
+	if route != "" {
+		span.SetTag("http.route", route)
 	}
 
 	return span
@@ -200,8 +382,14 @@ func (m *ServerMiddleware) createSpan(r *http.Request) opentracing.Span {
 
 // Tracing takes care of tracing for incoming http requests.
 // Trace information will be read from reqeust headers if present.
+// Spans are tagged with error for 5xx responses.
 func (m *ServerMiddleware) Tracing(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if excluded(m.filters, r, TracingPillar) {
+			next(w, r)
+			return
+		}
+
 		proto := r.Proto
 		method := r.Method
 		url := r.URL.Path
@@ -215,19 +403,201 @@ func (m *ServerMiddleware) Tracing(next http.HandlerFunc) http.HandlerFunc {
 		ctx = opentracing.ContextWithSpan(ctx, span)
 		req := r.WithContext(ctx)
 
-		// Call the next http handler
-		rw := NewResponseWriter(w)
-		next(rw, req)
-		statusCode := rw.StatusCode
+		m.baggage.SetTags(span, m.getBaggage(req))
 
 		// Tracing
 		// https://github.com/opentracing/specification/blob/master/semantic_conventions.md
 		span.SetTag("http.proto", proto)
+		span.SetTag("http.host", r.Host)
 		ext.HTTPMethod.Set(span, method)
 		ext.HTTPUrl.Set(span, url)
+		setPeerTags(span, r.RemoteAddr)
+
+		if userAgent := r.UserAgent(); userAgent != "" {
+			span.SetTag("http.user_agent", userAgent)
+		}
+
+		if r.ContentLength >= 0 {
+			span.SetTag("http.request_size", r.ContentLength)
+		}
+
+		if m.tags != nil {
+			for key, val := range m.tags(r) {
+				span.SetTag(key, val)
+			}
+		}
+
+		if m.capture != nil {
+			for key, val := range capturedTags(m.capture.request(r, true)) {
+				span.SetTag(key, val)
+			}
+		}
+
+		// Call the next http handler
+		rw := NewResponseWriter(w)
+		next(rw, req)
+		statusCode := rw.StatusCode
+
 		ext.HTTPStatusCode.Set(span, uint16(statusCode))
-		/* span.LogFields(
-			opentracingLog.String("key", value),
-		) */
+		span.SetTag("http.response_size", rw.Size)
+
+		if m.capture != nil {
+			for key, val := range capturedTags(m.capture.response(rw.Header())) {
+				span.SetTag(key, val)
+			}
+		}
+
+		if statusCode >= 500 {
+			ext.Error.Set(span, true)
+		}
+	}
+}
+
+// Body captures request and response bodies of incoming http requests for debugging.
+// Bodies are captured while they are read and written by the next handler, so streaming is not affected.
+// Captured bodies are logged at debug level if logging is enabled and logged on the span in the request context if any.
+func (m *ServerMiddleware) Body(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.body == nil || !m.body.enabled(r) {
+			next(w, r)
+			return
+		}
+
+		req := r.WithContext(r.Context())
+		reqBuf := newBodyBuffer(m.body.maxSize)
+		if r.Body != nil && r.Body != http.NoBody {
+			req.Body = &bodyReader{ReadCloser: r.Body, buf: reqBuf}
+		}
+
+		// Call the next http handler
+		bw := &bodyWriter{ResponseWriter: w, buf: newBodyBuffer(m.body.maxSize)}
+		next(bw, req)
+
+		statusCode := bw.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+
+		if !m.body.report(statusCode) {
+			return
+		}
+
+		fields := append(
+			reqBuf.fields("req", r.Header.Get("Content-Type"), m.body.redact),
+			bw.buf.fields("res", w.Header().Get("Content-Type"), m.body.redact)...,
+		)
+
+		if m.logger != nil {
+			pairs := []interface{}{
+				"http.kind", serverKind,
+				"req.method", r.Method,
+				"req.url", r.URL.Path,
+				"res.statusCode", statusCode,
+				"message", "http body",
+			}
+
+			if requestID := r.Header.Get(requestIDHeader); requestID != "" {
+				pairs = append(pairs, "requestId", requestID)
+			}
+
+			m.logger.DebugKV(append(pairs, fields...)...)
+		}
+
+		if span := opentracing.SpanFromContext(r.Context()); span != nil {
+			span.LogKV(append([]interface{}{"event", bodyEvent}, fields...)...)
+		}
+	}
+}
+
+// Limit sheds incoming http requests exceeding a concurrency limit (load shedding).
+// Shed requests are rejected with 503 (Service Unavailable) and a Retry-After header without calling the next handler.
+// Shedding decisions are logged and counted by metrics and the current limit is reported by a gauge metric.
+// It should be used inside the other middleware, so only the latency of the next handler is observed by adaptive limits.
+func (m *ServerMiddleware) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.limit == nil || !m.limit.limited(r) {
+			next(w, r)
+			return
+		}
+
+		release, ok := m.limit.limiter.Acquire()
+		if !ok {
+			m.shed(w, r)
+			return
+		}
+
+		rw := NewResponseWriter(w)
+		defer func() {
+			release(outcome(r, rw.StatusCode))
+			if m.limitMetrics != nil {
+				m.limitMetrics.limit.Set(float64(m.limit.limiter.Limit()))
+			}
+		}()
+
+		// Call the next http handler
+		next(rw, r)
+	}
+}
+
+// shed rejects a request exceeding the concurrency limit.
+func (m *ServerMiddleware) shed(w http.ResponseWriter, r *http.Request) {
+	limit := m.limit.limiter.Limit()
+
+	if m.limitMetrics != nil {
+		var route string
+		if m.route != nil {
+			route = m.route(r)
+		}
+		m.limitMetrics.shed.WithLabelValues(r.Method, m.limitMetrics.url(r, route)).Inc()
+	}
+
+	if m.logger != nil {
+		pairs := []interface{}{
+			"http.kind", serverKind,
+			"req.method", r.Method,
+			"req.url", r.URL.Path,
+			"limit", limit,
+			"message", fmt.Sprintf("%s %s shed: concurrency limit %d reached", r.Method, r.URL.Path, limit),
+		}
+
+		if requestID := r.Header.Get(requestIDHeader); requestID != "" {
+			pairs = append(pairs, "requestId", requestID)
+		}
+
+		m.logger.WarnKV(pairs...)
+	}
+
+	if span := opentracing.SpanFromContext(r.Context()); span != nil {
+		span.LogFields(
+			opentracingLog.String("event", "shed"),
+			opentracingLog.Int("limit", limit),
+		)
+	}
+
+	w.Header().Set("Retry-After", m.limit.retryAfter)
+	writeProblem(w, r, Problem{
+		Status: http.StatusServiceUnavailable,
+		Detail: "server is overloaded",
+	})
+}
+
+// AccessLog writes access logs for incoming http requests in Common, Combined, or W3C extended format.
+// Each request is logged as a single line to the dedicated writer of the access log after the next handler returns.
+func (m *ServerMiddleware) AccessLog(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.accessLog == nil || !m.accessLog.enabled(r) {
+			next(w, r)
+			return
+		}
+
+		clientIP := m.accessLog.capture.clientIP(r)
+
+		// Call the next http handler
+		start := time.Now()
+		rw := NewResponseWriter(w)
+		next(rw, r)
+		duration := time.Since(start)
+
+		m.accessLog.write(newAccessEntry(r, clientIP, start, rw.StatusCode, rw.Size, duration))
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -13,11 +15,15 @@ import (
 	"github.com/moorara/observe/log"
 	"github.com/moorara/observe/metrics"
 	"github.com/moorara/observe/request"
+	"github.com/moorara/observe/resilience"
+	"github.com/moorara/observe/trace"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/client_golang/prometheus"
 	promModel "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
 )
 
 func TestContextForTest(t *testing.T) {
@@ -64,6 +70,59 @@ func TestServerMiddlewareOptions(t *testing.T) {
 				tracer: tracer,
 			},
 		},
+		{
+			"ServerFilter",
+			ServerMiddleware{},
+			ServerFilter(Filter{Paths: []string{"/health"}}),
+			ServerMiddleware{
+				filters: []Filter{
+					{Paths: []string{"/health"}},
+				},
+			},
+		},
+		{
+			"ServerBaggage",
+			ServerMiddleware{},
+			ServerBaggage("tenant", "user-id"),
+			ServerMiddleware{
+				baggage: func() (p trace.BaggagePromoter) {
+					p.Add("tenant", "user-id")
+					return p
+				}(),
+			},
+		},
+		{
+			"ServerCapture",
+			ServerMiddleware{},
+			ServerCapture(CaptureOptions{RequestHeaders: []string{"Tenant"}}),
+			ServerMiddleware{
+				capture: newCapture(CaptureOptions{RequestHeaders: []string{"Tenant"}}),
+			},
+		},
+		{
+			"ServerBody",
+			ServerMiddleware{},
+			ServerBody(BodyOptions{MaxSize: 1024}),
+			ServerMiddleware{
+				body: newBodyCapture(BodyOptions{MaxSize: 1024}),
+			},
+		},
+		{
+			"ServerAccessLog",
+			ServerMiddleware{},
+			ServerAccessLog(AccessLogOptions{Writer: ioutil.Discard, Format: CombinedLogFormat}),
+			ServerMiddleware{
+				accessLog: newAccessLog(AccessLogOptions{Writer: ioutil.Discard, Format: CombinedLogFormat}),
+			},
+		},
+		{
+			"ServerLimit",
+			ServerMiddleware{},
+			ServerLimit(LimitOptions{Limit: resilience.FixedLimit(10)}),
+			ServerMiddleware{
+				limit: newConcurrencyLimit(LimitOptions{Limit: resilience.FixedLimit(10)}),
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -407,6 +466,7 @@ func TestServerMiddlewareTracing(t *testing.T) {
 		expectedMethod     string
 		expectedURL        string
 		expectedStatusCode int
+		expectedError      bool
 	}{
 		{
 			name:               "200",
@@ -451,6 +511,7 @@ func TestServerMiddlewareTracing(t *testing.T) {
 			expectedMethod:     "PUT",
 			expectedURL:        "/v1/items/1234",
 			expectedStatusCode: 500,
+			expectedError:      true,
 		},
 		{
 			name:               "WithRequestSpan",
@@ -502,6 +563,20 @@ func TestServerMiddlewareTracing(t *testing.T) {
 			assert.Equal(t, tc.expectedMethod, span.Tag("http.method"))
 			assert.Equal(t, tc.expectedURL, span.Tag("http.url"))
 			assert.Equal(t, uint16(tc.expectedStatusCode), span.Tag("http.status_code"))
+			assert.Equal(t, ext.SpanKindRPCServerEnum, span.Tag("span.kind"))
+			assert.Equal(t, "example.com", span.Tag("http.host"))
+			assert.Equal(t, "192.0.2.1:1234", span.Tag("peer.address"))
+			assert.Equal(t, "192.0.2.1", span.Tag("peer.hostname"))
+			assert.Equal(t, uint16(1234), span.Tag("peer.port"))
+			assert.Equal(t, int64(0), span.Tag("http.request_size"))
+			assert.Equal(t, 0, span.Tag("http.response_size"))
+			assert.Equal(t, tc.expectedMethod, span.Tag(trace.OperationTag))
+
+			if tc.expectedError {
+				assert.Equal(t, true, span.Tag("error"))
+			} else {
+				assert.Nil(t, span.Tag("error"))
+			}
 
 			if tc.reqSpan != nil {
 				reqSpan, ok := tc.reqSpan.(*mocktracer.MockSpan)
@@ -519,3 +594,847 @@ func TestServerMiddlewareTracing(t *testing.T) {
 		})
 	}
 }
+
+func TestServerMiddlewareTracingRoute(t *testing.T) {
+	tests := []struct {
+		name              string
+		route             func(*http.Request) string
+		expectedName      string
+		expectedRoute     interface{}
+		expectedOperation string
+	}{
+		{
+			name:              "NoRoute",
+			route:             nil,
+			expectedName:      serverSpanName,
+			expectedRoute:     nil,
+			expectedOperation: "GET",
+		},
+		{
+			name:              "UnknownRoute",
+			route:             func(*http.Request) string { return "" },
+			expectedName:      serverSpanName,
+			expectedRoute:     nil,
+			expectedOperation: "GET",
+		},
+		{
+			name:              "Route",
+			route:             func(*http.Request) string { return "/v1/users/{id}" },
+			expectedName:      "GET /v1/users/{id}",
+			expectedRoute:     "/v1/users/{id}",
+			expectedOperation: "GET /v1/users/{id}",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			mid := NewServerMiddleware(ServerTracing(tracer), ServerRoute(tc.route))
+
+			handler := mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			})
+			handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/users/1234", nil))
+
+			span := tracer.FinishedSpans()[0]
+			assert.Equal(t, tc.expectedName, span.OperationName)
+			assert.Equal(t, tc.expectedRoute, span.Tag("http.route"))
+			assert.Equal(t, tc.expectedOperation, span.Tag(trace.OperationTag))
+		})
+	}
+}
+
+func TestServerMiddlewareTracingTags(t *testing.T) {
+	tracer := mocktracer.New()
+	mid := NewServerMiddleware(
+		ServerTracing(tracer),
+		ServerSpanTags(func(r *http.Request) opentracing.Tags {
+			return opentracing.Tags{"tenant": r.Header.Get("Tenant")}
+		}),
+	)
+
+	handler := mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"1234"}`))
+	})
+
+	req := httptest.NewRequest("POST", "/v1/users", bytes.NewReader([]byte(`{"name":"john"}`)))
+	req.Header.Set("Tenant", "acme")
+	req.Header.Set("User-Agent", "test-client/1.0")
+	handler(httptest.NewRecorder(), req)
+
+	span := tracer.FinishedSpans()[0]
+	assert.Equal(t, "acme", span.Tag("tenant"))
+	assert.Equal(t, "test-client/1.0", span.Tag("http.user_agent"))
+	assert.Equal(t, int64(15), span.Tag("http.request_size"))
+	assert.Equal(t, 13, span.Tag("http.response_size"))
+	assert.Equal(t, uint16(200), span.Tag("http.status_code"))
+}
+
+func TestServerMiddlewareCapture(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Writer: buff})
+	tracer := mocktracer.New()
+
+	mid := NewServerMiddleware(
+		ServerLogging(logger),
+		ServerTracing(tracer),
+		ServerCapture(CaptureOptions{
+			RequestHeaders:  []string{"Tenant", "Authorization"},
+			ResponseHeaders: []string{"Content-Type"},
+			QueryParams:     []string{"page"},
+			RemoteIP:        true,
+			TrustedProxies:  []string{"192.0.2.0/24"},
+			UserAgent:       true,
+		}),
+	)
+
+	handler := mid.Logging(mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/users?page=2", nil)
+	req.Header.Set("Tenant", "acme")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("User-Agent", "test-client/1.0")
+	req.Header.Set("X-Forwarded-For", "203.0.113.10")
+	handler(httptest.NewRecorder(), req)
+
+	// Verify logs
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", log["req.header.tenant"])
+	assert.Equal(t, "[REDACTED]", log["req.header.authorization"])
+	assert.Equal(t, "2", log["req.query.page"])
+	assert.Equal(t, "203.0.113.10", log["req.remoteIp"])
+	assert.Equal(t, "test-client/1.0", log["req.userAgent"])
+	assert.Equal(t, "application/json", log["res.header.content-type"])
+
+	// Verify span tags
+	span := tracer.FinishedSpans()[0]
+	assert.Equal(t, "acme", span.Tag("http.request.header.tenant"))
+	assert.Equal(t, "[REDACTED]", span.Tag("http.request.header.authorization"))
+	assert.Equal(t, "2", span.Tag("http.request.query.page"))
+	assert.Equal(t, "203.0.113.10", span.Tag("http.request.remote_ip"))
+	assert.Equal(t, "application/json", span.Tag("http.response.header.content-type"))
+}
+
+func TestServerMiddlewareBody(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            BodyOptions
+		reqBody         string
+		resStatusCode   int
+		resBody         string
+		expectedLogged  bool
+		expectedReqBody string
+		expectedResBody string
+	}{
+		{
+			name:            "200",
+			opts:            BodyOptions{},
+			reqBody:         `{"name":"john"}`,
+			resStatusCode:   200,
+			resBody:         `{"id":"1234"}`,
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"john\"\n}",
+			expectedResBody: "{\n  \"id\": \"1234\"\n}",
+		},
+		{
+			name:           "Filtered",
+			opts:           BodyOptions{Filter: func(r *http.Request) bool { return false }},
+			reqBody:        `{"name":"john"}`,
+			resStatusCode:  200,
+			resBody:        `{"id":"1234"}`,
+			expectedLogged: false,
+		},
+		{
+			name:           "OnlyErrorsSuccess",
+			opts:           BodyOptions{OnlyErrors: true},
+			reqBody:        `{"name":"john"}`,
+			resStatusCode:  201,
+			resBody:        `{"id":"1234"}`,
+			expectedLogged: false,
+		},
+		{
+			name:            "OnlyErrorsFailure",
+			opts:            BodyOptions{OnlyErrors: true},
+			reqBody:         `{"name":""}`,
+			resStatusCode:   400,
+			resBody:         `{"message":"invalid name"}`,
+			expectedLogged:  true,
+			expectedReqBody: "{\n  \"name\": \"\"\n}",
+			expectedResBody: "{\n  \"message\": \"invalid name\"\n}",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff, Level: "debug"})
+			tracer := mocktracer.New()
+			mid := NewServerMiddleware(
+				ServerLogging(logger),
+				ServerTracing(tracer),
+				ServerBody(tc.opts),
+			)
+
+			handler := mid.Tracing(mid.Body(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.reqBody, string(body))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.resStatusCode)
+				_, _ = w.Write([]byte(tc.resBody))
+			}))
+
+			req := httptest.NewRequest("POST", "/v1/users", bytes.NewReader([]byte(tc.reqBody)))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			assert.Equal(t, tc.resStatusCode, rec.Code)
+			assert.Equal(t, tc.resBody, rec.Body.String())
+
+			span := tracer.FinishedSpans()[0]
+
+			if !tc.expectedLogged {
+				assert.Empty(t, buff.String())
+				assert.Empty(t, span.Logs())
+				return
+			}
+
+			// Verify logs
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			assert.Equal(t, "debug", log["level"])
+			assert.Equal(t, float64(tc.resStatusCode), log["res.statusCode"])
+			assert.Equal(t, float64(len(tc.reqBody)), log["req.bodySize"])
+			assert.Equal(t, tc.expectedReqBody, log["req.body"])
+			assert.Equal(t, float64(len(tc.resBody)), log["res.bodySize"])
+			assert.Equal(t, tc.expectedResBody, log["res.body"])
+
+			// Verify span logs
+			assert.Len(t, span.Logs(), 1)
+			fields := map[string]string{}
+			for _, f := range span.Logs()[0].Fields {
+				fields[f.Key] = f.ValueString
+			}
+			assert.Equal(t, bodyEvent, fields["event"])
+			assert.Equal(t, tc.expectedReqBody, fields["req.body"])
+			assert.Equal(t, tc.expectedResBody, fields["res.body"])
+		})
+	}
+}
+
+func TestServerMiddlewareFilter(t *testing.T) {
+	tests := []struct {
+		name            string
+		req             *http.Request
+		expectedLogged  bool
+		expectedMetrics bool
+		expectedTraced  bool
+	}{
+		{
+			name:            "NotFiltered",
+			req:             httptest.NewRequest("GET", "/v1/users", nil),
+			expectedLogged:  true,
+			expectedMetrics: true,
+			expectedTraced:  true,
+		},
+		{
+			name:            "FilteredFromLoggingAndTracing",
+			req:             httptest.NewRequest("GET", "/health", nil),
+			expectedLogged:  false,
+			expectedMetrics: true,
+			expectedTraced:  false,
+		},
+		{
+			name:            "FilteredFromAll",
+			req:             httptest.NewRequest("GET", "/favicon.ico", nil),
+			expectedLogged:  false,
+			expectedMetrics: false,
+			expectedTraced:  false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			promReg := prometheus.NewRegistry()
+			mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+			tracer := mocktracer.New()
+
+			mid := NewServerMiddleware(
+				ServerLogging(logger),
+				ServerMetrics(mf),
+				ServerTracing(tracer),
+				ServerFilter(Filter{Paths: []string{"/health"}, Pillars: LoggingPillar | TracingPillar}),
+				ServerFilter(Filter{Paths: []string{"/favicon.ico"}}),
+			)
+
+			var called bool
+			handler := mid.Logging(mid.Metrics(mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(200)
+			})))
+
+			rec := httptest.NewRecorder()
+			handler(rec, tc.req)
+
+			assert.True(t, called)
+			assert.Equal(t, 200, rec.Code)
+			assert.Equal(t, tc.expectedLogged, buff.Len() > 0)
+			assert.Equal(t, tc.expectedTraced, len(tracer.FinishedSpans()) > 0)
+
+			var counted bool
+			metricFamilies, err := promReg.Gather()
+			assert.NoError(t, err)
+			for _, metricFamily := range metricFamilies {
+				if *metricFamily.Name == serverCounterMetricName {
+					counted = len(metricFamily.Metric) > 0
+				}
+			}
+			assert.Equal(t, tc.expectedMetrics, counted)
+		})
+	}
+}
+
+func TestServerMiddlewareTracingSampling(t *testing.T) {
+	trusted := func(r *http.Request) bool {
+		return r.RemoteAddr == "10.0.0.1:1234"
+	}
+
+	tests := []struct {
+		name              string
+		opts              []ServerMiddlewareOption
+		remoteAddr        string
+		headers           map[string]string
+		expectedSampled   bool
+		expectedOperation string
+	}{
+		{
+			name:            "Default",
+			headers:         map[string]string{},
+			expectedSampled: false,
+		},
+		{
+			name:            "DebugHeaderNotEnabled",
+			headers:         map[string]string{trace.DebugHeader: "true"},
+			expectedSampled: false,
+		},
+		{
+			name:              "DebugHeaderEnabled",
+			opts:              []ServerMiddlewareOption{ServerTraceDebug(nil)},
+			headers:           map[string]string{trace.DebugHeader: "true"},
+			expectedSampled:   true,
+			expectedOperation: "GET",
+		},
+		{
+			name:              "DebugHeaderTrusted",
+			opts:              []ServerMiddlewareOption{ServerTraceDebug(trusted)},
+			remoteAddr:        "10.0.0.1:1234",
+			headers:           map[string]string{trace.DebugHeader: "true"},
+			expectedSampled:   true,
+			expectedOperation: "GET",
+		},
+		{
+			name:            "DebugHeaderUntrusted",
+			opts:            []ServerMiddlewareOption{ServerTraceDebug(trusted)},
+			remoteAddr:      "203.0.113.1:1234",
+			headers:         map[string]string{trace.DebugHeader: "true"},
+			expectedSampled: false,
+		},
+		{
+			name: "DebugHeaderWithRoute",
+			opts: []ServerMiddlewareOption{
+				ServerTraceDebug(nil),
+				ServerRoute(func(*http.Request) string { return "/v1/items/{id}" }),
+			},
+			headers:           map[string]string{trace.DebugHeader: "true"},
+			expectedSampled:   true,
+			expectedOperation: "GET /v1/items/{id}",
+		},
+	}
+
+	// Spans are not sampled unless forced
+	tracer, closer, err := trace.NewTracer(trace.Options{Sampler: trace.NewConstSampler(false)})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var span *jaeger.Span
+
+			mid := NewServerMiddleware(append(tc.opts, ServerTracing(tracer))...)
+			handler := mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+				span = opentracing.SpanFromContext(r.Context()).(*jaeger.Span)
+				w.WriteHeader(200)
+			})
+
+			req := httptest.NewRequest("GET", "/v1/items/1", nil)
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tc.expectedSampled, span.SpanContext().IsSampled())
+			if tc.expectedSampled {
+				assert.Equal(t, tc.expectedOperation, span.Tags()[trace.OperationTag])
+			}
+		})
+	}
+}
+
+func TestServerMiddlewareTracingPropagation(t *testing.T) {
+	tracer, closer, err := trace.NewTracer(trace.Options{
+		Propagator: trace.NewCompositePropagator(
+			trace.NewJaegerPropagator(),
+			trace.NewW3CPropagator(),
+			trace.NewB3SinglePropagator(),
+			trace.NewB3MultiPropagator(),
+		),
+	})
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	tests := []struct {
+		name            string
+		headers         map[string]string
+		expectedTraceID string
+	}{
+		{
+			name:            "NoHeader",
+			headers:         map[string]string{},
+			expectedTraceID: "",
+		},
+		{
+			name:            "Jaeger",
+			headers:         map[string]string{"Uber-Trace-Id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1"},
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:            "W3C",
+			headers:         map[string]string{"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:            "B3Single",
+			headers:         map[string]string{"B3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"},
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name: "B3Multi",
+			headers: map[string]string{
+				"X-B3-TraceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"X-B3-SpanId":  "00f067aa0ba902b7",
+			},
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var spanCtx jaeger.SpanContext
+
+			mid := &ServerMiddleware{tracer: tracer}
+			handler := mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+				spanCtx = opentracing.SpanFromContext(r.Context()).Context().(jaeger.SpanContext)
+				w.WriteHeader(200)
+			})
+
+			req := httptest.NewRequest("GET", "/v1/items", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler(httptest.NewRecorder(), req)
+
+			if tc.expectedTraceID == "" {
+				assert.Equal(t, jaeger.SpanID(0), spanCtx.ParentID())
+			} else {
+				assert.Equal(t, tc.expectedTraceID, spanCtx.TraceID().String())
+				assert.Equal(t, jaeger.SpanID(0x00f067aa0ba902b7), spanCtx.ParentID())
+			}
+		})
+	}
+}
+
+func TestServerMiddlewareBaggage(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          []string
+		headers       map[string]string
+		expectedItems map[string]string
+	}{
+		{
+			name:          "NoBaggage",
+			keys:          []string{"tenant"},
+			headers:       map[string]string{},
+			expectedItems: map[string]string{},
+		},
+		{
+			name: "AllowedBaggage",
+			keys: []string{"tenant", "region"},
+			headers: map[string]string{
+				"Mockpfx-Ids-Traceid":    "1",
+				"Mockpfx-Ids-Spanid":     "2",
+				"Mockpfx-Ids-Sampled":    "true",
+				"Mockpfx-Baggage-Tenant": "acme",
+				"Mockpfx-Baggage-User":   "jane",
+			},
+			expectedItems: map[string]string{
+				"tenant": "acme",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			logger := log.NewLogger(log.Options{Writer: buff})
+			promReg := prometheus.NewRegistry()
+			mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+			tracer := mocktracer.New()
+
+			mid := NewServerMiddleware(
+				ServerLogging(logger),
+				ServerMetrics(mf),
+				ServerTracing(tracer),
+				ServerBaggage(tc.keys...),
+			)
+
+			handler := mid.Metrics(mid.Logging(mid.Tracing(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			})))
+
+			req := httptest.NewRequest("GET", "/v1/items", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler(httptest.NewRecorder(), req)
+
+			// Verify logs
+			var log map[string]interface{}
+			err := json.NewDecoder(buff).Decode(&log)
+			assert.NoError(t, err)
+			for _, key := range tc.keys {
+				if val, ok := tc.expectedItems[key]; ok {
+					assert.Equal(t, val, log["baggage."+key])
+				} else {
+					assert.NotContains(t, log, "baggage."+key)
+				}
+			}
+
+			// Verify span tags
+			span := tracer.FinishedSpans()[0]
+			for _, key := range tc.keys {
+				if val, ok := tc.expectedItems[key]; ok {
+					assert.Equal(t, val, span.Tag("baggage."+key))
+				} else {
+					assert.Nil(t, span.Tag("baggage."+key))
+				}
+			}
+
+			// Verify metric labels
+			metricFamilies, err := promReg.Gather()
+			assert.NoError(t, err)
+			for _, metricFamily := range metricFamilies {
+				switch *metricFamily.Name {
+				case serverGaugeMetricName, serverCounterMetricName, serverHistogramMetricName, serverSummaryMetricName:
+				default:
+					continue
+				}
+
+				labels := map[string]string{}
+				for _, l := range metricFamily.Metric[0].Label {
+					labels[*l.Name] = *l.Value
+				}
+
+				for _, key := range tc.keys {
+					assert.Equal(t, tc.expectedItems[key], labels["baggage_"+key])
+				}
+			}
+		})
+	}
+}
+
+func TestServerMiddlewareLimit(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := log.NewLogger(log.Options{Writer: buff})
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+	tracer := mocktracer.New()
+
+	mid := NewServerMiddleware(
+		ServerLogging(logger),
+		ServerMetrics(mf),
+		ServerLimit(LimitOptions{
+			Limit:      resilience.FixedLimit(1),
+			RetryAfter: 1500 * time.Millisecond,
+			Filter: func(r *http.Request) bool {
+				return r.URL.Path != "/health"
+			},
+		}),
+	)
+	assert.NotNil(t, mid.limitMetrics)
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := mid.Limit(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-finish
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Occupy the only slot
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/slow", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	// Requests exceeding the limit are shed
+	span := tracer.StartSpan("test")
+	r := httptest.NewRequest("GET", "/v1/users", nil)
+	r = r.WithContext(opentracing.ContextWithSpan(r.Context(), span))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	span.Finish()
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "server is overloaded")
+	assert.Equal(t, "shed", tracer.FinishedSpans()[0].Logs()[0].Fields[0].ValueString)
+
+	// Filtered requests are not limited
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Requests are allowed after the slot is released
+	close(finish)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Verify logs
+	var log map[string]interface{}
+	err := json.NewDecoder(buff).Decode(&log)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", log["level"])
+	assert.Equal(t, "/v1/users", log["req.url"])
+	assert.Equal(t, float64(1), log["limit"])
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+	for _, metricFamily := range metricFamilies {
+		switch *metricFamily.Name {
+		case serverShedMetricName:
+			assert.Equal(t, float64(1), *metricFamily.Metric[0].Counter.Value)
+			assert.Equal(t, "url", *metricFamily.Metric[0].Label[1].Name)
+			assert.Equal(t, "/v1/users", *metricFamily.Metric[0].Label[1].Value)
+		case serverLimitMetricName:
+			assert.Equal(t, float64(1), *metricFamily.Metric[0].Gauge.Value)
+		}
+	}
+}
+
+func TestServerMiddlewareLimitRoute(t *testing.T) {
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+	mid := NewServerMiddleware(
+		ServerMetrics(mf),
+		ServerRoute(func(r *http.Request) string {
+			return "/v1/users/{id}"
+		}),
+		ServerLimit(LimitOptions{
+			Limit: resilience.FixedLimit(1),
+		}),
+	)
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := mid.Limit(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Occupy the only slot
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/users/0", nil))
+		close(done)
+	}()
+	<-started
+
+	// Shed requests for different paths are counted by their route
+	for i := 1; i <= 3; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", fmt.Sprintf("/v1/users/%d", i), nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	}
+
+	close(finish)
+	<-done
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+	for _, metricFamily := range metricFamilies {
+		if *metricFamily.Name == serverShedMetricName {
+			assert.Len(t, metricFamily.Metric, 1)
+			assert.Equal(t, float64(3), *metricFamily.Metric[0].Counter.Value)
+			assert.Equal(t, "/v1/users/{id}", *metricFamily.Metric[0].Label[1].Value)
+		}
+	}
+}
+
+func TestServerMiddlewareLimitAdaptive(t *testing.T) {
+	promReg := prometheus.NewRegistry()
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: promReg})
+
+	mid := NewServerMiddleware(
+		ServerMetrics(mf),
+		ServerLimit(LimitOptions{
+			Limit: resilience.NewAIMDLimit(resilience.AIMDOptions{Initial: 10}),
+		}),
+	)
+
+	handler := mid.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, 9, mid.limit.limiter.Limit())
+
+	// Verify metrics
+	metricFamilies, err := promReg.Gather()
+	assert.NoError(t, err)
+	for _, metricFamily := range metricFamilies {
+		if *metricFamily.Name == serverLimitMetricName {
+			assert.Equal(t, float64(9), *metricFamily.Metric[0].Gauge.Value)
+		}
+	}
+}
+
+func TestServerMiddlewareAccessLog(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           AccessLogOptions
+		req            func() *http.Request
+		statusCode     int
+		body           string
+		expectedRegexp string
+	}{
+		{
+			name: "Common",
+			opts: AccessLogOptions{Format: CommonLogFormat},
+			req: func() *http.Request {
+				r := httptest.NewRequest("GET", "/v1/users?limit=10", nil)
+				r.RemoteAddr = "10.0.0.1:54321"
+				return r
+			},
+			statusCode:     200,
+			body:           "hello",
+			expectedRegexp: `^10\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /v1/users\?limit=10 HTTP/1\.1" 200 5\n$`,
+		},
+		{
+			name: "CombinedWithTrustedProxy",
+			opts: AccessLogOptions{
+				Format:         CombinedLogFormat,
+				TrustedProxies: []string{"10.0.0.0/8"},
+			},
+			req: func() *http.Request {
+				r := httptest.NewRequest("DELETE", "/v1/users/1", nil)
+				r.RemoteAddr = "10.0.0.1:54321"
+				r.SetBasicAuth("admin", "secret")
+				r.Header.Set("X-Forwarded-For", "203.0.113.195")
+				r.Header.Set("User-Agent", "curl/7.68.0")
+				return r
+			},
+			statusCode:     204,
+			expectedRegexp: `^203\.0\.113\.195 - admin \[.+\] "DELETE /v1/users/1 HTTP/1\.1" 204 - "-" "curl/7\.68\.0"\n$`,
+		},
+		{
+			name: "W3C",
+			opts: AccessLogOptions{Format: W3CLogFormat},
+			req: func() *http.Request {
+				r := httptest.NewRequest("POST", "/v1/users", nil)
+				r.RemoteAddr = "10.0.0.1:54321"
+				return r
+			},
+			statusCode:     500,
+			body:           "error",
+			expectedRegexp: `^#Version: 1\.0\n#Date: .+\n#Fields: .+\n\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} 10\.0\.0\.1 - POST /v1/users - 500 5 \d+\.\d{3} - -\n$`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			tc.opts.Writer = buff
+			mid := NewServerMiddleware(ServerAccessLog(tc.opts))
+
+			handler := mid.AccessLog(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statusCode)
+				_, _ = w.Write([]byte(tc.body))
+			})
+
+			w := httptest.NewRecorder()
+			handler(w, tc.req())
+
+			assert.Equal(t, tc.statusCode, w.Code)
+			assert.Regexp(t, tc.expectedRegexp, buff.String())
+		})
+	}
+}
+
+func TestServerMiddlewareAccessLogDisabled(t *testing.T) {
+	buff := &bytes.Buffer{}
+	mid := NewServerMiddleware(ServerAccessLog(AccessLogOptions{
+		Writer: buff,
+		Filter: func(r *http.Request) bool {
+			return r.URL.Path != "/health"
+		},
+	}))
+
+	var called bool
+	handler := mid.AccessLog(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	assert.True(t, called)
+	assert.Empty(t, buff.String())
+
+	// Access logs are not written without the option
+	called = false
+	handler = NewServerMiddleware().AccessLog(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/users", nil))
+	assert.True(t, called)
+}
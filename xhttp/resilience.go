@@ -0,0 +1,184 @@
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	clientAttemptSpanName             = "http-client-attempt"
+	clientAttemptsMetricName          = "http_client_attempts_total"
+	clientTimeoutsMetricName          = "http_client_timeouts_total"
+	clientBreakerStateMetricName      = "http_client_circuit_breaker_state"
+	clientBreakerRejectionsMetricName = "http_client_circuit_breaker_rejections_total"
+)
+
+const (
+	defaultMaxAttempts   = 3
+	defaultMaxRetryAfter = 30 * time.Second
+)
+
+var defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// idempotentMethods are the http methods that are idempotent by definition.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// RetryOptions contains options for retrying failed requests.
+//   MaxAttempts is the maximum number of attempts including the first one (default 3).
+//   Backoff is the exponential backoff between attempts.
+//   StatusCodes are the status codes for which requests are retried (default 502, 503, and 504).
+//   RetryNonIdempotent enables retrying non-idempotent requests (i.e. POST requests without an Idempotency-Key header).
+//   MaxRetryAfter is the longest Retry-After delay for which requests are retried (default 30s).
+// Requests are also retried for transport errors. Requests with bodies are only retried if their bodies can be rewound (GetBody).
+// If a response has a Retry-After header (in seconds or as an http date) longer than the backoff delay, the request is retried after that.
+// If the Retry-After delay is longer than MaxRetryAfter, the request is not retried and the response is returned.
+type RetryOptions struct {
+	MaxAttempts        int
+	Backoff            resilience.Backoff
+	StatusCodes        []int
+	RetryNonIdempotent bool
+	MaxRetryAfter      time.Duration
+}
+
+// retryPolicy determines whether and when requests are retried.
+type retryPolicy struct {
+	maxAttempts   int
+	backoff       resilience.Backoff
+	statusCodes   map[int]bool
+	nonIdempotent bool
+	maxRetryAfter time.Duration
+}
+
+func newRetryPolicy(opts RetryOptions) *retryPolicy {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	codes := opts.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+
+	statusCodes := map[int]bool{}
+	for _, code := range codes {
+		statusCodes[code] = true
+	}
+
+	maxRetryAfter := opts.MaxRetryAfter
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = defaultMaxRetryAfter
+	}
+
+	return &retryPolicy{
+		maxAttempts:   maxAttempts,
+		backoff:       opts.Backoff,
+		statusCodes:   statusCodes,
+		nonIdempotent: opts.RetryNonIdempotent,
+		maxRetryAfter: maxRetryAfter,
+	}
+}
+
+// retryable determines whether or not a request can be retried.
+func (p *retryPolicy) retryable(r *http.Request) bool {
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return false
+	}
+
+	return p.nonIdempotent || idempotentMethods[r.Method] || r.Header.Get("Idempotency-Key") != ""
+}
+
+// shouldRetry determines whether or not an attempt should be retried by its result.
+// Requests rejected by a circuit breaker are not retried.
+func (p *retryPolicy) shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, resilience.ErrOpen)
+	}
+
+	return p.statusCodes[res.StatusCode]
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a response.
+// The header can be a number of seconds or an http date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	val := res.Header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(val); err == nil {
+		return time.Until(t), true
+	}
+
+	return 0, false
+}
+
+// delay returns the delay before a retry.
+// If the delay requested by the server is longer than the maximum Retry-After delay, false will be returned.
+func (p *retryPolicy) delay(retry int, res *http.Response) (time.Duration, bool) {
+	d := p.backoff.Delay(retry)
+
+	if after, ok := retryAfter(res); ok {
+		if after > p.maxRetryAfter {
+			return 0, false
+		}
+		if after > d {
+			d = after
+		}
+	}
+
+	return d, true
+}
+
+// resilienceMetrics are the metrics for retries, timeouts, and circuit breakers of client requests.
+type resilienceMetrics struct {
+	attempts          *prometheus.CounterVec
+	timeouts          *prometheus.CounterVec
+	breakerState      *prometheus.GaugeVec
+	breakerRejections *prometheus.CounterVec
+}
+
+func newResilienceMetrics(mf *metrics.Factory) *resilienceMetrics {
+	return &resilienceMetrics{
+		attempts:          mf.Counter(clientAttemptsMetricName, "counter metric for total number of attempts of client-side http requests", []string{"method", "url", "attempt"}),
+		timeouts:          mf.Counter(clientTimeoutsMetricName, "counter metric for total number of timed-out attempts of client-side http requests", []string{"method", "url"}),
+		breakerState:      mf.Gauge(clientBreakerStateMetricName, "gauge metric for state of circuit breakers of client-side http requests (0: closed, 1: half-open, 2: open)", []string{"host"}),
+		breakerRejections: mf.Counter(clientBreakerRejectionsMetricName, "counter metric for total number of client-side http requests rejected by circuit breakers", []string{"host"}),
+	}
+}
+
+// cancelBody cancels the context of a request when its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
@@ -0,0 +1,214 @@
+package xhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/moorara/observe/metrics"
+	"github.com/moorara/observe/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name                  string
+		opts                  RetryOptions
+		expectedMaxAttempts   int
+		expectedStatusCodes   map[int]bool
+		expectedMaxRetryAfter time.Duration
+	}{
+		{
+			name:                  "Defaults",
+			opts:                  RetryOptions{},
+			expectedMaxAttempts:   3,
+			expectedStatusCodes:   map[int]bool{502: true, 503: true, 504: true},
+			expectedMaxRetryAfter: 30 * time.Second,
+		},
+		{
+			name: "WithOptions",
+			opts: RetryOptions{
+				MaxAttempts:   5,
+				StatusCodes:   []int{429, 503},
+				MaxRetryAfter: time.Minute,
+			},
+			expectedMaxAttempts:   5,
+			expectedStatusCodes:   map[int]bool{429: true, 503: true},
+			expectedMaxRetryAfter: time.Minute,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newRetryPolicy(tc.opts)
+
+			assert.Equal(t, tc.expectedMaxAttempts, p.maxAttempts)
+			assert.Equal(t, tc.expectedStatusCodes, p.statusCodes)
+			assert.Equal(t, tc.expectedMaxRetryAfter, p.maxRetryAfter)
+		})
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	newRequest := func(method string, body []byte, rewindable bool, header map[string]string) *http.Request {
+		var req *http.Request
+		if body == nil {
+			req, _ = http.NewRequest(method, "http://users-service:8080/v1/users", nil)
+		} else if rewindable {
+			req, _ = http.NewRequest(method, "http://users-service:8080/v1/users", bytes.NewReader(body))
+		} else {
+			req, _ = http.NewRequest(method, "http://users-service:8080/v1/users", ioutil.NopCloser(bytes.NewReader(body)))
+		}
+
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+
+		return req
+	}
+
+	tests := []struct {
+		name              string
+		nonIdempotent     bool
+		req               *http.Request
+		expectedRetryable bool
+	}{
+		{"GET", false, newRequest("GET", nil, false, nil), true},
+		{"PUT", false, newRequest("PUT", []byte(`{}`), true, nil), true},
+		{"POST", false, newRequest("POST", []byte(`{}`), true, nil), false},
+		{"POSTWithIdempotencyKey", false, newRequest("POST", []byte(`{}`), true, map[string]string{"Idempotency-Key": "1234"}), true},
+		{"POSTNonIdempotent", true, newRequest("POST", []byte(`{}`), true, nil), true},
+		{"NotRewindableBody", true, newRequest("PUT", []byte(`{}`), false, nil), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newRetryPolicy(RetryOptions{RetryNonIdempotent: tc.nonIdempotent})
+			assert.Equal(t, tc.expectedRetryable, p.retryable(tc.req))
+		})
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		res           *http.Response
+		err           error
+		expectedRetry bool
+	}{
+		{"TransportError", nil, errors.New("connection refused"), true},
+		{"CircuitBreakerOpen", nil, fmt.Errorf("request failed: %w", resilience.ErrOpen), false},
+		{"200", &http.Response{StatusCode: 200}, nil, false},
+		{"500", &http.Response{StatusCode: 500}, nil, false},
+		{"503", &http.Response{StatusCode: 503}, nil, true},
+	}
+
+	p := newRetryPolicy(RetryOptions{})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRetry, p.shouldRetry(tc.res, tc.err))
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		res         *http.Response
+		expectedMin time.Duration
+		expectedMax time.Duration
+		expectedOK  bool
+	}{
+		{
+			name:        "NoResponse",
+			res:         nil,
+			expectedMin: 5 * time.Millisecond,
+			expectedMax: 10 * time.Millisecond,
+			expectedOK:  true,
+		},
+		{
+			name:        "RetryAfterSeconds",
+			res:         &http.Response{Header: http.Header{"Retry-After": []string{"2"}}},
+			expectedMin: 2 * time.Second,
+			expectedMax: 2 * time.Second,
+			expectedOK:  true,
+		},
+		{
+			name:        "RetryAfterDate",
+			res:         &http.Response{Header: http.Header{"Retry-After": []string{time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)}}},
+			expectedMin: 3 * time.Second,
+			expectedMax: 5 * time.Second,
+			expectedOK:  true,
+		},
+		{
+			name:        "RetryAfterPastDate",
+			res:         &http.Response{Header: http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:28:00 GMT"}}},
+			expectedMin: 5 * time.Millisecond,
+			expectedMax: 10 * time.Millisecond,
+			expectedOK:  true,
+		},
+		{
+			name:        "InvalidRetryAfter",
+			res:         &http.Response{Header: http.Header{"Retry-After": []string{"soon"}}},
+			expectedMin: 5 * time.Millisecond,
+			expectedMax: 10 * time.Millisecond,
+			expectedOK:  true,
+		},
+		{
+			name:       "RetryAfterTooLong",
+			res:        &http.Response{Header: http.Header{"Retry-After": []string{"86400"}}},
+			expectedOK: false,
+		},
+		{
+			name:       "RetryAfterDateTooLong",
+			res:        &http.Response{Header: http.Header{"Retry-After": []string{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}},
+			expectedOK: false,
+		},
+	}
+
+	p := newRetryPolicy(RetryOptions{
+		Backoff:       resilience.Backoff{Initial: 10 * time.Millisecond},
+		MaxRetryAfter: 10 * time.Second,
+	})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, ok := p.delay(1, tc.res)
+
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.True(t, d >= tc.expectedMin && d <= tc.expectedMax, "unexpected delay: %s", d)
+		})
+	}
+}
+
+func TestNewResilienceMetrics(t *testing.T) {
+	mf := metrics.NewFactory(metrics.FactoryOptions{Registerer: prometheus.NewRegistry()})
+	m := newResilienceMetrics(mf)
+
+	assert.NotNil(t, m.attempts)
+	assert.NotNil(t, m.timeouts)
+	assert.NotNil(t, m.breakerState)
+	assert.NotNil(t, m.breakerRejections)
+}
+
+func TestCancelBody(t *testing.T) {
+	var cancelled bool
+	b := &cancelBody{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader([]byte("hello"))),
+		cancel:     func() { cancelled = true },
+	}
+
+	data, err := ioutil.ReadAll(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.False(t, cancelled)
+
+	assert.NoError(t, b.Close())
+	assert.True(t, cancelled)
+}